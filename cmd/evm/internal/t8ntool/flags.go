@@ -85,6 +85,22 @@ var (
 			"The '.rlp' format is identical to the output.body format.",
 		Value: "txs.json",
 	}
+	InputBlockFlag = cli.StringFlag{
+		Name:  "input.block",
+		Usage: "File name of where to find the block to verify, as a hex encoded RLP string.",
+		Value: "block.rlp",
+	}
+	InputParentFlag = cli.StringFlag{
+		Name:  "input.parent",
+		Usage: "File name of where to find the JSON encoded parent header of the block to verify.",
+		Value: "parent.json",
+	}
+	InputWitnessFlag = cli.StringFlag{
+		Name: "input.witness",
+		Usage: "File name of where to find the state witness (as returned by debug_executionWitness) " +
+			"to verify the block with. If not set, the prestate alloc is used instead.",
+		Value: "",
+	}
 	RewardFlag = cli.Int64Flag{
 		Name:  "state.reward",
 		Usage: "Mining reward. Set to -1 to disable",
@@ -45,6 +45,7 @@ const (
 	ErrorEVM              = 2
 	ErrorVMConfig         = 3
 	ErrorMissingBlockhash = 4
+	ErrorVerification     = 5
 
 	ErrorJson = 10
 	ErrorIO   = 11
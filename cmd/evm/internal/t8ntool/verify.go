@@ -0,0 +1,173 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// verifyResult is the outcome of a successful block verification.
+type verifyResult struct {
+	Hash        common.Hash         `json:"hash"`
+	Number      math.HexOrDecimal64 `json:"number"`
+	StateRoot   common.Hash         `json:"stateRoot"`
+	ReceiptRoot common.Hash         `json:"receiptsRoot"`
+	Bloom       types.Bloom         `json:"logsBloom"`
+	GasUsed     math.HexOrDecimal64 `json:"gasUsed"`
+	Receipts    []*types.Receipt    `json:"receipts"`
+}
+
+// Verify re-executes a block on top of its parent header without any database,
+// using either a state witness or the full prestate alloc, and verifies the
+// resulting state root, receipts root, bloom and gas used against the block.
+func Verify(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Load the block and its parent header
+	var blob hexutil.Bytes
+	if err := readJSONFile(ctx.String(InputBlockFlag.Name), &blob); err != nil {
+		return err
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(blob, block); err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed decoding block: %v", err))
+	}
+	parent := new(types.Header)
+	if err := readJSONFile(ctx.String(InputParentFlag.Name), parent); err != nil {
+		return err
+	}
+	// Construct the chainconfig
+	chainConfig, extraEips, err := tests.GetChainConfig(ctx.String(ForknameFlag.Name))
+	if err != nil {
+		return NewError(ErrorVMConfig, fmt.Errorf("failed constructing chain configuration: %v", err))
+	}
+	chainConfig.ChainID = big.NewInt(ctx.Int64(ChainIDFlag.Name))
+	vmConfig := vm.Config{ExtraEips: extraEips}
+
+	// Assemble the parent state, either from the witness or from the prestate
+	var (
+		db        state.Database
+		ancestors map[common.Hash]*types.Header
+	)
+	if ctx.IsSet(InputWitnessFlag.Name) {
+		witness := new(state.Witness)
+		if err := readJSONFile(ctx.String(InputWitnessFlag.Name), witness); err != nil {
+			return err
+		}
+		db, ancestors = witness.StateDatabase(), witness.Headers
+	} else {
+		var alloc core.GenesisAlloc
+		if err := readJSONFile(ctx.String(InputAllocFlag.Name), &alloc); err != nil {
+			return err
+		}
+		statedb := MakePreState(rawdb.NewMemoryDatabase(), alloc)
+		if root := statedb.IntermediateRoot(false); root != parent.Root {
+			return NewError(ErrorVerification, fmt.Errorf("prestate root mismatch: have %x, want %x", root, parent.Root))
+		}
+		db = statedb.Database()
+	}
+	engine := &verifyEngine{Engine: ethash.NewFaker(), reward: ctx.Int64(RewardFlag.Name)}
+	receipts, err := core.VerifyBlockState(chainConfig, engine, block, parent, db, ancestors, vmConfig)
+	if err != nil {
+		return NewError(ErrorVerification, fmt.Errorf("block %d [%x] verification failed: %v", block.NumberU64(), block.Hash(), err))
+	}
+	log.Info("Verified block", "number", block.NumberU64(), "hash", block.Hash(), "txs", len(block.Transactions()))
+
+	result := &verifyResult{
+		Hash:        block.Hash(),
+		Number:      math.HexOrDecimal64(block.NumberU64()),
+		StateRoot:   block.Root(),
+		ReceiptRoot: block.ReceiptHash(),
+		Bloom:       block.Bloom(),
+		GasUsed:     math.HexOrDecimal64(block.GasUsed()),
+		Receipts:    receipts,
+	}
+	out, err := json.MarshalIndent(result, "", " ")
+	if err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+	}
+	os.Stdout.Write(out)
+	os.Stdout.Write([]byte("\n"))
+	return nil
+}
+
+// verifyEngine is the consensus engine of verified blocks. Instead of the ethash
+// block rewards, it credits the mining reward given by --state.reward the same
+// way t8n does, or no reward at all if it is negative.
+type verifyEngine struct {
+	consensus.Engine
+	reward int64
+}
+
+// Finalize implements consensus.Engine, accumulating the mining reward and
+// setting the final state root on the header.
+func (e *verifyEngine) Finalize(chain consensus.ChainHeaderReader, header *types.Header, statedb *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	if e.reward >= 0 {
+		var (
+			blockReward = big.NewInt(e.reward)
+			minerReward = new(big.Int).Set(blockReward)
+			perOmmer    = new(big.Int).Div(blockReward, big.NewInt(32))
+		)
+		for _, uncle := range uncles {
+			// Add 1/32th for each ommer included
+			minerReward.Add(minerReward, perOmmer)
+			// Add (8-delta)/8
+			reward := new(big.Int).Add(uncle.Number, big.NewInt(8))
+			reward.Sub(reward, header.Number)
+			reward.Mul(reward, blockReward)
+			reward.Div(reward, big.NewInt(8))
+			statedb.AddBalance(uncle.Coinbase, reward)
+		}
+		statedb.AddBalance(header.Coinbase, minerReward)
+	}
+	header.Root = statedb.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+}
+
+// readJSONFile decodes the JSON content of the given file into val.
+func readJSONFile(path string, val interface{}) error {
+	inFile, err := os.Open(path)
+	if err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed reading %s: %v", path, err))
+	}
+	defer inFile.Close()
+
+	if err := json.NewDecoder(inFile).Decode(val); err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed unmarshaling %s: %v", path, err))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		witness string
+		reward  string
+		wantErr string
+	}{
+		// Valid witness, with the ethash reward of the block
+		{witness: "witness.json", reward: "2000000000000000000"},
+		// Valid witness, without the reward credited when the block was mined
+		{witness: "witness.json", reward: "-1", wantErr: "invalid merkle root"},
+		// Witness missing the state accessed by the block
+		{witness: "witness_invalid.json", reward: "2000000000000000000", wantErr: "missing trie node"},
+	}
+	for i, test := range tests {
+		set := flag.NewFlagSet("verify", flag.ContinueOnError)
+		for _, f := range []cli.Flag{InputBlockFlag, InputParentFlag, InputWitnessFlag, InputAllocFlag, ForknameFlag, ChainIDFlag, RewardFlag, VerbosityFlag} {
+			f.Apply(set)
+		}
+		err := set.Parse([]string{
+			"--input.block", "../../testdata/14/block.json",
+			"--input.parent", "../../testdata/14/parent.json",
+			"--input.witness", "../../testdata/14/" + test.witness,
+			"--state.fork", "Berlin",
+			"--state.reward", test.reward,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Verify(cli.NewContext(nil, set, nil))
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("test %d: verification failed: %v", i, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("test %d: wrong error %v, want %q", i, err, test.wantErr)
+		}
+	}
+}
@@ -155,6 +155,22 @@ var stateTransitionCommand = cli.Command{
 	},
 }
 
+var blockVerifyCommand = cli.Command{
+	Name:   "verify",
+	Usage:  "verifies a block statelessly against a state witness or prestate",
+	Action: t8ntool.Verify,
+	Flags: []cli.Flag{
+		t8ntool.InputBlockFlag,
+		t8ntool.InputParentFlag,
+		t8ntool.InputWitnessFlag,
+		t8ntool.InputAllocFlag,
+		t8ntool.ForknameFlag,
+		t8ntool.ChainIDFlag,
+		t8ntool.RewardFlag,
+		t8ntool.VerbosityFlag,
+	},
+}
+
 func init() {
 	app.Flags = []cli.Flag{
 		BenchFlag,
@@ -187,6 +203,7 @@ func init() {
 		runCommand,
 		stateTestCommand,
 		stateTransitionCommand,
+		blockVerifyCommand,
 	}
 	cli.CommandHelpTemplate = flags.OriginCommandHelpTemplate
 }
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -62,6 +63,7 @@ Remove blockchain and state databases`,
 			dbPutCmd,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
+			dbVerifyFreezerCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -187,6 +189,28 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	dbVerifyFreezerCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerVerify),
+		Name:      "freezer-verify",
+		Usage:     "Verify the checksums of all items in the freezer",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: `This command scans every table of the freezer and reports the ranges of
+items failing checksum validation. Corrupted headers and bodies are recorded in
+the database, and will be refetched from the network the next time geth starts.
+Other tables cannot be repaired and require a resync of the affected range.
+
+Note, tables created before checksums were introduced can only be partially
+verified by decompressing their content.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -499,3 +523,70 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+// freezerVerify scans all the freezer tables for corrupted items and flags the
+// repairable ones for refetching from the network.
+func freezerVerify(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := ctx.GlobalString(utils.AncientFlag.Name)
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(path):
+		path = stack.ResolvePath(path)
+	}
+	var kinds []string
+	for kind := range rawdb.FreezerNoSnappy {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var (
+		corrupt = new(rawdb.CorruptAncients)
+		failed  bool
+	)
+	for _, kind := range kinds {
+		log.Info("Verifying freezer table", "location", path, "name", kind)
+		table, err := rawdb.NewFreezerTable(path, kind, rawdb.FreezerNoSnappy[kind])
+		if err != nil {
+			return err
+		}
+		ranges, err := table.Verify()
+		items, version := table.Items(), table.Version()
+		table.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Table %-8s version %d, %d items: ", kind, version, items)
+		if len(ranges) == 0 {
+			fmt.Println("ok")
+			continue
+		}
+		failed = true
+		fmt.Println("CORRUPT")
+		for _, r := range ranges {
+			fmt.Printf("  items %d - %d (%d)\n", r.From, r.To, r.To-r.From+1)
+		}
+		switch kind {
+		case "headers":
+			corrupt.Headers = ranges
+		case "bodies":
+			corrupt.Bodies = ranges
+		default:
+			fmt.Printf("  table cannot be repaired from the network, resync the affected range\n")
+		}
+	}
+	if !failed {
+		return nil
+	}
+	if len(corrupt.Headers) > 0 || len(corrupt.Bodies) > 0 {
+		db := utils.MakeChainDatabase(ctx, stack, false)
+		defer db.Close()
+
+		rawdb.WriteCorruptAncients(db, corrupt)
+		log.Info("Scheduled corrupted headers and bodies for repair", "headers", len(corrupt.Headers), "bodies", len(corrupt.Bodies))
+	}
+	return errors.New("freezer corruption detected")
+}
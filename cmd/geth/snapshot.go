@@ -44,6 +44,10 @@ var (
 	emptyCode = crypto.Keccak256(nil)
 )
 
+// snapshotExportChunkItems is the maximum number of accounts, storage slots or
+// codes stored in a single chunk of a snapshot export.
+const snapshotExportChunkItems = 4096
+
 var (
 	snapshotCommand = cli.Command{
 		Name:        "snapshot",
@@ -169,6 +173,47 @@ as the backend data source, making this command a lot faster.
 
 The argument is interpreted as block number or hash. If none is provided, the latest
 block is used.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the state at a given root into a portable snapshot file",
+				ArgsUsage: "<file> [<root>]",
+				Action:    utils.MigrateFlags(exportSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot export <file> [<root>]
+will serialize the flat state of the given root into a versioned, chunked and
+compressed file. Every chunk carries the Merkle proofs of its content, so that
+it can be verified against the state root on import. The default export target
+is the HEAD state.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import the state from a portable snapshot file",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot import <file>
+will import the state from a file created by 'geth snapshot export', verifying
+every chunk against the exported state root. The state trie and the snapshot
+are regenerated in the local database, which allows seeding nodes offline.
 `,
 			},
 		},
@@ -527,3 +572,73 @@ func dumpState(ctx *cli.Context) error {
 		"elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
+
+// exportSnapshot serializes the state at the given root into a portable file.
+func exportSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		log.Error("Invalid number of arguments given")
+		return errors.New("invalid arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, true)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	var root = headBlock.Root()
+	if ctx.NArg() == 2 {
+		root, err = parseRoot(ctx.Args()[1])
+		if err != nil {
+			log.Error("Failed to resolve state root", "err", err)
+			return err
+		}
+	}
+	out, err := os.Create(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := snapshot.Export(out, snaptree, root, snapshotExportChunkItems); err != nil {
+		log.Error("Failed to export state", "root", root, "err", err)
+		return err
+	}
+	return out.Sync()
+}
+
+// importSnapshot imports the state from a portable snapshot file.
+func importSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Invalid number of arguments given")
+		return errors.New("invalid arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chaindb.Close()
+
+	in, err := os.Open(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	root, err := snapshot.Import(in, chaindb)
+	if err != nil {
+		log.Error("Failed to import state", "err", err)
+		return err
+	}
+	log.Info("Imported the state", "root", root)
+	return nil
+}
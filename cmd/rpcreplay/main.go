@@ -0,0 +1,257 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// rpcreplay replays the calls recorded in RPC audit logs against a node, and
+// reports the calls whose results differ from the recorded ones.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	methodsFlag = flag.String("methods", "", "comma separated methods to replay, all read-only ones if empty (e.g. eth_call,eth_getBalance)")
+	errorsFlag  = flag.Bool("errors", false, "replay the calls that failed when recorded as well")
+	writesFlag  = flag.Bool("writes", false, "replay the methods not known to be read-only as well, which may change the state of the node")
+	timeoutFlag = flag.Duration("timeout", 30*time.Second, "timeout of each call")
+)
+
+// readOnlyMethods are the methods replayed by default, which don't change the
+// state of the node. Others, like eth_sendRawTransaction or the personal, admin
+// and miner methods, are only replayed with -writes.
+var readOnlyMethods = map[string]bool{
+	"eth_blockNumber":                         true,
+	"eth_call":                                true,
+	"eth_chainId":                             true,
+	"eth_createAccessList":                    true,
+	"eth_estimateGas":                         true,
+	"eth_feeHistory":                          true,
+	"eth_gasPrice":                            true,
+	"eth_getBalance":                          true,
+	"eth_getBlockByHash":                      true,
+	"eth_getBlockByNumber":                    true,
+	"eth_getBlockTransactionCountByHash":      true,
+	"eth_getBlockTransactionCountByNumber":    true,
+	"eth_getCode":                             true,
+	"eth_getHeaderByHash":                     true,
+	"eth_getHeaderByNumber":                   true,
+	"eth_getLogs":                             true,
+	"eth_getLogsPage":                         true,
+	"eth_getProof":                            true,
+	"eth_getStorageAt":                        true,
+	"eth_getTransactionByBlockHashAndIndex":   true,
+	"eth_getTransactionByBlockNumberAndIndex": true,
+	"eth_getTransactionByHash":                true,
+	"eth_getTransactionCount":                 true,
+	"eth_getTransactionReceipt":               true,
+	"eth_getUncleByBlockHashAndIndex":         true,
+	"eth_getUncleByBlockNumberAndIndex":       true,
+	"eth_getUncleCountByBlockHash":            true,
+	"eth_getUncleCountByBlockNumber":          true,
+	"eth_maxPriorityFeePerGas":                true,
+	"eth_syncing":                             true,
+	"debug_traceBlockByHash":                  true,
+	"debug_traceBlockByNumber":                true,
+	"debug_traceCall":                         true,
+	"debug_traceTransaction":                  true,
+	"net_version":                             true,
+	"web3_clientVersion":                      true,
+	"web3_sha3":                               true,
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[-methods <list>] [-errors] [-writes] [-timeout <duration>] <url> <auditlog>...")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, `
+Replays the calls recorded in the given RPC audit logs (see --rpc.auditlog)
+against the node at the given URL, and prints the calls whose results differ
+from the recorded ones. Subscriptions are not replayed, and only read-only
+methods are replayed unless -writes is given.`)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	client, err := rpc.Dial(flag.Arg(0))
+	if err != nil {
+		die(err)
+	}
+	defer client.Close()
+
+	r := &replayer{
+		client:  client,
+		out:     os.Stdout,
+		errors:  *errorsFlag,
+		writes:  *writesFlag,
+		timeout: *timeoutFlag,
+	}
+	if *methodsFlag != "" {
+		r.methods = make(map[string]bool)
+		for _, method := range strings.Split(*methodsFlag, ",") {
+			r.methods[strings.TrimSpace(method)] = true
+		}
+	}
+	for _, path := range flag.Args()[1:] {
+		if err := r.replayFile(path); err != nil {
+			die(err)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "Replayed %d calls, %d differ, %d skipped\n", r.replayed, r.differ, r.skipped)
+	if r.differ > 0 {
+		os.Exit(1)
+	}
+}
+
+func die(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
+}
+
+// replayer replays recorded calls, printing the differences of their results.
+type replayer struct {
+	client  *rpc.Client
+	out     io.Writer
+	methods map[string]bool // Methods replayed, all if nil
+	errors  bool            // Whether failed calls are replayed
+	writes  bool            // Whether methods not known to be read-only are replayed
+	timeout time.Duration
+
+	replayed, differ, skipped int
+}
+
+// replayFile replays the calls recorded in an audit log.
+func (r *replayer) replayFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec rpc.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: invalid record: %v", path, line, err)
+		}
+		if !r.replayable(&rec) {
+			r.skipped++
+			continue
+		}
+		if diff := r.replay(&rec); diff != "" {
+			r.differ++
+			fmt.Fprintf(r.out, "%s:%d: %s(%s) at %v\n%s\n", path, line, rec.Method, rec.Params, rec.Time, diff)
+		}
+		r.replayed++
+	}
+	return scanner.Err()
+}
+
+// replayable reports whether a recorded call should be replayed.
+func (r *replayer) replayable(rec *rpc.AuditRecord) bool {
+	if strings.HasSuffix(rec.Method, "_subscribe") || strings.HasSuffix(rec.Method, "_unsubscribe") {
+		return false
+	}
+	if r.methods != nil && !r.methods[rec.Method] {
+		return false
+	}
+	if !r.writes && !readOnlyMethods[rec.Method] {
+		return false
+	}
+	return r.errors || rec.Error == nil
+}
+
+// replay calls the recorded method, returning the difference of the results, or
+// the empty string if they are the same.
+func (r *replayer) replay(rec *rpc.AuditRecord) string {
+	var params []json.RawMessage
+	if len(rec.Params) > 0 {
+		if err := json.Unmarshal(rec.Params, &params); err != nil {
+			return fmt.Sprintf("  invalid params: %v", err)
+		}
+	}
+	args := make([]interface{}, len(params))
+	for i, param := range params {
+		args[i] = param
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var result json.RawMessage
+	err := r.client.CallContext(ctx, &result, rec.Method, args...)
+
+	recorded, replayed := formatOutcome(rec.Result, rec.Error), formatOutcome(result, auditError(err))
+	if recorded == replayed {
+		return ""
+	}
+	return fmt.Sprintf("  recorded: %s\n  replayed: %s", recorded, replayed)
+}
+
+// auditError converts the error of a call into the form it is recorded in.
+func auditError(err error) *rpc.AuditError {
+	if err == nil {
+		return nil
+	}
+	aerr := &rpc.AuditError{Code: -1, Message: err.Error()}
+	if rerr, ok := err.(rpc.Error); ok {
+		aerr.Code = rerr.ErrorCode()
+	}
+	if derr, ok := err.(rpc.DataError); ok && derr.ErrorData() != nil {
+		aerr.Data, _ = json.Marshal(derr.ErrorData())
+	}
+	return aerr
+}
+
+// formatOutcome formats the result or error of a call in a canonical form, so
+// that equal JSON values are formatted equally.
+func formatOutcome(result json.RawMessage, err *rpc.AuditError) string {
+	if err != nil {
+		return fmt.Sprintf("error %d %q %s", err.Code, err.Message, canonicalJSON(err.Data))
+	}
+	return canonicalJSON(result)
+}
+
+// canonicalJSON re-encodes a JSON value with sorted object keys and no spacing.
+// Numbers are kept as they are, without loss of precision.
+func canonicalJSON(data json.RawMessage) string {
+	if len(data) == 0 {
+		return "null"
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return string(data)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testService is served by the recorded and the replayed nodes. The upgraded
+// node returns different balances.
+type testService struct {
+	upgraded bool
+}
+
+func (s *testService) Balance(account string) map[string]interface{} {
+	balance := 100
+	if s.upgraded && account == "bob" {
+		balance = 200
+	}
+	return map[string]interface{}{"account": account, "balance": balance}
+}
+
+func (s *testService) Fail() error {
+	return errors.New("failed")
+}
+
+func newTestNode(t *testing.T, upgraded bool, audit rpc.AuditLog) *rpc.Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("test", &testService{upgraded}); err != nil {
+		t.Fatal(err)
+	}
+	if audit != nil {
+		server.SetAuditLog(audit)
+	}
+	t.Cleanup(server.Stop)
+	return rpc.DialInProc(server)
+}
+
+func TestReplay(t *testing.T) {
+	// Record some calls
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := rpc.OpenAuditFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := newTestNode(t, false, audit)
+	for _, account := range []string{"alice", "bob"} {
+		if err := recorded.Call(nil, "test_balance", account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded.Call(nil, "test_fail")
+	recorded.Close()
+	audit.Close()
+
+	// The test methods are not known to be read-only, nothing is replayed by default
+	var out bytes.Buffer
+	r := &replayer{client: newTestNode(t, true, nil), out: &out, timeout: time.Second}
+	if err := r.replayFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if r.replayed != 0 || r.skipped != 3 {
+		t.Fatalf("wrong counts without writes: %d replayed, %d skipped", r.replayed, r.skipped)
+	}
+
+	// Replay them against the upgraded node
+	r = &replayer{client: newTestNode(t, true, nil), out: &out, writes: true, timeout: time.Second}
+	if err := r.replayFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if r.replayed != 2 || r.differ != 1 || r.skipped != 1 {
+		t.Fatalf("wrong counts: %d replayed, %d differ, %d skipped", r.replayed, r.differ, r.skipped)
+	}
+	for _, want := range []string{
+		`audit.log:2: test_balance(["bob"])`,
+		`recorded: {"account":"bob","balance":100}`,
+		`replayed: {"account":"bob","balance":200}`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output misses %q:\n%s", want, out.String())
+		}
+	}
+
+	// Failed calls are the same when replayed
+	r = &replayer{client: newTestNode(t, true, nil), out: &out, errors: true, writes: true, methods: map[string]bool{"test_fail": true}, timeout: time.Second}
+	if err := r.replayFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if r.replayed != 1 || r.differ != 0 {
+		t.Fatalf("wrong counts for failed calls: %d replayed, %d differ", r.replayed, r.differ)
+	}
+}
+
+func TestReplayableMethods(t *testing.T) {
+	r := new(replayer)
+	for method, want := range map[string]bool{
+		"eth_call":               true,
+		"eth_getBalance":         true,
+		"eth_subscribe":          false,
+		"eth_sendRawTransaction": false,
+		"personal_sign":          false,
+		"admin_addPeer":          false,
+		"miner_start":            false,
+	} {
+		if have := r.replayable(&rpc.AuditRecord{Method: method}); have != want {
+			t.Errorf("%s: replayable mismatch: have %v, want %v", method, have, want)
+		}
+	}
+	r.writes = true
+	if !r.replayable(&rpc.AuditRecord{Method: "eth_sendRawTransaction"}) {
+		t.Errorf("eth_sendRawTransaction not replayable with writes")
+	}
+}
@@ -222,6 +222,10 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	LogIndexFlag = cli.BoolFlag{
+		Name:  "logindex",
+		Usage: "Maintains an exact index of log addresses and topics for fast log queries",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -334,9 +338,14 @@ var (
 		Usage: "Disk journal for local transaction to survive node restarts",
 		Value: core.DefaultTxPoolConfig.Journal,
 	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of remote transactions to survive node restarts (disabled if empty)",
+		Value: core.DefaultTxPoolConfig.Snapshot,
+	}
 	TxPoolRejournalFlag = cli.DurationFlag{
 		Name:  "txpool.rejournal",
-		Usage: "Time interval to regenerate the local transaction journal",
+		Usage: "Time interval to regenerate the local transaction journal and remote snapshot",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
@@ -374,6 +383,31 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: ethconfig.Defaults.TxPool.Lifetime,
 	}
+	TxPoolPrivateLifetimeFlag = cli.Uint64Flag{
+		Name:  "txpool.privatelifetime",
+		Usage: "Default number of blocks after which unincluded private transactions are dropped",
+		Value: ethconfig.Defaults.TxPool.PrivateLifetime,
+	}
+	TxPoolContractSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.contractslots",
+		Usage: "Maximum number of pooled transactions calling the same contract (0 = unlimited)",
+		Value: ethconfig.Defaults.TxPool.ContractSlots,
+	}
+	TxPoolSelectorSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.selectorslots",
+		Usage: "Maximum number of pooled transactions calling the same contract method (0 = unlimited)",
+		Value: ethconfig.Defaults.TxPool.SelectorSlots,
+	}
+	TxPoolSenderRateFlag = cli.Float64Flag{
+		Name:  "txpool.senderrate",
+		Usage: "Number of transactions per second admitted from a single sender not in --txpool.locals (0 = unlimited)",
+		Value: ethconfig.Defaults.TxPool.SenderRate,
+	}
+	TxPoolSenderBurstFlag = cli.Uint64Flag{
+		Name:  "txpool.senderburst",
+		Usage: "Number of transactions admitted from a single sender at once",
+		Value: ethconfig.Defaults.TxPool.SenderBurst,
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -464,6 +498,11 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerOrderingFlag = cli.StringFlag{
+		Name:  "miner.ordering",
+		Usage: `Block building strategy ordering the transactions ("price", "fifo", "roundrobin" or "bundle")`,
+		Value: miner.OrderingPrice,
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -498,6 +537,16 @@ var (
 		Usage: "Sets a cap on transaction fee (in ether) that can be sent via the RPC APIs (0 = no cap)",
 		Value: ethconfig.Defaults.RPCTxFeeCap,
 	}
+	RPCFinalizedDepthFlag = cli.Uint64Flag{
+		Name:  "rpc.finalizeddepth",
+		Usage: "Number of confirmations after which a block is reported as finalized via the RPC APIs (0 = consensus only)",
+		Value: ethconfig.Defaults.RPCFinalizedDepth,
+	}
+	RPCSafeDepthFlag = cli.Uint64Flag{
+		Name:  "rpc.safedepth",
+		Usage: "Number of confirmations after which a block is reported as safe via the RPC APIs (0 = finalized block)",
+		Value: ethconfig.Defaults.RPCSafeDepth,
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -554,6 +603,29 @@ var (
 		Usage: "HTTP path path prefix on which JSON-RPC is served. Use '/' to serve on all paths.",
 		Value: "",
 	}
+	HTTPGRPCFlag = cli.BoolFlag{
+		Name:  "http.grpc",
+		Usage: "Serve the HTTP-RPC API's over gRPC (HTTP/2) on the HTTP-RPC port",
+	}
+	RPCAuditLogFlag = cli.StringFlag{
+		Name:  "rpc.auditlog",
+		Usage: "File recording the calls served over HTTP-RPC and WS-RPC, with passwords and keys redacted (rotated, JSON lines)",
+	}
+	AuthListenFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Listening address for authenticated APIs",
+		Value: node.DefaultConfig.AuthAddr,
+	}
+	AuthPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Listening port for authenticated APIs",
+		Value: node.DefaultConfig.AuthPort,
+	}
+	JWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to a JWT secret to use for authenticated RPC endpoints",
+		Value: "",
+	}
 	GraphQLEnabledFlag = cli.BoolFlag{
 		Name:  "graphql",
 		Usage: "Enable GraphQL on the HTTP-RPC server. Note that GraphQL can only be started if an HTTP server is started as well.",
@@ -773,7 +845,7 @@ var (
 
 	CatalystFlag = cli.BoolFlag{
 		Name:  "catalyst",
-		Usage: "Catalyst mode (eth2 integration testing)",
+		Usage: "Catalyst mode (eth2 integration testing), serving the engine API on the authenticated RPC endpoint",
 	}
 )
 
@@ -970,6 +1042,21 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(HTTPPathPrefixFlag.Name) {
 		cfg.HTTPPathPrefix = ctx.GlobalString(HTTPPathPrefixFlag.Name)
 	}
+	if ctx.GlobalIsSet(HTTPGRPCFlag.Name) {
+		cfg.HTTPGRPC = ctx.GlobalBool(HTTPGRPCFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCAuditLogFlag.Name) {
+		cfg.RPCAuditLog = ctx.GlobalString(RPCAuditLogFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthListenFlag.Name) {
+		cfg.AuthAddr = ctx.GlobalString(AuthListenFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(JWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(JWTSecretFlag.Name)
+	}
 	if ctx.GlobalIsSet(AllowUnprotectedTxs.Name) {
 		cfg.AllowUnprotectedTxs = ctx.GlobalBool(AllowUnprotectedTxs.Name)
 	}
@@ -1328,6 +1415,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolJournalFlag.Name) {
 		cfg.Journal = ctx.GlobalString(TxPoolJournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
@@ -1352,6 +1442,21 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPrivateLifetimeFlag.Name) {
+		cfg.PrivateLifetime = ctx.GlobalUint64(TxPoolPrivateLifetimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolContractSlotsFlag.Name) {
+		cfg.ContractSlots = ctx.GlobalUint64(TxPoolContractSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSelectorSlotsFlag.Name) {
+		cfg.SelectorSlots = ctx.GlobalUint64(TxPoolSelectorSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSenderRateFlag.Name) {
+		cfg.SenderRate = ctx.GlobalFloat64(TxPoolSenderRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSenderBurstFlag.Name) {
+		cfg.SenderBurst = ctx.GlobalUint64(TxPoolSenderBurstFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1401,6 +1506,12 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerOrderingFlag.Name) {
+		cfg.Ordering = ctx.GlobalString(MinerOrderingFlag.Name)
+		if !miner.IsOrdering(cfg.Ordering) {
+			Fatalf("Unknown miner ordering %q, available: %v", cfg.Ordering, miner.Orderings())
+		}
+	}
 	if ctx.GlobalIsSet(LegacyMinerGasTargetFlag.Name) {
 		log.Warn("The generic --miner.gastarget flag is deprecated and will be removed in the future!")
 	}
@@ -1547,6 +1658,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(LogIndexFlag.Name) {
+		cfg.LogIndex = ctx.GlobalBool(LogIndexFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1590,6 +1704,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(RPCGlobalTxFeeCapFlag.Name) {
 		cfg.RPCTxFeeCap = ctx.GlobalFloat64(RPCGlobalTxFeeCapFlag.Name)
 	}
+	if ctx.GlobalIsSet(RPCFinalizedDepthFlag.Name) {
+		cfg.RPCFinalizedDepth = ctx.GlobalUint64(RPCFinalizedDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSafeDepthFlag.Name) {
+		cfg.RPCSafeDepth = ctx.GlobalUint64(RPCSafeDepthFlag.Name)
+	}
 	if ctx.GlobalIsSet(NoDiscoverFlag.Name) {
 		cfg.EthDiscoveryURLs, cfg.SnapDiscoveryURLs = []string{}, []string{}
 	} else if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
@@ -1731,8 +1851,8 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 }
 
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
-func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
-	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
+func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, lightMode bool, cfg node.Config) {
+	if err := graphql.New(stack, backend, lightMode, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
 		Fatalf("Failed to register the GraphQL service: %v", err)
 	}
 }
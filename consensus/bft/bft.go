@@ -0,0 +1,709 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bft implements a byzantine fault tolerant proof-of-authority consensus
+// engine with instant finality.
+//
+// A fixed set of validators agrees on every block in rounds of three phases
+// (pre-prepare, prepare and commit). A block is only ever added to the chain
+// together with the commit signatures of a two-thirds quorum of validators, so
+// it can never be reverted: the chain tolerates up to f faulty validators out
+// of n = 3f+1.
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	inmemorySnapshots  = 128  // Number of recent validator snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus message hashes to remember for deduplication
+)
+
+// BFT protocol constants.
+var (
+	epochLength    = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
+	requestTimeout = uint64(10000) // Default milliseconds to wait for a round to complete
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	defaultDifficulty = big.NewInt(1) // Block difficulty, forks are impossible so it carries no weight
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is something else that the two
+	// allowed constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errInvalidMixDigest is returned if a block's mix digest is not the BFT one.
+	errInvalidMixDigest = errors.New("invalid bft mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errMismatchingValidators is returned if a block lists a validator set other
+	// than the one the local node calculated.
+	errMismatchingValidators = errors.New("mismatching validator set")
+
+	// errUnauthorizedProposer is returned if a header is sealed by a non-validator.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+
+	// errInvalidCommittedSeals is returned if a block isn't committed by a quorum
+	// of distinct validators.
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	// errUnauthorizedValidator is returned if the local node is asked to seal a
+	// block without being part of the validator set.
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+
+	// errNotStarted is returned if a block is sealed before the consensus protocol
+	// is running.
+	errNotStarted = errors.New("consensus protocol not started")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// ChainBackend is the chain access needed to run the consensus protocol: reading
+// headers, executing proposals, and importing and following the committed blocks.
+type ChainBackend interface {
+	consensus.ChainHeaderReader
+
+	// CurrentBlock retrieves the head block of the local chain.
+	CurrentBlock() *types.Block
+
+	// Validator and Processor are used to execute and validate proposals on top of
+	// the state of their parent before agreeing on them.
+	Validator() core.Validator
+	Processor() core.Processor
+	StateAt(root common.Hash) (*state.StateDB, error)
+	GetVMConfig() *vm.Config
+
+	// InsertChain imports committed blocks into the local chain.
+	InsertChain(chain types.Blocks) (int, error)
+
+	// SubscribeChainHeadEvent subscribes to head changes of the local chain.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// sealHash returns the hash of a block prior to it being sealed by the proposer,
+// which is the header without any seals.
+func sealHash(header *types.Header) common.Hash {
+	filtered := types.BFTFilteredHeader(header, false)
+	if filtered == nil {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(rlpBytes(filtered))
+}
+
+// proposalHash returns the hash validators agree on and commit to, which is the
+// header with the proposer seal but without the committed seals. It's the block
+// hash of the header as well.
+func proposalHash(header *types.Header) common.Hash {
+	filtered := types.BFTFilteredHeader(header, true)
+	if filtered == nil {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(rlpBytes(filtered))
+}
+
+// committedSealData returns the data a validator signs when committing to the
+// proposal with the given hash.
+func committedSealData(hash common.Hash) []byte {
+	return append(hash.Bytes(), byte(msgCommit))
+}
+
+// rlpBytes returns the RLP encoding of x.
+func rlpBytes(x interface{}) []byte {
+	blob, _ := rlp.EncodeToBytes(x)
+	return blob
+}
+
+// recoverAddress returns the address which signed the keccak256 hash of the data.
+func recoverAddress(data []byte, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// ecrecover extracts the address of the proposer from a signed header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	extra, err := types.ExtractBFTExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	pubkey, err := crypto.SigToPub(sealHash(header).Bytes(), extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	proposer := crypto.PubkeyToAddress(*pubkey)
+
+	sigcache.Add(hash, proposer)
+	return proposer, nil
+}
+
+// BFT is the byzantine fault tolerant proof-of-authority consensus engine.
+type BFT struct {
+	config *params.BFTConfig // Consensus engine configuration parameters
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up proposer recovery
+	messages   *lru.ARCCache // Hashes of recently seen consensus messages
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer and proposals fields
+
+	peers *peerSet      // Peers running the consensus protocol
+	core  *stateMachine // Agreement protocol, nil until started
+	mu    sync.Mutex    // Protects the core field
+}
+
+// New creates a BFT consensus engine with the validator set specified by the
+// genesis block's extra-data.
+func New(config *params.BFTConfig, db ethdb.Database) *BFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = requestTimeout
+	}
+	// Allocate the caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	messages, _ := lru.NewARC(inmemoryMessages)
+
+	return &BFT{
+		config:     &conf,
+		recents:    recents,
+		signatures: signatures,
+		messages:   messages,
+		proposals:  make(map[common.Address]bool),
+		peers:      newPeerSet(),
+	}
+}
+
+// Start launches the agreement protocol on top of the given chain. From then on
+// the engine takes part in committing blocks if authorized as a validator, and
+// imports the blocks committed by the network.
+func (b *BFT) Start(chain ChainBackend) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.core != nil {
+		return errors.New("consensus protocol already started")
+	}
+	b.core = newStateMachine(b, chain)
+	b.core.start()
+	return nil
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the proposer seal in the header's extra-data section.
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, b.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (b *BFT) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil, true)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (b *BFT) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i], true)
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database. Proposals still being agreed upon are
+// verified with committed unset, skipping the check for a quorum of commits.
+func (b *BFT) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	// Ensure that the extra-data contains the BFT fields
+	if _, err := types.ExtractBFTExtra(header); err != nil {
+		return types.ErrInvalidBFTHeaderExtra
+	}
+	// Checkpoint blocks need to enforce zero beneficiary
+	checkpoint := (number % b.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	// Nonces must be 0x00..0 or 0xff..f, zeroes enforced on checkpoints
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the mix digest marks the header as BFT sealed
+	if header.MixDigest != types.BFTDigest {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in PoA
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Blocks are final, so the difficulty is fixed
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	// Verify that the gas limit is <= 2^63-1
+	cap := uint64(0x7fffffffffffffff)
+	if header.GasLimit > cap {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, cap)
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return b.verifyCascadingFields(chain, header, parents, committed)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers.
+func (b *BFT) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, committed bool) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+b.config.BlockPeriod > header.Time {
+		return errInvalidTimestamp
+	}
+	// Verify that the gasUsed is <= gasLimit
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	if !chain.Config().IsLondon(header.Number) {
+		// Verify BaseFee not present before EIP-1559 fork.
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		if err := misc.VerifyGaslimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		// Verify the header's EIP-1559 attributes.
+		return err
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// Every header lists the validator set it was agreed upon by
+	extra, err := types.ExtractBFTExtra(header)
+	if err != nil {
+		return err
+	}
+	validators := snap.validators()
+	if len(extra.Validators) != len(validators) {
+		return errMismatchingValidators
+	}
+	for i, validator := range validators {
+		if extra.Validators[i] != validator {
+			return errMismatchingValidators
+		}
+	}
+	// All basic checks passed, verify the seals and return
+	return b.verifySeals(header, extra, snap, committed)
+}
+
+// verifySeals checks that the header was proposed by a validator and, unless
+// it's a proposal still being agreed upon, committed by a quorum of validators.
+func (b *BFT) verifySeals(header *types.Header, extra *types.BFTExtra, snap *Snapshot, committed bool) error {
+	proposer, err := ecrecover(header, b.signatures)
+	if err != nil {
+		return err
+	}
+	if !snap.has(proposer) {
+		return errUnauthorizedProposer
+	}
+	if !committed {
+		return nil
+	}
+	var (
+		data = committedSealData(proposalHash(header))
+		seen = make(map[common.Address]struct{})
+	)
+	for _, seal := range extra.CommittedSeals {
+		validator, err := recoverAddress(data, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, dup := seen[validator]; dup || !snap.has(validator) {
+			return errInvalidCommittedSeals
+		}
+		seen[validator] = struct{}{}
+	}
+	if len(seen) < snap.quorum() {
+		return errInvalidCommittedSeals
+	}
+	return nil
+}
+
+// snapshot retrieves the validator set and voting state at a given point in
+// time. Snapshots are reconstructed from the closest checkpoint, each of which
+// lists the full validator set without any pending votes.
+func (b *BFT) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := b.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		// Checkpoints (the genesis included) start over from the listed set
+		if number%b.config.Epoch == 0 {
+			extra, err := types.ExtractBFTExtra(header)
+			if err != nil {
+				return nil, err
+			}
+			snap = newSnapshot(b.config, b.signatures, number, hash, extra.Validators)
+			break
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	b.recents.Add(snap.Hash, snap)
+	return snap, nil
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (b *BFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (b *BFT) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	// If the block isn't a checkpoint, cast a random vote (good enough for now)
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	// Assemble the voting snapshot to check which votes make sense
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch != 0 {
+		b.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(b.proposals))
+		for address, authorize := range b.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if b.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		b.lock.RUnlock()
+	}
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+	header.MixDigest = types.BFTDigest
+
+	// Ensure the extra data lists the current validator set and room for seals
+	extra, err := types.EncodeBFTExtra(header.Extra, &types.BFTExtra{
+		Validators:     snap.validators(),
+		Seal:           []byte{},
+		CommittedSeals: [][]byte{},
+	})
+	if err != nil {
+		return err
+	}
+	header.Extra = extra
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + b.config.BlockPeriod
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
+// rewards given.
+func (b *BFT) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	// No block rewards in PoA, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+}
+
+// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
+// nor block rewards given, and returns the final block.
+func (b *BFT) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// Finalize block
+	b.Finalize(chain, header, state, txs, uncles)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
+}
+
+// Authorize injects a private key into the consensus engine to propose and
+// commit blocks with.
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+// Seal implements consensus.Engine, signing the block as its proposer and handing
+// it to the agreement protocol. The block is delivered on the results channel
+// once committed by a quorum of validators, which only happens if the local node
+// is the proposer of the round.
+func (b *BFT) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	b.mu.Lock()
+	core := b.core
+	b.mu.Unlock()
+	if core == nil {
+		return errNotStarted
+	}
+	// Don't hold the signer fields for the entire sealing procedure
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	// Bail out if we're unauthorized to propose a block
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if !snap.has(signer) {
+		return errUnauthorizedValidator
+	}
+	// Sign the proposal, the committed seals are only known after agreement
+	extra, err := types.ExtractBFTExtra(header)
+	if err != nil {
+		return err
+	}
+	sighash := sealHash(header)
+	if extra.Seal, err = signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, rlpBytes(types.BFTFilteredHeader(header, false))); err != nil {
+		return err
+	}
+	if header.Extra, err = types.EncodeBFTExtra(header.Extra, extra); err != nil {
+		return err
+	}
+	// Wait for the block period to pass before proposing it
+	delay := time.Unix(int64(header.Time), 0).Sub(time.Now()) // nolint: gosimple
+	log.Trace("Waiting for slot to propose", "sealhash", sighash, "delay", common.PrettyDuration(delay))
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		core.request(&sealRequest{block: block.WithSeal(header), results: results, stop: stop})
+	}()
+	return nil
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. Committed blocks can't
+// be forked, so the difficulty is always 1.
+func (b *BFT) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (b *BFT) SealHash(header *types.Header) common.Hash {
+	return sealHash(header)
+}
+
+// FinalizedHeader implements consensus.FinalityEngine. Every block is imported
+// only after being committed by a quorum of validators, so the whole local chain
+// is final.
+func (b *BFT) FinalizedHeader(chain consensus.ChainHeaderReader) *types.Header {
+	return chain.CurrentHeader()
+}
+
+// Close implements consensus.Engine, terminating the agreement protocol.
+func (b *BFT) Close() error {
+	b.mu.Lock()
+	core := b.core
+	b.core = nil
+	b.mu.Unlock()
+
+	if core != nil {
+		core.stop()
+	}
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to query
+// the validator set and vote on changing it.
+func (b *BFT) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bft: b},
+		Public:    false,
+	}}
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testKeys generates n validator keys.
+func testKeys(n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	return keys
+}
+
+// testGenesis creates a genesis block with the given validators.
+func testGenesis(config *params.BFTConfig, keys []*ecdsa.PrivateKey) *core.Genesis {
+	chainConfig := *params.AllCliqueProtocolChanges
+	chainConfig.Clique = nil
+	chainConfig.BFT = config
+
+	validators := make([]common.Address, len(keys))
+	for i, key := range keys {
+		validators[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	extra, _ := types.EncodeBFTExtra(nil, &types.BFTExtra{Validators: validators, Seal: []byte{}, CommittedSeals: [][]byte{}})
+
+	return &core.Genesis{
+		Config:     &chainConfig,
+		ExtraData:  extra,
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Mixhash:    types.BFTDigest,
+		BaseFee:    big.NewInt(params.InitialBaseFee),
+		Alloc:      core.GenesisAlloc{},
+	}
+}
+
+// newTestChain creates a blockchain running the BFT engine on top of the genesis.
+func newTestChain(t *testing.T, genesis *core.Genesis) (*BFT, *core.BlockChain) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return engine, chain
+}
+
+// newTestBlock assembles an empty block on top of the chain head, casting the
+// given vote, without any seals.
+func newTestBlock(t *testing.T, engine *BFT, chain *core.BlockChain, coinbase common.Address, authorize bool) *types.Block {
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		BaseFee:    misc.CalcBaseFee(chain.Config(), parent.Header()),
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	header.Coinbase = coinbase
+	if authorize {
+		copy(header.Nonce[:], nonceAuthVote)
+	} else {
+		copy(header.Nonce[:], nonceDropVote)
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		t.Fatalf("failed to retrieve parent state: %v", err)
+	}
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	return block
+}
+
+// sealTestBlock signs the block by the proposer, and attaches the committed
+// seals of the committers.
+func sealTestBlock(t *testing.T, block *types.Block, proposer *ecdsa.PrivateKey, committers ...*ecdsa.PrivateKey) *types.Block {
+	header := block.Header()
+	extra, err := types.ExtractBFTExtra(header)
+	if err != nil {
+		t.Fatalf("failed to decode extra-data: %v", err)
+	}
+	if extra.Seal, err = crypto.Sign(sealHash(header).Bytes(), proposer); err != nil {
+		t.Fatalf("failed to sign proposal: %v", err)
+	}
+	header.Extra, _ = types.EncodeBFTExtra(header.Extra, extra)
+
+	for _, committer := range committers {
+		seal, err := crypto.Sign(crypto.Keccak256(committedSealData(proposalHash(header))), committer)
+		if err != nil {
+			t.Fatalf("failed to sign commit: %v", err)
+		}
+		extra.CommittedSeals = append(extra.CommittedSeals, seal)
+	}
+	header.Extra, _ = types.EncodeBFTExtra(header.Extra, extra)
+	return block.WithSeal(header)
+}
+
+// Tests that the proposal hash, which is the block hash too, ignores the committed
+// seals, but not the proposer seal.
+func TestProposalHash(t *testing.T) {
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: big.NewInt(1),
+		MixDigest:  types.BFTDigest,
+	}
+	setExtra := func(seal []byte, committed [][]byte) {
+		extra, err := types.EncodeBFTExtra(nil, &types.BFTExtra{
+			Validators:     []common.Address{{0x01}, {0x02}},
+			Seal:           seal,
+			CommittedSeals: committed,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		header.Extra = extra
+	}
+	setExtra([]byte{0x01}, nil)
+	hash, blockHash := proposalHash(header), header.Hash()
+
+	setExtra([]byte{0x01}, [][]byte{{0x02}, {0x03}})
+	if have := proposalHash(header); have != hash {
+		t.Errorf("committed seals changed the proposal hash: have %x, want %x", have, hash)
+	}
+	if have := header.Hash(); have != blockHash || have != hash {
+		t.Errorf("committed seals changed the block hash: have %x, want %x", have, blockHash)
+	}
+	setExtra([]byte{0x02}, nil)
+	if have := proposalHash(header); have == hash {
+		t.Errorf("proposer seal didn't change the proposal hash")
+	}
+}
+
+// Tests that blocks are only imported if committed by a quorum of validators.
+func TestCommittedSeals(t *testing.T) {
+	keys := testKeys(4)
+	outsider, _ := crypto.GenerateKey()
+
+	_, chain := newTestChain(t, testGenesis(&params.BFTConfig{Epoch: 30000}, keys))
+	defer chain.Stop()
+
+	engine := chain.Engine().(*BFT)
+	block := newTestBlock(t, engine, chain, common.Address{}, false)
+
+	tests := []struct {
+		proposer   *ecdsa.PrivateKey
+		committers []*ecdsa.PrivateKey
+		err        error
+	}{
+		{keys[0], nil, errInvalidCommittedSeals},
+		{keys[0], keys[:2], errInvalidCommittedSeals},
+		{keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], keys[1]}, errInvalidCommittedSeals},
+		{keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], outsider}, errInvalidCommittedSeals},
+		{outsider, keys[:3], errUnauthorizedProposer},
+		{keys[0], keys[1:], nil},
+	}
+	for i, tt := range tests {
+		sealed := sealTestBlock(t, block, tt.proposer, tt.committers...)
+		if proposalHash(sealed.Header()) != proposalHash(sealTestBlock(t, block, tt.proposer).Header()) {
+			t.Fatalf("test %d: committed seals changed the proposal hash", i)
+		}
+		if err := engine.VerifyHeader(chain, sealed.Header(), true); err != tt.err {
+			t.Errorf("test %d: verification error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Blocks committed by different quorums must have the same hash
+	committed := sealTestBlock(t, block, keys[0], keys[1:]...)
+	if other := sealTestBlock(t, block, keys[0], keys[:3]...); other.Hash() != committed.Hash() {
+		t.Fatalf("committed seals changed the block hash: %x != %x", other.Hash(), committed.Hash())
+	}
+	if _, err := chain.InsertChain(types.Blocks{committed}); err != nil {
+		t.Fatalf("failed to import committed block: %v", err)
+	}
+	if head := engine.FinalizedHeader(chain); head.Hash() != committed.Hash() {
+		t.Errorf("finalized header mismatch: have %x, want %x", head.Hash(), committed.Hash())
+	}
+}
+
+// Tests that validators are added by a majority of votes, and that blocks need
+// to list the resulting validator set.
+func TestValidatorVoting(t *testing.T) {
+	keys := testKeys(5)
+
+	_, chain := newTestChain(t, testGenesis(&params.BFTConfig{Epoch: 30000}, keys[:4]))
+	defer chain.Stop()
+
+	engine := chain.Engine().(*BFT)
+	candidate := crypto.PubkeyToAddress(keys[4].PublicKey)
+
+	// Three out of four validators need to vote the candidate in
+	for i := 0; i < 3; i++ {
+		block := newTestBlock(t, engine, chain, candidate, true)
+		if _, err := chain.InsertChain(types.Blocks{sealTestBlock(t, block, keys[i], keys[:3]...)}); err != nil {
+			t.Fatalf("block %d: failed to import: %v", i, err)
+		}
+	}
+	snap, err := engine.snapshot(chain, chain.CurrentHeader().Number.Uint64(), chain.CurrentHeader().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if !snap.has(candidate) || len(snap.Validators) != 5 {
+		t.Fatalf("candidate not voted in: %v", snap.validators())
+	}
+	// With five validators, four committed seals are needed
+	block := newTestBlock(t, engine, chain, common.Address{}, false)
+	if _, err := chain.InsertChain(types.Blocks{sealTestBlock(t, block, keys[4], keys[2:]...)}); err != errInvalidCommittedSeals {
+		t.Fatalf("import error mismatch: have %v, want %v", err, errInvalidCommittedSeals)
+	}
+	// Blocks listing the stale validator set are rejected
+	header := block.Header()
+	extra, _ := types.ExtractBFTExtra(header)
+	extra.Validators = extra.Validators[:0]
+	for _, key := range keys[:4] {
+		extra.Validators = append(extra.Validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	header.Extra, _ = types.EncodeBFTExtra(header.Extra, extra)
+	stale := sealTestBlock(t, block.WithSeal(header), keys[4], keys[1:]...)
+	if err := engine.VerifyHeader(chain, stale.Header(), true); err != errMismatchingValidators {
+		t.Fatalf("verification error mismatch: have %v, want %v", err, errMismatchingValidators)
+	}
+	if _, err := chain.InsertChain(types.Blocks{sealTestBlock(t, block, keys[4], keys[1:]...)}); err != nil {
+		t.Fatalf("failed to import block committed by the new set: %v", err)
+	}
+}
+
+// Tests that only the messages of validators about the heights processed by the
+// agreement protocol are relayed and queued.
+func TestMessageRelay(t *testing.T) {
+	keys := testKeys(4)
+	outsider, _ := crypto.GenerateKey()
+
+	engine, chain := newTestChain(t, testGenesis(&params.BFTConfig{Epoch: 30000}, keys))
+	defer chain.Stop()
+
+	sm := newStateMachine(engine, chain)
+	sm.startHeight(chain.CurrentBlock().Header())
+	engine.core = sm
+
+	remote := &peer{id: "remote", queue: make(chan []byte, 16)}
+	engine.peers.register(remote)
+
+	encode := func(key *ecdsa.PrivateKey, height uint64) []byte {
+		msg := &message{Code: msgPrepare, Payload: rlpBytes(&subject{View: view{Height: height}})}
+		msg.Signature, _ = crypto.Sign(crypto.Keccak256(msg.signingData()), key)
+		return rlpBytes(msg)
+	}
+	tests := []struct {
+		key     *ecdsa.PrivateKey
+		height  uint64
+		relayed bool
+	}{
+		{keys[0], 1, true},
+		{keys[1], 1 + maxFutureHeights, true},
+		{keys[1], 2 + maxFutureHeights, false},
+		{keys[2], 0, false},
+		{outsider, 1, false},
+		{outsider, 2, false},
+	}
+	for i, tt := range tests {
+		if err := engine.handleMessage(encode(tt.key, tt.height), "origin"); err != nil {
+			t.Fatalf("test %d: failed to handle message: %v", i, err)
+		}
+		select {
+		case <-remote.queue:
+			if !tt.relayed {
+				t.Errorf("test %d: message relayed", i)
+			}
+		default:
+			if tt.relayed {
+				t.Errorf("test %d: message not relayed", i)
+			}
+		}
+	}
+	// Only the future message of the validator is queued, not the one of the outsider
+	for len(sm.messages) > 0 {
+		sm.handleMessage(<-sm.messages)
+	}
+	msg, _ := decodeMessage(encode(outsider, 2))
+	sm.handleMessage(msg)
+	if len(sm.backlog) != 1 {
+		t.Errorf("backlog size mismatch: have %d, want %d", len(sm.backlog), 1)
+	}
+}
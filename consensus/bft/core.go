@@ -0,0 +1,692 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	maxFutureHeights = 16   // Number of heights ahead of the local chain to queue messages for
+	maxBacklog       = 4096 // Maximum number of queued messages for future heights and rounds
+	maxTimeoutShift  = 6    // Maximum doubling of the round timeout in consecutive round changes
+)
+
+// sealRequest is a block handed over by the miner, to be proposed when the local
+// validator's turn comes.
+type sealRequest struct {
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+// preparedBlock is a block which a quorum of validators prepared in some round,
+// along with the prepare messages proving it.
+type preparedBlock struct {
+	round uint64
+	block *types.Block
+	cert  [][]byte
+}
+
+// stateMachine runs the agreement protocol for consecutive heights of the chain.
+// All the agreement state is owned by a single goroutine, which is fed with the
+// consensus messages, the blocks to propose, chain head changes and timeouts.
+//
+// Every round of a height has a designated proposer, which broadcasts a block
+// in a pre-prepare message. Validators accepting it broadcast a prepare, and on
+// seeing a quorum of prepares lock on the block and broadcast a commit carrying
+// their seal on it. With a quorum of commits, the proposer attaches the seals to
+// the block and broadcasts it, finalizing the height. If a round doesn't complete
+// in time, validators request a round change, carrying the block they are locked
+// on so it is proposed again in the next round.
+type stateMachine struct {
+	engine *BFT
+	chain  ChainBackend
+
+	requests chan *sealRequest
+	messages chan *message
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	current atomic.Value // Validator set of the current height, read when relaying messages
+
+	// Agreement state, only accessed by the loop goroutine
+	parent *types.Header // Head of the local chain, being built on
+	snap   *Snapshot     // Validator set of the current height
+	height uint64        // Number of the block being agreed on
+	round  uint64        // Current round of the height
+	target uint64        // Highest round a round change was requested for
+
+	pending   *sealRequest                                 // Latest local block to propose
+	proposal  *types.Block                                 // Block proposed in the current round
+	prepares  map[common.Address]*message                  // Prepare messages of the current round
+	sentSeal  bool                                         // Whether the current round's commit was sent
+	proposals map[common.Hash]*types.Block                 // Valid proposals of any round of the height
+	commits   map[common.Hash]map[common.Address][]byte    // Committed seals of any round, by block
+	changes   map[uint64]map[common.Address]*roundChange   // Round change requests, by target round
+	prepared  map[uint64]map[common.Address]*preparedBlock // Prepared blocks carried by round changes
+	locked    *preparedBlock                               // Block the local validator is locked on
+	committed bool                                         // Whether the height was decided
+
+	backlog []*message  // Messages of future heights and rounds
+	timer   *time.Timer // Round timeout
+}
+
+// newStateMachine creates the agreement protocol for the given chain.
+func newStateMachine(engine *BFT, chain ChainBackend) *stateMachine {
+	timer := time.NewTimer(0)
+	<-timer.C
+
+	return &stateMachine{
+		engine:   engine,
+		chain:    chain,
+		requests: make(chan *sealRequest, 1),
+		messages: make(chan *message, 256),
+		quit:     make(chan struct{}),
+		timer:    timer,
+	}
+}
+
+// start launches the agreement loop.
+func (sm *stateMachine) start() {
+	sm.wg.Add(1)
+	go sm.loop()
+}
+
+// stop terminates the agreement loop and waits for it to exit, along with the
+// imports of committed blocks it started.
+func (sm *stateMachine) stop() {
+	close(sm.quit)
+	sm.wg.Wait()
+}
+
+// request hands a block to propose over to the agreement loop.
+func (sm *stateMachine) request(req *sealRequest) {
+	select {
+	case sm.requests <- req:
+	case <-sm.quit:
+	}
+}
+
+// post hands a consensus message over to the agreement loop, dropping it if the
+// loop is lagging behind.
+func (sm *stateMachine) post(msg *message) {
+	select {
+	case sm.messages <- msg:
+	default:
+		log.Debug("Dropping consensus message, queue full", "code", msg.Code, "sender", msg.sender)
+	}
+}
+
+// loop is the agreement goroutine.
+func (sm *stateMachine) loop() {
+	defer sm.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := sm.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+	defer sm.timer.Stop()
+
+	sm.startHeight(sm.chain.CurrentBlock().Header())
+	for {
+		select {
+		case ev := <-heads:
+			if ev.Block.NumberU64() >= sm.height {
+				sm.startHeight(ev.Block.Header())
+			}
+		case req := <-sm.requests:
+			sm.pending = req
+			if sm.snap != nil && !sm.committed && sm.snap.proposer(sm.round) == sm.self() {
+				sm.propose()
+			}
+		case msg := <-sm.messages:
+			sm.handleMessage(msg)
+		case <-sm.timer.C:
+			sm.handleTimeout()
+		case <-sub.Err():
+			return
+		case <-sm.quit:
+			return
+		}
+	}
+}
+
+// self returns the address of the local validator, or the zero address if the
+// node isn't authorized to sign.
+func (sm *stateMachine) self() common.Address {
+	sm.engine.lock.RLock()
+	defer sm.engine.lock.RUnlock()
+
+	if sm.engine.signFn == nil {
+		return common.Address{}
+	}
+	return sm.engine.signer
+}
+
+// isValidator returns whether the local node takes part in the current height.
+func (sm *stateMachine) isValidator() bool {
+	self := sm.self()
+	return self != (common.Address{}) && sm.snap.has(self)
+}
+
+// startHeight starts agreeing on the block following the given head.
+func (sm *stateMachine) startHeight(head *types.Header) {
+	snap, err := sm.engine.snapshot(sm.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		log.Warn("Failed to retrieve validator set", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	sm.parent, sm.snap = head, snap
+	sm.height = head.Number.Uint64() + 1
+	sm.current.Store(snap)
+
+	sm.proposals = make(map[common.Hash]*types.Block)
+	sm.commits = make(map[common.Hash]map[common.Address][]byte)
+	sm.changes = make(map[uint64]map[common.Address]*roundChange)
+	sm.prepared = make(map[uint64]map[common.Address]*preparedBlock)
+	sm.locked = nil
+	sm.committed = false
+
+	sm.startRound(0)
+}
+
+// startRound moves to the given round of the current height.
+func (sm *stateMachine) startRound(round uint64) {
+	if round > 0 {
+		log.Debug("Starting new consensus round", "height", sm.height, "round", round)
+	}
+	sm.round, sm.target = round, round
+	sm.proposal = nil
+	sm.prepares = make(map[common.Address]*message)
+	sm.sentSeal = false
+
+	sm.resetTimer()
+	if sm.snap.proposer(round) == sm.self() {
+		sm.propose()
+	}
+	sm.replayBacklog()
+}
+
+// resetTimer schedules the timeout of the round being entered, doubling with
+// every failed round.
+func (sm *stateMachine) resetTimer() {
+	shift := sm.target
+	if shift > maxTimeoutShift {
+		shift = maxTimeoutShift
+	}
+	if !sm.timer.Stop() {
+		select {
+		case <-sm.timer.C:
+		default:
+		}
+	}
+	sm.timer.Reset(time.Duration(sm.engine.config.RequestTimeout) * time.Millisecond << shift)
+}
+
+// view returns the current height and round.
+func (sm *stateMachine) view() view {
+	return view{Height: sm.height, Round: sm.round}
+}
+
+// propose broadcasts the block of the current round if the local validator is
+// its proposer. A block prepared in an earlier round takes precedence over the
+// pending local block, which would otherwise conflict with it.
+func (sm *stateMachine) propose() {
+	if sm.committed || sm.proposal != nil {
+		return
+	}
+	var block *types.Block
+	if prepared := sm.highestPrepared(sm.round); prepared != nil {
+		block = prepared.block
+	} else if sm.locked != nil {
+		block = sm.locked.block
+	} else if sm.pending != nil && sm.pending.block.NumberU64() == sm.height && sm.pending.block.ParentHash() == sm.parent.Hash() {
+		block = sm.pending.block
+	}
+	if block == nil {
+		return
+	}
+	log.Debug("Proposing block", "height", sm.height, "round", sm.round, "hash", block.Hash())
+	sm.broadcast(msgPreprepare, &preprepare{View: sm.view(), Block: block})
+}
+
+// highestPrepared returns the block prepared in the highest round among the
+// round change requests for the given round.
+func (sm *stateMachine) highestPrepared(round uint64) *preparedBlock {
+	var highest *preparedBlock
+	for _, prepared := range sm.prepared[round] {
+		if highest == nil || prepared.round > highest.round {
+			highest = prepared
+		}
+	}
+	return highest
+}
+
+// relayable reports whether a consensus message received from the network is
+// worth relaying to the other peers: it has to be signed by a validator of the
+// current height, and be about a height whose messages are processed or queued.
+// It's called from the peer goroutines.
+func (sm *stateMachine) relayable(msg *message) bool {
+	snap, _ := sm.current.Load().(*Snapshot)
+	if snap == nil || !snap.has(msg.sender) {
+		return false
+	}
+	v, _, err := msg.decodeView()
+	if err != nil {
+		return false
+	}
+	height := snap.Number + 1
+	return v.Height >= height && v.Height <= height+maxFutureHeights
+}
+
+// handleMessage processes a consensus message, queueing it if it belongs to a
+// future height or round. Only messages of the validators of the current height
+// are accepted, a changed validator set takes effect once its height is reached.
+func (sm *stateMachine) handleMessage(msg *message) {
+	if sm.snap == nil {
+		return
+	}
+	if !sm.snap.has(msg.sender) {
+		log.Debug("Consensus message from non-validator", "sender", msg.sender)
+		return
+	}
+	v, payload, err := msg.decodeView()
+	if err != nil {
+		log.Debug("Invalid consensus message", "sender", msg.sender, "err", err)
+		return
+	}
+	switch {
+	case v.Height < sm.height:
+		return
+	case v.Height > sm.height:
+		sm.store(msg, v)
+		return
+	case v.Round > sm.round && msg.Code != msgRoundChange:
+		sm.store(msg, v)
+		return
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		if v.Round == sm.round {
+			sm.handlePreprepare(msg, payload.(*preprepare))
+		}
+	case msgPrepare:
+		if v.Round == sm.round {
+			sm.handlePrepare(msg, payload.(*subject))
+		}
+	case msgCommit:
+		sm.handleCommit(msg, payload.(*commit))
+	case msgCommitted:
+		sm.handleCommitted(msg, payload.(*committed))
+	case msgRoundChange:
+		sm.handleRoundChange(msg, payload.(*roundChange))
+	}
+}
+
+// store queues a message of a future height or round.
+func (sm *stateMachine) store(msg *message, v view) {
+	if v.Height > sm.height+maxFutureHeights || len(sm.backlog) >= maxBacklog {
+		return
+	}
+	sm.backlog = append(sm.backlog, msg)
+}
+
+// replayBacklog processes the queued messages which became current, queueing
+// the rest again.
+func (sm *stateMachine) replayBacklog() {
+	backlog := sm.backlog
+	sm.backlog = nil
+
+	for _, msg := range backlog {
+		sm.handleMessage(msg)
+	}
+}
+
+// handlePreprepare validates the proposal of the current round and prepares it.
+func (sm *stateMachine) handlePreprepare(msg *message, pp *preprepare) {
+	if msg.sender != sm.snap.proposer(sm.round) || sm.proposal != nil || pp.Block == nil {
+		return
+	}
+	block := pp.Block
+	if block.NumberU64() != sm.height || block.ParentHash() != sm.parent.Hash() {
+		return
+	}
+	hash := proposalHash(block.Header())
+	if _, known := sm.proposals[hash]; !known {
+		if err := sm.verifyProposal(block); err != nil {
+			log.Warn("Invalid block proposal", "height", sm.height, "round", sm.round, "proposer", msg.sender, "hash", hash, "err", err)
+			return
+		}
+	}
+	// A validator locked on a block only accepts another one if it was prepared
+	// in a later round
+	if sm.locked != nil && proposalHash(sm.locked.block.Header()) != hash {
+		prepared := sm.highestPrepared(sm.round)
+		if prepared == nil || prepared.round <= sm.locked.round || proposalHash(prepared.block.Header()) != hash {
+			log.Debug("Rejecting proposal conflicting with lock", "height", sm.height, "round", sm.round, "hash", hash)
+			return
+		}
+	}
+	sm.proposal = block
+	sm.proposals[hash] = block
+
+	if sm.isValidator() {
+		sm.broadcast(msgPrepare, &subject{View: sm.view(), Digest: hash})
+	}
+	sm.checkPrepared()
+	sm.checkCommitted(hash)
+}
+
+// verifyProposal checks that a proposed block is valid on top of the local chain
+// by executing it, save for the commit seals it doesn't carry yet.
+func (sm *stateMachine) verifyProposal(block *types.Block) error {
+	if err := sm.engine.verifyHeader(sm.chain, block.Header(), nil, false); err != nil {
+		return err
+	}
+	if err := sm.chain.Validator().ValidateBody(block); err != nil {
+		return err
+	}
+	statedb, err := sm.chain.StateAt(sm.parent.Root)
+	if err != nil {
+		return err
+	}
+	receipts, _, usedGas, err := sm.chain.Processor().Process(block, statedb, *sm.chain.GetVMConfig())
+	if err != nil {
+		return err
+	}
+	return sm.chain.Validator().ValidateState(block, statedb, receipts, usedGas)
+}
+
+// handlePrepare records a prepare of the current round.
+func (sm *stateMachine) handlePrepare(msg *message, sub *subject) {
+	if _, ok := sm.prepares[msg.sender]; ok {
+		return
+	}
+	sm.prepares[msg.sender] = msg
+	sm.checkPrepared()
+}
+
+// checkPrepared locks on the proposal of the current round and commits to it
+// once a quorum of validators prepared it.
+func (sm *stateMachine) checkPrepared() {
+	if sm.proposal == nil || sm.sentSeal {
+		return
+	}
+	hash := proposalHash(sm.proposal.Header())
+
+	var cert [][]byte
+	for _, msg := range sm.prepares {
+		_, payload, _ := msg.decodeView()
+		if payload.(*subject).Digest == hash {
+			cert = append(cert, rlpBytes(msg))
+		}
+	}
+	if len(cert) < sm.snap.quorum() {
+		return
+	}
+	sm.locked = &preparedBlock{round: sm.round, block: sm.proposal, cert: cert}
+	sm.sentSeal = true
+
+	if !sm.isValidator() {
+		return
+	}
+	seal, err := sm.engine.sign(committedSealData(hash))
+	if err != nil {
+		log.Warn("Failed to sign committed seal", "err", err)
+		return
+	}
+	sm.broadcast(msgCommit, &commit{View: sm.view(), Digest: hash, Seal: seal})
+}
+
+// handleCommit records the committed seal of a validator, from any round of the
+// height as seals only depend on the block.
+func (sm *stateMachine) handleCommit(msg *message, c *commit) {
+	if signer, err := recoverAddress(committedSealData(c.Digest), c.Seal); err != nil || signer != msg.sender {
+		log.Debug("Invalid committed seal", "sender", msg.sender, "err", err)
+		return
+	}
+	seals := sm.commits[c.Digest]
+	if seals == nil {
+		seals = make(map[common.Address][]byte)
+		sm.commits[c.Digest] = seals
+	}
+	seals[msg.sender] = c.Seal
+	sm.checkCommitted(c.Digest)
+}
+
+// checkCommitted assembles the committed block once a quorum of validators
+// committed the proposal, if the local validator is the proposer of the round.
+// The other nodes import the block broadcast by the proposer. The block hash
+// doesn't cover the committed seals, so nodes importing the same block with
+// different seals, e.g. from other peers, still agree on its hash.
+func (sm *stateMachine) checkCommitted(hash common.Hash) {
+	if sm.committed || sm.snap.proposer(sm.round) != sm.self() {
+		return
+	}
+	block := sm.proposals[hash]
+	if block == nil || len(sm.commits[hash]) < sm.snap.quorum() {
+		return
+	}
+	// Attach the seals in validator order
+	validators := make([]common.Address, 0, len(sm.commits[hash]))
+	for validator := range sm.commits[hash] {
+		validators = append(validators, validator)
+	}
+	sort.Sort(validatorsAscending(validators))
+
+	header := block.Header()
+	extra, err := types.ExtractBFTExtra(header)
+	if err != nil {
+		log.Error("Invalid committed block", "hash", hash, "err", err)
+		return
+	}
+	extra.CommittedSeals = make([][]byte, len(validators))
+	for i, validator := range validators {
+		extra.CommittedSeals[i] = sm.commits[hash][validator]
+	}
+	if header.Extra, err = types.EncodeBFTExtra(header.Extra, extra); err != nil {
+		log.Error("Failed to encode committed seals", "hash", hash, "err", err)
+		return
+	}
+	sm.broadcast(msgCommitted, &committed{View: sm.view(), Block: block.WithSeal(header)})
+}
+
+// handleCommitted finalizes the height with the block assembled by the proposer
+// of the current round, once its committed seals are verified.
+func (sm *stateMachine) handleCommitted(msg *message, c *committed) {
+	if sm.committed || c.Block == nil || c.View.Round != sm.round || msg.sender != sm.snap.proposer(sm.round) {
+		return
+	}
+	block := c.Block
+	if block.NumberU64() != sm.height || block.ParentHash() != sm.parent.Hash() {
+		return
+	}
+	if err := sm.engine.verifyHeader(sm.chain, block.Header(), nil, true); err != nil {
+		log.Warn("Invalid committed block", "height", sm.height, "proposer", msg.sender, "hash", block.Hash(), "err", err)
+		return
+	}
+	sm.committed = true
+	sm.timer.Stop()
+
+	log.Info("Block committed", "number", sm.height, "round", c.View.Round, "hash", block.Hash())
+	sm.deliver(block)
+}
+
+// deliver hands a committed block to the miner if it's the one it requested to
+// seal, or imports it otherwise.
+func (sm *stateMachine) deliver(block *types.Block) {
+	if req := sm.pending; req != nil && sm.engine.SealHash(req.block.Header()) == sm.engine.SealHash(block.Header()) {
+		select {
+		case <-req.stop:
+		default:
+			select {
+			case req.results <- block:
+				return
+			default:
+			}
+		}
+	}
+	sm.wg.Add(1)
+	go func() {
+		defer sm.wg.Done()
+		if _, err := sm.chain.InsertChain(types.Blocks{block}); err != nil {
+			log.Error("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}()
+}
+
+// handleTimeout requests a round change when the current one failed to commit
+// a block in time.
+func (sm *stateMachine) handleTimeout() {
+	if sm.committed || sm.snap == nil || !sm.isValidator() {
+		return
+	}
+	sm.target++
+	log.Debug("Consensus round timed out", "height", sm.height, "round", sm.round, "target", sm.target)
+
+	sm.sendRoundChange(sm.target)
+	sm.resetTimer()
+}
+
+// sendRoundChange broadcasts a request to move to the given round, carrying the
+// block the local validator is locked on, if any.
+func (sm *stateMachine) sendRoundChange(round uint64) {
+	rc := &roundChange{View: view{Height: sm.height, Round: round}, PreparedBlock: []byte{}, PreparedCert: [][]byte{}}
+	if sm.locked != nil {
+		rc.PreparedRound = sm.locked.round
+		rc.PreparedBlock = rlpBytes(sm.locked.block)
+		rc.PreparedCert = sm.locked.cert
+	}
+	sm.broadcast(msgRoundChange, rc)
+}
+
+// handleRoundChange records a round change request, moving to the requested
+// round once a quorum of validators asked for it.
+func (sm *stateMachine) handleRoundChange(msg *message, rc *roundChange) {
+	round := rc.View.Round
+	if round <= sm.round || sm.committed {
+		return
+	}
+	var prepared *preparedBlock
+	if len(rc.PreparedBlock) > 0 {
+		var err error
+		if prepared, err = sm.verifyPrepared(rc); err != nil {
+			log.Debug("Invalid prepared block in round change", "sender", msg.sender, "err", err)
+			return
+		}
+	}
+	if sm.changes[round] == nil {
+		sm.changes[round] = make(map[common.Address]*roundChange)
+		sm.prepared[round] = make(map[common.Address]*preparedBlock)
+	}
+	sm.changes[round][msg.sender] = rc
+	if prepared != nil {
+		sm.prepared[round][msg.sender] = prepared
+	}
+	if len(sm.changes[round]) >= sm.snap.quorum() {
+		sm.startRound(round)
+		return
+	}
+	// If enough validators moved past our target that at least one of them is
+	// honest, join them rather than waiting for our own timeout
+	if weak := len(sm.snap.Validators) - sm.snap.quorum() + 1; round > sm.target && len(sm.changes[round]) >= weak && sm.isValidator() {
+		sm.target = round
+		sm.sendRoundChange(round)
+		sm.resetTimer()
+	}
+}
+
+// verifyPrepared checks the prepare certificate of the block carried by a round
+// change: a quorum of distinct validators must have prepared it in the claimed
+// round of the current height.
+func (sm *stateMachine) verifyPrepared(rc *roundChange) (*preparedBlock, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(rc.PreparedBlock, block); err != nil {
+		return nil, err
+	}
+	if block.NumberU64() != sm.height || block.ParentHash() != sm.parent.Hash() || rc.PreparedRound >= rc.View.Round {
+		return nil, errInvalidMessage
+	}
+	var (
+		hash    = proposalHash(block.Header())
+		signers = make(map[common.Address]struct{})
+	)
+	for _, blob := range rc.PreparedCert {
+		msg, err := decodeMessage(blob)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Code != msgPrepare || !sm.snap.has(msg.sender) {
+			return nil, errInvalidMessage
+		}
+		var sub subject
+		if err := rlp.DecodeBytes(msg.Payload, &sub); err != nil {
+			return nil, err
+		}
+		if sub.View.Height != sm.height || sub.View.Round != rc.PreparedRound || sub.Digest != hash {
+			return nil, errInvalidMessage
+		}
+		signers[msg.sender] = struct{}{}
+	}
+	if len(signers) < sm.snap.quorum() {
+		return nil, errInvalidMessage
+	}
+	if _, known := sm.proposals[hash]; !known {
+		if err := sm.verifyProposal(block); err != nil {
+			return nil, err
+		}
+		sm.proposals[hash] = block
+	}
+	return &preparedBlock{round: rc.PreparedRound, block: block, cert: rc.PreparedCert}, nil
+}
+
+// broadcast signs a consensus message, gossips it to the network and processes
+// it locally.
+func (sm *stateMachine) broadcast(code uint64, payload interface{}) {
+	msg := &message{Code: code, Payload: rlpBytes(payload)}
+	sig, err := sm.engine.sign(msg.signingData())
+	if err != nil {
+		log.Warn("Failed to sign consensus message", "code", code, "err", err)
+		return
+	}
+	msg.Signature, msg.sender = sig, sm.self()
+
+	sm.engine.gossip(rlpBytes(msg), "")
+	sm.handleMessage(msg)
+}
+
+// sign signs the keccak256 hash of the data with the local validator key.
+func (b *BFT) sign(data []byte) ([]byte, error) {
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	if signFn == nil {
+		return nil, errUnauthorizedValidator
+	}
+	return signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, data)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Codes of the messages exchanged by validators to agree on a block.
+const (
+	msgPreprepare  = 0x00 // Proposal of a block by the round's proposer
+	msgPrepare     = 0x01 // Acknowledgement of a valid proposal
+	msgCommit      = 0x02 // Commitment to a prepared proposal, carrying the committed seal
+	msgRoundChange = 0x03 // Request to move to a new round
+	msgCommitted   = 0x04 // Block assembled by the round's proposer with a quorum of committed seals
+)
+
+// errInvalidMessage is returned if a consensus message can't be decoded.
+var errInvalidMessage = errors.New("invalid consensus message")
+
+// message is the signed envelope of all consensus messages.
+type message struct {
+	Code      uint64
+	Payload   []byte
+	Signature []byte
+
+	sender common.Address // Validator which signed the message, cached on decoding
+}
+
+// signingData returns the data signed by the sender of the message.
+func (m *message) signingData() []byte {
+	return rlpBytes([]interface{}{m.Code, m.Payload})
+}
+
+// decodeMessage decodes a consensus message and recovers its sender.
+func decodeMessage(data []byte) (*message, error) {
+	msg := new(message)
+	if err := rlp.DecodeBytes(data, msg); err != nil {
+		return nil, err
+	}
+	sender, err := recoverAddress(msg.signingData(), msg.Signature)
+	if err != nil {
+		return nil, errInvalidMessage
+	}
+	msg.sender = sender
+	return msg, nil
+}
+
+// view identifies the height and round a consensus message is about.
+type view struct {
+	Height uint64
+	Round  uint64
+}
+
+// preprepare is the payload of msgPreprepare.
+type preprepare struct {
+	View  view
+	Block *types.Block
+}
+
+// subject is the payload of msgPrepare, referencing the proposal by hash.
+type subject struct {
+	View   view
+	Digest common.Hash
+}
+
+// commit is the payload of msgCommit.
+type commit struct {
+	View   view
+	Digest common.Hash
+	Seal   []byte // Signature over the proposal hash and the commit code
+}
+
+// committed is the payload of msgCommitted. Only the proposer of a round
+// assembles the committed block, so all nodes import the same set of seals.
+type committed struct {
+	View  view
+	Block *types.Block
+}
+
+// roundChange is the payload of msgRoundChange. A validator which already
+// prepared a block in an earlier round of the height carries it over together
+// with the quorum of prepare messages proving it, so it gets proposed again
+// instead of a conflicting one.
+type roundChange struct {
+	View          view
+	PreparedRound uint64
+	PreparedBlock []byte   // RLP encoded block, empty if nothing was prepared
+	PreparedCert  [][]byte // Encoded prepare messages of a quorum for the block
+}
+
+// decodeView decodes the payload of a message, returning the view it's about
+// along with the decoded payload.
+func (m *message) decodeView() (view, interface{}, error) {
+	switch m.Code {
+	case msgPreprepare:
+		var pp preprepare
+		if err := rlp.DecodeBytes(m.Payload, &pp); err != nil {
+			return view{}, nil, err
+		}
+		return pp.View, &pp, nil
+	case msgPrepare:
+		var sub subject
+		if err := rlp.DecodeBytes(m.Payload, &sub); err != nil {
+			return view{}, nil, err
+		}
+		return sub.View, &sub, nil
+	case msgCommit:
+		var c commit
+		if err := rlp.DecodeBytes(m.Payload, &c); err != nil {
+			return view{}, nil, err
+		}
+		return c.View, &c, nil
+	case msgCommitted:
+		var c committed
+		if err := rlp.DecodeBytes(m.Payload, &c); err != nil {
+			return view{}, nil, err
+		}
+		return c.View, &c, nil
+	case msgRoundChange:
+		var rc roundChange
+		if err := rlp.DecodeBytes(m.Payload, &rc); err != nil {
+			return view{}, nil, err
+		}
+		return rc.View, &rc, nil
+	default:
+		return view{}, nil, errInvalidMessage
+	}
+}
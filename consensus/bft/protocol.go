@@ -0,0 +1,188 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+const (
+	protocolName    = "bft" // Name of the consensus sub-protocol
+	protocolVersion = 1     // Version of the consensus sub-protocol
+	protocolLength  = 1     // Number of message codes used by the sub-protocol
+
+	consensusMsg   = 0x00             // Message code carrying an encoded consensus message
+	maxMessageSize = 10 * 1024 * 1024 // Maximum size of a consensus message, bound by the proposed block
+
+	maxQueuedMessages = 1024 // Maximum number of messages queued for sending to a peer
+)
+
+var errPeerAlreadyRegistered = errors.New("peer already registered")
+
+// peer is a remote node running the consensus sub-protocol.
+type peer struct {
+	id    string
+	rw    p2p.MsgReadWriter
+	queue chan []byte   // Messages waiting to be sent
+	term  chan struct{} // Termination channel to stop the sender
+}
+
+// sendLoop writes the queued messages to the peer.
+func (p *peer) sendLoop() {
+	for {
+		select {
+		case data := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, data); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// peerSet is the set of peers running the consensus sub-protocol.
+type peerSet struct {
+	peers map[string]*peer
+	lock  sync.RWMutex
+}
+
+// newPeerSet creates an empty peer set.
+func newPeerSet() *peerSet {
+	return &peerSet{peers: make(map[string]*peer)}
+}
+
+// register adds a peer to the set.
+func (ps *peerSet) register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, ok := ps.peers[p.id]; ok {
+		return errPeerAlreadyRegistered
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+// unregister removes a peer from the set.
+func (ps *peerSet) unregister(id string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.peers, id)
+}
+
+// Protocols returns the p2p sub-protocol used by validators to exchange
+// consensus messages. Non-validators run it too, relaying the messages.
+func (b *BFT) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    protocolName,
+		Version: protocolVersion,
+		Length:  protocolLength,
+		Run:     b.runPeer,
+	}}
+}
+
+// runPeer handles a remote node for the lifetime of its connection.
+func (b *BFT) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	remote := &peer{
+		id:    p.ID().String(),
+		rw:    rw,
+		queue: make(chan []byte, maxQueuedMessages),
+		term:  make(chan struct{}),
+	}
+	if err := b.peers.register(remote); err != nil {
+		return err
+	}
+	defer b.peers.unregister(remote.id)
+
+	go remote.sendLoop()
+	defer close(remote.term)
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Code != consensusMsg {
+			msg.Discard()
+			return errInvalidMessage
+		}
+		if msg.Size > maxMessageSize {
+			msg.Discard()
+			return errInvalidMessage
+		}
+		var data []byte
+		if err := msg.Decode(&data); err != nil {
+			return err
+		}
+		if err := b.handleMessage(data, remote.id); err != nil {
+			p.Log().Debug("Invalid consensus message", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage processes a consensus message received from the network,
+// relaying it to the other peers if it wasn't seen before. Messages not signed
+// by a validator of the current height, or about heights outside of the window
+// processed by the agreement protocol, are dropped without being relayed.
+func (b *BFT) handleMessage(data []byte, origin string) error {
+	hash := crypto.Keccak256Hash(data)
+	if b.messages.Contains(hash) {
+		return nil
+	}
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	core := b.core
+	b.mu.Unlock()
+
+	if core == nil || !core.relayable(msg) {
+		b.messages.Add(hash, struct{}{})
+		return nil
+	}
+	b.gossip(data, origin)
+	core.post(msg)
+	return nil
+}
+
+// gossip sends a consensus message to all peers but its origin.
+func (b *BFT) gossip(data []byte, origin string) {
+	b.messages.Add(crypto.Keccak256Hash(data), struct{}{})
+
+	b.peers.lock.RLock()
+	defer b.peers.lock.RUnlock()
+
+	for id, p := range b.peers.peers {
+		if id == origin {
+			continue
+		}
+		select {
+		case p.queue <- data:
+		default:
+			log.Debug("Dropping consensus message, peer queue full", "peer", id)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// simValidator is a node lifecycle running a validator on an in-memory chain,
+// attempting to seal a new empty block on top of every new head.
+type simValidator struct {
+	engine *BFT
+	chain  *core.BlockChain
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSimValidator(key *ecdsa.PrivateKey, genesis *core.Genesis) (*simValidator, error) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	return &simValidator{engine: engine, chain: chain, quit: make(chan struct{})}, nil
+}
+
+func (v *simValidator) Start() error {
+	if err := v.engine.Start(v.chain); err != nil {
+		return err
+	}
+	v.wg.Add(1)
+	go v.loop()
+	return nil
+}
+
+func (v *simValidator) Stop() error {
+	close(v.quit)
+	v.wg.Wait()
+	v.engine.Close()
+	v.chain.Stop()
+	return nil
+}
+
+func (v *simValidator) loop() {
+	defer v.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := v.chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	results := make(chan *types.Block, 1)
+	stop := make(chan struct{})
+	v.seal(results, stop)
+	for {
+		select {
+		case <-heads:
+			close(stop)
+			stop = make(chan struct{})
+			v.seal(results, stop)
+		case block := <-results:
+			if _, err := v.chain.InsertChain(types.Blocks{block}); err != nil {
+				log.Error("Failed to import sealed block", "err", err)
+			}
+		case <-v.quit:
+			close(stop)
+			return
+		}
+	}
+}
+
+func (v *simValidator) seal(results chan *types.Block, stop chan struct{}) {
+	parent := v.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		BaseFee:    misc.CalcBaseFee(v.chain.Config(), parent.Header()),
+	}
+	if err := v.engine.Prepare(v.chain, header); err != nil {
+		log.Error("Failed to prepare block", "err", err)
+		return
+	}
+	statedb, err := v.chain.StateAt(parent.Root())
+	if err != nil {
+		log.Error("Failed to retrieve parent state", "err", err)
+		return
+	}
+	block, err := v.engine.FinalizeAndAssemble(v.chain, header, statedb, nil, nil, nil)
+	if err != nil {
+		log.Error("Failed to assemble block", "err", err)
+		return
+	}
+	if err := v.engine.Seal(v.chain, block, results, stop); err != nil {
+		log.Error("Failed to seal block", "err", err)
+	}
+}
+
+// Tests that a network of validators commits the same chain.
+func TestSimulatedNetwork(t *testing.T) { testSimulatedNetwork(t, 4, 4) }
+
+// Tests that a network keeps committing blocks with a faulty validator, whose
+// turns to propose are skipped by round changes.
+func TestSimulatedNetworkFaulty(t *testing.T) { testSimulatedNetwork(t, 4, 3) }
+
+func testSimulatedNetwork(t *testing.T, validators int, online int) {
+	const target = 6
+
+	// Create the node configs up front, their keys are the validators
+	var (
+		configs = make([]*adapters.NodeConfig, validators)
+		keys    = make([]*ecdsa.PrivateKey, validators)
+	)
+	for i := range configs {
+		configs[i] = adapters.RandomNodeConfig()
+		keys[i] = configs[i].PrivateKey
+	}
+	genesis := testGenesis(&params.BFTConfig{Epoch: 30000, RequestTimeout: 250}, keys)
+
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"bft": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			v, err := newSimValidator(ctx.Config.PrivateKey, genesis)
+			if err != nil {
+				return nil, err
+			}
+			stack.RegisterProtocols(v.engine.Protocols())
+			stack.RegisterLifecycle(v)
+			return v, nil
+		},
+	})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: "bft"})
+	defer network.Shutdown()
+
+	ids := make([]enode.ID, online)
+	for i := 0; i < online; i++ {
+		n, err := network.NewNodeWithConfig(configs[i])
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		if err := network.Start(n.ID()); err != nil {
+			t.Fatalf("failed to start node %d: %v", i, err)
+		}
+		ids[i] = n.ID()
+	}
+	if err := network.ConnectNodesFull(ids); err != nil {
+		t.Fatalf("failed to connect nodes: %v", err)
+	}
+	chains := make([]*core.BlockChain, online)
+	for i, id := range ids {
+		chains[i] = network.GetNode(id).Node.(*adapters.SimNode).Service("bft").(*simValidator).chain
+	}
+	// Wait for all nodes to reach the target height
+	deadline := time.Now().Add(30 * time.Second)
+	for _, chain := range chains {
+		for chain.CurrentBlock().NumberU64() < target {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out at height %d", chain.CurrentBlock().NumberU64())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	// Ensure every node committed the same blocks
+	for n := uint64(1); n <= target; n++ {
+		want := chains[0].GetBlockByNumber(n).Hash()
+		for i, chain := range chains[1:] {
+			if have := chain.GetBlockByNumber(n).Hash(); have != want {
+				t.Errorf("node %d: block %d mismatch: have %x, want %x", i+1, n, have, want)
+			}
+		}
+	}
+}
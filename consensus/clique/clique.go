@@ -265,6 +265,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
 		return errInvalidCheckpointVote
 	}
+	// Header votes are disabled if the signers are managed by a contract
+	if c.config.Governance != nil && (header.Coinbase != (common.Address{}) || !bytes.Equal(header.Nonce[:], nonceDropVote)) {
+		return errGovernanceVote
+	}
 	// Check that the extra-data contains both the vanity and signature
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
@@ -351,8 +355,14 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if err != nil {
 		return err
 	}
-	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
+	// If the block is a checkpoint block, verify the signer list. Governance
+	// checkpoints of parents not processed yet are marked unverified in the
+	// snapshots built on top of them, and verified once the state is available.
+	if number%c.config.Epoch == 0 && c.config.Governance != nil {
+		if err := c.verifyGovernanceCheckpoint(chain, header, parent); err != nil && err != errGovernanceStateUnavailable {
+			return err
+		}
+	} else if number%c.config.Epoch == 0 {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -372,11 +382,12 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	var (
 		headers []*types.Header
 		snap    *Snapshot
+		cached  bool
 	)
 	for snap == nil {
 		// If an in-memory snapshot was found, use that
 		if s, ok := c.recents.Get(hash); ok {
-			snap = s.(*Snapshot)
+			snap, cached = s.(*Snapshot), true
 			break
 		}
 		// If an on-disk checkpoint snapshot can be found, use that
@@ -431,28 +442,136 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	for i := 0; i < len(headers)/2; i++ {
 		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
 	}
-	snap, err := snap.apply(headers)
+	// If the signers are managed by a contract, verify the checkpoints about to
+	// change the signer set. Checkpoints whose parent state is not available yet
+	// are marked unverified, to be verified once it is.
+	var deferred []*types.Header
+	if c.config.Governance != nil {
+		for i, header := range headers {
+			if number := header.Number.Uint64(); number%c.config.Epoch == 0 {
+				var parent *types.Header
+				if i > 0 {
+					parent = headers[i-1]
+				} else {
+					parent = chain.GetHeader(header.ParentHash, number-1)
+				}
+				if parent == nil {
+					deferred = append(deferred, header) // Parent not imported yet, so neither is its state
+					continue
+				}
+				if err := c.verifyGovernanceCheckpoint(chain, header, parent); err == errGovernanceStateUnavailable {
+					deferred = append(deferred, header)
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if len(headers) > 0 {
+		applied, err := snap.apply(headers)
+		if err != nil {
+			return nil, err
+		}
+		snap = applied
+		for _, header := range deferred {
+			if snap.Unverified == nil {
+				snap.Unverified = make(map[uint64]common.Hash)
+			}
+			snap.Unverified[header.Number.Uint64()] = header.Hash()
+		}
+	}
+	// Retry the verification of the checkpoints still pending
+	verified, err := c.verifyDeferred(chain, snap)
 	if err != nil {
 		return nil, err
 	}
+	if cached && len(headers) == 0 && verified == snap {
+		return snap, nil // Found in memory, nothing changed
+	}
+	changed := len(headers) > 0 || verified != snap
+	snap = verified
+	if len(snap.Unverified) > 0 {
+		log.Debug("Deferring governance checkpoint verification", "number", snap.Number, "hash", snap.Hash, "pending", len(snap.Unverified))
+	}
 	c.recents.Add(snap.Hash, snap)
 
 	// If we've generated a new checkpoint snapshot, save to disk
-	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
-		if err = snap.store(c.db); err != nil {
+	if snap.Number%checkpointInterval == 0 && changed {
+		if err := snap.store(c.db); err != nil {
 			return nil, err
 		}
 		log.Trace("Stored voting snapshot to disk", "number", snap.Number, "hash", snap.Hash)
 	}
-	return snap, err
+	return snap, nil
+}
+
+// verifyDeferred verifies the governance checkpoints of a snapshot pending
+// verification whose parent state became available, returning a copy of the
+// snapshot without them. Checkpoints buried deeper than the reorg limit are
+// trusted, like the checkpoints snapshots are started from.
+func (c *Clique) verifyDeferred(chain consensus.ChainHeaderReader, snap *Snapshot) (*Snapshot, error) {
+	if len(snap.Unverified) == 0 {
+		return snap, nil
+	}
+	var done []uint64
+	for number, hash := range snap.Unverified {
+		if snap.Number >= number+params.FullImmutabilityThreshold {
+			done = append(done, number)
+			continue
+		}
+		header := chain.GetHeader(hash, number)
+		if header == nil {
+			continue
+		}
+		parent := chain.GetHeader(header.ParentHash, number-1)
+		if parent == nil {
+			continue
+		}
+		switch err := c.verifyGovernanceCheckpoint(chain, header, parent); err {
+		case nil:
+			done = append(done, number)
+		case errGovernanceStateUnavailable:
+		default:
+			return nil, err
+		}
+	}
+	if len(done) == 0 {
+		return snap, nil
+	}
+	cpy := snap.copy()
+	for _, number := range done {
+		delete(cpy.Unverified, number)
+	}
+	if len(cpy.Unverified) == 0 {
+		cpy.Unverified = nil
+	}
+	return cpy, nil
 }
 
 // VerifyUncles implements consensus.Engine, always returning an error for any
 // uncles as this consensus mechanism doesn't permit uncles.
+//
+// In governance mode, it also verifies the signer list of checkpoint blocks, as
+// their headers may have been verified before their parents were processed. If
+// the parent state is still not available, the block can't be processed either
+// and the parent is reported as pruned, for its state to be regenerated.
 func (c *Clique) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
 	if len(block.Uncles()) > 0 {
 		return errors.New("uncles not allowed")
 	}
+	if number := block.NumberU64(); c.config.Governance != nil && number > 0 && number%c.config.Epoch == 0 {
+		parent := chain.GetHeader(block.ParentHash(), number-1)
+		if parent == nil {
+			return consensus.ErrUnknownAncestor
+		}
+		switch err := c.verifyGovernanceCheckpoint(chain, block.Header(), parent); err {
+		case nil:
+		case errGovernanceStateUnavailable:
+			return consensus.ErrPrunedAncestor
+		default:
+			return err
+		}
+	}
 	return nil
 }
 
@@ -514,7 +633,7 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.Epoch != 0 && c.config.Governance == nil {
 		c.lock.RLock()
 
 		// Gather all the proposals that make sense voting on
@@ -545,7 +664,17 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	header.Extra = header.Extra[:extraVanity]
 
 	if number%c.config.Epoch == 0 {
-		for _, signer := range snap.signers() {
+		signers := snap.signers()
+		if c.config.Governance != nil {
+			parent := chain.GetHeader(header.ParentHash, number-1)
+			if parent == nil {
+				return consensus.ErrUnknownAncestor
+			}
+			if signers, err = c.governanceSigners(chain, parent); err != nil {
+				return err
+			}
+		}
+		for _, signer := range signers {
 			header.Extra = append(header.Extra, signer[:]...)
 		}
 	}
@@ -18,6 +18,7 @@ package clique
 
 import (
 	"math/big"
+	"sort"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -125,3 +126,165 @@ func TestSealHash(t *testing.T) {
 		t.Errorf("have %x, want %x", have, want)
 	}
 }
+
+// Tests that in governance mode, the signer set is rotated at epoch checkpoints
+// according to the governance contract, and that checkpoints deviating from the
+// contract, as well as header votes, are rejected.
+func TestGovernanceSignerRotation(t *testing.T) {
+	var (
+		key1, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		key2, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		addr1    = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2    = crypto.PubkeyToAddress(key2.PublicKey)
+		contract = common.HexToAddress("0x000000000000000000000000000000000000c119")
+		signer   = new(types.HomesteadSigner)
+	)
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = &params.CliqueConfig{Period: 0, Epoch: 3, Governance: &contract}
+
+	// The governance contract is replaced by a raw storage writer, storing the
+	// second calldata word into the slot given by the first one
+	base := crypto.Keccak256Hash(governanceSignersSlot[:]).Big()
+	genspec := &core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: map[common.Address]core.GenesisAccount{
+			addr1: {Balance: big.NewInt(10000000000000000)},
+			contract: {
+				Balance: new(big.Int),
+				Code:    common.FromHex("0x6020356000355500"),
+				Storage: map[common.Hash]common.Hash{
+					governanceSignersSlot:  common.BigToHash(big.NewInt(1)),
+					common.BigToHash(base): common.BytesToHash(addr1[:]),
+				},
+			},
+		},
+		BaseFee: big.NewInt(params.InitialBaseFee),
+	}
+	copy(genspec.ExtraData[extraVanity:], addr1[:])
+
+	// Generate a chain which adds the second signer to the contract in block 1
+	db := rawdb.NewMemoryDatabase()
+	genesis := genspec.MustCommit(db)
+	engine := New(config.Clique, db)
+	blocks, _ := core.GenerateChain(&config, genesis, engine, db, 4, func(i int, block *core.BlockGen) {
+		block.SetDifficulty(diffInTurn)
+		if i == 0 {
+			writes := [][2]common.Hash{
+				{common.BigToHash(new(big.Int).Add(base, common.Big1)), common.BytesToHash(addr2[:])},
+				{governanceSignersSlot, common.BigToHash(big.NewInt(2))},
+			}
+			for _, write := range writes {
+				tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(addr1), contract, new(big.Int), 100000, block.BaseFee(), append(write[0][:], write[1][:]...)), signer, key1)
+				block.AddTx(tx)
+			}
+		}
+	})
+	// Sign the blocks, rotating in the second signer after the checkpoint at block 3
+	rotated := []common.Address{addr1, addr2}
+	sort.Sort(signersAscending(rotated))
+
+	seal := func(blocks []*types.Block, checkpoint []common.Address) []*types.Block {
+		sealed := make([]*types.Block, len(blocks))
+		for i, block := range blocks {
+			header := block.Header()
+			if i > 0 {
+				header.ParentHash = sealed[i-1].Hash()
+			}
+			header.Extra = make([]byte, extraVanity)
+			if header.Number.Uint64()%config.Clique.Epoch == 0 {
+				for _, signer := range checkpoint {
+					header.Extra = append(header.Extra, signer[:]...)
+				}
+			}
+			header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+
+			key, difficulty := key1, diffInTurn
+			if header.Number.Uint64() > 3 {
+				key = key2
+				if rotated[header.Number.Uint64()%2] != addr2 {
+					difficulty = diffNoTurn
+				}
+			}
+			header.Difficulty = difficulty
+
+			sig, _ := crypto.Sign(SealHash(header).Bytes(), key)
+			copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+			sealed[i] = block.WithSeal(header)
+		}
+		return sealed
+	}
+	newChain := func() *core.BlockChain {
+		db := rawdb.NewMemoryDatabase()
+		genspec.MustCommit(db)
+		chain, _ := core.NewBlockChain(db, nil, &config, New(config.Clique, db), vm.Config{}, nil, nil)
+		return chain
+	}
+	// Import the chain block by block, with the parent state always available
+	chain := newChain()
+	defer chain.Stop()
+
+	for _, block := range seal(blocks, rotated) {
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatalf("failed to insert block %d: %v", block.NumberU64(), err)
+		}
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 4 {
+		t.Fatalf("chain head mismatch: have %d, want %d", head, 4)
+	}
+	// A checkpoint not matching the contract must be rejected
+	chain = newChain()
+	defer chain.Stop()
+
+	bad := seal(blocks, []common.Address{addr1})
+	if _, err := chain.InsertChain(bad[:2]); err != nil {
+		t.Fatalf("failed to insert initial blocks: %v", err)
+	}
+	if _, err := chain.InsertChain(bad[2:3]); err != errMismatchingCheckpointSigners {
+		t.Fatalf("checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	// Import the chains in a single batch, verifying the checkpoint headers before
+	// their parents are processed
+	chain = newChain()
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(seal(blocks, rotated)); err != nil {
+		t.Fatalf("failed to insert chain in one batch: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 4 {
+		t.Fatalf("batch chain head mismatch: have %d, want %d", head, 4)
+	}
+	// Checkpoints verified before their parents were processed must be verified
+	// once the parent state is available
+	head := chain.CurrentBlock()
+	snap, err := chain.Engine().(*Clique).snapshot(chain, head.NumberU64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve head snapshot: %v", err)
+	}
+	if len(snap.Unverified) != 0 {
+		t.Fatalf("checkpoints still pending verification: %v", snap.Unverified)
+	}
+	chain = newChain()
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(bad); err != errMismatchingCheckpointSigners {
+		t.Fatalf("batch checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 2 {
+		t.Fatalf("batch chain head mismatch: have %d, want %d", head, 2)
+	}
+	if snap, ok := chain.Engine().(*Clique).recents.Get(bad[2].Hash()); !ok || snap.(*Snapshot).Unverified[bad[2].NumberU64()] != bad[2].Hash() {
+		t.Fatalf("unverified checkpoint snapshot not marked pending")
+	}
+	// Header votes must be rejected
+	header := blocks[0].Header()
+	header.Coinbase = addr2
+	copy(header.Nonce[:], nonceAuthVote)
+	header.Extra = make([]byte, extraVanity+extraSeal)
+
+	sig, _ := crypto.Sign(SealHash(header).Bytes(), key1)
+	copy(header.Extra[extraVanity:], sig)
+	if err := engine.VerifyHeader(chain, header, true); err != errGovernanceVote {
+		t.Fatalf("vote error mismatch: have %v, want %v", err, errGovernanceVote)
+	}
+}
@@ -0,0 +1,101 @@
+pragma solidity ^0.6.0;
+
+/**
+ * @title CliqueGovernance
+ * @dev Reference implementation of a clique signer governance contract. The
+ * authorized signers vote on adding and removing signers; a proposal passes once
+ * more than half of the current signers voted for it. Clique reads the signer
+ * set straight from storage at every epoch checkpoint, so `signers` must remain
+ * the first state variable (storage slot 0).
+ */
+contract CliqueGovernance {
+    /*
+        Events
+    */
+
+    // Voted is emitted when a signer votes on a proposal.
+    event Voted(address indexed voter, address indexed subject, bool authorize, uint256 round);
+
+    // SignerAdded is emitted when a proposal to add a signer passes.
+    event SignerAdded(address indexed signer);
+
+    // SignerRemoved is emitted when a proposal to remove a signer passes.
+    event SignerRemoved(address indexed signer);
+
+    /*
+        Public Functions
+    */
+    constructor(address[] memory _signers) public {
+        require(_signers.length > 0, "no signers");
+        for (uint i = 0; i < _signers.length; i++) {
+            require(!isSigner[_signers[i]], "duplicate signer");
+            isSigner[_signers[i]] = true;
+            signers.push(_signers[i]);
+        }
+    }
+
+    /**
+     * @dev Get the current list of authorized signers.
+     * @return the signer addresses.
+     */
+    function getSigners() public view returns (address[] memory) {
+        return signers;
+    }
+
+    /**
+     * @dev Vote on adding or removing a signer. Votes are discarded whenever the
+     * signer set changes.
+     * @param _subject the account to add or remove.
+     * @param _authorize whether to add (true) or remove (false) the account.
+     */
+    function vote(address _subject, bool _authorize) public {
+        require(isSigner[msg.sender], "not a signer");
+        require(isSigner[_subject] != _authorize, "proposal already in effect");
+
+        bytes32 proposal = keccak256(abi.encodePacked(round, _subject, _authorize));
+        require(!voted[proposal][msg.sender], "already voted");
+        voted[proposal][msg.sender] = true;
+        tally[proposal]++;
+
+        emit Voted(msg.sender, _subject, _authorize, round);
+
+        if (tally[proposal] <= signers.length / 2) {
+            return;
+        }
+        if (_authorize) {
+            isSigner[_subject] = true;
+            signers.push(_subject);
+            emit SignerAdded(_subject);
+        } else {
+            require(signers.length > 1, "can't remove last signer");
+            isSigner[_subject] = false;
+            for (uint i = 0; i < signers.length; i++) {
+                if (signers[i] == _subject) {
+                    signers[i] = signers[signers.length - 1];
+                    signers.pop();
+                    break;
+                }
+            }
+            emit SignerRemoved(_subject);
+        }
+        round++;
+    }
+
+    /*
+        Fields
+    */
+    // signers is the list of authorized signers, read by clique from slot 0.
+    address[] signers;
+
+    // isSigner is the authorization status of each account.
+    mapping(address => bool) public isSigner;
+
+    // round is bumped on every signer set change, invalidating pending votes.
+    uint256 public round;
+
+    // voted records which signers voted on each proposal.
+    mapping(bytes32 => mapping(address => bool)) voted;
+
+    // tally counts the votes on each proposal.
+    mapping(bytes32 => uint256) tally;
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxGovernanceSigners is the maximum number of signers accepted from the
+// governance contract, protecting against reading an unbounded storage array.
+const maxGovernanceSigners = 1024
+
+// governanceSignersSlot is the storage slot of the dynamic signer array in the
+// governance contract. It's the first state variable of contract/governance.sol.
+var governanceSignersSlot = common.Hash{}
+
+var (
+	// errInvalidGovernanceSigners is returned if the governance contract holds an
+	// empty, oversized or duplicated signer list.
+	errInvalidGovernanceSigners = errors.New("invalid signer list in governance contract")
+
+	// errGovernanceVote is returned if a block casts a header vote while the signer
+	// set is managed by the governance contract.
+	errGovernanceVote = errors.New("header vote in governance mode")
+
+	// errGovernanceStateUnavailable is returned if the state holding the governance
+	// contract can't be accessed.
+	errGovernanceStateUnavailable = errors.New("governance state unavailable")
+)
+
+// stateReader is implemented by chain readers with access to historical state,
+// which is required to read the signer set from the governance contract.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// ReadGovernanceSigners reads the authorized signer set from the governance
+// contract in the given state, sorted in ascending order.
+func ReadGovernanceSigners(statedb *state.StateDB, contract common.Address) ([]common.Address, error) {
+	length := statedb.GetState(contract, governanceSignersSlot).Big()
+	if length.Sign() == 0 || length.Cmp(big.NewInt(maxGovernanceSigners)) > 0 {
+		return nil, errInvalidGovernanceSigners
+	}
+	// Solidity stores the items of a dynamic array consecutively, starting at
+	// the hash of the slot holding its length
+	var (
+		base    = crypto.Keccak256Hash(governanceSignersSlot[:]).Big()
+		signers = make([]common.Address, length.Uint64())
+		seen    = make(map[common.Address]struct{})
+	)
+	for i := range signers {
+		slot := common.BigToHash(new(big.Int).Add(base, big.NewInt(int64(i))))
+		signers[i] = common.BytesToAddress(statedb.GetState(contract, slot).Bytes())
+		if _, ok := seen[signers[i]]; ok {
+			return nil, errInvalidGovernanceSigners
+		}
+		seen[signers[i]] = struct{}{}
+	}
+	sort.Sort(signersAscending(signers))
+	return signers, nil
+}
+
+// governanceSigners reads the authorized signer set from the governance contract
+// in the state of the given header.
+func (c *Clique) governanceSigners(chain consensus.ChainHeaderReader, header *types.Header) ([]common.Address, error) {
+	reader, ok := chain.(stateReader)
+	if !ok {
+		return nil, errGovernanceStateUnavailable
+	}
+	statedb, err := reader.StateAt(header.Root)
+	if err != nil {
+		return nil, errGovernanceStateUnavailable
+	}
+	return ReadGovernanceSigners(statedb, *c.config.Governance)
+}
+
+// verifyGovernanceCheckpoint checks that the signer list of a checkpoint header
+// matches the governance contract in the state of its parent. If that state is
+// not accessible (yet), errGovernanceStateUnavailable is returned and the caller
+// has to defer the verification until the parent was processed.
+func (c *Clique) verifyGovernanceCheckpoint(chain consensus.ChainHeaderReader, header, parent *types.Header) error {
+	signers, err := c.governanceSigners(chain, parent)
+	if err != nil {
+		return err
+	}
+	expected := make([]byte, len(signers)*common.AddressLength)
+	for i, signer := range signers {
+		copy(expected[i*common.AddressLength:], signer[:])
+	}
+	extraSuffix := len(header.Extra) - extraSeal
+	if !bytes.Equal(header.Extra[extraVanity:extraSuffix], expected) {
+		return errMismatchingCheckpointSigners
+	}
+	return nil
+}
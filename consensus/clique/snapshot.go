@@ -57,6 +57,8 @@ type Snapshot struct {
 	Recents map[uint64]common.Address   `json:"recents"` // Set of recent signers for spam protections
 	Votes   []*Vote                     `json:"votes"`   // List of votes cast in chronological order
 	Tally   map[common.Address]Tally    `json:"tally"`   // Current vote tally to avoid recalculating
+
+	Unverified map[uint64]common.Hash `json:"unverified,omitempty"` // Governance checkpoints whose signer lists are pending verification
 }
 
 // signersAscending implements the sort interface to allow sorting a list of addresses
@@ -133,6 +135,12 @@ func (s *Snapshot) copy() *Snapshot {
 	}
 	copy(cpy.Votes, s.Votes)
 
+	if len(s.Unverified) > 0 {
+		cpy.Unverified = make(map[uint64]common.Hash, len(s.Unverified))
+		for number, hash := range s.Unverified {
+			cpy.Unverified[number] = hash
+		}
+	}
 	return cpy
 }
 
@@ -229,6 +237,23 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		}
 		snap.Recents[number] = signer
 
+		// If the signers are managed by a contract, the set listed by the checkpoint
+		// takes effect from the next block on
+		if number%s.config.Epoch == 0 && s.config.Governance != nil {
+			snap.Signers = make(map[common.Address]struct{})
+			for i := 0; i < (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength; i++ {
+				var signer common.Address
+				copy(signer[:], header.Extra[extraVanity+i*common.AddressLength:])
+				snap.Signers[signer] = struct{}{}
+			}
+			// Drop any recents which fell out of the (possibly shrunk) window
+			limit := uint64(len(snap.Signers)/2 + 1)
+			for seen := range snap.Recents {
+				if seen+limit <= number {
+					delete(snap.Recents, seen)
+				}
+			}
+		}
 		// Header authorized, discard any previous votes from the signer
 		for i, vote := range snap.Votes {
 			if vote.Signer == signer && vote.Address == header.Coinbase {
@@ -125,3 +125,12 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// FinalityEngine is a consensus engine offering deterministic finality, able to
+// report the latest finalized block of a chain.
+type FinalityEngine interface {
+	Engine
+
+	// FinalizedHeader retrieves the latest finalized header of the given chain.
+	FinalizedHeader(chain ChainHeaderReader) *types.Header
+}
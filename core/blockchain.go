@@ -61,6 +61,8 @@ var (
 	storageHashTimer   = metrics.NewRegisteredTimer("chain/storage/hashes", nil)
 	storageUpdateTimer = metrics.NewRegisteredTimer("chain/storage/updates", nil)
 	storageCommitTimer = metrics.NewRegisteredTimer("chain/storage/commits", nil)
+	storageTrieMeter   = metrics.NewRegisteredMeter("chain/storage/tries", nil)
+	storageParTimer    = metrics.NewRegisteredTimer("chain/storage/parallel", nil)
 
 	snapshotAccountReadTimer = metrics.NewRegisteredTimer("chain/snapshot/account/reads", nil)
 	snapshotStorageReadTimer = metrics.NewRegisteredTimer("chain/snapshot/storage/reads", nil)
@@ -80,6 +82,8 @@ var (
 	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
 
 	errInsertionInterrupted = errors.New("insertion is interrupted")
+	errUnknownMarker        = errors.New("unknown finalized or safe block")
+	errNonCanonicalMarker   = errors.New("finalized or safe block not in canonical chain")
 )
 
 const (
@@ -187,6 +191,8 @@ type BlockChain struct {
 
 	currentBlock     atomic.Value // Current head of the block chain
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
+	currentFinalized atomic.Value // Latest finalized block chosen by the consensus client
+	currentSafe      atomic.Value // Latest safe block chosen by the consensus client
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
@@ -264,6 +270,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	bc.currentBlock.Store(nilBlock)
 	bc.currentFastBlock.Store(nilBlock)
 
+	var nilHeader *types.Header
+	bc.currentFinalized.Store(nilHeader)
+	bc.currentSafe.Store(nilHeader)
+
 	// Initialize the chain with ancient data if it isn't empty.
 	var txIndexBlock uint64
 
@@ -456,6 +466,9 @@ func (bc *BlockChain) loadLastState() error {
 			headFastBlockGauge.Update(int64(block.NumberU64()))
 		}
 	}
+	// Restore the finalized and safe markers, dropping any rewound or reorged away
+	bc.loadMarkers()
+
 	// Issue a status log for the user
 	currentFastBlock := bc.CurrentFastBlock()
 
@@ -671,6 +684,91 @@ func (bc *BlockChain) CurrentFastBlock() *types.Block {
 	return bc.currentFastBlock.Load().(*types.Block)
 }
 
+// CurrentFinalizedHeader retrieves the latest finalized block chosen by the
+// consensus client, or nil if none was chosen yet.
+func (bc *BlockChain) CurrentFinalizedHeader() *types.Header {
+	return bc.currentFinalized.Load().(*types.Header)
+}
+
+// CurrentSafeHeader retrieves the latest safe block chosen by the consensus
+// client, or nil if none was chosen yet.
+func (bc *BlockChain) CurrentSafeHeader() *types.Header {
+	return bc.currentSafe.Load().(*types.Header)
+}
+
+// SetFinalized sets and persists the latest finalized block chosen by the
+// consensus client. The block must be part of the canonical chain, at or below
+// the current head.
+func (bc *BlockChain) SetFinalized(hash common.Hash) error {
+	header, err := bc.checkMarker(hash)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteHeadFinalizedBlockHash(bc.db, hash)
+	bc.currentFinalized.Store(header)
+	return nil
+}
+
+// SetSafe sets and persists the latest safe block chosen by the consensus
+// client. The block must be part of the canonical chain, at or below the
+// current head.
+func (bc *BlockChain) SetSafe(hash common.Hash) error {
+	header, err := bc.checkMarker(hash)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteHeadSafeBlockHash(bc.db, hash)
+	bc.currentSafe.Store(header)
+	return nil
+}
+
+// loadMarkers loads the persisted finalized and safe markers. Markers no longer
+// on the canonical chain at or below the head, e.g. after a rewind or reorg, are
+// dropped both in memory and on disk.
+func (bc *BlockChain) loadMarkers() {
+	finalized := bc.canonicalMarker(rawdb.ReadHeadFinalizedBlockHash(bc.db))
+	if finalized == nil {
+		rawdb.DeleteHeadFinalizedBlockHash(bc.db)
+	}
+	bc.currentFinalized.Store(finalized)
+
+	safe := bc.canonicalMarker(rawdb.ReadHeadSafeBlockHash(bc.db))
+	if safe == nil {
+		rawdb.DeleteHeadSafeBlockHash(bc.db)
+	}
+	bc.currentSafe.Store(safe)
+}
+
+// checkMarker retrieves the header of a finalized or safe block, ensuring it is
+// an ancestor of (or equal to) the current head block.
+func (bc *BlockChain) checkMarker(hash common.Hash) (*types.Header, error) {
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownMarker
+	}
+	if bc.canonicalMarker(hash) == nil {
+		return nil, errNonCanonicalMarker
+	}
+	return header, nil
+}
+
+// canonicalMarker retrieves the header of a finalized or safe block if it is
+// an ancestor of (or equal to) the current head block, or nil otherwise.
+func (bc *BlockChain) canonicalMarker(hash common.Hash) *types.Header {
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil
+	}
+	number := header.Number.Uint64()
+	if number > bc.CurrentBlock().NumberU64() || bc.GetCanonicalHash(number) != hash {
+		return nil
+	}
+	return header
+}
+
 // Validator returns the current validator.
 func (bc *BlockChain) Validator() Validator {
 	return bc.validator
@@ -1440,23 +1538,20 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
-	return bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
+	return bc.writeBlockAndSetHead(block, receipts, logs, state, emitHeadEvent)
 }
 
 // writeBlockWithState writes the block and all associated state to the database,
-// but is expects the chain mutex to be held.
-func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
+// but it doesn't touch the canonical chain. It expects the chain mutex to be held.
+func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB) error {
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
 	// Calculate the total difficulty of the block
 	ptd := bc.GetTd(block.ParentHash(), block.NumberU64()-1)
 	if ptd == nil {
-		return NonStatTy, consensus.ErrUnknownAncestor
+		return consensus.ErrUnknownAncestor
 	}
-	// Make sure no inconsistent state is leaked during insertion
-	currentBlock := bc.CurrentBlock()
-	localTd := bc.GetTd(currentBlock.Hash(), currentBlock.NumberU64())
 	externTd := new(big.Int).Add(block.Difficulty(), ptd)
 
 	// Irrelevant of the canonical status, write the block itself to the database.
@@ -1474,14 +1569,14 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	// Commit all cached state changes into underlying memory database.
 	root, err := state.Commit(bc.chainConfig.IsEIP158(block.Number()))
 	if err != nil {
-		return NonStatTy, err
+		return err
 	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.TrieDirtyDisabled {
 		if err := triedb.Commit(root, false, nil); err != nil {
-			return NonStatTy, err
+			return err
 		}
 	} else {
 		// Full but not archive node, do proper garbage collection
@@ -1530,11 +1625,28 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			}
 		}
 	}
+	return nil
+}
+
+// writeBlockAndSetHead writes the block and all associated state to the database,
+// and applies the block as the new chain head if its total difficulty is higher
+// than the current head's. It expects the chain mutex to be held.
+func (bc *BlockChain) writeBlockAndSetHead(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	if err := bc.writeBlockWithState(block, receipts, logs, state); err != nil {
+		return NonStatTy, err
+	}
+	// Make sure no inconsistent state is leaked during insertion
+	currentBlock := bc.CurrentBlock()
+	localTd := bc.GetTd(currentBlock.Hash(), currentBlock.NumberU64())
+	externTd := bc.GetTd(block.Hash(), block.NumberU64())
+
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
 	// Please refer to http://www.cs.cornell.edu/~ie53/publications/btcProcFC.pdf
 	reorg := externTd.Cmp(localTd) > 0
-	currentBlock = bc.CurrentBlock()
 	if !reorg && externTd.Cmp(localTd) == 0 {
 		// Split same-difficulty blocks by number, then preferentially select
 		// the block generated by the local miner as the canonical block.
@@ -1631,7 +1743,7 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	// Pre-checks passed, start the full block imports
 	bc.wg.Add(1)
 	bc.chainmu.Lock()
-	n, err := bc.insertChain(chain, true)
+	n, err := bc.insertChain(chain, true, true)
 	bc.chainmu.Unlock()
 	bc.wg.Done()
 
@@ -1647,13 +1759,85 @@ func (bc *BlockChain) InsertChainWithoutSealVerification(block *types.Block) (in
 	// Pre-checks passed, start the full block imports
 	bc.wg.Add(1)
 	bc.chainmu.Lock()
-	n, err := bc.insertChain(types.Blocks([]*types.Block{block}), false)
+	n, err := bc.insertChain(types.Blocks([]*types.Block{block}), false, true)
 	bc.chainmu.Unlock()
 	bc.wg.Done()
 
 	return n, err
 }
 
+// InsertBlockWithoutSetHead executes the block, runs the necessary verification
+// upon it and then persists the block and the associated state into the database.
+// Contrary to InsertChain, the block is not made canonical even if its total
+// difficulty exceeds the current head's; the head has to be chosen explicitly via
+// SetChainHead. Seal verification is omitted.
+func (bc *BlockChain) InsertBlockWithoutSetHead(block *types.Block) error {
+	bc.wg.Add(1)
+	bc.chainmu.Lock()
+	_, err := bc.insertChain(types.Blocks([]*types.Block{block}), false, false)
+	bc.chainmu.Unlock()
+	bc.wg.Done()
+
+	return err
+}
+
+// SetChainHead makes the given block, which must already be in the database with
+// its state, the new head of the canonical chain, reorganising or rewinding the
+// chain as necessary.
+func (bc *BlockChain) SetChainHead(head *types.Block) error {
+	if !bc.HasBlockAndState(head.Hash(), head.NumberU64()) {
+		return fmt.Errorf("unknown block or missing state #%d [%x]", head.NumberU64(), head.Hash())
+	}
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	current := bc.CurrentBlock()
+	if current.Hash() == head.Hash() {
+		return nil
+	}
+	if head.ParentHash() != current.Hash() {
+		if err := bc.reorg(current, head); err != nil {
+			return err
+		}
+	}
+	bc.writeHeadBlock(head)
+
+	// When rewinding onto an ancestor, drop the leftover canonical assignments and
+	// move the header and fast sync markers back onto the new head too.
+	if head.NumberU64() < current.NumberU64() {
+		batch := bc.db.NewBatch()
+		for i := head.NumberU64() + 1; ; i++ {
+			hash := rawdb.ReadCanonicalHash(bc.db, i)
+			if hash == (common.Hash{}) {
+				break
+			}
+			rawdb.DeleteCanonicalHash(batch, i)
+		}
+		rawdb.WriteHeadHeaderHash(batch, head.Hash())
+		rawdb.WriteHeadFastBlockHash(batch, head.Hash())
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to rewind chain markers", "err", err)
+		}
+		bc.hc.SetCurrentHeader(head.Header())
+		bc.currentFastBlock.Store(head)
+		headFastBlockGauge.Update(int64(head.NumberU64()))
+	}
+	// Drop the finalized and safe markers if they were rewound or reorged away
+	bc.loadMarkers()
+	var logs []*types.Log
+	for _, receipt := range rawdb.ReadReceipts(bc.db, head.Hash(), head.NumberU64(), bc.chainConfig) {
+		logs = append(logs, receipt.Logs...)
+	}
+	bc.chainFeed.Send(ChainEvent{Block: head, Hash: head.Hash(), Logs: logs})
+	if len(logs) > 0 {
+		bc.logsFeed.Send(logs)
+	}
+	bc.chainHeadFeed.Send(ChainHeadEvent{Block: head})
+	return nil
+}
+
 // insertChain is the internal implementation of InsertChain, which assumes that
 // 1) chains are contiguous, and 2) The chain mutex is held.
 //
@@ -1661,8 +1845,11 @@ func (bc *BlockChain) InsertChainWithoutSealVerification(block *types.Block) (in
 // historical blocks can do so without releasing the lock, which could lead to
 // racey behaviour. If a sidechain import is in progress, and the historic state
 // is imported, but then new canon-head is added before the actual sidechain
-// completes, then the historic state could be pruned again
-func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, error) {
+// completes, then the historic state could be pruned again.
+//
+// If setHead is false, the blocks are only written to the database without
+// updating the canonical chain, leaving the choice of head to the caller.
+func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool) (int, error) {
 	// If the chain is terminating, don't even bother starting up
 	if atomic.LoadInt32(&bc.procInterrupt) == 1 {
 		return 0, nil
@@ -1726,7 +1913,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// When node runs a fast sync again, it can re-import a batch of known blocks via
 		// `insertChain` while a part of them have higher total difficulty than current
 		// head full block(new pivot point).
-		for block != nil && err == ErrKnownBlock {
+		for block != nil && err == ErrKnownBlock && setHead {
 			log.Debug("Writing previously known block", "number", block.Number(), "hash", block.Hash())
 			if err := bc.writeKnownBlock(block); err != nil {
 				return it.index, err
@@ -1891,12 +2078,19 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// Update the metrics touched during block validation
 		accountHashTimer.Update(statedb.AccountHashes) // Account hashes are complete, we can mark them
 		storageHashTimer.Update(statedb.StorageHashes) // Storage hashes are complete, we can mark them
+		storageTrieMeter.Mark(int64(statedb.StorageTries))
+		storageParTimer.Update(statedb.StorageParallel)
 
 		blockValidationTimer.Update(time.Since(substart) - (statedb.AccountHashes + statedb.StorageHashes - triehash))
 
 		// Write the block to the chain and get the status.
 		substart = time.Now()
-		status, err := bc.writeBlockWithState(block, receipts, logs, statedb, false)
+		var status WriteStatus
+		if !setHead {
+			err = bc.writeBlockWithState(block, receipts, logs, statedb)
+		} else {
+			status, err = bc.writeBlockAndSetHead(block, receipts, logs, statedb, false)
+		}
 		atomic.StoreUint32(&followupInterrupt, 1)
 		if err != nil {
 			return it.index, err
@@ -1909,8 +2103,13 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		blockWriteTimer.Update(time.Since(substart) - statedb.AccountCommits - statedb.StorageCommits - statedb.SnapshotCommits)
 		blockInsertTimer.UpdateSince(start)
 
-		switch status {
-		case CanonStatTy:
+		switch {
+		case !setHead:
+			log.Debug("Inserted block without setting head", "number", block.Number(), "hash", block.Hash(),
+				"txs", len(block.Transactions()), "gas", block.GasUsed(), "elapsed", common.PrettyDuration(time.Since(start)),
+				"root", block.Root())
+
+		case status == CanonStatTy:
 			log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(),
 				"uncles", len(block.Uncles()), "txs", len(block.Transactions()), "gas", block.GasUsed(),
 				"elapsed", common.PrettyDuration(time.Since(start)),
@@ -1921,7 +2120,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 			// Only count canonical blocks for GC processing time
 			bc.gcproc += proctime
 
-		case SideStatTy:
+		case status == SideStatTy:
 			log.Debug("Inserted forked block", "number", block.Number(), "hash", block.Hash(),
 				"diff", block.Difficulty(), "elapsed", common.PrettyDuration(time.Since(start)),
 				"txs", len(block.Transactions()), "gas", block.GasUsed(), "uncles", len(block.Uncles()),
@@ -2064,7 +2263,7 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 		// memory here.
 		if len(blocks) >= 2048 || memory > 64*1024*1024 {
 			log.Info("Importing heavy sidechain segment", "blocks", len(blocks), "start", blocks[0].NumberU64(), "end", block.NumberU64())
-			if _, err := bc.insertChain(blocks, false); err != nil {
+			if _, err := bc.insertChain(blocks, false, true); err != nil {
 				return 0, err
 			}
 			blocks, memory = blocks[:0], 0
@@ -2078,7 +2277,7 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 	}
 	if len(blocks) > 0 {
 		log.Info("Importing sidechain segment", "start", blocks[0].NumberU64(), "end", blocks[len(blocks)-1].NumberU64())
-		return bc.insertChain(blocks, false)
+		return bc.insertChain(blocks, false, true)
 	}
 	return 0, nil
 }
@@ -2199,6 +2398,11 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		blockReorgAddMeter.Mark(int64(len(newChain)))
 		blockReorgDropMeter.Mark(int64(len(oldChain)))
 		blockReorgMeter.Mark(1)
+	} else if len(oldChain) > 0 || len(newChain) > 0 {
+		// The new head is a descendant or an ancestor of the old one, as chosen
+		// explicitly through SetChainHead
+		log.Debug("Chain head moved along the canonical chain", "number", commonBlock.Number(), "hash", commonBlock.Hash(),
+			"drop", len(oldChain), "add", len(newChain))
 	} else {
 		log.Error("Impossible reorg, please file an issue", "oldnum", oldBlock.Number(), "oldhash", oldBlock.Hash(), "newnum", newBlock.Number(), "newhash", newBlock.Hash())
 	}
@@ -3275,3 +3275,75 @@ func TestEIP1559Transition(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that the finalized and safe markers only accept canonical blocks at or
+// below the head, and that they are persisted across restarts and rewinds.
+func TestFinalizedSafeMarkers(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(db)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+
+	chain, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, gen *BlockGen) {})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	fork, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if err := blockchain.SetFinalized(common.Hash{0xff}); err != errUnknownMarker {
+		t.Fatalf("unknown block: error mismatch: have %v, want %v", err, errUnknownMarker)
+	}
+	if err := blockchain.SetSafe(fork[1].Hash()); err != errNonCanonicalMarker {
+		t.Fatalf("side block: error mismatch: have %v, want %v", err, errNonCanonicalMarker)
+	}
+	if header := blockchain.CurrentSafeHeader(); header != nil {
+		t.Fatalf("rejected safe block stored: %d", header.Number)
+	}
+	if err := blockchain.SetFinalized(chain[3].Hash()); err != nil {
+		t.Fatalf("failed to set finalized block: %v", err)
+	}
+	if err := blockchain.SetSafe(chain[5].Hash()); err != nil {
+		t.Fatalf("failed to set safe block: %v", err)
+	}
+	blockchain.Stop()
+
+	// Reopen the chain and ensure the markers are restored
+	blockchain, _ = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer blockchain.Stop()
+
+	if header := blockchain.CurrentFinalizedHeader(); header == nil || header.Hash() != chain[3].Hash() {
+		t.Fatalf("finalized block not restored: have %v, want %x", header, chain[3].Hash())
+	}
+	if header := blockchain.CurrentSafeHeader(); header == nil || header.Hash() != chain[5].Hash() {
+		t.Fatalf("safe block not restored: have %v, want %x", header, chain[5].Hash())
+	}
+	// Rewind below the safe block and ensure only the finalized marker survives
+	if err := blockchain.SetHead(chain[4].NumberU64()); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if header := blockchain.CurrentFinalizedHeader(); header == nil || header.Hash() != chain[3].Hash() {
+		t.Fatalf("finalized block dropped on rewind: have %v, want %x", header, chain[3].Hash())
+	}
+	if header := blockchain.CurrentSafeHeader(); header != nil {
+		t.Fatalf("safe block above head retained: %d", header.Number)
+	}
+	if hash := rawdb.ReadHeadSafeBlockHash(db); hash != (common.Hash{}) {
+		t.Fatalf("safe block above head persisted: %x", hash)
+	}
+	// Move the head below the finalized block and ensure it's dropped too
+	if err := blockchain.SetChainHead(chain[2]); err != nil {
+		t.Fatalf("failed to set chain head: %v", err)
+	}
+	if header := blockchain.CurrentFinalizedHeader(); header != nil {
+		t.Fatalf("finalized block above head retained: %d", header.Number)
+	}
+	if hash := rawdb.ReadHeadFinalizedBlockHash(db); hash != (common.Hash{}) {
+		t.Fatalf("finalized block above head persisted: %x", hash)
+	}
+}
@@ -17,6 +17,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -24,6 +26,45 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// TxPoolEventType is the kind of change a transaction underwent in the pool.
+type TxPoolEventType uint8
+
+const (
+	TxEventAdded    TxPoolEventType = iota // Transaction entered the pool
+	TxEventPromoted                        // Transaction became executable
+	TxEventDemoted                         // Transaction became non-executable
+	TxEventReplaced                        // Transaction was replaced by another one with the same nonce
+	TxEventDropped                         // Transaction was removed from the pool
+)
+
+// String implements fmt.Stringer.
+func (t TxPoolEventType) String() string {
+	switch t {
+	case TxEventAdded:
+		return "added"
+	case TxEventPromoted:
+		return "promoted"
+	case TxEventDemoted:
+		return "demoted"
+	case TxEventReplaced:
+		return "replaced"
+	case TxEventDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// TxPoolEvent is posted whenever a transaction is added to, moved within or
+// removed from the transaction pool.
+type TxPoolEvent struct {
+	Tx         *types.Transaction
+	Type       TxPoolEventType
+	Reason     error       // Reason of a demotion or drop
+	ReplacedBy common.Hash // Hash of the replacing transaction
+	Time       time.Time
+}
+
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
 
@@ -0,0 +1,125 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	// logIndexThrottling is the time to wait between processing two consecutive
+	// index sections. It's useful during chain upgrades to prevent disk overload.
+	logIndexThrottling = 100 * time.Millisecond
+)
+
+// logIndexKey identifies the logs of an address, or of a topic at a position.
+type logIndexKey struct {
+	kind  byte
+	value common.Hash // Addresses are right aligned
+}
+
+// LogIndexer implements a core.ChainIndexer, building up an exact index from the
+// addresses and topics of logs to their positions in the canonical chain.
+type LogIndexer struct {
+	size    uint64                   // section size to index logs for
+	db      ethdb.Database           // database instance to write index data and metadata into
+	entries map[logIndexKey][]uint64 // log positions of the section being processed
+	section uint64                   // Section is the section number being processed currently
+	head    common.Hash              // Head is the hash of the last header processed
+}
+
+// NewLogIndexer returns a chain indexer that generates the log index for the
+// canonical chain for exact logs filtering.
+func NewLogIndexer(db ethdb.Database, size, confirms uint64) *ChainIndexer {
+	backend := &LogIndexer{
+		db:   db,
+		size: size,
+	}
+	table := rawdb.NewTable(db, string(rawdb.LogIndexPrefix))
+
+	return NewChainIndexer(db, table, backend, size, confirms, logIndexThrottling, "logindex")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new log index section.
+func (b *LogIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	b.entries, b.section, b.head = make(map[logIndexKey][]uint64), section, common.Hash{}
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding the logs of a new header
+// into the index.
+func (b *LogIndexer) Process(ctx context.Context, header *types.Header) error {
+	b.head = header.Hash()
+	if header.Bloom == (types.Bloom{}) {
+		return nil
+	}
+	receipts := rawdb.ReadRawReceipts(b.db, b.head, header.Number.Uint64())
+	if receipts == nil {
+		return errors.New("receipts not found")
+	}
+	var (
+		offset = (header.Number.Uint64() - b.section*b.size) << 32
+		index  uint64
+	)
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			position := offset | index
+			index++
+
+			key := logIndexKey{kind: rawdb.LogIndexAddress, value: common.BytesToHash(log.Address.Bytes())}
+			b.entries[key] = append(b.entries[key], position)
+			for i, topic := range log.Topics {
+				key := logIndexKey{kind: rawdb.LogIndexTopic + byte(i), value: topic}
+				b.entries[key] = append(b.entries[key], position)
+			}
+		}
+	}
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, finalizing the log index section
+// and writing it out into the database.
+func (b *LogIndexer) Commit() error {
+	batch := b.db.NewBatch()
+	for key, positions := range b.entries {
+		value := key.value.Bytes()
+		if key.kind == rawdb.LogIndexAddress {
+			value = value[common.HashLength-common.AddressLength:]
+		}
+		rawdb.WriteLogIndex(batch, key.kind, value, b.section, b.head, positions)
+
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (b *LogIndexer) Prune(threshold uint64) error {
+	return nil
+}
@@ -188,6 +188,54 @@ func WriteHeadFastBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// ReadHeadFinalizedBlockHash retrieves the hash of the latest finalized block
+// chosen by the consensus client.
+func ReadHeadFinalizedBlockHash(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headFinalizedBlockKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteHeadFinalizedBlockHash stores the hash of the latest finalized block.
+func WriteHeadFinalizedBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(headFinalizedBlockKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last finalized block's hash", "err", err)
+	}
+}
+
+// DeleteHeadFinalizedBlockHash removes the hash of the latest finalized block.
+func DeleteHeadFinalizedBlockHash(db ethdb.KeyValueWriter) {
+	if err := db.Delete(headFinalizedBlockKey); err != nil {
+		log.Crit("Failed to delete last finalized block's hash", "err", err)
+	}
+}
+
+// ReadHeadSafeBlockHash retrieves the hash of the latest safe block chosen by
+// the consensus client.
+func ReadHeadSafeBlockHash(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headSafeBlockKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteHeadSafeBlockHash stores the hash of the latest safe block.
+func WriteHeadSafeBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(headSafeBlockKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last safe block's hash", "err", err)
+	}
+}
+
+// DeleteHeadSafeBlockHash removes the hash of the latest safe block.
+func DeleteHeadSafeBlockHash(db ethdb.KeyValueWriter) {
+	if err := db.Delete(headSafeBlockKey); err != nil {
+		log.Crit("Failed to delete last safe block's hash", "err", err)
+	}
+}
+
 // ReadLastPivotNumber retrieves the number of the last pivot block. If the node
 // full synced, the last pivot will always be nil.
 func ReadLastPivotNumber(db ethdb.KeyValueReader) *uint64 {
@@ -686,6 +734,26 @@ func WriteAncientBlock(db ethdb.AncientWriter, block *types.Block, receipts type
 	return len(headerBlob) + len(bodyBlob) + len(receiptBlob) + len(tdBlob) + common.HashLength
 }
 
+// RepairAncientHeader replaces a corrupted header in the ancient store. The new
+// header must encode to the exact same data as the originally frozen one.
+func RepairAncientHeader(db ethdb.AncientWriter, header *types.Header) error {
+	blob, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return err
+	}
+	return db.RepairAncient(freezerHeaderTable, header.Number.Uint64(), blob)
+}
+
+// RepairAncientBody replaces a corrupted block body in the ancient store. The new
+// body must encode to the exact same data as the originally frozen one.
+func RepairAncientBody(db ethdb.AncientWriter, number uint64, body *types.Body) error {
+	blob, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		return err
+	}
+	return db.RepairAncient(freezerBodiesTable, number, blob)
+}
+
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
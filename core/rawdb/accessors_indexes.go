@@ -155,6 +155,42 @@ func WriteBloomBits(db ethdb.KeyValueWriter, bit uint, section uint64, head comm
 	}
 }
 
+// Kinds of the keys of the log index. Topics are indexed by their position in
+// the topic list of the logs, LogIndexTopic being the first position.
+const (
+	LogIndexAddress byte = 0
+	LogIndexTopic   byte = 1
+)
+
+// ReadLogIndex retrieves the positions of the logs with the given address or
+// topic within a section of the log index. Positions are encoded as the offset
+// of the block within the section in the upper 32 bits, and the index of the log
+// within the block in the lower 32 bits.
+func ReadLogIndex(db ethdb.KeyValueReader, kind byte, value []byte, section uint64, head common.Hash) []uint64 {
+	data, _ := db.Get(logIndexKey(kind, value, section, head))
+	if len(data) == 0 {
+		return nil
+	}
+	var positions []uint64
+	if err := rlp.DecodeBytes(data, &positions); err != nil {
+		log.Error("Invalid log index entry RLP", "section", section, "err", err)
+		return nil
+	}
+	return positions
+}
+
+// WriteLogIndex stores the positions of the logs with the given address or topic
+// within a section of the log index.
+func WriteLogIndex(db ethdb.KeyValueWriter, kind byte, value []byte, section uint64, head common.Hash, positions []uint64) {
+	data, err := rlp.EncodeToBytes(positions)
+	if err != nil {
+		log.Crit("Failed to encode log index entry", "err", err)
+	}
+	if err := db.Put(logIndexKey(kind, value, section, head), data); err != nil {
+		log.Crit("Failed to store log index entry", "err", err)
+	}
+}
+
 // DeleteBloombits removes all compressed bloom bits vector belonging to the
 // given section range and bit index.
 func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
@@ -138,3 +138,48 @@ func PopUncleanShutdownMarker(db ethdb.KeyValueStore) {
 		log.Warn("Failed to clear unclean-shutdown marker", "err", err)
 	}
 }
+
+// AncientRange is an inclusive range of item numbers within an ancient table.
+type AncientRange struct {
+	From uint64
+	To   uint64
+}
+
+// CorruptAncients is the set of ancient chain items found corrupt by a freezer
+// verification, which are pending repair from the network.
+type CorruptAncients struct {
+	Headers []AncientRange
+	Bodies  []AncientRange
+}
+
+// ReadCorruptAncients retrieves the ancient items flagged as corrupt.
+func ReadCorruptAncients(db ethdb.KeyValueReader) *CorruptAncients {
+	data, _ := db.Get(corruptAncientsKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var corrupt CorruptAncients
+	if err := rlp.DecodeBytes(data, &corrupt); err != nil {
+		log.Error("Invalid corrupt ancients RLP", "err", err)
+		return nil
+	}
+	return &corrupt
+}
+
+// WriteCorruptAncients stores the ancient items flagged as corrupt, deleting
+// the marker altogether if nothing is left to repair.
+func WriteCorruptAncients(db ethdb.KeyValueWriter, corrupt *CorruptAncients) {
+	if corrupt == nil || (len(corrupt.Headers) == 0 && len(corrupt.Bodies) == 0) {
+		if err := db.Delete(corruptAncientsKey); err != nil {
+			log.Crit("Failed to remove corrupt ancients", "err", err)
+		}
+		return
+	}
+	data, err := rlp.EncodeToBytes(corrupt)
+	if err != nil {
+		log.Crit("Failed to encode corrupt ancients", "err", err)
+	}
+	if err := db.Put(corruptAncientsKey, data); err != nil {
+		log.Crit("Failed to store corrupt ancients", "err", err)
+	}
+}
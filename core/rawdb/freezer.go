@@ -272,6 +272,18 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// RepairAncient overwrites a corrupted item of the given table in place. The blob
+// is only accepted if it matches the checksum recorded when the item was frozen.
+func (f *freezer) RepairAncient(kind string, number uint64, blob []byte) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	if table := f.tables[kind]; table != nil {
+		return table.Patch(number, blob)
+	}
+	return errUnknownTable
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -20,15 +20,19 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/golang/snappy"
 )
 
@@ -43,30 +47,66 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errChecksumMismatch is returned if the data read from a checksummed freezer
+	// table does not match the checksum recorded when it was appended.
+	errChecksumMismatch = errors.New("checksum mismatch")
+)
+
+const (
+	// freezerTableV1 is the legacy table format, whose index entries only track
+	// the data file and offset of each item.
+	freezerTableV1 = uint16(1)
+
+	// freezerTableV2 extends every index entry with a CRC32 checksum of the item
+	// as stored on disk, allowing bit-rot to be detected on read.
+	freezerTableV2 = uint16(2)
+
+	// freezerTableVersion is the table format used for newly created tables.
+	freezerTableVersion = freezerTableV2
 )
 
+// crc32Table is the CRC32 (Castagnoli) table used to checksum freezer items.
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// freezerTableMeta is the metadata stored alongside a freezer table, tracking
+// the format version of its index and data files.
+type freezerTableMeta struct {
+	Version uint16
+}
+
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
-// offset within the file to the end of the data
+// offset within the file to the end of the data, and the checksum of the data.
 // In serialized form, the filenum is stored as uint16.
 type indexEntry struct {
-	filenum uint32 // stored as uint16 ( 2 bytes)
-	offset  uint32 // stored as uint32 ( 4 bytes)
+	filenum  uint32 // stored as uint16 ( 2 bytes)
+	offset   uint32 // stored as uint32 ( 4 bytes)
+	checksum uint32 // stored as uint32 ( 4 bytes, absent in v1 tables)
 }
 
-const indexEntrySize = 6
+const (
+	indexEntrySize       = 10 // Size of an index entry in the current table format
+	legacyIndexEntrySize = 6  // Size of an index entry in v1 tables, without checksum
+)
 
-// unmarshallBinary deserializes binary b into the rawIndex entry.
+// unmarshallBinary deserializes binary b into the rawIndex entry. The checksum
+// is only decoded if b is long enough to contain one.
 func (i *indexEntry) unmarshalBinary(b []byte) error {
 	i.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
 	i.offset = binary.BigEndian.Uint32(b[2:6])
+	if len(b) >= indexEntrySize {
+		i.checksum = binary.BigEndian.Uint32(b[6:10])
+	}
 	return nil
 }
 
-// marshallBinary serializes the rawIndex entry into binary.
+// marshallBinary serializes the rawIndex entry into binary. The v1 encoding is
+// a prefix of the returned blob.
 func (i *indexEntry) marshallBinary() []byte {
 	b := make([]byte, indexEntrySize)
 	binary.BigEndian.PutUint16(b[:2], uint16(i.filenum))
 	binary.BigEndian.PutUint32(b[2:6], i.offset)
+	binary.BigEndian.PutUint32(b[6:10], i.checksum)
 	return b
 }
 
@@ -94,6 +134,8 @@ type freezerTable struct {
 
 	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
 	maxFileSize   uint32 // Max file size for data-files
+	version       uint16 // Format version of the table files
+	entrySize     int64  // Size of a single index entry, depending on the version
 	name          string
 	path          string
 
@@ -152,6 +194,39 @@ func openFreezerFileTruncated(filename string) (*os.File, error) {
 	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 }
 
+// readTableMeta loads the format version of a freezer table from its metadata
+// file. If the metadata is missing, the table is either brand new, in which case
+// the metadata is created with the current version, or it predates versioning,
+// in which case it is a v1 table.
+func readTableMeta(path string, fresh bool) (uint16, error) {
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		var meta freezerTableMeta
+		if err := rlp.DecodeBytes(blob, &meta); err != nil {
+			return 0, err
+		}
+		if meta.Version != freezerTableV1 && meta.Version != freezerTableV2 {
+			return 0, fmt.Errorf("unsupported freezer table version %d", meta.Version)
+		}
+		return meta.Version, nil
+
+	case !os.IsNotExist(err):
+		return 0, err
+
+	case !fresh:
+		return freezerTableV1, nil
+	}
+	blob, err = rlp.EncodeToBytes(&freezerTableMeta{Version: freezerTableVersion})
+	if err != nil {
+		return 0, err
+	}
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		return 0, err
+	}
+	return freezerTableVersion, nil
+}
+
 // truncateFreezerFile resizes a freezer table file and seeks to the end
 func truncateFreezerFile(file *os.File, size int64) error {
 	if err := file.Truncate(size); err != nil {
@@ -172,13 +247,22 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
+	var idxName, metaName string
 	if noCompression {
 		// Raw idx
-		idxName = fmt.Sprintf("%s.ridx", name)
+		idxName, metaName = fmt.Sprintf("%s.ridx", name), fmt.Sprintf("%s.rmeta", name)
 	} else {
 		// Compressed idx
-		idxName = fmt.Sprintf("%s.cidx", name)
+		idxName, metaName = fmt.Sprintf("%s.cidx", name), fmt.Sprintf("%s.cmeta", name)
+	}
+	// Determine the table format before the index file gets created
+	var fresh bool
+	if stat, err := os.Stat(filepath.Join(path, idxName)); os.IsNotExist(err) || (err == nil && stat.Size() == 0) {
+		fresh = true
+	}
+	version, err := readTableMeta(filepath.Join(path, metaName), fresh)
+	if err != nil {
+		return nil, err
 	}
 	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
 	if err != nil {
@@ -196,6 +280,11 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 		logger:        log.New("database", path, "table", name),
 		noCompression: noCompression,
 		maxFileSize:   maxFilesize,
+		version:       version,
+		entrySize:     indexEntrySize,
+	}
+	if version == freezerTableV1 {
+		tab.entrySize = legacyIndexEntrySize
 	}
 	if err := tab.repair(); err != nil {
 		tab.Close()
@@ -216,7 +305,7 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
 	// Create a temporary offset buffer to init files with and read indexEntry into
-	buffer := make([]byte, indexEntrySize)
+	buffer := make([]byte, t.entrySize)
 
 	// If we've just created the files, initialize the index with the 0 indexEntry
 	stat, err := t.index.Stat()
@@ -228,8 +317,8 @@ func (t *freezerTable) repair() error {
 			return err
 		}
 	}
-	// Ensure the index is a multiple of indexEntrySize bytes
-	if overflow := stat.Size() % indexEntrySize; overflow != 0 {
+	// Ensure the index is a multiple of the index entry size
+	if overflow := stat.Size() % t.entrySize; overflow != 0 {
 		truncateFreezerFile(t.index, stat.Size()-overflow) // New file can't trigger this path
 	}
 	// Retrieve the file sizes and prepare for truncation
@@ -253,7 +342,7 @@ func (t *freezerTable) repair() error {
 	t.tailId = firstIndex.filenum
 	t.itemOffset = firstIndex.offset
 
-	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+	t.index.ReadAt(buffer, offsetsSize-t.entrySize)
 	lastIndex.unmarshalBinary(buffer)
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
@@ -279,11 +368,11 @@ func (t *freezerTable) repair() error {
 		// Truncate the index to point within the head file
 		if contentExp > contentSize {
 			t.logger.Warn("Truncating dangling indexes", "indexed", common.StorageSize(contentExp), "stored", common.StorageSize(contentSize))
-			if err := truncateFreezerFile(t.index, offsetsSize-indexEntrySize); err != nil {
+			if err := truncateFreezerFile(t.index, offsetsSize-t.entrySize); err != nil {
 				return err
 			}
-			offsetsSize -= indexEntrySize
-			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+			offsetsSize -= t.entrySize
+			t.index.ReadAt(buffer, offsetsSize-t.entrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
 			// We might have slipped back into an earlier head-file here
@@ -312,7 +401,7 @@ func (t *freezerTable) repair() error {
 		return err
 	}
 	// Update the item and byte counters and return
-	t.items = uint64(t.itemOffset) + uint64(offsetsSize/indexEntrySize-1) // last indexEntry points to the end of the data file
+	t.items = uint64(t.itemOffset) + uint64(offsetsSize/t.entrySize-1) // last indexEntry points to the end of the data file
 	t.headBytes = uint32(contentSize)
 	t.headId = lastIndex.filenum
 
@@ -320,7 +409,7 @@ func (t *freezerTable) repair() error {
 	if err := t.preopen(); err != nil {
 		return err
 	}
-	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes))
+	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes), "version", t.version)
 	return nil
 }
 
@@ -363,12 +452,12 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+	if err := truncateFreezerFile(t.index, int64(items+1)*t.entrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
-	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	buffer := make([]byte, t.entrySize)
+	if _, err := t.index.ReadAt(buffer, int64(items)*t.entrySize); err != nil {
 		return err
 	}
 	var expected indexEntry
@@ -549,11 +638,14 @@ func (t *freezerTable) append(item uint64, encodedBlob []byte, wlock bool) (bool
 		filenum: atomic.LoadUint32(&t.headId),
 		offset:  newOffset,
 	}
+	if t.version >= freezerTableV2 {
+		idx.checksum = crc32.Checksum(encodedBlob, crc32Table)
+	}
 	// Write indexEntry
-	t.index.Write(idx.marshallBinary())
+	t.index.Write(idx.marshallBinary()[:t.entrySize])
 
-	t.writeMeter.Mark(int64(bLen + indexEntrySize))
-	t.sizeGauge.Inc(int64(bLen + indexEntrySize))
+	t.writeMeter.Mark(int64(bLen) + t.entrySize)
+	t.sizeGauge.Inc(int64(bLen) + t.entrySize)
 
 	atomic.AddUint64(&t.items, 1)
 	return false, nil
@@ -569,18 +661,18 @@ func (t *freezerTable) getIndices(from, count uint64) ([]*indexEntry, error) {
 	// Apply the table-offset
 	from = from - uint64(t.itemOffset)
 	// For reading N items, we need N+1 indices.
-	buffer := make([]byte, (count+1)*indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(from*indexEntrySize)); err != nil {
+	buffer := make([]byte, int64(count+1)*t.entrySize)
+	if _, err := t.index.ReadAt(buffer, int64(from)*t.entrySize); err != nil {
 		return nil, err
 	}
 	var (
 		indices []*indexEntry
-		offset  int
+		offset  int64
 	)
 	for i := from; i <= from+count; i++ {
 		index := new(indexEntry)
-		index.unmarshalBinary(buffer[offset:])
-		offset += indexEntrySize
+		index.unmarshalBinary(buffer[offset : offset+t.entrySize])
+		offset += t.entrySize
 		indices = append(indices, index)
 	}
 	if from == 0 {
@@ -609,9 +701,11 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 // It will return at most 'max' items, but will abort earlier to respect the
 // 'maxBytes' argument. However, if the 'maxBytes' is smaller than the size of one
 // item, it _will_ return one element and possibly overflow the maxBytes.
+//
+// If the table carries checksums, every item is verified before being returned.
 func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, error) {
 	// First we read the 'raw' data, which might be compressed.
-	diskData, sizes, err := t.retrieveItems(start, count, maxBytes)
+	diskData, sizes, checksums, err := t.retrieveItems(start, count, maxBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -624,6 +718,10 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 	for i, diskSize := range sizes {
 		item := diskData[offset : offset+diskSize]
 		offset += diskSize
+		if checksums != nil && crc32.Checksum(item, crc32Table) != checksums[i] {
+			t.logger.Error("Corrupted freezer item", "number", start+uint64(i))
+			return nil, fmt.Errorf("%w: item %d", errChecksumMismatch, start+uint64(i))
+		}
 		decompressedSize := diskSize
 		if !t.noCompression {
 			decompressedSize, _ = snappy.DecodedLen(item)
@@ -647,19 +745,20 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 
 // retrieveItems reads up to 'count' items from the table. It reads at least
 // one item, but otherwise avoids reading more than maxBytes bytes.
-// It returns the (potentially compressed) data, and the sizes.
-func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []int, error) {
+// It returns the (potentially compressed) data, the sizes and, for checksummed
+// tables, the expected checksums.
+func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []int, []uint32, error) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
 	// Ensure the table and the item is accessible
 	if t.index == nil || t.head == nil {
-		return nil, nil, errClosed
+		return nil, nil, nil, errClosed
 	}
 	itemCount := atomic.LoadUint64(&t.items) // max number
 	// Ensure the start is written, not deleted from the tail, and that the
 	// caller actually wants something
 	if itemCount <= start || uint64(t.itemOffset) > start || count == 0 {
-		return nil, nil, errOutOfBounds
+		return nil, nil, nil, errOutOfBounds
 	}
 	if start+count > itemCount {
 		count = itemCount - start
@@ -688,10 +787,11 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 	// Read all the indexes in one go
 	indices, err := t.getIndices(start, count)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	var (
 		sizes      []int               // The sizes for each element
+		checksums  []uint32            // The checksums for each element (v2+ only)
 		totalSize  = 0                 // The total size of all data read so far
 		readStart  = indices[0].offset // Where, in the file, to start reading
 		unreadSize = 0                 // The size of the as-yet-unread data
@@ -707,7 +807,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 			// If we have unread data in the first file, we need to do that read now.
 			if unreadSize > 0 {
 				if err := readData(firstIndex.filenum, readStart, unreadSize); err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 				unreadSize = 0
 			}
@@ -718,7 +818,7 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 			// read this last item, but we need to do the deferred reads now.
 			if unreadSize > 0 {
 				if err := readData(secondIndex.filenum, readStart, unreadSize); err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 			}
 			break
@@ -727,15 +827,127 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 		unreadSize += size
 		totalSize += size
 		sizes = append(sizes, size)
+		if t.version >= freezerTableV2 {
+			checksums = append(checksums, secondIndex.checksum)
+		}
 		if i == len(indices)-2 || uint64(totalSize) > maxBytes {
 			// Last item, need to do the read now
 			if err := readData(secondIndex.filenum, readStart, unreadSize); err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			break
 		}
 	}
-	return output[:outputSize], sizes, nil
+	return output[:outputSize], sizes, checksums, nil
+}
+
+// verifyBatchSize is the number of items read in one go while verifying a table.
+const verifyBatchSize = 1024
+
+// Verify scans every item in the table and returns the (inclusive) ranges of
+// items whose stored data doesn't match its checksum or fails to decompress.
+// Legacy v1 tables carry no checksums, so for them only the decompression can
+// be checked.
+func (t *freezerTable) Verify() ([]AncientRange, error) {
+	var (
+		corrupt []AncientRange
+		logged  = time.Now()
+	)
+	mark := func(item uint64) {
+		if n := len(corrupt); n > 0 && corrupt[n-1].To+1 == item {
+			corrupt[n-1].To = item
+			return
+		}
+		corrupt = append(corrupt, AncientRange{From: item, To: item})
+	}
+	for item := uint64(t.itemOffset); item < atomic.LoadUint64(&t.items); {
+		data, sizes, checksums, err := t.retrieveItems(item, verifyBatchSize, 16*1024*1024)
+		if err != nil {
+			return corrupt, err
+		}
+		var offset int
+		for i, size := range sizes {
+			blob := data[offset : offset+size]
+			offset += size
+
+			if checksums != nil && crc32.Checksum(blob, crc32Table) != checksums[i] {
+				mark(item + uint64(i))
+				continue
+			}
+			if !t.noCompression {
+				if _, err := snappy.Decode(nil, blob); err != nil {
+					mark(item + uint64(i))
+				}
+			}
+		}
+		item += uint64(len(sizes))
+
+		if time.Since(logged) > 8*time.Second {
+			t.logger.Info("Verifying freezer table", "item", item, "items", atomic.LoadUint64(&t.items), "corrupt", len(corrupt))
+			logged = time.Now()
+		}
+	}
+	return corrupt, nil
+}
+
+// Patch overwrites the data of an already stored item in place, to heal it after
+// bit-rot. The replacement must encode to the exact same length and checksum as
+// the original item, so only checksummed tables can be patched.
+func (t *freezerTable) Patch(item uint64, blob []byte) error {
+	if t.version < freezerTableV2 {
+		return errNotSupported
+	}
+	if !t.noCompression {
+		blob = snappy.Encode(nil, blob)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table and the item is accessible
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= item || uint64(t.itemOffset) > item {
+		return errOutOfBounds
+	}
+	indices, err := t.getIndices(item, 1)
+	if err != nil {
+		return err
+	}
+	start, end, filenum := indices[0].bounds(indices[1])
+	if int(end-start) != len(blob) {
+		return fmt.Errorf("item size mismatch: have %d, want %d", len(blob), end-start)
+	}
+	if crc32.Checksum(blob, crc32Table) != indices[1].checksum {
+		return errChecksumMismatch
+	}
+	// Older data files are opened read only, so patch through a fresh handle
+	dataFile, exist := t.files[filenum]
+	if !exist {
+		return fmt.Errorf("missing data file %d", filenum)
+	}
+	file, err := os.OpenFile(dataFile.Name(), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteAt(blob, int64(start)); err != nil {
+		return err
+	}
+	t.logger.Info("Patched corrupted freezer item", "number", item)
+	return file.Sync()
+}
+
+// Items returns the number of items stored in the table, including the ones
+// deleted from the tail.
+func (t *freezerTable) Items() uint64 {
+	return atomic.LoadUint64(&t.items)
+}
+
+// Version returns the format version of the table.
+func (t *freezerTable) Version() uint16 {
+	return t.version
 }
 
 // has returns an indicator whether the specified number data
@@ -775,21 +987,21 @@ func (t *freezerTable) Sync() error {
 // DumpIndex is a debug print utility function, mainly for testing. It can also
 // be used to analyse a live freezer table index.
 func (t *freezerTable) DumpIndex(start, stop int64) {
-	buf := make([]byte, indexEntrySize)
+	buf := make([]byte, t.entrySize)
 
-	fmt.Printf("| number | fileno | offset |\n")
-	fmt.Printf("|--------|--------|--------|\n")
+	fmt.Printf("| number | fileno | offset | checksum |\n")
+	fmt.Printf("|--------|--------|--------|----------|\n")
 
 	for i := uint64(start); ; i++ {
-		if _, err := t.index.ReadAt(buf, int64(i*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buf, int64(i)*t.entrySize); err != nil {
 			break
 		}
 		var entry indexEntry
 		entry.unmarshalBinary(buf)
-		fmt.Printf("|  %03d   |  %03d   |  %03d   | \n", i, entry.filenum, entry.offset)
+		fmt.Printf("|  %03d   |  %03d   |  %03d   | %08x | \n", i, entry.filenum, entry.offset, entry.checksum)
 		if stop > 0 && i >= uint64(stop) {
 			break
 		}
 	}
-	fmt.Printf("|--------------------------|\n")
+	fmt.Printf("|-------------------------------------|\n")
 }
@@ -19,16 +19,19 @@ package rawdb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func init() {
@@ -807,3 +810,128 @@ func TestSequentialReadByteLimit(t *testing.T) {
 		}
 	}
 }
+
+// TestFreezerChecksum tests that corrupted items are detected by their checksum,
+// reported by the table verification and can be patched with the original data.
+func TestFreezerChecksum(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("checksum-%d", rand.Uint64())
+
+	{ // Fill table: 3 files with 5 items each
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 15; x++ {
+			f.Append(uint64(x), getChunk(10, x))
+		}
+		f.Close()
+	}
+	// Flip a byte in items 6 and 7 of the second file
+	p := filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))
+	file, err := os.OpenFile(p, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 13)
+	file.WriteAt([]byte{0xff}, 27)
+	file.Close()
+
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Retrieve(6); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("corrupted item retrieval error mismatch: have %v, want %v", err, errChecksumMismatch)
+	}
+	if _, err := f.RetrieveItems(4, 5, 1000); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("corrupted batch retrieval error mismatch: have %v, want %v", err, errChecksumMismatch)
+	}
+	if _, err := f.Retrieve(8); err != nil {
+		t.Fatalf("failed to retrieve intact item: %v", err)
+	}
+	corrupt, err := f.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify table: %v", err)
+	}
+	if want := []AncientRange{{From: 6, To: 7}}; !reflect.DeepEqual(corrupt, want) {
+		t.Fatalf("corrupt ranges mismatch: have %v, want %v", corrupt, want)
+	}
+	// Patching with different data must be rejected, the original accepted
+	if err := f.Patch(6, getChunk(10, 0xaa)); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("invalid patch error mismatch: have %v, want %v", err, errChecksumMismatch)
+	}
+	if err := f.Patch(6, getChunk(11, 6)); err == nil {
+		t.Fatalf("oversized patch accepted")
+	}
+	for x := 6; x < 8; x++ {
+		if err := f.Patch(uint64(x), getChunk(10, x)); err != nil {
+			t.Fatalf("failed to patch item %d: %v", x, err)
+		}
+	}
+	for x := 0; x < 15; x++ {
+		have, err := f.Retrieve(uint64(x))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", x, err)
+		}
+		if want := getChunk(10, x); !bytes.Equal(have, want) {
+			t.Fatalf("item %d mismatch: have %x, want %x", x, have, want)
+		}
+	}
+	if corrupt, err = f.Verify(); err != nil || len(corrupt) != 0 {
+		t.Fatalf("patched table verification failed: %v, %v", corrupt, err)
+	}
+}
+
+// TestFreezerLegacyTable tests that tables created before checksums were added
+// are still opened with their original index format.
+func TestFreezerLegacyTable(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("legacy-%d", rand.Uint64())
+	meta := filepath.Join(os.TempDir(), fmt.Sprintf("%s.cmeta", fname))
+
+	{ // Create a v1 table and drop its metadata, as legacy tables had none
+		blob, _ := rlp.EncodeToBytes(&freezerTableMeta{Version: freezerTableV1})
+		if err := ioutil.WriteFile(meta, blob, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 10; x++ {
+			f.Append(uint64(x), getChunk(20, x))
+		}
+		f.Close()
+		os.Remove(meta)
+	}
+	p := filepath.Join(os.TempDir(), fmt.Sprintf("%s.cidx", fname))
+	if err := assertFileSize(p, 11*legacyIndexEntrySize); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.Version() != freezerTableV1 {
+		t.Fatalf("table version mismatch: have %d, want %d", f.Version(), freezerTableV1)
+	}
+	for x := 0; x < 10; x++ {
+		have, err := f.Retrieve(uint64(x))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", x, err)
+		}
+		if want := getChunk(20, x); !bytes.Equal(have, want) {
+			t.Fatalf("item %d mismatch: have %x, want %x", x, have, want)
+		}
+	}
+	if err := f.Patch(0, getChunk(20, 0)); err != errNotSupported {
+		t.Fatalf("legacy patch error mismatch: have %v, want %v", err, errNotSupported)
+	}
+}
@@ -92,6 +92,12 @@ func (t *table) TruncateAncients(items uint64) error {
 	return t.db.TruncateAncients(items)
 }
 
+// RepairAncient is a noop passthrough that just forwards the request to the
+// underlying database.
+func (t *table) RepairAncient(kind string, number uint64, blob []byte) error {
+	return t.db.RepairAncient(kind, number, blob)
+}
+
 // Sync is a noop passthrough that just forwards the request to the underlying
 // database.
 func (t *table) Sync() error {
@@ -0,0 +1,538 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+)
+
+const (
+	// exportVersion is the version of the portable snapshot format.
+	exportVersion = 1
+
+	// exportMaxChunkSize is the maximum size of a single compressed chunk that
+	// an import accepts, protecting against memory exhaustion on corrupt files.
+	exportMaxChunkSize = 64 * 1024 * 1024
+)
+
+// exportMagic is the prefix identifying a portable snapshot file.
+var exportMagic = []byte("GETHSNAP")
+
+// Chunk kinds contained in a portable snapshot file.
+const (
+	exportAccountChunk = iota // Range of accounts, proven against the state root
+	exportStorageChunk        // Range of storage slots, proven against an account's storage root
+	exportCodeChunk           // Contract codes referenced by the preceding accounts
+)
+
+// exportHeader is the first chunk of a portable snapshot file.
+type exportHeader struct {
+	Version uint64
+	Root    common.Hash
+}
+
+// exportChunk is a batch of state data in a portable snapshot file. Account and
+// storage chunks carry the edge proofs of their range, starting from the key
+// following the previous chunk of the same trie.
+//
+// The chunks of a file are ordered so that every account chunk is followed by
+// the storage chunks of its contracts and the codes they reference.
+type exportChunk struct {
+	Kind    uint64
+	Account common.Hash   // Owner account of a storage chunk
+	Keys    []common.Hash // Account hashes, slot hashes or code hashes
+	Vals    [][]byte      // Consensus encoded accounts, storage values or codes
+	Proof   [][]byte      // Edge proof nodes of the key range
+}
+
+// Export serializes the entire state at the given root into a versioned, chunked
+// and compressed portable format, which can be imported offline into another
+// node with Import. Each chunk holds at most chunkItems entries.
+func Export(w io.Writer, snaptree *Tree, root common.Hash, chunkItems int) error {
+	if chunkItems <= 0 {
+		return errors.New("invalid chunk size")
+	}
+	triedb := snaptree.triedb
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	accIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err
+	}
+	defer accIt.Release()
+
+	out := bufio.NewWriter(w)
+	if _, err := out.Write(exportMagic); err != nil {
+		return err
+	}
+	if err := writeExportChunk(out, &exportHeader{Version: exportVersion, Root: root}); err != nil {
+		return err
+	}
+	var (
+		start    = time.Now()
+		logged   = time.Now()
+		accounts uint64
+		slots    uint64
+		origin   common.Hash
+		done     bool
+	)
+	for !done {
+		// Gather the next range of accounts
+		chunk := &exportChunk{Kind: exportAccountChunk}
+		for len(chunk.Keys) < chunkItems {
+			if !accIt.Next() {
+				done = true
+				break
+			}
+			full, err := FullAccountRLP(accIt.Account())
+			if err != nil {
+				return err
+			}
+			chunk.Keys = append(chunk.Keys, accIt.Hash())
+			chunk.Vals = append(chunk.Vals, full)
+		}
+		if err := accIt.Error(); err != nil {
+			return err
+		}
+		if len(chunk.Keys) == 0 {
+			break
+		}
+		if chunk.Proof, err = proveRange(accTrie, origin, chunk.Keys[len(chunk.Keys)-1]); err != nil {
+			return err
+		}
+		if err := writeExportChunk(out, chunk); err != nil {
+			return err
+		}
+		accounts += uint64(len(chunk.Keys))
+		origin = nextKey(chunk.Keys[len(chunk.Keys)-1])
+
+		// Export the storage and codes of the contracts in the range
+		codes := &exportChunk{Kind: exportCodeChunk}
+		for i, hash := range chunk.Keys {
+			var acc Account
+			if err := rlp.DecodeBytes(chunk.Vals[i], &acc); err != nil {
+				return err
+			}
+			if codeHash := common.BytesToHash(acc.CodeHash); codeHash != emptyCode {
+				code := rawdb.ReadCode(triedb.DiskDB(), codeHash)
+				if len(code) == 0 {
+					return fmt.Errorf("missing code %x", codeHash)
+				}
+				codes.Keys = append(codes.Keys, codeHash)
+				codes.Vals = append(codes.Vals, code)
+			}
+			if storageRoot := common.BytesToHash(acc.Root); storageRoot != emptyRoot {
+				n, err := exportStorage(out, snaptree, root, hash, storageRoot, chunkItems)
+				if err != nil {
+					return err
+				}
+				slots += n
+			}
+		}
+		if len(codes.Keys) > 0 {
+			if err := writeExportChunk(out, codes); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state snapshot", "at", origin, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Exported state snapshot", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return out.Flush()
+}
+
+// exportStorage writes the storage slots of a single contract as a sequence of
+// proven storage chunks, returning the number of exported slots.
+func exportStorage(out io.Writer, snaptree *Tree, root common.Hash, account common.Hash, storageRoot common.Hash, chunkItems int) (uint64, error) {
+	stTrie, err := trie.New(storageRoot, snaptree.triedb)
+	if err != nil {
+		return 0, err
+	}
+	stIt, err := snaptree.StorageIterator(root, account, common.Hash{})
+	if err != nil {
+		return 0, err
+	}
+	defer stIt.Release()
+
+	var (
+		slots  uint64
+		origin common.Hash
+		done   bool
+	)
+	for !done {
+		chunk := &exportChunk{Kind: exportStorageChunk, Account: account}
+		for len(chunk.Keys) < chunkItems {
+			if !stIt.Next() {
+				done = true
+				break
+			}
+			chunk.Keys = append(chunk.Keys, stIt.Hash())
+			chunk.Vals = append(chunk.Vals, common.CopyBytes(stIt.Slot()))
+		}
+		if err := stIt.Error(); err != nil {
+			return 0, err
+		}
+		if len(chunk.Keys) == 0 {
+			break
+		}
+		if chunk.Proof, err = proveRange(stTrie, origin, chunk.Keys[len(chunk.Keys)-1]); err != nil {
+			return 0, err
+		}
+		if err := writeExportChunk(out, chunk); err != nil {
+			return 0, err
+		}
+		slots += uint64(len(chunk.Keys))
+		origin = nextKey(chunk.Keys[len(chunk.Keys)-1])
+	}
+	return slots, nil
+}
+
+// proveRange collects the edge proof nodes of a key range within a trie.
+func proveRange(tr *trie.Trie, origin common.Hash, last common.Hash) ([][]byte, error) {
+	proof := memorydb.New()
+	if err := tr.Prove(origin[:], 0, proof); err != nil {
+		return nil, err
+	}
+	if err := tr.Prove(last[:], 0, proof); err != nil {
+		return nil, err
+	}
+	var nodes [][]byte
+	it := proof.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		nodes = append(nodes, common.CopyBytes(it.Value()))
+	}
+	return nodes, it.Error()
+}
+
+// verifyRange checks that the keys and values of a chunk are the complete set
+// of trie entries between origin and the last key.
+func verifyRange(root common.Hash, origin common.Hash, chunk *exportChunk) error {
+	keys := make([][]byte, len(chunk.Keys))
+	for i, key := range chunk.Keys {
+		keys[i] = common.CopyBytes(key[:])
+	}
+	proof := memorydb.New()
+	for _, node := range chunk.Proof {
+		proof.Put(crypto.Keccak256(node), node)
+	}
+	_, err := trie.VerifyRangeProof(root, origin[:], keys[len(keys)-1], keys, chunk.Vals, proof)
+	return err
+}
+
+// nextKey returns the key directly following the given one, or the zero hash if
+// the key is the last possible one.
+func nextKey(key common.Hash) common.Hash {
+	next := common.CopyBytes(key[:])
+	increaseKey(next)
+	return common.BytesToHash(next)
+}
+
+// writeExportChunk RLP encodes, compresses and writes a length prefixed chunk.
+func writeExportChunk(w io.Writer, chunk interface{}) error {
+	blob, err := rlp.EncodeToBytes(chunk)
+	if err != nil {
+		return err
+	}
+	blob = snappy.Encode(nil, blob)
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(blob)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(blob)
+	return err
+}
+
+// readExportChunk reads, decompresses and RLP decodes a length prefixed chunk.
+func readExportChunk(r io.Reader, chunk interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > exportMaxChunkSize {
+		return fmt.Errorf("chunk too large: %d bytes", length)
+	}
+	blob := make([]byte, length)
+	if _, err := io.ReadFull(r, blob); err != nil {
+		return err
+	}
+	blob, err := snappy.Decode(nil, blob)
+	if err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(blob, chunk)
+}
+
+// importer tracks the progress of a snapshot import, regenerating the tries with
+// stack tries as the chunks are streamed in.
+type importer struct {
+	db    ethdb.KeyValueStore
+	batch ethdb.Batch
+	root  common.Hash
+	stale bool // Whether the database contained flat state before the import
+
+	accTrie   *trie.StackTrie
+	accOrigin common.Hash // Key following the last imported account
+
+	storage map[common.Hash]common.Hash // Storage roots of the last account chunk's contracts
+	codes   map[common.Hash]struct{}    // Codes referenced by the last account chunk
+
+	owner     common.Hash     // Contract whose storage is being imported
+	stTrie    *trie.StackTrie // Storage trie of the contract being imported
+	stOrigin  common.Hash     // Key following the last imported slot of the contract
+	completed map[common.Hash]struct{}
+
+	accounts, slots, bytes uint64
+}
+
+// Import reads a portable snapshot file created by Export, verifying every chunk
+// against the state root it was exported for. The flat snapshot is written into
+// the database along with the regenerated account and storage tries, and the
+// code of all contracts. The root of the imported state is returned.
+//
+// The snapshot in the database is only marked complete once the whole file has
+// been verified, so an aborted import is regenerated on the next startup. If the
+// database already contained flat state, the imported snapshot is marked for
+// regeneration too, which verifies it against the tries and drops stale entries.
+func Import(r io.Reader, db ethdb.KeyValueStore) (common.Hash, error) {
+	in := bufio.NewReader(r)
+
+	magic := make([]byte, len(exportMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		return common.Hash{}, err
+	}
+	if !bytes.Equal(magic, exportMagic) {
+		return common.Hash{}, errors.New("not a snapshot export")
+	}
+	var header exportHeader
+	if err := readExportChunk(in, &header); err != nil {
+		return common.Hash{}, err
+	}
+	if header.Version != exportVersion {
+		return common.Hash{}, fmt.Errorf("unsupported snapshot export version %d", header.Version)
+	}
+	// Drop any previous snapshot, the flat state is about to be overwritten
+	it := db.NewIterator(rawdb.SnapshotAccountPrefix, nil)
+	stale := it.Next() && len(it.Key()) == len(rawdb.SnapshotAccountPrefix)+common.HashLength
+	it.Release()
+
+	rawdb.DeleteSnapshotRoot(db)
+	rawdb.DeleteSnapshotJournal(db)
+
+	imp := &importer{
+		db:        db,
+		batch:     db.NewBatch(),
+		root:      header.Root,
+		stale:     stale,
+		storage:   make(map[common.Hash]common.Hash),
+		codes:     make(map[common.Hash]struct{}),
+		completed: make(map[common.Hash]struct{}),
+	}
+	imp.accTrie = trie.NewStackTrie(imp.batch)
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for {
+		chunk := new(exportChunk)
+		if err := readExportChunk(in, chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, err
+		}
+		if err := imp.process(chunk); err != nil {
+			return common.Hash{}, err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state snapshot", "at", imp.accOrigin, "accounts", imp.accounts, "slots", imp.slots, "size", common.StorageSize(imp.bytes), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := imp.finalize(); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Imported state snapshot", "root", header.Root, "accounts", imp.accounts, "slots", imp.slots, "size", common.StorageSize(imp.bytes), "elapsed", common.PrettyDuration(time.Since(start)))
+	return header.Root, nil
+}
+
+// process verifies a single chunk and writes its content into the database.
+func (imp *importer) process(chunk *exportChunk) error {
+	if len(chunk.Keys) != len(chunk.Vals) || len(chunk.Keys) == 0 {
+		return errors.New("malformed chunk")
+	}
+	switch chunk.Kind {
+	case exportAccountChunk:
+		// All the data belonging to the previous accounts must be complete
+		if err := imp.closeAccounts(); err != nil {
+			return err
+		}
+		if err := verifyRange(imp.root, imp.accOrigin, chunk); err != nil {
+			return fmt.Errorf("invalid account chunk at %x: %v", imp.accOrigin, err)
+		}
+		for i, hash := range chunk.Keys {
+			var acc Account
+			if err := rlp.DecodeBytes(chunk.Vals[i], &acc); err != nil {
+				return err
+			}
+			if err := imp.accTrie.TryUpdate(hash[:], chunk.Vals[i]); err != nil {
+				return err
+			}
+			rawdb.WriteAccountSnapshot(imp.batch, hash, SlimAccountRLP(acc.Nonce, acc.Balance, common.BytesToHash(acc.Root), acc.CodeHash))
+
+			if root := common.BytesToHash(acc.Root); root != emptyRoot {
+				imp.storage[hash] = root
+			}
+			if codeHash := common.BytesToHash(acc.CodeHash); codeHash != emptyCode {
+				imp.codes[codeHash] = struct{}{}
+			}
+		}
+		imp.accounts += uint64(len(chunk.Keys))
+		imp.accOrigin = nextKey(chunk.Keys[len(chunk.Keys)-1])
+
+	case exportStorageChunk:
+		root, ok := imp.storage[chunk.Account]
+		if !ok {
+			return fmt.Errorf("unexpected storage for account %x", chunk.Account)
+		}
+		if _, done := imp.completed[chunk.Account]; done {
+			return fmt.Errorf("interleaved storage for account %x", chunk.Account)
+		}
+		if chunk.Account != imp.owner || imp.stTrie == nil {
+			if err := imp.closeStorage(); err != nil {
+				return err
+			}
+			imp.owner, imp.stOrigin = chunk.Account, common.Hash{}
+			imp.stTrie = trie.NewStackTrie(imp.batch)
+		}
+		if err := verifyRange(root, imp.stOrigin, chunk); err != nil {
+			return fmt.Errorf("invalid storage chunk of %x at %x: %v", chunk.Account, imp.stOrigin, err)
+		}
+		for i, hash := range chunk.Keys {
+			if err := imp.stTrie.TryUpdate(hash[:], chunk.Vals[i]); err != nil {
+				return err
+			}
+			rawdb.WriteStorageSnapshot(imp.batch, chunk.Account, hash, chunk.Vals[i])
+		}
+		imp.slots += uint64(len(chunk.Keys))
+		imp.stOrigin = nextKey(chunk.Keys[len(chunk.Keys)-1])
+
+	case exportCodeChunk:
+		for i, hash := range chunk.Keys {
+			if crypto.Keccak256Hash(chunk.Vals[i]) != hash {
+				return fmt.Errorf("invalid code %x", hash)
+			}
+			rawdb.WriteCode(imp.batch, hash, chunk.Vals[i])
+			delete(imp.codes, hash)
+		}
+
+	default:
+		return fmt.Errorf("unknown chunk kind %d", chunk.Kind)
+	}
+	for _, val := range chunk.Vals {
+		imp.bytes += uint64(len(val))
+	}
+	if imp.batch.ValueSize() > ethdb.IdealBatchSize {
+		if err := imp.batch.Write(); err != nil {
+			return err
+		}
+		imp.batch.Reset()
+	}
+	return nil
+}
+
+// closeStorage commits the storage trie being imported, checking that it was
+// delivered completely.
+func (imp *importer) closeStorage() error {
+	if imp.stTrie == nil {
+		return nil
+	}
+	root, err := imp.stTrie.Commit()
+	if err != nil {
+		return err
+	}
+	if want := imp.storage[imp.owner]; root != want {
+		return fmt.Errorf("incomplete storage for account %x: have root %x, want %x", imp.owner, root, want)
+	}
+	imp.completed[imp.owner] = struct{}{}
+	imp.stTrie = nil
+	return nil
+}
+
+// closeAccounts checks that all the storage and codes referenced by the last
+// account chunk were imported.
+func (imp *importer) closeAccounts() error {
+	if err := imp.closeStorage(); err != nil {
+		return err
+	}
+	for account := range imp.storage {
+		if _, ok := imp.completed[account]; !ok {
+			return fmt.Errorf("missing storage for account %x", account)
+		}
+	}
+	for hash := range imp.codes {
+		return fmt.Errorf("missing code %x", hash)
+	}
+	imp.storage = make(map[common.Hash]common.Hash)
+	imp.completed = make(map[common.Hash]struct{})
+	return nil
+}
+
+// finalize checks the regenerated state root and marks the snapshot complete.
+func (imp *importer) finalize() error {
+	if err := imp.closeAccounts(); err != nil {
+		return err
+	}
+	root, err := imp.accTrie.Commit()
+	if err != nil {
+		return err
+	}
+	if root != imp.root {
+		return fmt.Errorf("state root mismatch: have %x, want %x", root, imp.root)
+	}
+	rawdb.WriteSnapshotRoot(imp.batch, imp.root)
+	if imp.stale {
+		journalProgress(imp.batch, []byte{}, nil)
+	} else {
+		journalProgress(imp.batch, nil, nil)
+	}
+	return imp.batch.Write()
+}
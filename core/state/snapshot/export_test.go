@@ -0,0 +1,163 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeExportState creates a state with a few dozen accounts, some of them with
+// code and storage, and returns a snapshot tree built on top of it.
+func makeExportState(t *testing.T) (*Tree, common.Hash) {
+	helper := newHelper()
+	for i := 0; i < 40; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()}
+		if i%3 == 0 {
+			var keys, vals []string
+			for j := 0; j < 10+i; j++ {
+				keys = append(keys, fmt.Sprintf("key-%d-%d", i, j))
+				vals = append(vals, fmt.Sprintf("val-%d-%d", i, j))
+			}
+			acc.Root = helper.makeStorageTrie(keys, vals)
+			helper.addSnapStorage(fmt.Sprintf("acc-%d", i), keys, vals)
+		}
+		if i%5 == 0 {
+			code := []byte(fmt.Sprintf("code-%d", i))
+			acc.CodeHash = crypto.Keccak256(code)
+			rawdb.WriteCode(helper.diskdb, common.BytesToHash(acc.CodeHash), code)
+		}
+		helper.addAccount(fmt.Sprintf("acc-%d", i), acc)
+	}
+	root, snap := helper.Generate()
+	select {
+	case <-snap.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Snapshot generation failed")
+	}
+	return &Tree{
+		diskdb: helper.diskdb,
+		triedb: helper.triedb,
+		layers: map[common.Hash]snapshot{root: snap},
+	}, root
+}
+
+// Tests that a state exported into the portable format can be imported into an
+// empty database, regenerating both the tries and the flat snapshot.
+func TestExportImport(t *testing.T) {
+	snaps, root := makeExportState(t)
+
+	for _, chunkItems := range []int{1, 4, 1000} {
+		var buf bytes.Buffer
+		if err := Export(&buf, snaps, root, chunkItems); err != nil {
+			t.Fatalf("chunk %d: failed to export state: %v", chunkItems, err)
+		}
+		db := memorydb.New()
+		imported, err := Import(bytes.NewReader(buf.Bytes()), db)
+		if err != nil {
+			t.Fatalf("chunk %d: failed to import state: %v", chunkItems, err)
+		}
+		if imported != root {
+			t.Fatalf("chunk %d: root mismatch: have %x, want %x", chunkItems, imported, root)
+		}
+		// The regenerated tries must be complete, the snapshot must be usable
+		triedb := trie.NewDatabase(db)
+		tr, err := trie.NewSecure(root, triedb)
+		if err != nil {
+			t.Fatalf("chunk %d: failed to open imported trie: %v", chunkItems, err)
+		}
+		accIt := trie.NewIterator(tr.NodeIterator(nil))
+		for accIt.Next() {
+		}
+		if accIt.Err != nil {
+			t.Fatalf("chunk %d: imported trie incomplete: %v", chunkItems, accIt.Err)
+		}
+		snaps, err := New(db, triedb, 16, root, false, false, false)
+		if err != nil {
+			t.Fatalf("chunk %d: failed to load imported snapshot: %v", chunkItems, err)
+		}
+		if err := snaps.Verify(root); err != nil {
+			t.Fatalf("chunk %d: imported snapshot invalid: %v", chunkItems, err)
+		}
+		if code := rawdb.ReadCode(db, crypto.Keccak256Hash([]byte("code-35"))); string(code) != "code-35" {
+			t.Fatalf("chunk %d: code mismatch: have %q", chunkItems, code)
+		}
+	}
+}
+
+// Tests that tampered exports are rejected.
+func TestImportTampered(t *testing.T) {
+	snaps, root := makeExportState(t)
+
+	var buf bytes.Buffer
+	if err := Export(&buf, snaps, root, 4); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	blob := buf.Bytes()
+
+	// Truncate the export at various positions
+	for cut := len(blob) / 2; cut < len(blob); cut += len(blob)/64 + 1 {
+		if _, err := Import(bytes.NewReader(blob[:cut]), memorydb.New()); err == nil {
+			t.Fatalf("truncated export at %d/%d accepted", cut, len(blob))
+		}
+	}
+	// Replace an account chunk with a chunk proving a different range
+	var (
+		r      = bytes.NewReader(blob[len(exportMagic):])
+		header exportHeader
+		chunks []*exportChunk
+	)
+	readExportChunk(r, &header)
+	for r.Len() > 0 {
+		chunk := new(exportChunk)
+		if err := readExportChunk(r, chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	for i, chunk := range chunks {
+		if chunk.Kind != exportAccountChunk || len(chunk.Keys) < 2 {
+			continue
+		}
+		tampered := *chunk
+		tampered.Keys = chunk.Keys[1:]
+		tampered.Vals = chunk.Vals[1:]
+
+		var out bytes.Buffer
+		out.Write(exportMagic)
+		writeExportChunk(&out, &header)
+		for j, chunk := range chunks {
+			if i == j {
+				chunk = &tampered
+			}
+			writeExportChunk(&out, chunk)
+		}
+		if _, err := Import(&out, memorydb.New()); err == nil {
+			t.Fatalf("export with dropped account in chunk %d accepted", i)
+		}
+		break
+	}
+}
@@ -18,10 +18,14 @@
 package state
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
+	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -74,6 +78,9 @@ type StateDB struct {
 	snapAccounts  map[common.Hash][]byte
 	snapStorage   map[common.Hash]map[common.Hash][]byte
 
+	workers     int        // Number of workers to update, hash and commit storage tries with
+	storageLock sync.Mutex // Lock protecting the shared fields during concurrent storage trie updates
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects        map[common.Address]*stateObject
 	stateObjectsPending map[common.Address]struct{} // State objects finalized but not yet written to the trie
@@ -117,6 +124,9 @@ type StateDB struct {
 	SnapshotAccountReads time.Duration
 	SnapshotStorageReads time.Duration
 	SnapshotCommits      time.Duration
+
+	StorageTries    int           // Number of storage tries updated and hashed
+	StorageParallel time.Duration // Time spent updating and hashing the storage tries concurrently
 }
 
 // New creates a new state from a given trie.
@@ -138,6 +148,7 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 		journal:             newJournal(),
 		accessList:          newAccessList(),
 		hasher:              crypto.NewKeccakState(),
+		workers:             runtime.GOMAXPROCS(0),
 	}
 	if sdb.snaps != nil {
 		if sdb.snap = sdb.snaps.Snapshot(root); sdb.snap != nil {
@@ -658,6 +669,7 @@ func (s *StateDB) Copy() *StateDB {
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
+		workers:             s.workers,
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range s.journal.dirties {
@@ -843,11 +855,31 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	// the account prefetcher. Instead, let's process all the storage updates
 	// first, giving the account prefeches just a few more milliseconds of time
 	// to pull useful data from disk.
+	//
+	// The storage tries are independent of each other, so they are updated and
+	// hashed concurrently. Since every trie yields the same root regardless of
+	// the order the tries are processed in, the result is deterministic.
+	objs := make([]*stateObject, 0, len(s.stateObjectsPending))
 	for addr := range s.stateObjectsPending {
 		if obj := s.stateObjects[addr]; !obj.deleted {
-			obj.updateRoot(s.db)
+			objs = append(objs, obj)
 		}
 	}
+	s.openStorageTries(objs)
+
+	start := time.Now()
+	s.forEachObject(objs, func(obj *stateObject) { obj.updateTrie(s.db) })
+	if metrics.EnabledExpensive {
+		s.StorageUpdates += time.Since(start)
+	}
+	hashStart := time.Now()
+	s.forEachObject(objs, func(obj *stateObject) { obj.updateRoot(s.db) })
+	if metrics.EnabledExpensive {
+		s.StorageHashes += time.Since(hashStart)
+		s.StorageParallel += time.Since(start)
+	}
+	s.StorageTries += len(objs)
+
 	// Now we're about to start to write changes to the trie. The trie is so far
 	// _untouched_. We can check with the prefetcher, if it can give us a trie
 	// which has the same root, but also has some content loaded into it.
@@ -878,6 +910,51 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	return s.trie.Hash()
 }
 
+// openStorageTries opens the storage tries of the objects having storage changes.
+// The tries are retrieved from the prefetcher, which is not thread safe, so they
+// need to be opened before the objects are processed concurrently.
+func (s *StateDB) openStorageTries(objs []*stateObject) {
+	for _, obj := range objs {
+		obj.finalise(false)
+		if len(obj.pendingStorage) > 0 {
+			obj.getTrie(s.db)
+		}
+	}
+}
+
+// forEachObject runs fn on all the given state objects, spreading the calls over
+// the storage workers of the statedb. The calls must be independent of each other.
+func (s *StateDB) forEachObject(objs []*stateObject, fn func(obj *stateObject)) {
+	workers := s.workers
+	if workers > len(objs) {
+		workers = len(objs)
+	}
+	if workers <= 1 {
+		for _, obj := range objs {
+			fn(obj)
+		}
+		return
+	}
+	var (
+		next = int32(-1)
+		wg   sync.WaitGroup
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				idx := int(atomic.AddInt32(&next, 1))
+				if idx >= len(objs) {
+					return
+				}
+				fn(objs[idx])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 // Prepare sets the current transaction hash and index which are
 // used when the EVM emits new state logs.
 func (s *StateDB) Prepare(thash common.Hash, ti int) {
@@ -903,7 +980,10 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	s.IntermediateRoot(deleteEmptyObjects)
 
 	// Commit objects to the trie, measuring the elapsed time
-	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	var (
+		codeWriter = s.db.TrieDB().DiskDB().NewBatch()
+		objs       = make([]*stateObject, 0, len(s.stateObjectsDirty))
+	)
 	for addr := range s.stateObjectsDirty {
 		if obj := s.stateObjects[addr]; !obj.deleted {
 			// Write any contract code associated with the state object
@@ -911,10 +991,31 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 				rawdb.WriteCode(codeWriter, common.BytesToHash(obj.CodeHash()), obj.code)
 				obj.dirtyCode = false
 			}
-			// Write any storage changes in the state object to its storage trie
-			if err := obj.CommitTrie(s.db); err != nil {
-				return common.Hash{}, err
-			}
+			objs = append(objs, obj)
+		}
+	}
+	// Write the storage changes of all objects into their storage tries. The
+	// objects are sorted, so that the same error is reported on every run.
+	sort.Slice(objs, func(i, j int) bool {
+		return bytes.Compare(objs[i].address[:], objs[j].address[:]) < 0
+	})
+	var (
+		start = time.Now()
+		errs  = make(map[*stateObject]error)
+	)
+	s.forEachObject(objs, func(obj *stateObject) {
+		if err := obj.CommitTrie(s.db); err != nil {
+			s.storageLock.Lock()
+			errs[obj] = err
+			s.storageLock.Unlock()
+		}
+	})
+	if metrics.EnabledExpensive {
+		s.StorageCommits += time.Since(start)
+	}
+	for _, obj := range objs {
+		if err := errs[obj]; err != nil {
+			return common.Hash{}, err
 		}
 	}
 	if len(s.stateObjectsDirty) > 0 {
@@ -926,7 +1027,6 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		}
 	}
 	// Write the account trie changes, measuing the amount of wasted time
-	var start time.Time
 	if metrics.EnabledExpensive {
 		start = time.Now()
 	}
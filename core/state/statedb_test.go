@@ -742,6 +742,115 @@ func TestMissingTrieNodes(t *testing.T) {
 	}
 }
 
+// fillStorage writes the given number of slots into the storage of the given
+// number of accounts, on top of the state created with the given salt.
+func fillStorage(state *StateDB, accounts, slots int, salt byte) {
+	for i := 0; i < accounts; i++ {
+		addr := common.BytesToAddress([]byte{byte(i >> 8), byte(i)})
+		state.SetBalance(addr, big.NewInt(int64(i+1)))
+		for j := 0; j < slots; j++ {
+			key := common.BytesToHash([]byte{byte(j >> 8), byte(j)})
+			// Delete every 7th slot after the first round to exercise node collapses
+			if salt > 0 && j%7 == 0 {
+				state.SetState(addr, key, common.Hash{})
+				continue
+			}
+			state.SetState(addr, key, common.BytesToHash([]byte{salt, byte(i), byte(j)}))
+		}
+	}
+}
+
+// Tests that updating, hashing and committing the storage tries concurrently
+// yields the same results as doing so sequentially.
+func TestConcurrentStorageTries(t *testing.T) {
+	var roots [][]common.Hash
+	for _, workers := range []int{1, 4, 16} {
+		db := NewDatabase(rawdb.NewMemoryDatabase())
+		state, _ := New(common.Hash{}, db, nil)
+		state.workers = workers
+
+		var results []common.Hash
+		for round := byte(0); round < 3; round++ {
+			fillStorage(state, 64, 32, round)
+			results = append(results, state.IntermediateRoot(false))
+
+			root, err := state.Commit(false)
+			if err != nil {
+				t.Fatalf("workers %d, round %d: failed to commit: %v", workers, round, err)
+			}
+			results = append(results, root)
+			state, _ = New(root, db, nil)
+			state.workers = workers
+		}
+		roots = append(roots, results)
+	}
+	for i := 1; i < len(roots); i++ {
+		if !reflect.DeepEqual(roots[0], roots[i]) {
+			t.Errorf("root mismatch: have %x, want %x", roots[i], roots[0])
+		}
+	}
+}
+
+// Tests that storage tries sharing their root are concurrently updated correctly
+// when they are retrieved from the prefetcher.
+func TestConcurrentStorageTriesPrefetched(t *testing.T) {
+	db := NewDatabase(rawdb.NewMemoryDatabase())
+	state, _ := New(common.Hash{}, db, nil)
+	for i := 0; i < 256; i++ {
+		addr := common.BytesToAddress([]byte{byte(i >> 8), byte(i)})
+		state.SetBalance(addr, big.NewInt(1))
+		for j := 0; j < 16; j++ {
+			state.SetState(addr, common.BytesToHash([]byte{byte(j)}), common.BytesToHash([]byte{1, byte(j)}))
+		}
+	}
+	root, _ := state.Commit(false)
+
+	var roots []common.Hash
+	for _, prefetch := range []bool{false, true} {
+		state, _ := New(root, db, nil)
+		state.workers = 64
+		if prefetch {
+			state.StartPrefetcher("test")
+		}
+		for i := 0; i < 256; i++ {
+			addr := common.BytesToAddress([]byte{byte(i >> 8), byte(i)})
+			state.SetState(addr, common.BytesToHash([]byte{byte(i % 16)}), common.BytesToHash([]byte{2, byte(i)}))
+		}
+		state.Finalise(false)
+		roots = append(roots, state.IntermediateRoot(false))
+	}
+	if roots[0] != roots[1] {
+		t.Fatalf("root mismatch: have %x, want %x", roots[1], roots[0])
+	}
+}
+
+func benchmarkStorageTries(b *testing.B, workers int, commit bool) {
+	db := NewDatabase(rawdb.NewMemoryDatabase())
+	state, _ := New(common.Hash{}, db, nil)
+	fillStorage(state, 1000, 16, 0)
+	root, _ := state.Commit(false)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		state, _ := New(root, db, nil)
+		state.workers = workers
+		fillStorage(state, 1000, 16, byte(i%255+1))
+		b.StartTimer()
+
+		if commit {
+			state.Commit(false)
+		} else {
+			state.IntermediateRoot(false)
+		}
+	}
+}
+
+func BenchmarkIntermediateRootSequential(b *testing.B) { benchmarkStorageTries(b, 1, false) }
+func BenchmarkIntermediateRootConcurrent(b *testing.B) { benchmarkStorageTries(b, 8, false) }
+func BenchmarkCommitSequential(b *testing.B)           { benchmarkStorageTries(b, 1, true) }
+func BenchmarkCommitConcurrent(b *testing.B)           { benchmarkStorageTries(b, 8, true) }
+
 func TestStateDBAccessList(t *testing.T) {
 	// Some helpers
 	addr := func(a string) common.Address {
@@ -0,0 +1,236 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Witness is the set of trie nodes, contract codes and ancestor headers accessed
+// while executing a block. Together with the parent header it contains all data
+// needed to re-execute and verify the block statelessly.
+//
+// Items are keyed by their own hash, so a witness can be partial, but it can not
+// contain state which is inconsistent with the root it was collected against.
+type Witness struct {
+	Headers map[common.Hash]*types.Header // Ancestor headers accessed via BLOCKHASH
+	Codes   map[common.Hash][]byte        // Contract codes accessed
+	State   map[common.Hash][]byte        // Account and storage trie nodes accessed
+
+	lock sync.Mutex
+}
+
+// NewWitness creates an empty witness.
+func NewWitness() *Witness {
+	return &Witness{
+		Headers: make(map[common.Hash]*types.Header),
+		Codes:   make(map[common.Hash][]byte),
+		State:   make(map[common.Hash][]byte),
+	}
+}
+
+// AddHeader adds an ancestor header to the witness.
+func (w *Witness) AddHeader(header *types.Header) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.Headers[header.Hash()] = header
+}
+
+// AddCode adds a contract code to the witness.
+func (w *Witness) AddCode(code []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.Codes[crypto.Keccak256Hash(code)] = common.CopyBytes(code)
+}
+
+// AddNode adds an RLP encoded trie node to the witness.
+func (w *Witness) AddNode(blob []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.State[crypto.Keccak256Hash(blob)] = common.CopyBytes(blob)
+}
+
+// StateDatabase creates an in-memory state database containing only the trie
+// nodes and contract codes of the witness.
+func (w *Witness) StateDatabase() Database {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	db := rawdb.NewMemoryDatabase()
+	for hash, blob := range w.State {
+		rawdb.WriteTrieNode(db, hash, blob)
+	}
+	for hash, code := range w.Codes {
+		rawdb.WriteCode(db, hash, code)
+	}
+	return NewDatabase(db)
+}
+
+// witnessJSON is the JSON representation of a witness, with all items sorted
+// for a deterministic output.
+type witnessJSON struct {
+	Headers []*types.Header `json:"headers"`
+	Codes   []hexutil.Bytes `json:"codes"`
+	State   []hexutil.Bytes `json:"state"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w *Witness) MarshalJSON() ([]byte, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	enc := witnessJSON{
+		Headers: make([]*types.Header, 0, len(w.Headers)),
+		Codes:   make([]hexutil.Bytes, 0, len(w.Codes)),
+		State:   make([]hexutil.Bytes, 0, len(w.State)),
+	}
+	for _, header := range w.Headers {
+		enc.Headers = append(enc.Headers, header)
+	}
+	sort.Slice(enc.Headers, func(i, j int) bool {
+		return enc.Headers[i].Number.Cmp(enc.Headers[j].Number) > 0
+	})
+	for _, code := range w.Codes {
+		enc.Codes = append(enc.Codes, code)
+	}
+	sort.Slice(enc.Codes, func(i, j int) bool { return bytes.Compare(enc.Codes[i], enc.Codes[j]) < 0 })
+
+	for _, blob := range w.State {
+		enc.State = append(enc.State, blob)
+	}
+	sort.Slice(enc.State, func(i, j int) bool { return bytes.Compare(enc.State[i], enc.State[j]) < 0 })
+
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. All items are rehashed, the keys
+// of the witness are never taken from the input.
+func (w *Witness) UnmarshalJSON(input []byte) error {
+	var dec witnessJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*w = *NewWitness()
+	for _, header := range dec.Headers {
+		w.AddHeader(header)
+	}
+	for _, code := range dec.Codes {
+		w.AddCode(code)
+	}
+	for _, blob := range dec.State {
+		w.AddNode(blob)
+	}
+	return nil
+}
+
+// witnessDatabase is a state database which records all trie nodes and contract
+// codes accessed through it into a witness.
+type witnessDatabase struct {
+	source  Database
+	triedb  *trie.Database
+	witness *Witness
+}
+
+// NewWitnessDatabase wraps a state database, recording all trie nodes and codes
+// accessed through the returned database into the given witness. All tries are
+// resolved node by node from the source, bypassing any flat snapshot.
+func NewWitnessDatabase(source Database, witness *Witness) Database {
+	recorder := &nodeRecorder{
+		KeyValueStore: source.TrieDB().DiskDB(),
+		source:        source.TrieDB(),
+		witness:       witness,
+	}
+	return &witnessDatabase{
+		source:  source,
+		triedb:  trie.NewDatabase(recorder),
+		witness: witness,
+	}
+}
+
+// OpenTrie opens the main account trie at a specific root hash.
+func (db *witnessDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	return trie.NewSecure(root, db.triedb)
+}
+
+// OpenStorageTrie opens the storage trie of an account.
+func (db *witnessDatabase) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	return trie.NewSecure(root, db.triedb)
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *witnessDatabase) CopyTrie(t Trie) Trie {
+	return db.source.CopyTrie(t)
+}
+
+// ContractCode retrieves a particular contract's code, adding it to the witness.
+func (db *witnessDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.source.ContractCode(addrHash, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	db.witness.AddCode(code)
+	return code, nil
+}
+
+// ContractCodeSize retrieves a particular contracts code's size. The entire code
+// is added to the witness, since it's needed to derive the size statelessly.
+func (db *witnessDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// TrieDB retrieves the recording trie database.
+func (db *witnessDatabase) TrieDB() *trie.Database {
+	return db.triedb
+}
+
+// nodeRecorder is a key-value store which serves trie node lookups from a source
+// trie database, recording every node returned. All other accesses are passed
+// through to the source's disk database.
+type nodeRecorder struct {
+	ethdb.KeyValueStore
+
+	source  *trie.Database
+	witness *Witness
+}
+
+// Get retrieves the given key, recording it if it's a trie node.
+func (r *nodeRecorder) Get(key []byte) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return r.KeyValueStore.Get(key)
+	}
+	blob, err := r.source.Node(common.BytesToHash(key))
+	if err != nil {
+		return nil, err
+	}
+	r.witness.AddNode(blob)
+	return blob, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// witnessChain is a chain reader which records all headers retrieved through
+// it into a witness.
+type witnessChain struct {
+	processorChain
+	witness *state.Witness
+}
+
+// GetHeader retrieves a block header by hash and number, recording it.
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return c.record(c.processorChain.GetHeader(hash, number))
+}
+
+// GetHeaderByNumber retrieves a block header by number, recording it.
+func (c *witnessChain) GetHeaderByNumber(number uint64) *types.Header {
+	return c.record(c.processorChain.GetHeaderByNumber(number))
+}
+
+// GetHeaderByHash retrieves a block header by hash, recording it.
+func (c *witnessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.record(c.processorChain.GetHeaderByHash(hash))
+}
+
+func (c *witnessChain) record(header *types.Header) *types.Header {
+	if header != nil {
+		c.witness.AddHeader(header)
+	}
+	return header
+}
+
+// statelessChain is a chain reader serving the ancestor headers of a witness.
+// Headers are only reachable by walking the parent hashes from the parent of the
+// block being verified, so they are all authenticated by it.
+type statelessChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	parent  *types.Header
+	headers map[common.Hash]*types.Header
+}
+
+// Config retrieves the chain configuration.
+func (c *statelessChain) Config() *params.ChainConfig { return c.config }
+
+// Engine retrieves the consensus engine.
+func (c *statelessChain) Engine() consensus.Engine { return c.engine }
+
+// CurrentHeader returns the parent of the block being verified.
+func (c *statelessChain) CurrentHeader() *types.Header { return c.parent }
+
+// GetHeader retrieves an ancestor header by hash and number.
+func (c *statelessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	for header := c.parent; header != nil; header = c.headers[header.ParentHash] {
+		if header.Number.Uint64() < number {
+			return nil
+		}
+		if header.Number.Uint64() == number {
+			if header.Hash() != hash {
+				return nil
+			}
+			return header
+		}
+	}
+	return nil
+}
+
+// GetHeaderByNumber retrieves an ancestor header by number.
+func (c *statelessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for header := c.parent; header != nil; header = c.headers[header.ParentHash] {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// GetHeaderByHash retrieves an ancestor header by hash.
+func (c *statelessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for header := c.parent; header != nil; header = c.headers[header.ParentHash] {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+
+// VerifyStateless re-executes the block on top of the given parent header, using
+// only the state contained in the witness, and validates the resulting gas usage,
+// bloom, receipt root and state root against the block header. The header itself
+// is not verified against the consensus rules.
+func VerifyStateless(config *params.ChainConfig, engine consensus.Engine, block *types.Block, parent *types.Header, witness *state.Witness, cfg vm.Config) (types.Receipts, error) {
+	return VerifyBlockState(config, engine, block, parent, witness.StateDatabase(), witness.Headers, cfg)
+}
+
+// VerifyBlockState re-executes the block on top of the given parent header, using
+// the parent state from the given database and the given ancestor headers, which
+// are needed by BLOCKHASH. The resulting gas usage, bloom, receipt root and state
+// root are validated against the block header.
+func VerifyBlockState(config *params.ChainConfig, engine consensus.Engine, block *types.Block, parent *types.Header, db state.Database, ancestors map[common.Hash]*types.Header, cfg vm.Config) (types.Receipts, error) {
+	if block.ParentHash() != parent.Hash() {
+		return nil, fmt.Errorf("parent hash mismatch: have %x, want %x", parent.Hash(), block.ParentHash())
+	}
+	statedb, err := state.New(parent.Root, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	chain := &statelessChain{
+		config:  config,
+		engine:  engine,
+		parent:  parent,
+		headers: ancestors,
+	}
+	processor := &StateProcessor{config: config, bc: chain, engine: engine}
+	receipts, _, usedGas, err := processor.Process(block, statedb, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Missing trie nodes are only recorded in the statedb, check them before any
+	// validation error, which would most probably be a consequence of them.
+	validator := &BlockValidator{config: config}
+	verr := validator.ValidateState(block, statedb, receipts, usedGas)
+	if err := statedb.Error(); err != nil {
+		return nil, fmt.Errorf("incomplete state: %w", err)
+	}
+	if verr != nil {
+		return nil, verr
+	}
+	return receipts, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the witness collected while processing a block suffices to verify
+// it statelessly, and that no part of it can be left out.
+func TestStatelessVerification(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		db       = rawdb.NewMemoryDatabase()
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				addr: {Balance: big.NewInt(params.Ether)},
+				contract: {
+					// SLOAD(0); SSTORE(0, NUMBER); SSTORE(1, BLOCKHASH(NUMBER-3)); SSTORE(2, 0)
+					Code: common.FromHex("0x6000545043600055600343034060015560006002550000"),
+					Storage: map[common.Hash]common.Hash{
+						common.HexToHash("0x02"): common.HexToHash("0x01"),
+						common.HexToHash("0x03"): common.HexToHash("0x01"),
+						common.HexToHash("0x04"): common.HexToHash("0x01"),
+					},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		signer = types.LatestSigner(gspec.Config)
+	)
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	// Generate the blocks one by one, as BLOCKHASH needs access to the chain
+	var blocks []*types.Block
+	for i := 0; i < 5; i++ {
+		next, _ := GenerateChain(gspec.Config, chain.CurrentBlock(), ethash.NewFaker(), db, 1, func(_ int, gen *BlockGen) {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), contract, nil, 100000, gen.header.BaseFee, nil), signer, key)
+			gen.AddTxWithChain(chain, tx)
+			tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1), params.TxGas, gen.header.BaseFee, nil), signer, key)
+			gen.AddTxWithChain(chain, tx)
+		})
+		if _, err := chain.InsertChain(next); err != nil {
+			t.Fatalf("failed to insert block %d: %v", i+1, err)
+		}
+		blocks = append(blocks, next...)
+	}
+	processor := NewStateProcessor(gspec.Config, chain, chain.Engine())
+	for _, block := range blocks {
+		parent := chain.GetHeaderByHash(block.ParentHash())
+		witness, _, _, err := processor.ProcessWithWitness(block, parent.Root, chain.StateCache(), vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: failed to collect witness: %v", block.NumberU64(), err)
+		}
+		// Ship the witness through its JSON encoding and verify the block with it
+		blob, err := json.Marshal(witness)
+		if err != nil {
+			t.Fatalf("block %d: failed to encode witness: %v", block.NumberU64(), err)
+		}
+		witness = new(state.Witness)
+		if err := json.Unmarshal(blob, witness); err != nil {
+			t.Fatalf("block %d: failed to decode witness: %v", block.NumberU64(), err)
+		}
+		if block.NumberU64() > 3 && len(witness.Headers) == 0 {
+			t.Errorf("block %d: no ancestor headers in witness", block.NumberU64())
+		}
+		receipts, err := VerifyStateless(gspec.Config, ethash.NewFaker(), block, parent, witness, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: stateless verification failed: %v", block.NumberU64(), err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			t.Errorf("block %d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+		}
+		// Drop every single item of the witness and ensure verification fails
+		for hash, blob := range witness.State {
+			delete(witness.State, hash)
+			if _, err := VerifyStateless(gspec.Config, ethash.NewFaker(), block, parent, witness, vm.Config{}); err == nil {
+				t.Errorf("block %d: verified without trie node %x", block.NumberU64(), hash)
+			}
+			witness.State[hash] = blob
+		}
+		for hash, code := range witness.Codes {
+			delete(witness.Codes, hash)
+			if _, err := VerifyStateless(gspec.Config, ethash.NewFaker(), block, parent, witness, vm.Config{}); err == nil {
+				t.Errorf("block %d: verified without code %x", block.NumberU64(), hash)
+			}
+			witness.Codes[hash] = code
+		}
+		for hash, header := range witness.Headers {
+			if hash == parent.Hash() {
+				continue // The parent is provided separately
+			}
+			delete(witness.Headers, hash)
+			if _, err := VerifyStateless(gspec.Config, ethash.NewFaker(), block, parent, witness, vm.Config{}); err == nil {
+				t.Errorf("block %d: verified without header %x", block.NumberU64(), hash)
+			}
+			witness.Headers[hash] = header
+		}
+	}
+}
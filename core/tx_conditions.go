@@ -0,0 +1,135 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxConditionChecks is the maximum number of storage roots and slots the
+// preconditions of a single transaction may reference.
+const maxConditionChecks = 1000
+
+var (
+	// ErrConditionsTooLarge is returned if the preconditions of a transaction
+	// reference too many storage roots and slots.
+	ErrConditionsTooLarge = errors.New("too many preconditions")
+
+	// ErrConditionBlockNumber is returned if the block number is outside of the
+	// range a conditional transaction may be included in.
+	ErrConditionBlockNumber = errors.New("block number out of precondition range")
+
+	// ErrConditionTimestamp is returned if the block timestamp is outside of the
+	// range a conditional transaction may be included in.
+	ErrConditionTimestamp = errors.New("timestamp out of precondition range")
+
+	// ErrConditionStorage is returned if the state doesn't match the expected
+	// storage of a conditional transaction.
+	ErrConditionStorage = errors.New("storage precondition mismatch")
+)
+
+// KnownAccount is the expected storage of an account: either the root of its
+// whole storage trie, or the values of individual slots.
+type KnownAccount struct {
+	StorageRoot  *common.Hash
+	StorageSlots map[common.Hash]common.Hash
+}
+
+// TxConditions are the preconditions a conditional transaction may only be
+// included in a block under. Nil fields are not checked.
+type TxConditions struct {
+	BlockNumberMin *big.Int
+	BlockNumberMax *big.Int
+	TimestampMin   *uint64
+	TimestampMax   *uint64
+	KnownAccounts  map[common.Address]KnownAccount
+}
+
+// Validate checks the preconditions for sanity, without checking them against
+// any chain state.
+func (c *TxConditions) Validate() error {
+	checks := 0
+	for _, account := range c.KnownAccounts {
+		if account.StorageRoot != nil {
+			checks++
+		}
+		checks += len(account.StorageSlots)
+	}
+	if checks > maxConditionChecks {
+		return ErrConditionsTooLarge
+	}
+	if c.BlockNumberMin != nil && c.BlockNumberMax != nil && c.BlockNumberMin.Cmp(c.BlockNumberMax) > 0 {
+		return fmt.Errorf("%w: min %v above max %v", ErrConditionBlockNumber, c.BlockNumberMin, c.BlockNumberMax)
+	}
+	if c.TimestampMin != nil && c.TimestampMax != nil && *c.TimestampMin > *c.TimestampMax {
+		return fmt.Errorf("%w: min %d above max %d", ErrConditionTimestamp, *c.TimestampMin, *c.TimestampMax)
+	}
+	return nil
+}
+
+// Check verifies that the preconditions hold for inclusion in the block with the
+// given header, on top of the given state.
+func (c *TxConditions) Check(header *types.Header, statedb *state.StateDB) error {
+	if c.BlockNumberMin != nil && header.Number.Cmp(c.BlockNumberMin) < 0 {
+		return fmt.Errorf("%w: block %v before %v", ErrConditionBlockNumber, header.Number, c.BlockNumberMin)
+	}
+	if c.TimestampMin != nil && header.Time < *c.TimestampMin {
+		return fmt.Errorf("%w: time %d before %d", ErrConditionTimestamp, header.Time, *c.TimestampMin)
+	}
+	return c.expired(header.Number, header.Time, statedb)
+}
+
+// Expired checks whether the preconditions can no longer hold for any block
+// built on top of the given head and its state. A storage mismatch is treated
+// as expiry too, even though later blocks may change the storage back.
+func (c *TxConditions) Expired(head *types.Header, statedb *state.StateDB) error {
+	return c.expired(new(big.Int).Add(head.Number, common.Big1), head.Time+1, statedb)
+}
+
+// expired checks the upper bounds and storage of the preconditions against the
+// given block number, timestamp and state.
+func (c *TxConditions) expired(number *big.Int, time uint64, statedb *state.StateDB) error {
+	if c.BlockNumberMax != nil && number.Cmp(c.BlockNumberMax) > 0 {
+		return fmt.Errorf("%w: block %v after %v", ErrConditionBlockNumber, number, c.BlockNumberMax)
+	}
+	if c.TimestampMax != nil && time > *c.TimestampMax {
+		return fmt.Errorf("%w: time %d after %d", ErrConditionTimestamp, time, *c.TimestampMax)
+	}
+	for addr, account := range c.KnownAccounts {
+		if account.StorageRoot != nil {
+			root := types.EmptyRootHash
+			if trie := statedb.StorageTrie(addr); trie != nil {
+				root = trie.Hash()
+			}
+			if root != *account.StorageRoot {
+				return fmt.Errorf("%w: account %x root %x, want %x", ErrConditionStorage, addr, root, *account.StorageRoot)
+			}
+		}
+		for slot, want := range account.StorageSlots {
+			if have := statedb.GetState(addr, slot); have != want {
+				return fmt.Errorf("%w: account %x slot %x is %x, want %x", ErrConditionStorage, addr, slot, have, want)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxPoolLimits are the spam protection limits of the transaction pool which can
+// be changed at runtime. Zero values disable the respective limit.
+type TxPoolLimits struct {
+	ContractSlots uint64  // Maximum number of pooled transactions calling the same contract
+	SelectorSlots uint64  // Maximum number of pooled transactions calling the same contract method
+	SenderRate    float64 // Number of transactions per second admitted from a single sender
+	SenderBurst   uint64  // Number of transactions admitted from a single sender at once
+}
+
+// txSelector identifies a method of a contract, as called by a transaction.
+type txSelector struct {
+	to  common.Address
+	sig [4]byte
+}
+
+// selectorOf returns the contract method called by a transaction, if any.
+func selectorOf(tx *types.Transaction) (txSelector, bool) {
+	to, data := tx.To(), tx.Data()
+	if to == nil || len(data) < 4 {
+		return txSelector{}, false
+	}
+	sel := txSelector{to: *to}
+	copy(sel.sig[:], data)
+	return sel, true
+}
+
+// txBucket is a token bucket limiting the admission rate of a single sender.
+type txBucket struct {
+	tokens float64   // Number of transactions which may be admitted
+	last   time.Time // Time the tokens were last refilled
+}
+
+// refill tops up the bucket with the tokens accumulated since the last refill.
+func (b *txBucket) refill(now time.Time, rate float64, burst uint64) {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+}
+
+// txLimiter tracks the admission rate of every sender against the configured
+// limits.
+type txLimiter struct {
+	limits  TxPoolLimits
+	buckets map[common.Address]*txBucket
+	lock    sync.Mutex
+}
+
+// newTxLimiter creates a limiter enforcing the given limits.
+func newTxLimiter(limits TxPoolLimits) *txLimiter {
+	return &txLimiter{
+		limits:  limits,
+		buckets: make(map[common.Address]*txBucket),
+	}
+}
+
+// get returns the currently enforced limits.
+func (l *txLimiter) get() TxPoolLimits {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.limits
+}
+
+// set changes the enforced limits. The tokens accumulated by the senders are
+// retained, but capped to the new burst size.
+func (l *txLimiter) set(limits TxPoolLimits) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.limits = limits
+	for _, bucket := range l.buckets {
+		if bucket.tokens > float64(limits.SenderBurst) {
+			bucket.tokens = float64(limits.SenderBurst)
+		}
+	}
+}
+
+// allow consumes a token of the sender, returning ErrSenderRateLimit if it ran
+// out of them.
+func (l *txLimiter) allow(from common.Address, now time.Time) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.limits.SenderRate <= 0 {
+		return nil
+	}
+	bucket := l.buckets[from]
+	if bucket == nil {
+		bucket = &txBucket{tokens: float64(l.limits.SenderBurst), last: now}
+		l.buckets[from] = bucket
+	}
+	bucket.refill(now, l.limits.SenderRate, l.limits.SenderBurst)
+	if bucket.tokens < 1 {
+		return ErrSenderRateLimit
+	}
+	bucket.tokens--
+	return nil
+}
+
+// prune drops the buckets of all senders which would be full by now, as those
+// are indistinguishable from senders not seen before.
+func (l *txLimiter) prune(now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for from, bucket := range l.buckets {
+		bucket.refill(now, l.limits.SenderRate, l.limits.SenderBurst)
+		if bucket.tokens >= float64(l.limits.SenderBurst) {
+			delete(l.buckets, from)
+		}
+	}
+}
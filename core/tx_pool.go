@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 const (
@@ -84,11 +85,41 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrAccountLimitExceeded is reported if a transaction is dropped because its
+	// account exceeded the number of non-executable transaction slots.
+	ErrAccountLimitExceeded = errors.New("account limit exceeded")
+
+	// ErrNonceGap is reported if a transaction is demoted because a transaction
+	// with a lower nonce of the same account was removed.
+	ErrNonceGap = errors.New("nonce gap")
+
+	// ErrTxExpired is reported if a non-executable transaction is dropped because
+	// it was queued for longer than the configured lifetime.
+	ErrTxExpired = errors.New("queue lifetime exceeded")
+
+	// ErrPrivateTxExpired is reported if a private transaction is dropped because
+	// it wasn't included within its lifetime.
+	ErrPrivateTxExpired = errors.New("private lifetime exceeded")
+
+	// ErrContractLimit is returned if a transaction calls a contract which already
+	// has the maximum number of pooled transactions calling it.
+	ErrContractLimit = errors.New("txpool contract limit exceeded")
+
+	// ErrSelectorLimit is returned if a transaction calls a contract method which
+	// already has the maximum number of pooled transactions calling it.
+	ErrSelectorLimit = errors.New("txpool selector limit exceeded")
+
+	// ErrSenderRateLimit is returned if the sender of a transaction submitted
+	// transactions faster than the permitted admission rate.
+	ErrSenderRateLimit = errors.New("txpool sender rate limit exceeded")
 )
 
 var (
 	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
 	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
+	txHistoryLimit      = 16384           // Number of transactions to remember the latest event of
+	txEventQueueLimit   = 4096            // Number of transaction events buffered for the subscribers
 )
 
 var (
@@ -105,12 +136,21 @@ var (
 	queuedNofundsMeter   = metrics.NewRegisteredMeter("txpool/queued/nofunds", nil)   // Dropped due to out-of-funds
 	queuedEvictionMeter  = metrics.NewRegisteredMeter("txpool/queued/eviction", nil)  // Dropped due to lifetime
 
+	// Metrics for the private transactions
+	privateExpiryMeter   = metrics.NewRegisteredMeter("txpool/private/expiry", nil)      // Dropped due to private lifetime
+	conditionalDropMeter = metrics.NewRegisteredMeter("txpool/private/conditional", nil) // Dropped due to unsatisfiable preconditions
+
+	// txEventDropMeter counts the transaction events dropped because the subscribers
+	// didn't keep up with them.
+	txEventDropMeter = metrics.NewRegisteredMeter("txpool/events/drop", nil)
+
 	// General tx metrics
 	knownTxMeter       = metrics.NewRegisteredMeter("txpool/known", nil)
 	validTxMeter       = metrics.NewRegisteredMeter("txpool/valid", nil)
 	invalidTxMeter     = metrics.NewRegisteredMeter("txpool/invalid", nil)
 	underpricedTxMeter = metrics.NewRegisteredMeter("txpool/underpriced", nil)
 	overflowedTxMeter  = metrics.NewRegisteredMeter("txpool/overflowed", nil)
+	limitedTxMeter     = metrics.NewRegisteredMeter("txpool/limited", nil)
 
 	pendingGauge = metrics.NewRegisteredGauge("txpool/pending", nil)
 	queuedGauge  = metrics.NewRegisteredGauge("txpool/queued", nil)
@@ -145,7 +185,8 @@ type TxPoolConfig struct {
 	Locals    []common.Address // Addresses that should be treated by default as local
 	NoLocals  bool             // Whether local transaction handling should be disabled
 	Journal   string           // Journal of local transactions to survive node restarts
-	Rejournal time.Duration    // Time interval to regenerate the local transaction journal
+	Snapshot  string           // Snapshot of remote transactions to survive node restarts (empty = disabled)
+	Rejournal time.Duration    // Time interval to regenerate the local transaction journal and remote snapshot
 
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
@@ -156,6 +197,13 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	PrivateLifetime uint64 // Number of blocks after which private transactions are dropped
+
+	ContractSlots uint64  // Maximum number of pooled transactions calling the same contract (0 = unlimited)
+	SelectorSlots uint64  // Maximum number of pooled transactions calling the same contract method (0 = unlimited)
+	SenderRate    float64 // Number of transactions per second admitted from a single non-local sender (0 = unlimited)
+	SenderBurst   uint64  // Number of transactions admitted from a single sender at once
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -173,6 +221,10 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	PrivateLifetime: 25,
+
+	SenderBurst: 16,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -211,9 +263,31 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.PrivateLifetime < 1 {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
+	if conf.SenderRate < 0 {
+		log.Warn("Sanitizing invalid txpool sender rate", "provided", conf.SenderRate, "updated", 0)
+		conf.SenderRate = 0
+	}
+	if conf.SenderBurst < 1 {
+		log.Warn("Sanitizing invalid txpool sender burst", "provided", conf.SenderBurst, "updated", DefaultTxPoolConfig.SenderBurst)
+		conf.SenderBurst = DefaultTxPoolConfig.SenderBurst
+	}
 	return conf
 }
 
+// limits returns the runtime adjustable limits of the configuration.
+func (config *TxPoolConfig) limits() TxPoolLimits {
+	return TxPoolLimits{
+		ContractSlots: config.ContractSlots,
+		SelectorSlots: config.SelectorSlots,
+		SenderRate:    config.SenderRate,
+		SenderBurst:   config.SenderBurst,
+	}
+}
+
 // TxPool contains all currently known transactions. Transactions
 // enter the pool when they are received from the network or submitted
 // locally. They exit the pool when they are included in the blockchain.
@@ -227,6 +301,7 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	txEventFeed event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
@@ -239,8 +314,20 @@ type TxPool struct {
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	snapshot *txJournal  // Snapshot of remote transactions to back up to disk
+
+	txEvents  []TxPoolEvent    // Transaction events accumulated while holding the lock, to be sent once released
+	txEventCh chan TxPoolEvent // Transaction events queued for delivery to the subscribers
+	txHistory *lru.Cache       // Latest event of the recently seen transactions
+
+	limiter *txLimiter  // Per contract, method and sender admission limits
+	exempt  *accountSet // Configured local accounts exempt from the sender admission rate
+
+	private     map[common.Hash]uint64        // Private transactions never to be propagated, with their expiry block
+	conditions  map[common.Hash]*TxConditions // Preconditions of the private transactions added conditionally
+	privateLock sync.RWMutex                  // Lock protecting the private set, to avoid contention on mu
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
@@ -255,7 +342,7 @@ type TxPool struct {
 	queueTxEventCh  chan *types.Transaction
 	reorgDoneCh     chan chan struct{}
 	reorgShutdownCh chan struct{}  // requests shutdown of scheduleReorgLoop
-	wg              sync.WaitGroup // tracks loop, scheduleReorgLoop
+	wg              sync.WaitGroup // tracks loop, scheduleReorgLoop, txEventLoop
 }
 
 type txpoolResetRequest struct {
@@ -278,15 +365,21 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
 		all:             newTxLookup(),
+		private:         make(map[common.Hash]uint64),
+		conditions:      make(map[common.Hash]*TxConditions),
+		limiter:         newTxLimiter(TxPoolLimits{}),
 		chainHeadCh:     make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:      make(chan *txpoolResetRequest),
 		reqPromoteCh:    make(chan *accountSet),
 		queueTxEventCh:  make(chan *types.Transaction),
+		txEventCh:       make(chan TxPoolEvent, txEventQueueLimit),
 		reorgDoneCh:     make(chan chan struct{}),
 		reorgShutdownCh: make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
 	}
+	pool.txHistory, _ = lru.New(txHistoryLimit)
 	pool.locals = newAccountSet(pool.signer)
+	pool.exempt = newAccountSet(pool.signer, config.Locals...)
 	for _, addr := range config.Locals {
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
@@ -297,6 +390,8 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	// Start the reorg loop early so it can handle requests generated during journal loading.
 	pool.wg.Add(1)
 	go pool.scheduleReorgLoop()
+	pool.wg.Add(1)
+	go pool.txEventLoop()
 
 	// If local transactions and journaling is enabled, load from disk
 	if !config.NoLocals && config.Journal != "" {
@@ -309,6 +404,19 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If remote transaction snapshotting is enabled, load from disk. The snapshot
+	// is only written once the pool is running, with the transactions re-validated
+	// against the current head by then.
+	if config.Snapshot != "" {
+		pool.snapshot = newTxJournal(config.Snapshot)
+
+		if err := pool.snapshot.load(pool.AddRemotesSync); err != nil {
+			log.Warn("Failed to load transaction snapshot", "err", err)
+		}
+	}
+	// Persisted transactions were admitted once already, only enforce the limits
+	// for transactions arriving from now on
+	pool.limiter.set(config.limits())
 
 	// Subscribe events from blockchain and start the main event loop.
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
@@ -375,12 +483,16 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
+						pool.txEvent(TxEventDropped, tx, ErrTxExpired)
 						pool.removeTx(tx.Hash(), true)
 					}
 					queuedEvictionMeter.Mark(int64(len(list)))
 				}
 			}
+			events := pool.takeTxEvents()
 			pool.mu.Unlock()
+			pool.sendTxEvents(events)
+			pool.limiter.prune(time.Now())
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -391,6 +503,13 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+			if pool.snapshot != nil {
+				pool.mu.Lock()
+				if err := pool.snapshot.rotate(pool.remote()); err != nil {
+					log.Warn("Failed to rotate remote tx snapshot", "err", err)
+				}
+				pool.mu.Unlock()
+			}
 		}
 	}
 }
@@ -407,6 +526,14 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.snapshot != nil {
+		pool.mu.Lock()
+		if err := pool.snapshot.rotate(pool.remote()); err != nil {
+			log.Warn("Failed to write remote tx snapshot", "err", err)
+		}
+		pool.mu.Unlock()
+		pool.snapshot.close()
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -416,6 +543,91 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxPoolEvent registers a subscription of TxPoolEvent and starts sending
+// an event to the given channel whenever a transaction is added, promoted, demoted,
+// replaced or dropped.
+func (pool *TxPool) SubscribeTxPoolEvent(ch chan<- TxPoolEvent) event.Subscription {
+	return pool.scope.Track(pool.txEventFeed.Subscribe(ch))
+}
+
+// LastEvent retrieves the latest event of a recently seen transaction, which
+// is retained for a while even after the transaction left the pool.
+func (pool *TxPool) LastEvent(hash common.Hash) (TxPoolEvent, bool) {
+	if ev, ok := pool.txHistory.Get(hash); ok {
+		return ev.(TxPoolEvent), true
+	}
+	return TxPoolEvent{}, false
+}
+
+// txEvent records an event of a transaction, to be sent once the pool lock is
+// released.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) txEvent(typ TxPoolEventType, tx *types.Transaction, reason error) {
+	pool.recordTxEvent(TxPoolEvent{Tx: tx, Type: typ, Reason: reason, Time: time.Now()})
+}
+
+// txReplaced records the replacement of a transaction by another one.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) txReplaced(old, tx *types.Transaction) {
+	pool.recordTxEvent(TxPoolEvent{Tx: old, Type: TxEventReplaced, ReplacedBy: tx.Hash(), Time: time.Now()})
+}
+
+// recordTxEvent remembers an event as the latest one of its transaction and
+// accumulates it to be sent.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) recordTxEvent(ev TxPoolEvent) {
+	pool.txHistory.Add(ev.Tx.Hash(), ev)
+	pool.txEvents = append(pool.txEvents, ev)
+}
+
+// takeTxEvents retrieves and clears the transaction events recorded so far.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) takeTxEvents() []TxPoolEvent {
+	events := pool.txEvents
+	pool.txEvents = nil
+	return events
+}
+
+// sendTxEvents queues a batch of transaction events for delivery to the
+// subscribers. Events are dropped if the queue is full, so that slow subscribers
+// never block the pool.
+func (pool *TxPool) sendTxEvents(events []TxPoolEvent) {
+	for i, ev := range events {
+		select {
+		case pool.txEventCh <- ev:
+		default:
+			txEventDropMeter.Mark(int64(len(events) - i))
+			return
+		}
+	}
+}
+
+// txEventLoop delivers the queued transaction events to the subscribers.
+func (pool *TxPool) txEventLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case ev := <-pool.txEventCh:
+			pool.txEventFeed.Send(ev)
+		case <-pool.reorgShutdownCh:
+			return
+		}
+	}
+}
+
+// unpayable returns the reason an unpayable transaction is dropped for.
+func (pool *TxPool) unpayable(tx *types.Transaction) error {
+	if tx.Gas() > pool.currentMaxGas {
+		return ErrGasLimit
+	}
+	return ErrInsufficientFunds
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -428,7 +640,6 @@ func (pool *TxPool) GasPrice() *big.Int {
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
 
 	old := pool.gasPrice
 	pool.gasPrice = price
@@ -437,14 +648,36 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		// pool.priced is sorted by GasFeeCap, so we have to iterate through pool.all instead
 		drop := pool.all.RemotesBelowTip(price)
 		for _, tx := range drop {
+			pool.txEvent(TxEventDropped, tx, ErrUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 		pool.priced.Removed(len(drop))
 	}
+	events := pool.takeTxEvents()
+	pool.mu.Unlock()
 
+	pool.sendTxEvents(events)
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// Limits returns the currently enforced spam protection limits.
+func (pool *TxPool) Limits() TxPoolLimits {
+	return pool.limiter.get()
+}
+
+// SetLimits updates the spam protection limits. Transactions already in the pool
+// are retained, the new limits only apply to newly added ones.
+func (pool *TxPool) SetLimits(limits TxPoolLimits) {
+	if limits.SenderRate < 0 {
+		limits.SenderRate = 0
+	}
+	if limits.SenderBurst < 1 {
+		limits.SenderBurst = 1
+	}
+	pool.limiter.set(limits)
+	log.Info("Transaction pool limits updated", "contract", limits.ContractSlots, "selector", limits.SelectorSlots, "rate", limits.SenderRate, "burst", limits.SenderBurst)
+}
+
 // Nonce returns the next nonce of an account, with all transactions executable
 // by the pool already applied on top.
 func (pool *TxPool) Nonce(addr common.Address) uint64 {
@@ -551,21 +784,62 @@ func (pool *TxPool) Locals() []common.Address {
 }
 
 // local retrieves all currently known local transactions, grouped by origin
-// account and sorted by nonce. The returned transaction set is a copy and can be
-// freely modified by calling code.
+// account and sorted by nonce. Private transactions are left out, as they must
+// not survive a restart. The returned transaction set is a copy and can be freely
+// modified by calling code.
 func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
 		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(pending.Flatten())...)
 		}
 		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(queued.Flatten())...)
+		}
+		if len(txs[addr]) == 0 {
+			delete(txs, addr)
 		}
 	}
 	return txs
 }
 
+// remote retrieves all currently known remote transactions, grouped by origin
+// account and sorted by nonce. The returned transaction set is a copy and can be
+// freely modified by calling code.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) remote() map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	for addr, list := range pool.pending {
+		if !pool.locals.contains(addr) {
+			txs[addr] = list.Flatten()
+		}
+	}
+	for addr, list := range pool.queue {
+		if !pool.locals.contains(addr) {
+			txs[addr] = append(txs[addr], list.Flatten()...)
+		}
+	}
+	return txs
+}
+
+// public filters out the private transactions from a list.
+func (pool *TxPool) public(txs types.Transactions) types.Transactions {
+	pool.privateLock.RLock()
+	defer pool.privateLock.RUnlock()
+
+	if len(pool.private) == 0 {
+		return txs
+	}
+	filtered := make(types.Transactions, 0, len(txs))
+	for _, tx := range txs {
+		if _, ok := pool.private[tx.Hash()]; !ok {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -655,6 +929,12 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		invalidTxMeter.Mark(1)
 		return false, err
 	}
+	// If the transaction calls an overly popular contract, discard it
+	if err := pool.checkSlotLimits(tx); err != nil {
+		log.Trace("Discarding rate limited transaction", "hash", hash, "to", tx.To(), "err", err)
+		limitedTxMeter.Mark(1)
+		return false, err
+	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(pool.all.Slots()+numSlots(tx)) > pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
@@ -678,6 +958,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
+			pool.txEvent(TxEventDropped, tx, ErrUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -695,9 +976,12 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.txReplaced(old, tx)
 		}
 		pool.all.Add(tx, isLocal)
 		pool.priced.Put(tx, isLocal)
+		pool.txEvent(TxEventAdded, tx, nil)
+		pool.txEvent(TxEventPromoted, tx, nil)
 		pool.journalTx(from, tx)
 		pool.queueTxEvent(tx)
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
@@ -711,6 +995,8 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	if err != nil {
 		return false, err
 	}
+	pool.txEvent(TxEventAdded, tx, nil)
+
 	// Mark local addresses and journal local transactions
 	if local && !pool.locals.contains(from) {
 		log.Info("Setting new local account", "address", from)
@@ -726,6 +1012,49 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	return replaced, nil
 }
 
+// checkSlotLimits checks whether adding a transaction would exceed the number
+// of pooled transactions permitted to call the same contract or method. Replacing
+// a transaction calling the same target doesn't change the counts, so it's never
+// rejected.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) checkSlotLimits(tx *types.Transaction) error {
+	limits := pool.limiter.get()
+	if tx.To() == nil || (limits.ContractSlots == 0 && limits.SelectorSlots == 0) {
+		return nil
+	}
+	if pool.currentState.GetCodeSize(*tx.To()) == 0 {
+		return nil
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	sel, called := selectorOf(tx)
+
+	var old *types.Transaction
+	if list := pool.pending[from]; list != nil {
+		old = list.txs.Get(tx.Nonce())
+	}
+	if list := pool.queue[from]; old == nil && list != nil {
+		old = list.txs.Get(tx.Nonce())
+	}
+	if limits.ContractSlots > 0 {
+		same := old != nil && old.To() != nil && *old.To() == *tx.To()
+		if !same && uint64(pool.all.TargetCount(*tx.To())) >= limits.ContractSlots {
+			return ErrContractLimit
+		}
+	}
+	if limits.SelectorSlots > 0 && called {
+		var same bool
+		if old != nil {
+			oldSel, ok := selectorOf(old)
+			same = ok && oldSel == sel
+		}
+		if !same && uint64(pool.all.SelectorCount(sel)) >= limits.SelectorSlots {
+			return ErrSelectorLimit
+		}
+	}
+	return nil
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -746,6 +1075,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.txReplaced(old, tx)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -769,8 +1099,8 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local and not private
+	if pool.journal == nil || !pool.locals.contains(from) || pool.IsPrivate(tx.Hash()) {
 		return
 	}
 	if err := pool.journal.insert(tx); err != nil {
@@ -795,6 +1125,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
 		pendingDiscardMeter.Mark(1)
+		pool.txEvent(TxEventDropped, tx, ErrReplaceUnderpriced)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -802,6 +1133,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
+		pool.txReplaced(old, tx)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
@@ -811,6 +1143,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 
 	// Successful promotion, bump the heartbeat
 	pool.beats[addr] = time.Now()
+	pool.txEvent(TxEventPromoted, tx, nil)
 	return true
 }
 
@@ -830,6 +1163,145 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate enqueues a single local transaction into the pool if it is valid,
+// marking it as private. Private transactions are never announced or propagated
+// to the network, only included in blocks by the local miner, are not journaled,
+// and are dropped from the pool after the given number of blocks. A zero lifetime
+// selects the configured default.
+func (pool *TxPool) AddPrivate(tx *types.Transaction, lifetime uint64) error {
+	return pool.addPrivate(tx, lifetime, nil)
+}
+
+// AddConditional enqueues a single local transaction into the pool if it is valid
+// and its preconditions may still hold. The transaction is only included in a
+// block satisfying the preconditions, and dropped as soon as they can no longer
+// hold. As the preconditions can't be enforced by other nodes, conditional
+// transactions are private ones with the default lifetime.
+func (pool *TxPool) AddConditional(tx *types.Transaction, cond *TxConditions) error {
+	if err := cond.Validate(); err != nil {
+		return err
+	}
+	pool.mu.RLock()
+	err := cond.Expired(pool.chain.CurrentBlock().Header(), pool.currentState)
+	pool.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+	return pool.addPrivate(tx, 0, cond)
+}
+
+// addPrivate enqueues a single local transaction into the pool as a private one,
+// along with its optional preconditions.
+func (pool *TxPool) addPrivate(tx *types.Transaction, lifetime uint64, cond *TxConditions) error {
+	if lifetime == 0 {
+		lifetime = pool.config.PrivateLifetime
+	}
+	hash := tx.Hash()
+
+	// Mark the transaction private before it's added, so that it's never seen as
+	// a public one by the subsystems listening for new transactions.
+	pool.privateLock.Lock()
+	if _, ok := pool.private[hash]; ok || pool.all.Get(hash) != nil {
+		pool.privateLock.Unlock()
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	pool.private[hash] = pool.chain.CurrentBlock().NumberU64() + lifetime
+	if cond != nil {
+		pool.conditions[hash] = cond
+	}
+	pool.privateLock.Unlock()
+
+	if err := pool.AddLocal(tx); err != nil {
+		pool.privateLock.Lock()
+		delete(pool.private, hash)
+		delete(pool.conditions, hash)
+		pool.privateLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// IsPrivate returns whether the transaction with the given hash was added to the
+// pool as a private one and must not be propagated.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	pool.privateLock.RLock()
+	defer pool.privateLock.RUnlock()
+
+	_, ok := pool.private[hash]
+	return ok
+}
+
+// Private retrieves the hashes of all private transactions along with the block
+// numbers at which they expire. The returned map is a copy and can be freely
+// modified by calling code.
+func (pool *TxPool) Private() map[common.Hash]uint64 {
+	pool.privateLock.RLock()
+	defer pool.privateLock.RUnlock()
+
+	private := make(map[common.Hash]uint64, len(pool.private))
+	for hash, expiry := range pool.private {
+		private[hash] = expiry
+	}
+	return private
+}
+
+// Conditions returns the preconditions of a transaction added conditionally, or
+// nil if the transaction has none.
+func (pool *TxPool) Conditions(hash common.Hash) *TxConditions {
+	pool.privateLock.RLock()
+	defer pool.privateLock.RUnlock()
+
+	return pool.conditions[hash]
+}
+
+// expirePrivate drops all private transactions which expired by the given block
+// from the pool. The private marks are retained until expiry even if the tx has
+// left the pool, so that transactions reinjected by a reorg stay private.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expirePrivate(number uint64) {
+	pool.privateLock.Lock()
+	defer pool.privateLock.Unlock()
+
+	for hash, expiry := range pool.private {
+		if number < expiry {
+			continue
+		}
+		if pool.all.Get(hash) != nil {
+			log.Debug("Dropping expired private transaction", "hash", hash, "expiry", expiry)
+			pool.txEvent(TxEventDropped, pool.all.Get(hash), ErrPrivateTxExpired)
+			pool.removeTx(hash, true)
+			privateExpiryMeter.Mark(1)
+		}
+		delete(pool.private, hash)
+		delete(pool.conditions, hash)
+	}
+}
+
+// dropUnsatisfiable drops all conditional transactions from the pool whose
+// preconditions can no longer hold on top of the given head.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) dropUnsatisfiable(head *types.Header) {
+	pool.privateLock.RLock()
+	defer pool.privateLock.RUnlock()
+
+	for hash, cond := range pool.conditions {
+		tx := pool.all.Get(hash)
+		if tx == nil {
+			continue
+		}
+		if err := cond.Expired(head, pool.currentState); err != nil {
+			log.Debug("Dropping unsatisfiable conditional transaction", "hash", hash, "err", err)
+			pool.txEvent(TxEventDropped, tx, err)
+			pool.removeTx(hash, true)
+			conditionalDropMeter.Mark(1)
+		}
+	}
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -876,12 +1348,22 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		// Exclude transactions with invalid signatures as soon as
 		// possible and cache senders in transactions before
 		// obtaining lock
-		_, err := types.Sender(pool.signer, tx)
+		from, err := types.Sender(pool.signer, tx)
 		if err != nil {
 			errs[i] = ErrInvalidSender
 			invalidTxMeter.Mark(1)
 			continue
 		}
+		// Exclude transactions of senders exceeding their admission rate. Local
+		// submissions over RPC are limited too, only the configured local
+		// accounts are exempt.
+		if !pool.exempt.contains(from) {
+			if err := pool.limiter.allow(from, time.Now()); err != nil {
+				errs[i] = err
+				limitedTxMeter.Mark(1)
+				continue
+			}
+		}
 		// Accumulate all unknown transactions for deeper processing
 		news = append(news, tx)
 	}
@@ -892,8 +1374,11 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	events := pool.takeTxEvents()
 	pool.mu.Unlock()
 
+	pool.sendTxEvents(events)
+
 	var nilSlot = 0
 	for _, err := range newErrs {
 		for errs[nilSlot] != nil {
@@ -989,6 +1474,7 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 			for _, tx := range invalids {
 				// Internal shuffle shouldn't touch the lookup set.
 				pool.enqueueTx(tx.Hash(), tx, false, false)
+				pool.txEvent(TxEventDemoted, tx, ErrNonceGap)
 			}
 			// Update the account nonce if needed
 			pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1127,6 +1613,10 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	if reset != nil {
 		// Reset from the old head to the new, rescheduling any reorged transactions
 		pool.reset(reset.oldHead, reset.newHead)
+		if reset.newHead != nil {
+			pool.expirePrivate(reset.newHead.Number.Uint64())
+			pool.dropUnsatisfiable(reset.newHead)
+		}
 
 		// Nonces were reset, discard any events that became stale
 		for addr := range events {
@@ -1163,8 +1653,11 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		highestPending := list.LastElement()
 		pool.pendingNonces.set(addr, highestPending.Nonce()+1)
 	}
+	txEvents := pool.takeTxEvents()
 	pool.mu.Unlock()
 
+	pool.sendTxEvents(txEvents)
+
 	// Notify subsystems for newly added transactions
 	for _, tx := range promoted {
 		addr, _ := types.Sender(pool.signer, tx)
@@ -1291,6 +1784,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range forwards {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvent(TxEventDropped, tx, ErrNonceTooLow)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
 		// Drop all transactions that are too costly (low balance or out of gas)
@@ -1298,6 +1792,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvent(TxEventDropped, tx, pool.unpayable(tx))
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
 		queuedNofundsMeter.Mark(int64(len(drops)))
@@ -1320,6 +1815,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.txEvent(TxEventDropped, tx, ErrAccountLimitExceeded)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
@@ -1385,6 +1881,7 @@ func (pool *TxPool) truncatePending() {
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
+						pool.txEvent(TxEventDropped, tx, ErrTxPoolOverflow)
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 					}
 					pool.priced.Removed(len(caps))
@@ -1412,6 +1909,7 @@ func (pool *TxPool) truncatePending() {
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
+					pool.txEvent(TxEventDropped, tx, ErrTxPoolOverflow)
 					log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 				}
 				pool.priced.Removed(len(caps))
@@ -1455,6 +1953,7 @@ func (pool *TxPool) truncateQueue() {
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
+				pool.txEvent(TxEventDropped, tx, ErrTxPoolOverflow)
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1464,6 +1963,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.txEvent(TxEventDropped, txs[i], ErrTxPoolOverflow)
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1488,6 +1988,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		for _, tx := range olds {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvent(TxEventDropped, tx, ErrNonceTooLow)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
@@ -1496,6 +1997,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.txEvent(TxEventDropped, tx, pool.unpayable(tx))
 		}
 		pendingNofundsMeter.Mark(int64(len(drops)))
 
@@ -1505,6 +2007,7 @@ func (pool *TxPool) demoteUnexecutables() {
 
 			// Internal shuffle shouldn't touch the lookup set.
 			pool.enqueueTx(hash, tx, false, false)
+			pool.txEvent(TxEventDemoted, tx, ErrNonceGap)
 		}
 		pendingGauge.Dec(int64(len(olds) + len(drops) + len(invalids)))
 		if pool.locals.contains(addr) {
@@ -1519,6 +2022,7 @@ func (pool *TxPool) demoteUnexecutables() {
 
 				// Internal shuffle shouldn't touch the lookup set.
 				pool.enqueueTx(hash, tx, false, false)
+				pool.txEvent(TxEventDemoted, tx, ErrNonceGap)
 			}
 			pendingGauge.Dec(int64(len(gapped)))
 			// This might happen in a reorg, so log it to the metering
@@ -1634,13 +2138,18 @@ type txLookup struct {
 	lock    sync.RWMutex
 	locals  map[common.Hash]*types.Transaction
 	remotes map[common.Hash]*types.Transaction
+
+	targets   map[common.Address]int // Number of transactions sent to each address
+	selectors map[txSelector]int     // Number of transactions calling each contract method
 }
 
 // newTxLookup returns a new txLookup structure.
 func newTxLookup() *txLookup {
 	return &txLookup{
-		locals:  make(map[common.Hash]*types.Transaction),
-		remotes: make(map[common.Hash]*types.Transaction),
+		locals:    make(map[common.Hash]*types.Transaction),
+		remotes:   make(map[common.Hash]*types.Transaction),
+		targets:   make(map[common.Address]int),
+		selectors: make(map[txSelector]int),
 	}
 }
 
@@ -1718,6 +2227,24 @@ func (t *txLookup) RemoteCount() int {
 	return len(t.remotes)
 }
 
+// TargetCount returns the number of transactions in the lookup sent to the given
+// address.
+func (t *txLookup) TargetCount(addr common.Address) int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.targets[addr]
+}
+
+// SelectorCount returns the number of transactions in the lookup calling the
+// given contract method.
+func (t *txLookup) SelectorCount(sel txSelector) int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.selectors[sel]
+}
+
 // Slots returns the current number of slots used in the lookup.
 func (t *txLookup) Slots() int {
 	t.lock.RLock()
@@ -1739,6 +2266,12 @@ func (t *txLookup) Add(tx *types.Transaction, local bool) {
 	} else {
 		t.remotes[tx.Hash()] = tx
 	}
+	if to := tx.To(); to != nil {
+		t.targets[*to]++
+	}
+	if sel, ok := selectorOf(tx); ok {
+		t.selectors[sel]++
+	}
 }
 
 // Remove removes a transaction from the lookup.
@@ -1759,6 +2292,17 @@ func (t *txLookup) Remove(hash common.Hash) {
 
 	delete(t.locals, hash)
 	delete(t.remotes, hash)
+
+	if to := tx.To(); to != nil {
+		if t.targets[*to]--; t.targets[*to] == 0 {
+			delete(t.targets, *to)
+		}
+	}
+	if sel, ok := selectorOf(tx); ok {
+		if t.selectors[sel]--; t.selectors[sel] == 0 {
+			delete(t.selectors, sel)
+		}
+	}
 }
 
 // RemoteToLocals migrates the transactions belongs to the given locals to locals
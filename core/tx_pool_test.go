@@ -2348,6 +2348,418 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that remote transactions are snapshotted on shutdown and reinjected on
+// startup, dropping the ones invalidated in the meantime.
+func TestTransactionSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary file for the snapshot
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary snapshot: %v", err)
+	}
+	snapshot := file.Name()
+	defer os.Remove(snapshot)
+
+	file.Close()
+	os.Remove(snapshot)
+
+	// Create the original pool to inject transactions into the snapshot
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Snapshot = snapshot
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	stale, _ := crypto.GenerateKey()
+
+	testAddBalance(pool, crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(stale.PublicKey), big.NewInt(1000000000))
+
+	// Add a local, two pending and a queued remote, and a soon stale remote transaction
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.addRemoteSync(pricedTransaction(nonce, 100000, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("failed to add remote transaction %d: %v", nonce, err)
+		}
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), stale)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 4 || queued != 1 {
+		t.Fatalf("transaction count mismatch: have %d/%d, want %d/%d", pending, queued, 4, 1)
+	}
+	// Terminate the old pool, include the stale transaction and ensure the valid
+	// remotes survive the restart
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(stale.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(); pending != 2 || queued != 1 {
+		t.Fatalf("transaction count mismatch: have %d/%d, want %d/%d", pending, queued, 2, 1)
+	}
+	if pool.Has(pricedTransaction(0, 100000, big.NewInt(1), local).Hash()) {
+		t.Errorf("local transaction snapshotted")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that private transactions are tracked with their expiry, are left out
+// of the journal and are dropped from the pool once they expire.
+func TestTransactionPrivate(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary file for the journal
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary journal: %v", err)
+	}
+	journal := file.Name()
+	defer os.Remove(journal)
+
+	file.Close()
+	os.Remove(journal)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Journal = journal
+	config.PrivateLifetime = 3
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Add a public local transaction and private ones with explicit and default lifetimes
+	public := transaction(0, 100000, key)
+	short := transaction(1, 100000, key)
+	long := transaction(3, 100000, key)
+
+	if err := pool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddPrivate(short, 1); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(long, 0); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(long, 0); err != ErrAlreadyKnown {
+		t.Fatalf("duplicate private transaction error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if err := pool.AddPrivate(public, 0); err != ErrAlreadyKnown {
+		t.Fatalf("public transaction made private: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if pool.IsPrivate(public.Hash()) || !pool.IsPrivate(short.Hash()) || !pool.IsPrivate(long.Hash()) {
+		t.Fatalf("private transaction marks mismatch")
+	}
+	private := pool.Private()
+	if len(private) != 2 || private[short.Hash()] != 1 || private[long.Hash()] != 3 {
+		t.Fatalf("private transaction expiries mismatch: have %v", private)
+	}
+	if status := pool.Status([]common.Hash{short.Hash(), long.Hash()}); status[0] != TxStatusPending || status[1] != TxStatusQueued {
+		t.Fatalf("private transaction status mismatch: have %v", status)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Ensure only the public transaction made it into the journal
+	pool.mu.Lock()
+	local := pool.local()
+	pool.mu.Unlock()
+
+	if txs := local[crypto.PubkeyToAddress(key.PublicKey)]; len(txs) != 1 || txs[0].Hash() != public.Hash() {
+		t.Fatalf("journaled local transactions mismatch: have %v", txs)
+	}
+	var journaled []*types.Transaction
+	if err := newTxJournal(journal).load(func(txs []*types.Transaction) []error {
+		journaled = append(journaled, txs...)
+		return make([]error, len(txs))
+	}); err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if len(journaled) != 1 || journaled[0].Hash() != public.Hash() {
+		t.Fatalf("journal content mismatch: have %d txs, want 1", len(journaled))
+	}
+	// Advance the chain and ensure the private transactions expire one by one
+	for number, want := range []int{3, 2, 2, 1} {
+		<-pool.requestReset(nil, &types.Header{Number: big.NewInt(int64(number)), GasLimit: 1000000, BaseFee: big.NewInt(1)})
+		if pending, queued := pool.Stats(); pending+queued != want {
+			t.Fatalf("block %d: pooled transactions mismatch: have %d, want %d", number, pending+queued, want)
+		}
+		if err := validateTxPoolInternals(pool); err != nil {
+			t.Fatalf("block %d: pool internal state corrupted: %v", number, err)
+		}
+	}
+	if pool.Has(short.Hash()) || pool.Has(long.Hash()) || !pool.Has(public.Hash()) {
+		t.Fatalf("expired private transactions not dropped")
+	}
+	if private := pool.Private(); len(private) != 0 {
+		t.Fatalf("expired private transactions still marked: %v", private)
+	}
+}
+
+// Tests that conditional transactions are only accepted while their preconditions
+// may hold, and are dropped as soon as they can't anymore.
+func TestTransactionConditional(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	contract, slot := common.Address{0xc0}, common.Hash{0x01}
+	pool.mu.Lock()
+	pool.currentState.SetState(contract, slot, common.Hash{0x01})
+	pool.mu.Unlock()
+
+	// Ensure unsatisfiable preconditions are rejected
+	past, min := big.NewInt(0), big.NewInt(5)
+	tests := []struct {
+		cond *TxConditions
+		err  error
+	}{
+		{&TxConditions{BlockNumberMax: past}, ErrConditionBlockNumber},
+		{&TxConditions{BlockNumberMin: min, BlockNumberMax: past}, ErrConditionBlockNumber},
+		{&TxConditions{KnownAccounts: map[common.Address]KnownAccount{contract: {StorageSlots: map[common.Hash]common.Hash{slot: {0x02}}}}}, ErrConditionStorage},
+		{&TxConditions{KnownAccounts: map[common.Address]KnownAccount{contract: {StorageRoot: &common.Hash{}}}}, ErrConditionStorage},
+	}
+	for i, tt := range tests {
+		if err := pool.AddConditional(transaction(0, 100000, key), tt.cond); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Add a satisfiable conditional transaction and check its inclusion constraints
+	tx := transaction(0, 100000, key)
+	cond := &TxConditions{
+		BlockNumberMin: min,
+		KnownAccounts:  map[common.Address]KnownAccount{contract: {StorageSlots: map[common.Hash]common.Hash{slot: {0x01}}}},
+	}
+	if err := pool.AddConditional(tx, cond); err != nil {
+		t.Fatalf("failed to add conditional transaction: %v", err)
+	}
+	if !pool.IsPrivate(tx.Hash()) || pool.Conditions(tx.Hash()) != cond {
+		t.Fatalf("conditional transaction not tracked")
+	}
+	pool.mu.Lock()
+	early := cond.Check(&types.Header{Number: big.NewInt(4)}, pool.currentState)
+	ready := cond.Check(&types.Header{Number: big.NewInt(5)}, pool.currentState)
+	pool.mu.Unlock()
+
+	if !errors.Is(early, ErrConditionBlockNumber) {
+		t.Errorf("early inclusion error mismatch: have %v, want %v", early, ErrConditionBlockNumber)
+	}
+	if ready != nil {
+		t.Errorf("inclusion prevented: %v", ready)
+	}
+	// Change the expected storage and ensure the transaction is dropped on the next head
+	pool.mu.Lock()
+	pool.currentState.SetState(contract, slot, common.Hash{0x02})
+	pool.mu.Unlock()
+
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(1), GasLimit: 1000000, BaseFee: big.NewInt(1)})
+	if pool.Has(tx.Hash()) {
+		t.Fatalf("unsatisfiable conditional transaction retained")
+	}
+	if ev, ok := pool.LastEvent(tx.Hash()); !ok || ev.Type != TxEventDropped || !errors.Is(ev.Reason, ErrConditionStorage) {
+		t.Errorf("drop event mismatch: have %v (%v)", ev.Type, ev.Reason)
+	}
+}
+
+// Tests that every change of a transaction within the pool is reported with its
+// reason, and that the latest change remains retrievable.
+func TestTransactionPoolEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+
+	// expect checks that exactly the given events were posted, in order
+	expect := func(want ...TxPoolEvent) {
+		t.Helper()
+		for i, w := range want {
+			select {
+			case ev := <-events:
+				if ev.Tx.Hash() != w.Tx.Hash() || ev.Type != w.Type || ev.Reason != w.Reason || ev.ReplacedBy != w.ReplacedBy {
+					t.Fatalf("event %d mismatch: have %v %x (%v), want %v %x (%v)", i, ev.Type, ev.Tx.Hash(), ev.Reason, w.Type, w.Tx.Hash(), w.Reason)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("event %d missing: want %v %x", i, w.Type, w.Tx.Hash())
+			}
+		}
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event: %v %x", ev.Type, ev.Tx.Hash())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// Add a gapped transaction, and then fill the gap
+	tx0, tx1 := pricedTransaction(0, 100000, big.NewInt(1), key), pricedTransaction(1, 100000, big.NewInt(1), key)
+	if err := pool.addRemoteSync(tx1); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	expect(TxPoolEvent{Tx: tx1, Type: TxEventAdded})
+
+	if err := pool.addRemoteSync(tx0); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	expect(TxPoolEvent{Tx: tx0, Type: TxEventAdded}, TxPoolEvent{Tx: tx0, Type: TxEventPromoted}, TxPoolEvent{Tx: tx1, Type: TxEventPromoted})
+
+	// Replace a pending transaction
+	rep := pricedTransaction(1, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(rep); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	expect(TxPoolEvent{Tx: tx1, Type: TxEventReplaced, ReplacedBy: rep.Hash()}, TxPoolEvent{Tx: rep, Type: TxEventAdded}, TxPoolEvent{Tx: rep, Type: TxEventPromoted})
+
+	// Raise the minimum price, dropping the cheap remote transactions
+	pool.SetGasPrice(big.NewInt(2))
+	expect(TxPoolEvent{Tx: tx0, Type: TxEventDropped, Reason: ErrUnderpriced}, TxPoolEvent{Tx: rep, Type: TxEventDemoted, Reason: ErrNonceGap})
+
+	// Ensure the latest event of each transaction is retained
+	if ev, ok := pool.LastEvent(tx1.Hash()); !ok || ev.Type != TxEventReplaced || ev.ReplacedBy != rep.Hash() {
+		t.Errorf("replaced transaction last event mismatch: have %v %x", ev.Type, ev.ReplacedBy)
+	}
+	if ev, ok := pool.LastEvent(tx0.Hash()); !ok || ev.Type != TxEventDropped || ev.Reason != ErrUnderpriced {
+		t.Errorf("dropped transaction last event mismatch: have %v %v", ev.Type, ev.Reason)
+	}
+	if ev, ok := pool.LastEvent(rep.Hash()); !ok || ev.Type != TxEventDemoted {
+		t.Errorf("demoted transaction last event mismatch: have %v", ev.Type)
+	}
+	if _, ok := pool.LastEvent(common.Hash{}); ok {
+		t.Errorf("unknown transaction has an event")
+	}
+}
+
+// Tests that subscribers not keeping up with the transaction events don't block
+// the pool, the events exceeding the queue being dropped instead.
+func TestTransactionPoolEventsSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	events := make(chan TxPoolEvent)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	batch := make([]TxPoolEvent, 2*txEventQueueLimit)
+	for i := range batch {
+		batch[i] = TxPoolEvent{Tx: transaction(uint64(i), 100000, key), Type: TxEventAdded}
+	}
+	done := make(chan struct{})
+	go func() {
+		pool.sendTxEvents(batch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending events blocked on the subscriber")
+	}
+	// The events queued are still delivered in order
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Tx.Hash() != batch[i].Tx.Hash() {
+				t.Fatalf("event %d mismatch: have %x, want %x", i, ev.Tx.Hash(), batch[i].Tx.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d missing", i)
+		}
+	}
+}
+
+// Tests that the per contract and per method transaction counts, as well as the
+// per sender admission rates are enforced.
+func TestTransactionLimits(t *testing.T) {
+	t.Parallel()
+
+	pool, _ := setupTxPool()
+	defer pool.Stop()
+
+	pool.SetLimits(TxPoolLimits{ContractSlots: 2, SelectorSlots: 1})
+
+	contract := common.Address{0xc0}
+	pool.mu.Lock()
+	pool.currentState.SetCode(contract, []byte{0x00})
+	pool.mu.Unlock()
+
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		testAddBalance(pool, crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	call := func(nonce uint64, to common.Address, sig byte, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(0), 100000, big.NewInt(price), []byte{sig, 0, 0, 0}), types.HomesteadSigner{}, key)
+		return tx
+	}
+	tests := []struct {
+		tx  *types.Transaction
+		err error
+	}{
+		{call(0, contract, 0x01, 1, keys[0]), nil},
+		{call(0, contract, 0x01, 1, keys[1]), ErrSelectorLimit},
+		{call(0, contract, 0x02, 1, keys[1]), nil},
+		{call(0, contract, 0x03, 1, keys[2]), ErrContractLimit},
+		{call(0, contract, 0x01, 2, keys[0]), nil},             // replacement calling the same method
+		{call(0, common.Address{0xee}, 0x01, 1, keys[2]), nil}, // not a contract
+		{call(1, common.Address{0xee}, 0x01, 1, keys[2]), nil},
+	}
+	for i, tt := range tests {
+		if err := pool.addRemoteSync(tt.tx); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Ensure senders are throttled after exhausting their burst
+	pool.SetLimits(TxPoolLimits{SenderRate: 0.001, SenderBurst: 2})
+	if limits := pool.Limits(); limits.SenderRate != 0.001 || limits.SenderBurst != 2 || limits.ContractSlots != 0 {
+		t.Fatalf("limits mismatch: have %+v", limits)
+	}
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		err := pool.addRemoteSync(pricedTransaction(nonce, 100000, big.NewInt(1), keys[3]))
+		if nonce < 2 && err != nil {
+			t.Errorf("transaction %d: failed to add: %v", nonce, err)
+		}
+		if nonce == 2 && err != ErrSenderRateLimit {
+			t.Errorf("transaction %d: error mismatch: have %v, want %v", nonce, err, ErrSenderRateLimit)
+		}
+	}
+	if err := pool.addRemoteSync(pricedTransaction(2, 100000, big.NewInt(1), keys[2])); err != nil {
+		t.Errorf("other sender throttled: %v", err)
+	}
+	// Ensure local submissions are throttled too, unless of configured local accounts
+	if err := pool.AddLocal(pricedTransaction(2, 100000, big.NewInt(1), keys[3])); err != ErrSenderRateLimit {
+		t.Errorf("local transaction error mismatch: have %v, want %v", err, ErrSenderRateLimit)
+	}
+	pool.exempt.add(crypto.PubkeyToAddress(keys[3].PublicKey))
+	if err := pool.AddLocal(pricedTransaction(2, 100000, big.NewInt(1), keys[3])); err != nil {
+		t.Errorf("configured local account throttled: %v", err)
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
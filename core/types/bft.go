@@ -0,0 +1,90 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// BFTDigest is the mix digest marking headers sealed by the BFT engine.
+	BFTDigest = common.HexToHash("0x63746963616c2062797a616e74696e65206661756c7420746f6c6572616e6365")
+
+	// BFTExtraVanity is the number of extra-data prefix bytes reserved for vanity.
+	BFTExtraVanity = 32
+
+	// ErrInvalidBFTHeaderExtra is returned if the extra-data of a header can't be
+	// decoded into the BFT fields.
+	ErrInvalidBFTHeaderExtra = errors.New("invalid bft header extra-data")
+)
+
+// BFTExtra is the consensus data stored in the extra-data of BFT headers, after
+// the vanity prefix.
+type BFTExtra struct {
+	Validators     []common.Address // Validator set authorized to seal the block
+	Seal           []byte           // Signature of the proposer over the seal hash
+	CommittedSeals [][]byte         // Signatures of the validators committing the block
+}
+
+// ExtractBFTExtra extracts the BFT fields from the extra-data of a header.
+func ExtractBFTExtra(h *Header) (*BFTExtra, error) {
+	if len(h.Extra) < BFTExtraVanity {
+		return nil, ErrInvalidBFTHeaderExtra
+	}
+	extra := new(BFTExtra)
+	if err := rlp.DecodeBytes(h.Extra[BFTExtraVanity:], extra); err != nil {
+		return nil, err
+	}
+	return extra, nil
+}
+
+// EncodeBFTExtra assembles the extra-data of a header from the vanity prefix and
+// the BFT fields.
+func EncodeBFTExtra(vanity []byte, extra *BFTExtra) ([]byte, error) {
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, BFTExtraVanity, BFTExtraVanity+len(payload))
+	copy(buf, vanity)
+	return append(buf, payload...), nil
+}
+
+// BFTFilteredHeader returns a copy of the header with the committed seals removed
+// from its extra-data, and the proposer seal too unless keepSeal is set. It
+// returns nil if the extra-data is not a valid BFT one.
+func BFTFilteredHeader(h *Header, keepSeal bool) *Header {
+	extra, err := ExtractBFTExtra(h)
+	if err != nil {
+		return nil
+	}
+	if !keepSeal {
+		extra.Seal = []byte{}
+	}
+	extra.CommittedSeals = [][]byte{}
+
+	payload, err := EncodeBFTExtra(h.Extra[:BFTExtraVanity], extra)
+	if err != nil {
+		return nil
+	}
+	cpy := CopyHeader(h)
+	cpy.Extra = payload
+	return cpy
+}
@@ -100,8 +100,14 @@ type headerMarshaling struct {
 }
 
 // Hash returns the block hash of the header, which is simply the keccak256 hash of its
-// RLP encoding.
+// RLP encoding. The hash of BFT headers excludes the committed seals, as different
+// quorums of validators may commit the same block.
 func (h *Header) Hash() common.Hash {
+	if h.MixDigest == BFTDigest {
+		if filtered := BFTFilteredHeader(h, true); filtered != nil {
+			return rlpHash(filtered)
+		}
+	}
 	return rlpHash(h)
 }
 
@@ -34,7 +34,11 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
@@ -82,6 +86,111 @@ func (api *PublicMinerAPI) Mining() bool {
 	return api.e.IsMining()
 }
 
+// PublicBundleAPI provides an API to submit and simulate atomic transaction
+// bundles, which the local miner includes in the targeted block either as a
+// whole or not at all.
+type PublicBundleAPI struct {
+	e *Ethereum
+}
+
+// NewPublicBundleAPI creates a new RPC service for transaction bundles.
+func NewPublicBundleAPI(e *Ethereum) *PublicBundleAPI {
+	return &PublicBundleAPI{e}
+}
+
+// BundleArgs represents the arguments to submit or simulate a bundle.
+type BundleArgs struct {
+	Txs               []hexutil.Bytes `json:"txs"`
+	BlockNumber       hexutil.Uint64  `json:"blockNumber"`
+	MinTimestamp      *hexutil.Uint64 `json:"minTimestamp"`
+	MaxTimestamp      *hexutil.Uint64 `json:"maxTimestamp"`
+	RevertingTxHashes []common.Hash   `json:"revertingTxHashes"`
+}
+
+// toBundle decodes the transactions of the bundle.
+func (args *BundleArgs) toBundle() (*miner.Bundle, error) {
+	bundle := &miner.Bundle{
+		BlockNumber:       uint64(args.BlockNumber),
+		RevertingTxHashes: args.RevertingTxHashes,
+	}
+	for i, input := range args.Txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(input); err != nil {
+			return nil, fmt.Errorf("tx %d: %v", i, err)
+		}
+		bundle.Txs = append(bundle.Txs, tx)
+	}
+	if args.MinTimestamp != nil {
+		bundle.MinTimestamp = uint64(*args.MinTimestamp)
+	}
+	if args.MaxTimestamp != nil {
+		bundle.MaxTimestamp = uint64(*args.MaxTimestamp)
+	}
+	return bundle, nil
+}
+
+// bundleHash is the hash identifying a bundle, the hash of its transaction hashes.
+func bundleHash(bundle *miner.Bundle) common.Hash {
+	hashes := make([]byte, 0, len(bundle.Txs)*common.HashLength)
+	for _, tx := range bundle.Txs {
+		hashes = append(hashes, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(hashes)
+}
+
+// SendBundle queues up a bundle for inclusion in the block it targets, returning
+// the bundle hash.
+func (api *PublicBundleAPI) SendBundle(ctx context.Context, args BundleArgs) (common.Hash, error) {
+	bundle, err := args.toBundle()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.Miner().AddBundle(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	hash := bundleHash(bundle)
+	log.Info("Submitted bundle", "hash", hash, "number", bundle.BlockNumber, "txs", len(bundle.Txs))
+	return hash, nil
+}
+
+// SimulateBundle executes a bundle on top of the current chain head, as if it
+// was included at the start of the next block, and reports its gas usage and the
+// profit for the miner. The bundle block number is optional.
+func (api *PublicBundleAPI) SimulateBundle(ctx context.Context, args BundleArgs) (map[string]interface{}, error) {
+	bundle, err := args.toBundle()
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.e.Miner().SimulateBundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]map[string]interface{}, len(result.Txs))
+	for i, tx := range result.Txs {
+		txs[i] = map[string]interface{}{
+			"txHash":   tx.Hash,
+			"gasUsed":  hexutil.Uint64(tx.GasUsed),
+			"reverted": tx.Reverted,
+			"profit":   (*hexutil.Big)(tx.Profit),
+		}
+	}
+	fields := map[string]interface{}{
+		"bundleHash":  bundleHash(bundle),
+		"blockNumber": hexutil.Uint64(result.BlockNumber),
+		"timestamp":   hexutil.Uint64(result.Timestamp),
+		"coinbase":    result.Coinbase,
+		"gasUsed":     hexutil.Uint64(result.GasUsed),
+		"profit":      (*hexutil.Big)(result.Profit),
+		"gasPrice":    (*hexutil.Big)(result.GasPrice),
+		"results":     txs,
+		"includable":  result.Err == nil,
+	}
+	if result.Err != nil {
+		fields["error"] = result.Err.Error()
+	}
+	return fields, nil
+}
+
 // PrivateMinerAPI provides private RPC methods to control the miner.
 // These methods can be abused by external users and must be considered insecure for use by untrusted users.
 type PrivateMinerAPI struct {
@@ -158,6 +267,52 @@ func NewPrivateAdminAPI(eth *Ethereum) *PrivateAdminAPI {
 	return &PrivateAdminAPI{eth: eth}
 }
 
+// TxPoolLimits are the spam protection limits of the transaction pool, with nil
+// fields left unchanged on update.
+type TxPoolLimits struct {
+	ContractSlots *hexutil.Uint64 `json:"contractSlots"`
+	SelectorSlots *hexutil.Uint64 `json:"selectorSlots"`
+	SenderRate    *float64        `json:"senderRate"`
+	SenderBurst   *hexutil.Uint64 `json:"senderBurst"`
+}
+
+// TxPoolLimits returns the spam protection limits enforced by the transaction pool.
+func (api *PrivateAdminAPI) TxPoolLimits() TxPoolLimits {
+	limits := api.eth.txPool.Limits()
+	return TxPoolLimits{
+		ContractSlots: (*hexutil.Uint64)(&limits.ContractSlots),
+		SelectorSlots: (*hexutil.Uint64)(&limits.SelectorSlots),
+		SenderRate:    &limits.SenderRate,
+		SenderBurst:   (*hexutil.Uint64)(&limits.SenderBurst),
+	}
+}
+
+// SetTxPoolLimits updates the spam protection limits enforced by the transaction
+// pool. Zero values disable the respective limit.
+func (api *PrivateAdminAPI) SetTxPoolLimits(args TxPoolLimits) (bool, error) {
+	limits := api.eth.txPool.Limits()
+	if args.ContractSlots != nil {
+		limits.ContractSlots = uint64(*args.ContractSlots)
+	}
+	if args.SelectorSlots != nil {
+		limits.SelectorSlots = uint64(*args.SelectorSlots)
+	}
+	if args.SenderRate != nil {
+		if *args.SenderRate < 0 {
+			return false, errors.New("negative sender rate")
+		}
+		limits.SenderRate = *args.SenderRate
+	}
+	if args.SenderBurst != nil {
+		if *args.SenderBurst == 0 {
+			return false, errors.New("zero sender burst")
+		}
+		limits.SenderBurst = uint64(*args.SenderBurst)
+	}
+	api.eth.txPool.SetLimits(limits)
+	return true, nil
+}
+
 // ExportChain exports the current blockchain into a local file,
 // or a range of blocks if first and last are non-nil
 func (api *PrivateAdminAPI) ExportChain(file string, first *uint64, last *uint64) (bool, error) {
@@ -354,6 +509,41 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs,
 	return results, nil
 }
 
+// executionWitnessReexec is the maximum number of blocks to re-execute in order to
+// regenerate a missing parent state for an execution witness.
+const executionWitnessReexec = 128
+
+// ExecutionWitness re-executes the given block on top of its parent state and
+// returns the witness of all trie nodes, contract codes and ancestor headers it
+// accessed. Together with the parent header, the witness suffices to verify the
+// block statelessly.
+func (api *PrivateDebugAPI) ExecutionWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.Witness, error) {
+	block, err := api.eth.APIBackend.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis has no execution witness")
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	statedb, err := api.eth.stateAtBlock(parent, executionWitnessReexec, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	processor := core.NewStateProcessor(api.eth.blockchain.Config(), api.eth.blockchain, api.eth.engine)
+	witness, _, _, err := processor.ProcessWithWitness(block, parent.Root(), statedb.Database(), vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
 // AccountRangeMaxResults is the maximum number of results to be returned per call
 const AccountRangeMaxResults = 256
 
@@ -71,9 +71,57 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
+	if number == rpc.FinalizedBlockNumber {
+		return b.finalizedHeader()
+	}
+	if number == rpc.SafeBlockNumber {
+		return b.safeHeader()
+	}
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
+// finalizedHeader returns the latest finalized block. It is determined by the
+// consensus engine, chosen by the consensus client, or at the configured
+// confirmation depth, in this order of precedence.
+func (b *EthAPIBackend) finalizedHeader() (*types.Header, error) {
+	if engine, ok := b.eth.engine.(consensus.FinalityEngine); ok {
+		return engine.FinalizedHeader(b.eth.blockchain), nil
+	}
+	if header := b.eth.blockchain.CurrentFinalizedHeader(); header != nil {
+		return header, nil
+	}
+	if depth := b.eth.config.RPCFinalizedDepth; depth > 0 {
+		return b.confirmedHeader(depth), nil
+	}
+	return nil, errors.New("finalized block not available")
+}
+
+// safeHeader returns the latest safe block. It is chosen by the consensus client,
+// or at the configured confirmation depth, falling back to the finalized block.
+// Blocks finalized by the consensus engine are final instantly, so they're safe
+// too.
+func (b *EthAPIBackend) safeHeader() (*types.Header, error) {
+	if _, ok := b.eth.engine.(consensus.FinalityEngine); !ok {
+		if header := b.eth.blockchain.CurrentSafeHeader(); header != nil {
+			return header, nil
+		}
+		if depth := b.eth.config.RPCSafeDepth; depth > 0 {
+			return b.confirmedHeader(depth), nil
+		}
+	}
+	return b.finalizedHeader()
+}
+
+// confirmedHeader returns the canonical block the given number of blocks below
+// the head, or the genesis block if the chain is shorter.
+func (b *EthAPIBackend) confirmedHeader(depth uint64) *types.Header {
+	head := b.eth.blockchain.CurrentBlock().NumberU64()
+	if head < depth {
+		return b.eth.blockchain.GetHeaderByNumber(0)
+	}
+	return b.eth.blockchain.GetHeaderByNumber(head - depth)
+}
+
 func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.HeaderByNumber(ctx, blockNr)
@@ -105,6 +153,13 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		header, err := b.HeaderByNumber(ctx, number)
+		if err != nil || header == nil {
+			return nil, err
+		}
+		return b.eth.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
+	}
 	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
 }
 
@@ -234,6 +289,14 @@ func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.AddLocal(signedTx)
 }
 
+func (b *EthAPIBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, lifetime uint64) error {
+	return b.eth.txPool.AddPrivate(signedTx, lifetime)
+}
+
+func (b *EthAPIBackend) SendConditionalTx(ctx context.Context, signedTx *types.Transaction, cond *core.TxConditions) error {
+	return b.eth.txPool.AddConditional(signedTx, cond)
+}
+
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	pending, err := b.eth.txPool.Pending(false)
 	if err != nil {
@@ -271,6 +334,18 @@ func (b *EthAPIBackend) TxPoolContentFrom(addr common.Address) (types.Transactio
 	return b.eth.TxPool().ContentFrom(addr)
 }
 
+func (b *EthAPIBackend) TxPoolPrivate() map[common.Hash]uint64 {
+	return b.eth.TxPool().Private()
+}
+
+func (b *EthAPIBackend) TxPoolTxStatus(hash common.Hash) (core.TxStatus, *core.TxPoolEvent) {
+	status := b.eth.TxPool().Status([]common.Hash{hash})[0]
+	if ev, ok := b.eth.TxPool().LastEvent(hash); ok {
+		return status, &ev
+	}
+	return status, nil
+}
+
 func (b *EthAPIBackend) TxPool() *core.TxPool {
 	return b.eth.TxPool()
 }
@@ -279,6 +354,10 @@ func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.S
 	return b.eth.TxPool().SubscribeNewTxsEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeTxPoolEvent(ch chan<- core.TxPoolEvent) event.Subscription {
+	return b.eth.TxPool().SubscribeTxPoolEvent(ch)
+}
+
 func (b *EthAPIBackend) Downloader() *downloader.Downloader {
 	return b.eth.Downloader()
 }
@@ -324,6 +403,16 @@ func (b *EthAPIBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, sections
 }
 
+// LogIndexStatus implements filters.LogIndexBackend, reporting the sections of
+// the log index if enabled.
+func (b *EthAPIBackend) LogIndexStatus() (uint64, uint64) {
+	if b.eth.logIndexer == nil {
+		return params.BloomBitsBlocks, 0
+	}
+	sections, _, _ := b.eth.logIndexer.Sections()
+	return params.BloomBitsBlocks, sections
+}
+
 func (b *EthAPIBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	for i := 0; i < bloomFilterThreads; i++ {
 		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, b.eth.bloomRequests)
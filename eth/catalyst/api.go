@@ -14,14 +14,18 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package catalyst implements the temporary eth1/eth2 RPC integration.
+// Package catalyst implements the engine API, the RPC interface through which a
+// consensus client drives the execution layer.
 package catalyst
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
-	"time"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/misc"
@@ -36,7 +40,8 @@ import (
 	"github.com/ethereum/go-ethereum/trie"
 )
 
-// Register adds catalyst APIs to the node.
+// Register adds the engine API to the node. The API is only served on the
+// authenticated RPC endpoint.
 func Register(stack *node.Node, backend *eth.Ethereum) error {
 	chainconfig := backend.BlockChain().Config()
 	if chainconfig.CatalystBlock == nil {
@@ -48,21 +53,33 @@ func Register(stack *node.Node, backend *eth.Ethereum) error {
 	log.Warn("Catalyst mode enabled")
 	stack.RegisterAPIs([]rpc.API{
 		{
-			Namespace: "consensus",
-			Version:   "1.0",
-			Service:   newConsensusAPI(backend),
-			Public:    true,
+			Namespace:     "engine",
+			Version:       "1.0",
+			Service:       NewConsensusAPI(backend),
+			Public:        true,
+			Authenticated: true,
 		},
 	})
 	return nil
 }
 
-type consensusAPI struct {
-	eth *eth.Ethereum
+// maxTrackedPayloads is the maximum number of prepared payloads the execution
+// engine tracks before evicting old ones.
+const maxTrackedPayloads = 10
+
+// ConsensusAPI implements the engine API, through which a consensus client
+// drives block production and chain head selection.
+type ConsensusAPI struct {
+	eth      *eth.Ethereum
+	payloads *payloadQueue // Payloads prepared for the consensus client
 }
 
-func newConsensusAPI(eth *eth.Ethereum) *consensusAPI {
-	return &consensusAPI{eth: eth}
+// NewConsensusAPI creates a new engine API for the given backend.
+func NewConsensusAPI(eth *eth.Ethereum) *ConsensusAPI {
+	return &ConsensusAPI{
+		eth:      eth,
+		payloads: newPayloadQueue(),
+	}
 }
 
 // blockExecutionEnv gathers all the data required to execute
@@ -91,7 +108,7 @@ func (env *blockExecutionEnv) commitTransaction(tx *types.Transaction, coinbase
 	return nil
 }
 
-func (api *consensusAPI) makeEnv(parent *types.Block, header *types.Header) (*blockExecutionEnv, error) {
+func (api *ConsensusAPI) makeEnv(parent *types.Block, header *types.Header) (*blockExecutionEnv, error) {
 	state, err := api.eth.BlockChain().StateAt(parent.Root())
 	if err != nil {
 		return nil, err
@@ -105,39 +122,149 @@ func (api *consensusAPI) makeEnv(parent *types.Block, header *types.Header) (*bl
 	return env, nil
 }
 
-// AssembleBlock creates a new block, inserts it into the chain, and returns the "execution
-// data" required for eth2 clients to process the new block.
-func (api *consensusAPI) AssembleBlock(params assembleBlockParams) (*executableData, error) {
-	log.Info("Producing block", "parentHash", params.ParentHash)
-
+// ForkchoiceUpdatedV1 makes the given head block canonical. If payload attributes
+// are given, the building of a new payload on top of the head is started, which
+// can be retrieved via GetPayloadV1 with the returned payload id.
+func (api *ConsensusAPI) ForkchoiceUpdatedV1(update ForkchoiceStateV1, payloadAttributes *PayloadAttributesV1) (ForkChoiceResponse, error) {
+	log.Trace("Engine API request received", "method", "ForkchoiceUpdated", "head", update.HeadBlockHash, "finalized", update.FinalizedBlockHash, "safe", update.SafeBlockHash)
+	if update.HeadBlockHash == (common.Hash{}) {
+		log.Warn("Forkchoice requested update to zero hash")
+		return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, nil
+	}
 	bc := api.eth.BlockChain()
-	parent := bc.GetBlockByHash(params.ParentHash)
-	if parent == nil {
-		log.Warn("Cannot assemble block with parent hash to unknown block", "parentHash", params.ParentHash)
-		return nil, fmt.Errorf("cannot assemble block with unknown parent %s", params.ParentHash)
+
+	// If the head is unknown, or its state is missing, we can't follow yet. Syncing
+	// the missing chain segment is up to the consensus client feeding the payloads.
+	head := bc.GetBlockByHash(update.HeadBlockHash)
+	if head == nil || !bc.HasBlockAndState(head.Hash(), head.NumberU64()) {
+		log.Debug("Forkchoice requested unknown head", "hash", update.HeadBlockHash)
+		return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: SYNCING}}, nil
+	}
+	// The finalized and safe blocks must be known, and be ancestors of the head
+	for _, hash := range []common.Hash{update.FinalizedBlockHash, update.SafeBlockHash} {
+		if hash == (common.Hash{}) {
+			continue
+		}
+		block := bc.GetBlockByHash(hash)
+		if block == nil || block.NumberU64() > head.NumberU64() {
+			log.Warn("Forkchoice requested invalid finalized or safe block", "hash", hash)
+			return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, InvalidForkChoiceState
+		}
+		maxNonCanonical := uint64(math.MaxUint64)
+		if ancestor, _ := bc.GetAncestor(head.Hash(), head.NumberU64(), head.NumberU64()-block.NumberU64(), &maxNonCanonical); ancestor != hash {
+			log.Warn("Forkchoice requested invalid finalized or safe block", "hash", hash)
+			return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, InvalidForkChoiceState
+		}
+	}
+	if err := bc.SetChainHead(head); err != nil {
+		return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, err
+	}
+	if update.FinalizedBlockHash != (common.Hash{}) {
+		if err := bc.SetFinalized(update.FinalizedBlockHash); err != nil {
+			return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, InvalidForkChoiceState
+		}
 	}
+	if update.SafeBlockHash != (common.Hash{}) {
+		if err := bc.SetSafe(update.SafeBlockHash); err != nil {
+			return ForkChoiceResponse{PayloadStatus: PayloadStatusV1{Status: INVALID}}, InvalidForkChoiceState
+		}
+	}
+	valid := PayloadStatusV1{Status: VALID, LatestValidHash: &update.HeadBlockHash}
+	if payloadAttributes == nil {
+		return ForkChoiceResponse{PayloadStatus: valid}, nil
+	}
+	// Start building the requested payload on top of the new head
+	data, err := api.assembleBlock(head, payloadAttributes)
+	if err != nil {
+		log.Error("Failed to create payload", "err", err)
+		return ForkChoiceResponse{PayloadStatus: valid}, InvalidPayloadAttributes
+	}
+	id := computePayloadID(head.Hash(), payloadAttributes)
+	api.payloads.put(id, data)
 
-	pool := api.eth.TxPool()
+	log.Info("Prepared payload", "id", id, "number", data.Number, "hash", data.BlockHash, "txs", len(data.Transactions))
+	return ForkChoiceResponse{PayloadStatus: valid, PayloadID: &id}, nil
+}
 
-	if parent.Time() >= params.Timestamp {
-		return nil, fmt.Errorf("child timestamp lower than parent's: %d >= %d", parent.Time(), params.Timestamp)
-	}
-	if now := uint64(time.Now().Unix()); params.Timestamp > now+1 {
-		wait := time.Duration(params.Timestamp-now) * time.Second
-		log.Info("Producing block too far in the future", "wait", common.PrettyDuration(wait))
-		time.Sleep(wait)
+// GetPayloadV1 returns the payload prepared for the given payload id.
+func (api *ConsensusAPI) GetPayloadV1(payloadID PayloadID) (*ExecutableDataV1, error) {
+	log.Trace("Engine API request received", "method", "GetPayload", "id", payloadID)
+	data := api.payloads.get(payloadID)
+	if data == nil {
+		return nil, UnknownPayload
 	}
+	return data, nil
+}
 
-	pending, err := pool.Pending(true)
+// NewPayloadV1 executes the given payload and stores the resulting block, without
+// making it canonical. The head of the chain is only updated via ForkchoiceUpdatedV1.
+func (api *ConsensusAPI) NewPayloadV1(params ExecutableDataV1) (PayloadStatusV1, error) {
+	log.Trace("Engine API request received", "method", "NewPayload", "number", params.Number, "hash", params.BlockHash)
+	block, err := ExecutableDataToBlock(params)
 	if err != nil {
-		return nil, err
+		log.Debug("Invalid payload", "number", params.Number, "hash", params.BlockHash, "err", err)
+		return PayloadStatusV1{Status: INVALID_BLOCK_HASH}, nil
 	}
+	bc := api.eth.BlockChain()
 
-	coinbase, err := api.eth.Etherbase()
+	// If we already have the block, there's nothing to do
+	if bc.HasBlockAndState(block.Hash(), block.NumberU64()) {
+		hash := block.Hash()
+		return PayloadStatusV1{Status: VALID, LatestValidHash: &hash}, nil
+	}
+	// If the parent or its state is missing, the block can't be executed yet
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil || !bc.HasBlockAndState(parent.Hash(), parent.NumberU64()) {
+		log.Debug("Payload with unknown parent", "number", block.NumberU64(), "hash", block.Hash(), "parent", block.ParentHash())
+		return PayloadStatusV1{Status: SYNCING}, nil
+	}
+	parentHash := parent.Hash()
+	if block.Time() <= parent.Time() {
+		log.Warn("Invalid timestamp", "parent", parent.Time(), "block", block.Time())
+		return invalidStatus(parentHash, errors.New("invalid timestamp")), nil
+	}
+	if err := bc.InsertBlockWithoutSetHead(block); err != nil {
+		log.Warn("Payload execution failed", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		return invalidStatus(parentHash, err), nil
+	}
+	hash := block.Hash()
+	return PayloadStatusV1{Status: VALID, LatestValidHash: &hash}, nil
+}
+
+// invalidStatus creates an INVALID payload status with the given latest valid
+// hash and validation error.
+func invalidStatus(latestValid common.Hash, err error) PayloadStatusV1 {
+	msg := err.Error()
+	return PayloadStatusV1{Status: INVALID, LatestValidHash: &latestValid, ValidationError: &msg}
+}
+
+// computePayloadID computes a pseudo-random payload id, based on the parameters
+// the payload is built with.
+func computePayloadID(headBlockHash common.Hash, params *PayloadAttributesV1) PayloadID {
+	hasher := sha256.New()
+	hasher.Write(headBlockHash[:])
+	binary.Write(hasher, binary.BigEndian, params.Timestamp)
+	hasher.Write(params.Random[:])
+	hasher.Write(params.SuggestedFeeRecipient[:])
+
+	var out PayloadID
+	copy(out[:], hasher.Sum(nil)[:8])
+	return out
+}
+
+// assembleBlock creates a new block on top of the given parent, filled with the
+// pending transactions of the pool, and returns its execution payload.
+func (api *ConsensusAPI) assembleBlock(parent *types.Block, params *PayloadAttributesV1) (*ExecutableDataV1, error) {
+	if parent.Time() >= params.Timestamp {
+		return nil, fmt.Errorf("child timestamp lower than parent's: %d >= %d", parent.Time(), params.Timestamp)
+	}
+	bc := api.eth.BlockChain()
+	pending, err := api.eth.TxPool().Pending(true)
 	if err != nil {
 		return nil, err
 	}
-	num := parent.Number()
+	coinbase := params.SuggestedFeeRecipient
+	num := new(big.Int).Set(parent.Number())
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     num.Add(num, common.Big1),
@@ -145,23 +272,21 @@ func (api *consensusAPI) AssembleBlock(params assembleBlockParams) (*executableD
 		GasLimit:   parent.GasLimit(), // Keep the gas limit constant in this prototype
 		Extra:      []byte{},
 		Time:       params.Timestamp,
+		MixDigest:  params.Random,
 	}
-	if config := api.eth.BlockChain().Config(); config.IsLondon(header.Number) {
+	if config := bc.Config(); config.IsLondon(header.Number) {
 		header.BaseFee = misc.CalcBaseFee(config, parent.Header())
 	}
-	err = api.eth.Engine().Prepare(bc, header)
-	if err != nil {
+	if err := api.eth.Engine().Prepare(bc, header); err != nil {
 		return nil, err
 	}
-
 	env, err := api.makeEnv(parent, header)
 	if err != nil {
 		return nil, err
 	}
-
 	var (
 		signer       = types.MakeSigner(bc.Config(), header.Number)
-		txHeap       = types.NewTransactionsByPriceAndNonce(signer, pending, nil)
+		txHeap       = types.NewTransactionsByPriceAndNonce(signer, pending, header.BaseFee)
 		transactions []*types.Transaction
 	)
 	for {
@@ -215,19 +340,7 @@ func (api *consensusAPI) AssembleBlock(params assembleBlockParams) (*executableD
 	if err != nil {
 		return nil, err
 	}
-	return &executableData{
-		BlockHash:    block.Hash(),
-		ParentHash:   block.ParentHash(),
-		Miner:        block.Coinbase(),
-		StateRoot:    block.Root(),
-		Number:       block.NumberU64(),
-		GasLimit:     block.GasLimit(),
-		GasUsed:      block.GasUsed(),
-		Timestamp:    block.Time(),
-		ReceiptRoot:  block.ReceiptHash(),
-		LogsBloom:    block.Bloom().Bytes(),
-		Transactions: encodeTransactions(block.Transactions()),
-	}, nil
+	return BlockToExecutableData(block), nil
 }
 
 func encodeTransactions(txs []*types.Transaction) [][]byte {
@@ -250,66 +363,101 @@ func decodeTransactions(enc [][]byte) ([]*types.Transaction, error) {
 	return txs, nil
 }
 
-func insertBlockParamsToBlock(config *chainParams.ChainConfig, parent *types.Header, params executableData) (*types.Block, error) {
+// ExecutableDataToBlock constructs a block from the given execution payload, and
+// verifies that the block hash of the payload matches the constructed block.
+func ExecutableDataToBlock(params ExecutableDataV1) (*types.Block, error) {
 	txs, err := decodeTransactions(params.Transactions)
 	if err != nil {
 		return nil, err
 	}
-
-	number := big.NewInt(0)
-	number.SetUint64(params.Number)
+	if len(params.ExtraData) > 32 {
+		return nil, fmt.Errorf("invalid extradata length: %v", len(params.ExtraData))
+	}
+	if len(params.LogsBloom) != types.BloomByteLength {
+		return nil, fmt.Errorf("invalid logsBloom length: %v", len(params.LogsBloom))
+	}
 	header := &types.Header{
 		ParentHash:  params.ParentHash,
 		UncleHash:   types.EmptyUncleHash,
-		Coinbase:    params.Miner,
+		Coinbase:    params.FeeRecipient,
 		Root:        params.StateRoot,
 		TxHash:      types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil)),
-		ReceiptHash: params.ReceiptRoot,
+		ReceiptHash: params.ReceiptsRoot,
 		Bloom:       types.BytesToBloom(params.LogsBloom),
 		Difficulty:  big.NewInt(1),
-		Number:      number,
+		Number:      new(big.Int).SetUint64(params.Number),
 		GasLimit:    params.GasLimit,
 		GasUsed:     params.GasUsed,
 		Time:        params.Timestamp,
-	}
-	if config.IsLondon(number) {
-		header.BaseFee = misc.CalcBaseFee(config, parent)
+		BaseFee:     params.BaseFeePerGas,
+		Extra:       params.ExtraData,
+		MixDigest:   params.Random,
 	}
 	block := types.NewBlockWithHeader(header).WithBody(txs, nil /* uncles */)
+	if block.Hash() != params.BlockHash {
+		return nil, fmt.Errorf("blockhash mismatch, want %x, got %x", params.BlockHash, block.Hash())
+	}
 	return block, nil
 }
 
-// NewBlock creates an Eth1 block, inserts it in the chain, and either returns true,
-// or false + an error. This is a bit redundant for go, but simplifies things on the
-// eth2 side.
-func (api *consensusAPI) NewBlock(params executableData) (*newBlockResponse, error) {
-	parent := api.eth.BlockChain().GetBlockByHash(params.ParentHash)
-	if parent == nil {
-		return &newBlockResponse{false}, fmt.Errorf("could not find parent %x", params.ParentHash)
+// BlockToExecutableData constructs the execution payload of the given block.
+func BlockToExecutableData(block *types.Block) *ExecutableDataV1 {
+	return &ExecutableDataV1{
+		BlockHash:     block.Hash(),
+		ParentHash:    block.ParentHash(),
+		FeeRecipient:  block.Coinbase(),
+		StateRoot:     block.Root(),
+		Number:        block.NumberU64(),
+		GasLimit:      block.GasLimit(),
+		GasUsed:       block.GasUsed(),
+		BaseFeePerGas: block.BaseFee(),
+		Timestamp:     block.Time(),
+		ReceiptsRoot:  block.ReceiptHash(),
+		LogsBloom:     block.Bloom().Bytes(),
+		Transactions:  encodeTransactions(block.Transactions()),
+		Random:        block.MixDigest(),
+		ExtraData:     block.Extra(),
 	}
-	block, err := insertBlockParamsToBlock(api.eth.BlockChain().Config(), parent.Header(), params)
-	if err != nil {
-		return nil, err
-	}
-	_, err = api.eth.BlockChain().InsertChainWithoutSealVerification(block)
-	return &newBlockResponse{err == nil}, err
 }
 
-// Used in tests to add a the list of transactions from a block to the tx pool.
-func (api *consensusAPI) addBlockTxs(block *types.Block) error {
-	for _, tx := range block.Transactions() {
-		api.eth.TxPool().AddLocal(tx)
-	}
-	return nil
+// payloadQueue keeps track of the most recently prepared payloads, evicting the
+// oldest ones once full.
+type payloadQueue struct {
+	payloads [maxTrackedPayloads]*payloadQueueItem
+	lock     sync.RWMutex
+}
+
+type payloadQueueItem struct {
+	id      PayloadID
+	payload *ExecutableDataV1
 }
 
-// FinalizeBlock is called to mark a block as synchronized, so
-// that data that is no longer needed can be removed.
-func (api *consensusAPI) FinalizeBlock(blockHash common.Hash) (*genericResponse, error) {
-	return &genericResponse{true}, nil
+// newPayloadQueue creates an empty payload queue.
+func newPayloadQueue() *payloadQueue {
+	return new(payloadQueue)
 }
 
-// SetHead is called to perform a force choice.
-func (api *consensusAPI) SetHead(newHead common.Hash) (*genericResponse, error) {
-	return &genericResponse{true}, nil
+// put inserts a new payload into the queue, evicting the oldest one if full.
+func (q *payloadQueue) put(id PayloadID, data *ExecutableDataV1) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	copy(q.payloads[1:], q.payloads[:len(q.payloads)-1])
+	q.payloads[0] = &payloadQueueItem{id: id, payload: data}
+}
+
+// get retrieves a previously stored payload, or nil if it's unknown.
+func (q *payloadQueue) get(id PayloadID) *ExecutableDataV1 {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	for _, item := range q.payloads {
+		if item == nil {
+			return nil
+		}
+		if item.id == id {
+			return item.payload
+		}
+	}
+	return nil
 }
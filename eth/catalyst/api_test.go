@@ -17,9 +17,14 @@
 package catalyst
 
 import (
+	"io/ioutil"
 	"math/big"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -29,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var (
@@ -43,7 +49,7 @@ var (
 
 func generateTestChain() (*core.Genesis, []*types.Block) {
 	db := rawdb.NewMemoryDatabase()
-	config := params.AllEthashProtocolChanges
+	config := testChainConfig()
 	genesis := &core.Genesis{
 		Config:    config,
 		Alloc:     core.GenesisAlloc{testAddr: {Balance: testBalance}},
@@ -62,12 +68,8 @@ func generateTestChain() (*core.Genesis, []*types.Block) {
 	return genesis, blocks
 }
 
-func generateTestChainWithFork(n int, fork int) (*core.Genesis, []*types.Block, []*types.Block) {
-	if fork >= n {
-		fork = n - 1
-	}
-	db := rawdb.NewMemoryDatabase()
-	config := &params.ChainConfig{
+func testChainConfig() *params.ChainConfig {
+	return &params.ChainConfig{
 		ChainID:             big.NewInt(1337),
 		HomesteadBlock:      big.NewInt(0),
 		EIP150Block:         big.NewInt(0),
@@ -83,6 +85,14 @@ func generateTestChainWithFork(n int, fork int) (*core.Genesis, []*types.Block,
 		CatalystBlock:       big.NewInt(0),
 		Ethash:              new(params.EthashConfig),
 	}
+}
+
+func generateTestChainWithFork(n int, fork int) (*core.Genesis, []*types.Block, []*types.Block) {
+	if fork >= n {
+		fork = n - 1
+	}
+	db := rawdb.NewMemoryDatabase()
+	config := testChainConfig()
 	genesis := &core.Genesis{
 		Config:    config,
 		Alloc:     core.GenesisAlloc{testAddr: {Balance: testBalance}},
@@ -106,31 +116,52 @@ func generateTestChainWithFork(n int, fork int) (*core.Genesis, []*types.Block,
 	return genesis, blocks, forkedBlocks
 }
 
-func TestEth2AssembleBlock(t *testing.T) {
+func TestEth2PrepareAndGetPayload(t *testing.T) {
 	genesis, blocks := generateTestChain()
 	n, ethservice := startEthService(t, genesis, blocks[1:9])
 	defer n.Close()
 
-	api := newConsensusAPI(ethservice)
+	api := NewConsensusAPI(ethservice)
 	signer := types.NewEIP155Signer(ethservice.BlockChain().Config().ChainID)
 	tx, err := types.SignTx(types.NewTransaction(0, blocks[8].Coinbase(), big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), signer, testKey)
 	if err != nil {
 		t.Fatalf("error signing transaction, err=%v", err)
 	}
 	ethservice.TxPool().AddLocal(tx)
-	blockParams := assembleBlockParams{
-		ParentHash: blocks[8].ParentHash(),
-		Timestamp:  blocks[8].Time(),
-	}
-	execData, err := api.AssembleBlock(blockParams)
 
+	fcState := ForkchoiceStateV1{HeadBlockHash: blocks[8].Hash()}
+	attrs := &PayloadAttributesV1{
+		Timestamp:             blocks[8].Time() + 5,
+		Random:                common.Hash{0x01},
+		SuggestedFeeRecipient: common.Address{0x02},
+	}
+	resp, err := api.ForkchoiceUpdatedV1(fcState, attrs)
 	if err != nil {
-		t.Fatalf("error producing block, err=%v", err)
+		t.Fatalf("error preparing payload, err=%v", err)
+	}
+	if resp.PayloadStatus.Status != VALID {
+		t.Fatalf("invalid forkchoice status: %v", resp.PayloadStatus.Status)
+	}
+	if resp.PayloadID == nil {
+		t.Fatal("missing payload id")
+	}
+	if want := computePayloadID(blocks[8].Hash(), attrs); *resp.PayloadID != want {
+		t.Fatalf("payload id mismatch: have %v, want %v", resp.PayloadID, want)
+	}
+	execData, err := api.GetPayloadV1(*resp.PayloadID)
+	if err != nil {
+		t.Fatalf("error getting payload, err=%v", err)
 	}
-
 	if len(execData.Transactions) != 1 {
 		t.Fatalf("invalid number of transactions %d != 1", len(execData.Transactions))
 	}
+	if execData.FeeRecipient != attrs.SuggestedFeeRecipient || execData.Random != attrs.Random {
+		t.Fatalf("payload attributes not applied: recipient %x, random %x", execData.FeeRecipient, execData.Random)
+	}
+	// Unknown payloads should be rejected with the dedicated error
+	if _, err := api.GetPayloadV1(PayloadID{0xff}); err != UnknownPayload {
+		t.Fatalf("wrong error for unknown payload: have %v, want %v", err, UnknownPayload)
+	}
 }
 
 func TestEth2AssembleBlockWithAnotherBlocksTxs(t *testing.T) {
@@ -138,82 +169,187 @@ func TestEth2AssembleBlockWithAnotherBlocksTxs(t *testing.T) {
 	n, ethservice := startEthService(t, genesis, blocks[1:9])
 	defer n.Close()
 
-	api := newConsensusAPI(ethservice)
+	api := NewConsensusAPI(ethservice)
 
 	// Put the 10th block's tx in the pool and produce a new block
-	api.addBlockTxs(blocks[9])
-	blockParams := assembleBlockParams{
-		ParentHash: blocks[9].ParentHash(),
-		Timestamp:  blocks[9].Time(),
+	for _, tx := range blocks[9].Transactions() {
+		ethservice.TxPool().AddLocal(tx)
 	}
-	execData, err := api.AssembleBlock(blockParams)
+	execData, err := api.assembleBlock(blocks[8], &PayloadAttributesV1{Timestamp: blocks[9].Time()})
 	if err != nil {
 		t.Fatalf("error producing block, err=%v", err)
 	}
-
 	if len(execData.Transactions) != blocks[9].Transactions().Len() {
 		t.Fatalf("invalid number of transactions %d != 1", len(execData.Transactions))
 	}
 }
 
-func TestEth2NewBlock(t *testing.T) {
+func TestEth2NewPayload(t *testing.T) {
 	genesis, blocks, forkedBlocks := generateTestChainWithFork(10, 4)
 	n, ethservice := startEthService(t, genesis, blocks[1:5])
 	defer n.Close()
 
-	api := newConsensusAPI(ethservice)
+	var (
+		api   = NewConsensusAPI(ethservice)
+		chain = ethservice.BlockChain()
+	)
+	// Insert the canonical blocks, which shouldn't move the head
 	for i := 5; i < 10; i++ {
-		p := executableData{
-			ParentHash:   ethservice.BlockChain().CurrentBlock().Hash(),
-			Miner:        blocks[i].Coinbase(),
-			StateRoot:    blocks[i].Root(),
-			GasLimit:     blocks[i].GasLimit(),
-			GasUsed:      blocks[i].GasUsed(),
-			Transactions: encodeTransactions(blocks[i].Transactions()),
-			ReceiptRoot:  blocks[i].ReceiptHash(),
-			LogsBloom:    blocks[i].Bloom().Bytes(),
-			BlockHash:    blocks[i].Hash(),
-			Timestamp:    blocks[i].Time(),
-			Number:       uint64(i),
+		status, err := api.NewPayloadV1(*BlockToExecutableData(blocks[i]))
+		if err != nil || status.Status != VALID {
+			t.Fatalf("Failed to insert block #%d: %v %v", i, status.Status, err)
 		}
-		success, err := api.NewBlock(p)
-		if err != nil || !success.Valid {
-			t.Fatalf("Failed to insert block: %v", err)
+		if *status.LatestValidHash != blocks[i].Hash() {
+			t.Fatalf("Wrong latest valid hash: have %x, want %x", *status.LatestValidHash, blocks[i].Hash())
 		}
 	}
-
-	exp := ethservice.BlockChain().CurrentBlock().Hash()
-
-	// Introduce the fork point.
-	lastBlockNum := blocks[4].Number()
-	lastBlock := blocks[4]
-	for i := 0; i < 4; i++ {
-		lastBlockNum.Add(lastBlockNum, big.NewInt(1))
-		p := executableData{
-			ParentHash:   lastBlock.Hash(),
-			Miner:        forkedBlocks[i].Coinbase(),
-			StateRoot:    forkedBlocks[i].Root(),
-			Number:       lastBlockNum.Uint64(),
-			GasLimit:     forkedBlocks[i].GasLimit(),
-			GasUsed:      forkedBlocks[i].GasUsed(),
-			Transactions: encodeTransactions(blocks[i].Transactions()),
-			ReceiptRoot:  forkedBlocks[i].ReceiptHash(),
-			LogsBloom:    forkedBlocks[i].Bloom().Bytes(),
-			BlockHash:    forkedBlocks[i].Hash(),
-			Timestamp:    forkedBlocks[i].Time(),
+	if head := chain.CurrentBlock().Hash(); head != blocks[4].Hash() {
+		t.Fatalf("Head moved by new payload: have %x, want %x", head, blocks[4].Hash())
+	}
+	// Insert the forked blocks as well
+	for i := 0; i < len(forkedBlocks); i++ {
+		status, err := api.NewPayloadV1(*BlockToExecutableData(forkedBlocks[i]))
+		if err != nil || status.Status != VALID {
+			t.Fatalf("Failed to insert forked block #%d: %v %v", i, status.Status, err)
+		}
+	}
+	// Switch between the two chains and back onto an ancestor via forkchoice updates
+	for _, head := range []*types.Block{blocks[9], forkedBlocks[len(forkedBlocks)-1], blocks[7], blocks[6]} {
+		resp, err := api.ForkchoiceUpdatedV1(ForkchoiceStateV1{HeadBlockHash: head.Hash(), FinalizedBlockHash: blocks[4].Hash()}, nil)
+		if err != nil || resp.PayloadStatus.Status != VALID {
+			t.Fatalf("Failed to set head #%d: %v %v", head.NumberU64(), resp.PayloadStatus.Status, err)
 		}
-		success, err := api.NewBlock(p)
-		if err != nil || !success.Valid {
-			t.Fatalf("Failed to insert forked block #%d: %v", i, err)
+		if current := chain.CurrentBlock().Hash(); current != head.Hash() {
+			t.Fatalf("Wrong head: have %x, want %x", current, head.Hash())
 		}
-		lastBlock, err = insertBlockParamsToBlock(ethservice.BlockChain().Config(), lastBlock.Header(), p)
-		if err != nil {
-			t.Fatal(err)
+		if canon := chain.GetHeaderByNumber(head.NumberU64() + 1); canon != nil {
+			t.Fatalf("Canonical block #%d left above head", canon.Number)
 		}
+		if canon := chain.GetHeaderByNumber(head.NumberU64()); canon == nil || canon.Hash() != head.Hash() {
+			t.Fatalf("Head #%d not canonical", head.NumberU64())
+		}
+	}
+}
+
+func TestEth2PayloadStatuses(t *testing.T) {
+	genesis, blocks, forkedBlocks := generateTestChainWithFork(10, 4)
+	n, ethservice := startEthService(t, genesis, blocks[1:5])
+	defer n.Close()
+
+	api := NewConsensusAPI(ethservice)
+
+	// A payload whose hash doesn't match its contents is rejected
+	data := BlockToExecutableData(blocks[5])
+	data.BlockHash = common.Hash{0x01}
+	if status, _ := api.NewPayloadV1(*data); status.Status != INVALID_BLOCK_HASH {
+		t.Errorf("Wrong status for mismatching hash: have %v, want %v", status.Status, INVALID_BLOCK_HASH)
 	}
+	// A payload with an unknown parent requires syncing
+	if status, _ := api.NewPayloadV1(*BlockToExecutableData(blocks[7])); status.Status != SYNCING {
+		t.Errorf("Wrong status for unknown parent: have %v, want %v", status.Status, SYNCING)
+	}
+	// A payload failing execution is invalid, pointing back at its parent
+	bad := blocks[5].Header()
+	bad.Root = common.Hash{0x02}
+	data = BlockToExecutableData(types.NewBlockWithHeader(bad).WithBody(blocks[5].Transactions(), nil))
+	status, _ := api.NewPayloadV1(*data)
+	if status.Status != INVALID {
+		t.Errorf("Wrong status for bad state root: have %v, want %v", status.Status, INVALID)
+	}
+	if status.LatestValidHash == nil || *status.LatestValidHash != blocks[4].Hash() {
+		t.Errorf("Wrong latest valid hash for bad state root: have %v, want %x", status.LatestValidHash, blocks[4].Hash())
+	}
+	if status.ValidationError == nil {
+		t.Errorf("Missing validation error for bad state root")
+	}
+	// A forkchoice update to an unknown head requires syncing
+	resp, err := api.ForkchoiceUpdatedV1(ForkchoiceStateV1{HeadBlockHash: blocks[9].Hash()}, nil)
+	if err != nil || resp.PayloadStatus.Status != SYNCING {
+		t.Errorf("Wrong status for unknown head: have %v %v, want %v", resp.PayloadStatus.Status, err, SYNCING)
+	}
+	// A forkchoice update finalizing a block off the head's chain is rejected
+	if _, err := api.NewPayloadV1(*BlockToExecutableData(forkedBlocks[0])); err != nil {
+		t.Fatalf("Failed to insert forked block: %v", err)
+	}
+	resp, err = api.ForkchoiceUpdatedV1(ForkchoiceStateV1{HeadBlockHash: blocks[4].Hash(), FinalizedBlockHash: forkedBlocks[0].Hash()}, nil)
+	if err != InvalidForkChoiceState {
+		t.Errorf("Wrong error for invalid finalized block: have %v, want %v", err, InvalidForkChoiceState)
+	}
+	// A payload can't be built with a timestamp before its parent's
+	_, err = api.ForkchoiceUpdatedV1(ForkchoiceStateV1{HeadBlockHash: blocks[4].Hash()}, &PayloadAttributesV1{Timestamp: blocks[4].Time()})
+	if err != InvalidPayloadAttributes {
+		t.Errorf("Wrong error for invalid payload attributes: have %v, want %v", err, InvalidPayloadAttributes)
+	}
+}
 
-	if ethservice.BlockChain().CurrentBlock().Hash() != exp {
-		t.Fatalf("Wrong head after inserting fork %x != %x", exp, ethservice.BlockChain().CurrentBlock().Hash())
+// TestEth2MockConsensusClient drives block production through the authenticated
+// engine API endpoint, the way a consensus client would.
+func TestEth2MockConsensusClient(t *testing.T) {
+	genesis, blocks := generateTestChain()
+
+	secret := common.Hex2Bytes("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	secretFile := filepath.Join(t.TempDir(), "jwtsecret")
+	if err := ioutil.WriteFile(secretFile, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := node.New(&node.Config{AuthAddr: "127.0.0.1", AuthPort: 0, JWTSecret: secretFile})
+	if err != nil {
+		t.Fatal("can't create node:", err)
+	}
+	defer n.Close()
+
+	ethservice, err := eth.New(n, &ethconfig.Config{Genesis: genesis, Ethash: ethash.Config{PowMode: ethash.ModeFake}})
+	if err != nil {
+		t.Fatal("can't create eth service:", err)
+	}
+	if err := Register(n, ethservice); err != nil {
+		t.Fatal("can't register engine API:", err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatal("can't start node:", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks[1:]); err != nil {
+		t.Fatal("can't import test blocks:", err)
+	}
+	// Unauthenticated requests must be refused
+	client, err := rpc.Dial(n.HTTPAuthEndpoint())
+	if err != nil {
+		t.Fatal("can't dial engine API:", err)
+	}
+	var resp ForkChoiceResponse
+	if err := client.Call(&resp, "engine_forkchoiceUpdatedV1", ForkchoiceStateV1{HeadBlockHash: blocks[10].Hash()}, nil); err == nil {
+		t.Fatal("unauthenticated request accepted")
+	}
+	// Drive a few blocks on top of the chain
+	head := blocks[10]
+	for i := 0; i < 3; i++ {
+		client.SetHeader("Authorization", "Bearer "+node.NewJWTToken(secret, time.Now()))
+
+		attrs := &PayloadAttributesV1{Timestamp: head.Time() + 5, Random: common.Hash{byte(i)}, SuggestedFeeRecipient: testAddr}
+		if err := client.Call(&resp, "engine_forkchoiceUpdatedV1", ForkchoiceStateV1{HeadBlockHash: head.Hash()}, attrs); err != nil {
+			t.Fatalf("forkchoice update %d failed: %v", i, err)
+		}
+		if resp.PayloadStatus.Status != VALID || resp.PayloadID == nil {
+			t.Fatalf("forkchoice update %d: status %v, payload id %v", i, resp.PayloadStatus.Status, resp.PayloadID)
+		}
+		var payload ExecutableDataV1
+		if err := client.Call(&payload, "engine_getPayloadV1", *resp.PayloadID); err != nil {
+			t.Fatalf("get payload %d failed: %v", i, err)
+		}
+		var status PayloadStatusV1
+		if err := client.Call(&status, "engine_newPayloadV1", payload); err != nil {
+			t.Fatalf("new payload %d failed: %v", i, err)
+		}
+		if status.Status != VALID {
+			t.Fatalf("new payload %d: status %v", i, status.Status)
+		}
+		if err := client.Call(&resp, "engine_forkchoiceUpdatedV1", ForkchoiceStateV1{HeadBlockHash: payload.BlockHash, FinalizedBlockHash: head.Hash()}, nil); err != nil {
+			t.Fatalf("forkchoice update %d failed: %v", i, err)
+		}
+		head = ethservice.BlockChain().CurrentBlock()
+		if head.Hash() != payload.BlockHash {
+			t.Fatalf("head not updated: have %x, want %x", head.Hash(), payload.BlockHash)
+		}
 	}
 }
 
@@ -241,12 +241,23 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
+//
+// If the criteria start at a given block, the matching logs since that block are
+// replayed before delivering new logs. A resuming client may instead pass the hash
+// of the last block it processed: if that block was reorged out, its logs are sent
+// again as removed first. Replays are limited to maxReplayBlocks, and if a replay
+// fails or falls behind the new logs, the subscription fails with an error.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
 
+	// Resolve the historical logs to replay before going live
+	replay, err := newLogReplay(ctx, api.backend, &crit)
+	if err != nil {
+		return nil, err
+	}
 	var (
 		rpcSub      = notifier.CreateSubscription()
 		matchedLogs = make(chan []*types.Log)
@@ -256,20 +267,75 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	if err != nil {
 		return nil, err
 	}
+	// Replay up to the head known after subscribing, so no block is missed
+	var (
+		replayed chan []*types.Log
+		quit     = make(chan struct{})
+	)
+	if replay != nil {
+		header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil {
+			logsSub.Unsubscribe()
+			return nil, err
+		}
+		end := header.Number.Uint64()
+		if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < end {
+			end = crit.ToBlock.Uint64()
+		}
+		if err := replay.setEnd(end); err != nil {
+			logsSub.Unsubscribe()
+			return nil, err
+		}
+		replayed = make(chan []*types.Log)
+		go replay.run(api.backend, crit, replayed, quit)
+	}
 
 	go func() {
+		defer logsSub.Unsubscribe()
+		defer close(quit)
 
+		notify := func(logs []*types.Log) {
+			for _, log := range logs {
+				notifier.Notify(rpcSub.ID, &log)
+			}
+		}
+		var pending []*types.Log // Live logs delivered during the replay
+		if replay != nil {
+			notify(replay.removed)
+		}
 		for {
 			select {
+			case logs, ok := <-replayed:
+				if !ok {
+					// Replay done, fail the subscription rather than leave a gap
+					if replay.err != nil {
+						notifier.Fail(rpcSub.ID, replay.err)
+						return
+					}
+					// Deliver the live logs the replay didn't cover
+					replayed = nil
+					notify(replay.filter(pending))
+					pending = nil
+					continue
+				}
+				replay.record(logs)
+				notify(logs)
 			case logs := <-matchedLogs:
-				for _, log := range logs {
-					notifier.Notify(rpcSub.ID, &log)
+				switch {
+				case replayed != nil:
+					if len(pending)+len(logs) > maxReplayPending {
+						notifier.Fail(rpcSub.ID, errReplayPending)
+						return
+					}
+					pending = append(pending, logs...)
+				case replay != nil:
+					notify(replay.filter(logs))
+				default:
+					notify(logs)
 				}
 			case <-rpcSub.Err(): // client send an unsubscribe request
-				logsSub.Unsubscribe()
 				return
 			case <-notifier.Closed(): // connection dropped
-				logsSub.Unsubscribe()
 				return
 			}
 		}
@@ -356,6 +422,44 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 	return returnLogs(logs), err
 }
 
+// maxLogsPageSize is the maximum number of logs returned in a page by
+// eth_getLogsPage, also used if the requested limit is zero.
+const maxLogsPageSize = 10000
+
+// LogsPage is a page of the logs matching a filter query.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *LogCursor   `json:"cursor"` // Position of the next matching log, nil if there are no more
+}
+
+// GetLogsPage returns at most limit logs matching the given argument, starting
+// with the log at the cursor if given. The cursor of the returned page resumes
+// the query with the next matching log.
+func (api *PublicFilterAPI) GetLogsPage(ctx context.Context, crit FilterCriteria, limit hexutil.Uint, cursor *LogCursor) (*LogsPage, error) {
+	if limit == 0 || limit > maxLogsPageSize {
+		limit = maxLogsPageSize
+	}
+	var filter *Filter
+	if crit.BlockHash != nil {
+		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
+	} else {
+		begin := rpc.LatestBlockNumber.Int64()
+		if crit.FromBlock != nil {
+			begin = crit.FromBlock.Int64()
+		}
+		end := rpc.LatestBlockNumber.Int64()
+		if crit.ToBlock != nil {
+			end = crit.ToBlock.Int64()
+		}
+		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
+	}
+	logs, next, err := filter.LogsPage(ctx, int(limit), cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &LogsPage{Logs: returnLogs(logs), Cursor: next}, nil
+}
+
 // UninstallFilter removes the filter with the given filter id.
 //
 // https://eth.wiki/json-rpc/API#eth_uninstallfilter
@@ -20,10 +20,13 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -47,6 +50,21 @@ type Backend interface {
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
 }
 
+// LogIndexBackend is implemented by backends maintaining an exact index of the
+// addresses and topics of logs, see core.NewLogIndexer. Filters use the index
+// in place of the bloom bits where available.
+type LogIndexBackend interface {
+	// LogIndexStatus returns the section size and the number of sections of
+	// the log index.
+	LogIndexStatus() (uint64, uint64)
+}
+
+// LogCursor is the position of a log in the chain, used to resume a query at.
+type LogCursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	LogIndex    hexutil.Uint   `json:"logIndex"`
+}
+
 // Filter can be used to retrieve and filter logs.
 type Filter struct {
 	backend Backend
@@ -58,6 +76,9 @@ type Filter struct {
 	block      common.Hash // Block hash if filtering a single block
 	begin, end int64       // Range interval if filtering multiple blocks
 
+	limit  int        // Number of logs to stop searching beyond, unlimited if zero
+	cursor *LogCursor // Position of the first log to return, if any
+
 	matcher *bloombits.Matcher
 }
 
@@ -135,37 +156,115 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	}
 	head := header.Number.Uint64()
 
-	if f.begin == -1 {
-		f.begin = int64(head)
+	begin, err := f.resolveNumber(ctx, f.begin, head)
+	if err != nil {
+		return nil, err
+	}
+	end, err := f.resolveNumber(ctx, f.end, head)
+	if err != nil {
+		return nil, err
 	}
-	end := uint64(f.end)
-	if f.end == -1 {
-		end = head
+	if f.cursor != nil && uint64(f.cursor.BlockNumber) > begin {
+		begin = uint64(f.cursor.BlockNumber)
+	}
+	f.begin = int64(begin)
+
+	// Gather all exactly indexed logs, continue with bloom indexed ones and
+	// finish with non indexed ones
+	var logs []*types.Log
+	if backend, ok := f.backend.(LogIndexBackend); ok && f.constrained() {
+		size, sections := backend.LogIndexStatus()
+		if indexed := sections * size; indexed > uint64(f.begin) {
+			if indexed > end {
+				logs, err = f.exactLogs(ctx, size, end)
+			} else {
+				logs, err = f.exactLogs(ctx, size, indexed-1)
+			}
+			if err != nil || f.exceeded(logs) {
+				return logs, err
+			}
+		}
 	}
-	// Gather all indexed logs, and finish with non indexed ones
-	var (
-		logs []*types.Log
-		err  error
-	)
 	size, sections := f.backend.BloomStatus()
 	if indexed := sections * size; indexed > uint64(f.begin) {
+		var found []*types.Log
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			found, err = f.indexedLogs(ctx, end, len(logs))
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			found, err = f.indexedLogs(ctx, indexed-1, len(logs))
 		}
-		if err != nil {
+		logs = append(logs, found...)
+		if err != nil || f.exceeded(logs) {
 			return logs, err
 		}
 	}
-	rest, err := f.unindexedLogs(ctx, end)
+	rest, err := f.unindexedLogs(ctx, end, len(logs))
 	logs = append(logs, rest...)
 	return logs, err
 }
 
+// LogsPage searches the blockchain like Logs, returning at most limit logs from
+// the cursor on, if given. The cursor of the next matching log is returned if
+// the results are truncated.
+func (f *Filter) LogsPage(ctx context.Context, limit int, cursor *LogCursor) ([]*types.Log, *LogCursor, error) {
+	f.limit, f.cursor = limit, cursor
+
+	logs, err := f.Logs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit > 0 && len(logs) > limit {
+		next := &LogCursor{
+			BlockNumber: hexutil.Uint64(logs[limit].BlockNumber),
+			LogIndex:    hexutil.Uint(logs[limit].Index),
+		}
+		return logs[:limit], next, nil
+	}
+	return logs, nil, nil
+}
+
+// exceeded reports whether the given number of logs found exceeds the limit,
+// ending the search.
+func (f *Filter) exceeded(logs []*types.Log) bool {
+	return f.limit > 0 && len(logs) > f.limit
+}
+
+// constrained reports whether the filter restricts the address or any topic of
+// the logs, as needed to look them up in the log index.
+func (f *Filter) constrained() bool {
+	if len(f.addresses) > 0 {
+		return true
+	}
+	for _, topics := range f.topics {
+		if len(topics) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveNumber converts the latest, finalized and safe block tags bounding the
+// filter range into block numbers.
+func (f *Filter) resolveNumber(ctx context.Context, number int64, head uint64) (uint64, error) {
+	switch rpc.BlockNumber(number) {
+	case rpc.LatestBlockNumber:
+		return head, nil
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return 0, err
+		}
+		if header == nil {
+			return 0, errors.New("unknown block")
+		}
+		return header.Number.Uint64(), nil
+	}
+	return uint64(number), nil
+}
+
 // indexedLogs returns the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
-func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+func (f *Filter) indexedLogs(ctx context.Context, end uint64, found int) ([]*types.Log, error) {
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
@@ -198,11 +297,14 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 			if header == nil || err != nil {
 				return logs, err
 			}
-			found, err := f.checkMatches(ctx, header)
+			matched, err := f.checkMatches(ctx, header)
 			if err != nil {
 				return logs, err
 			}
-			logs = append(logs, found...)
+			logs = append(logs, matched...)
+			if f.limit > 0 && found+len(logs) > f.limit {
+				return logs, nil
+			}
 
 		case <-ctx.Done():
 			return logs, ctx.Err()
@@ -210,9 +312,92 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 	}
 }
 
+// exactLogs returns the logs matching the filter criteria based on the exact log
+// index available locally, only retrieving the blocks with matching logs.
+func (f *Filter) exactLogs(ctx context.Context, size uint64, end uint64) ([]*types.Log, error) {
+	var logs []*types.Log
+
+	for section := uint64(f.begin) / size; section*size <= end; section++ {
+		head := rawdb.ReadCanonicalHash(f.db, (section+1)*size-1)
+		for _, number := range f.exactMatches(section, size, head) {
+			if number < uint64(f.begin) || number > end {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return logs, err
+			}
+			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+			if header == nil || err != nil {
+				return logs, err
+			}
+			matched, err := f.checkMatches(ctx, header)
+			if err != nil {
+				return logs, err
+			}
+			logs = append(logs, matched...)
+			if f.exceeded(logs) {
+				f.begin = int64(number) + 1
+				return logs, nil
+			}
+		}
+		f.begin = int64((section + 1) * size)
+	}
+	if f.begin > int64(end) {
+		f.begin = int64(end) + 1
+	}
+	return logs, nil
+}
+
+// exactMatches returns the numbers of the blocks within a section of the log
+// index containing logs matching the filter criteria, in ascending order.
+func (f *Filter) exactMatches(section, size uint64, head common.Hash) []uint64 {
+	// Collect the positions of the logs matching each criterion, intersecting
+	// them across the criteria
+	var matches map[uint64]struct{}
+	lookup := func(kind byte, values [][]byte) {
+		positions := make(map[uint64]struct{})
+		for _, value := range values {
+			for _, position := range rawdb.ReadLogIndex(f.db, kind, value, section, head) {
+				if _, ok := matches[position]; ok || matches == nil {
+					positions[position] = struct{}{}
+				}
+			}
+		}
+		matches = positions
+	}
+	if len(f.addresses) > 0 {
+		values := make([][]byte, len(f.addresses))
+		for i, address := range f.addresses {
+			values[i] = address.Bytes()
+		}
+		lookup(rawdb.LogIndexAddress, values)
+	}
+	for i, topics := range f.topics {
+		if len(topics) == 0 || (matches != nil && len(matches) == 0) {
+			continue
+		}
+		values := make([][]byte, len(topics))
+		for j, topic := range topics {
+			values[j] = topic.Bytes()
+		}
+		lookup(rawdb.LogIndexTopic+byte(i), values)
+	}
+	// Convert the log positions into block numbers
+	blocks := make(map[uint64]struct{})
+	for position := range matches {
+		blocks[section*size+position>>32] = struct{}{}
+	}
+	numbers := make([]uint64, 0, len(blocks))
+	for number := range blocks {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
 // unindexedLogs returns the logs matching the filter criteria based on raw block
 // iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, found int) ([]*types.Log, error) {
 	var logs []*types.Log
 
 	for ; f.begin <= int64(end); f.begin++ {
@@ -220,11 +405,15 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 		if header == nil || err != nil {
 			return logs, err
 		}
-		found, err := f.blockLogs(ctx, header)
+		matched, err := f.blockLogs(ctx, header)
 		if err != nil {
 			return logs, err
 		}
-		logs = append(logs, found...)
+		logs = append(logs, matched...)
+		if f.limit > 0 && found+len(logs) > f.limit {
+			f.begin++
+			return logs, nil
+		}
 	}
 	return logs, nil
 }
@@ -267,11 +456,29 @@ func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs [
 			}
 			logs = filterLogs(unfiltered, nil, nil, f.addresses, f.topics)
 		}
-		return logs, nil
+		return f.afterCursor(logs), nil
 	}
 	return nil, nil
 }
 
+// afterCursor drops the logs preceding the cursor of the filter, if any.
+func (f *Filter) afterCursor(logs []*types.Log) []*types.Log {
+	if f.cursor == nil {
+		return logs
+	}
+	var (
+		number = uint64(f.cursor.BlockNumber)
+		index  = uint(f.cursor.LogIndex)
+		ret    []*types.Log
+	)
+	for _, log := range logs {
+		if log.BlockNumber > number || (log.BlockNumber == number && log.Index >= index) {
+			ret = append(ret, log)
+		}
+	}
+	return ret
+}
+
 func includes(addresses []common.Address, a common.Address) bool {
 	for _, addr := range addresses {
 		if addr == a {
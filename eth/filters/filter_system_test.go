@@ -52,6 +52,9 @@ type testBackend struct {
 	rmLogsFeed      event.Feed
 	pendingLogsFeed event.Feed
 	chainFeed       event.Feed
+	chainHeadFeed   event.Feed
+	finalized       uint64 // Number of the finalized block, also reported as safe
+	logIndex        *core.ChainIndexer
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -70,6 +73,9 @@ func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumbe
 			return nil, nil
 		}
 		num = *number
+	} else if blockNr == rpc.FinalizedBlockNumber || blockNr == rpc.SafeBlockNumber {
+		num = b.finalized
+		hash = rawdb.ReadCanonicalHash(b.db, num)
 	} else {
 		num = uint64(blockNr)
 		hash = rawdb.ReadCanonicalHash(b.db, num)
@@ -130,6 +136,23 @@ func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
 
+func (b *testBackend) LogIndexStatus() (uint64, uint64) {
+	if b.logIndex == nil {
+		return testLogIndexSize, 0
+	}
+	sections, _, _ := b.logIndex.Sections()
+	return testLogIndexSize, sections
+}
+
+func (b *testBackend) CurrentHeader() *types.Header {
+	header, _ := b.HeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+	return header
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.chainHeadFeed.Subscribe(ch)
+}
+
 func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	requests := make(chan chan *bloombits.Retrieval)
 
@@ -606,6 +629,140 @@ func TestPendingLogsSubscription(t *testing.T) {
 	}
 }
 
+// TestLogsSubscriptionReplay tests that log subscriptions replay the historical
+// logs before the live ones without duplicates, and that a client resuming from
+// a reorged block gets its logs removed first.
+func TestLogsSubscriptionReplay(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+		addr    = common.HexToAddress("0x1111")
+	)
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	gen := func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr}}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, gen.BaseFee(), nil))
+	}
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 30, gen)
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		if block.NumberU64() <= 20 {
+			rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			rawdb.WriteHeadBlockHash(db, block.Hash())
+		}
+	}
+	// Create a side block on top of block 10, known but not canonical
+	fork, forkReceipts := core.GenerateChain(params.TestChainConfig, chain[9], ethash.NewFaker(), db, 1, func(i int, g *core.BlockGen) {
+		g.SetCoinbase(common.HexToAddress("0x2222"))
+		gen(i, g)
+	})
+	rawdb.WriteBlock(db, fork[0])
+	rawdb.WriteReceipts(db, fork[0].Hash(), fork[0].NumberU64(), forkReceipts[0])
+
+	blockLogs := func(block *types.Block, removed bool) []*types.Log {
+		var logs []*types.Log
+		for _, receipt := range rawdb.ReadReceipts(db, block.Hash(), block.NumberU64(), params.TestChainConfig) {
+			for _, log := range receipt.Logs {
+				log.Removed = removed
+				logs = append(logs, log)
+			}
+		}
+		return logs
+	}
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	expect := func(ch chan types.Log, want []*types.Log) {
+		t.Helper()
+		for i, w := range want {
+			select {
+			case have := <-ch:
+				if have.BlockHash != w.BlockHash || have.Removed != w.Removed {
+					t.Fatalf("log %d mismatch: have block %d %x removed %v, want block %d %x removed %v",
+						i, have.BlockNumber, have.BlockHash, have.Removed, w.BlockNumber, w.BlockHash, w.Removed)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("log %d not received", i)
+			}
+		}
+		select {
+		case have := <-ch:
+			t.Fatalf("unexpected log of block %d", have.BlockNumber)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	// Subscribe from block 5, expecting the replay of blocks 5-20
+	logs := make(chan types.Log, 64)
+	sub, err := client.EthSubscribe(context.Background(), logs, "logs", map[string]interface{}{"fromBlock": "0x5"})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	var want []*types.Log
+	for _, block := range chain[4:20] {
+		want = append(want, blockLogs(block, false)...)
+	}
+	expect(logs, want)
+
+	// Deliver live logs overlapping with the replay, only new ones are expected
+	var live []*types.Log
+	for _, block := range chain[18:22] {
+		live = append(live, blockLogs(block, false)...)
+	}
+	backend.logsFeed.Send(live)
+	expect(logs, live[2:])
+
+	// Resume from the side block, expecting its removal and the canonical chain
+	hash := fork[0].Hash()
+	resumed := make(chan types.Log, 64)
+	sub2, err := client.EthSubscribe(context.Background(), resumed, "logs", map[string]interface{}{"blockHash": hash})
+	if err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	defer sub2.Unsubscribe()
+
+	want = blockLogs(fork[0], true)
+	for _, block := range chain[10:20] {
+		want = append(want, blockLogs(block, false)...)
+	}
+	expect(resumed, want)
+}
+
+// TestLogReplayRange tests that log replays are limited to maxReplayBlocks.
+func TestLogReplayRange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		begin, end uint64
+		err        error
+	}{
+		{0, 0, nil},
+		{10, 5, nil},
+		{0, maxReplayBlocks - 1, nil},
+		{0, maxReplayBlocks, errReplayRange},
+		{100, 100 + maxReplayBlocks - 1, nil},
+		{100, 100 + maxReplayBlocks, errReplayRange},
+	}
+	for i, tt := range tests {
+		replay := &logReplay{begin: tt.begin}
+		if err := replay.setEnd(tt.end); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
 // TestPendingTxFilterDeadlock tests if the event loop hangs when pending
 // txes arrive at the same time that one of multiple filters is timing out.
 // Please refer to #22131 for more details.
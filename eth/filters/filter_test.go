@@ -21,7 +21,9 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
@@ -30,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func makeReceipt(addr common.Address) *types.Receipt {
@@ -200,6 +203,19 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 2 log, got", len(logs))
 	}
 
+	backend.finalized = 999
+	filter = NewRangeFilter(backend, 0, int64(rpc.FinalizedBlockNumber), []common.Address{addr}, [][]common.Hash{{hash1, hash2, hash3, hash4}})
+	logs, _ = filter.Logs(context.Background())
+	if len(logs) != 3 {
+		t.Error("expected 3 log, got", len(logs))
+	}
+
+	filter = NewRangeFilter(backend, int64(rpc.SafeBlockNumber), -1, []common.Address{addr}, [][]common.Hash{{hash3, hash4}})
+	logs, _ = filter.Logs(context.Background())
+	if len(logs) != 2 {
+		t.Error("expected 2 log, got", len(logs))
+	}
+
 	failHash := common.BytesToHash([]byte("fail"))
 	filter = NewRangeFilter(backend, 0, -1, nil, [][]common.Hash{{failHash}})
 
@@ -223,3 +239,105 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// testLogIndexSize is the section size of the log index used in tests.
+const testLogIndexSize = 64
+
+// Tests that filters served from the log index return the same logs as filters
+// iterating over the blocks, and that paginated queries resume correctly.
+func TestLogIndexFilters(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		addr1   = common.HexToAddress("0x1111")
+		addr2   = common.HexToAddress("0x2222")
+		hashA   = common.BytesToHash([]byte("topicA"))
+		hashB   = common.BytesToHash([]byte("topicB"))
+	)
+	genesis := core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 1000, func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		if i%10 == 0 {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr1, Topics: []common.Hash{hashA}})
+		}
+		if i%15 == 0 {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr2, Topics: []common.Hash{hashA, hashB}})
+		}
+		if i%25 == 0 {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr1, Topics: []common.Hash{hashB, hashA}})
+		}
+		if len(receipt.Logs) > 0 {
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, gen.BaseFee(), nil))
+		}
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	indexed := &testBackend{db: db, logIndex: core.NewLogIndexer(db, testLogIndexSize, 0)}
+	indexed.logIndex.Start(indexed)
+	defer indexed.logIndex.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, sections := indexed.LogIndexStatus(); sections == 1001/testLogIndexSize {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("log index not generated in time")
+		}
+	}
+	tests := []struct {
+		begin, end int64
+		addresses  []common.Address
+		topics     [][]common.Hash
+	}{
+		{0, -1, []common.Address{addr1}, nil},
+		{0, -1, nil, [][]common.Hash{{hashA}}},
+		{0, -1, []common.Address{addr1}, [][]common.Hash{{hashA}}},
+		{0, -1, nil, [][]common.Hash{nil, {hashA}}},
+		{0, -1, []common.Address{addr1, addr2}, [][]common.Hash{{hashB}}},
+		{0, -1, nil, [][]common.Hash{{hashA, hashB}, {hashB}}},
+		{130, 870, []common.Address{addr2}, nil},
+		{500, 999, nil, [][]common.Hash{{hashB}, {hashA}}},
+		{0, -1, []common.Address{common.HexToAddress("0x3333")}, nil},
+		{0, -1, nil, [][]common.Hash{nil, nil, {hashA}}},
+	}
+	for i, test := range tests {
+		want, err := NewRangeFilter(backend, test.begin, test.end, test.addresses, test.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: unindexed filter failed: %v", i, err)
+		}
+		have, err := NewRangeFilter(indexed, test.begin, test.end, test.addresses, test.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: indexed filter failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("test %d: log mismatch: have %d logs, want %d", i, len(have), len(want))
+		}
+		// Retrieve the same logs in pages
+		var (
+			paged  []*types.Log
+			cursor *LogCursor
+		)
+		for {
+			logs, next, err := NewRangeFilter(indexed, test.begin, test.end, test.addresses, test.topics).LogsPage(context.Background(), 7, cursor)
+			if err != nil {
+				t.Fatalf("test %d: paginated filter failed: %v", i, err)
+			}
+			if len(logs) > 7 {
+				t.Fatalf("test %d: page exceeds limit: %d logs", i, len(logs))
+			}
+			paged = append(paged, logs...)
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+		if len(paged) != len(want) || (len(want) > 0 && !reflect.DeepEqual(paged, want)) {
+			t.Errorf("test %d: paginated log mismatch: have %d logs, want %d", i, len(paged), len(want))
+		}
+	}
+}
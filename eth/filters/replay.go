@@ -0,0 +1,204 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// replayPageSize is the number of logs retrieved at once while replaying.
+	replayPageSize = 1000
+
+	// replayReorgDepth is the number of blocks below the head whose replayed
+	// logs are tracked, to tell reorged logs from duplicates.
+	replayReorgDepth = 128
+
+	// maxReplayBlocks is the maximum number of blocks a subscription may replay.
+	// Longer ranges should be retrieved with eth_getLogsPage first.
+	maxReplayBlocks = 100000
+
+	// maxReplayPending is the maximum number of live logs held back while the
+	// replay is running, the same as the maximum page of eth_getLogsPage.
+	maxReplayPending = maxLogsPageSize
+)
+
+var (
+	errReplayRange   = fmt.Errorf("log replay exceeds %d blocks", maxReplayBlocks)
+	errReplayPending = errors.New("log replay fell behind the chain")
+)
+
+// logReplay replays the historical logs matching a subscription, and merges them
+// with the live logs delivered in the meantime, so that every log is sent once.
+type logReplay struct {
+	begin, end uint64                   // Range of blocks to replay
+	removed    []*types.Log             // Logs of the abandoned fork of the resumed block
+	replayed   map[common.Hash]struct{} // Blocks near the head with replayed logs
+	err        error                    // Failure of the replay, set before its pages are closed
+}
+
+// newLogReplay creates the replay of the logs matching the criteria of a log
+// subscription, or nil if no replay is requested. The criteria are updated for
+// the live subscription to follow the replay.
+//
+// The replay starts at the FromBlock of the criteria, or after the block of the
+// BlockHash, which is the last block processed by a resuming client. If that
+// block is no longer canonical, the logs of its fork are removed first.
+func newLogReplay(ctx context.Context, backend Backend, crit *FilterCriteria) (*logReplay, error) {
+	replay := &logReplay{replayed: make(map[common.Hash]struct{})}
+	switch {
+	case crit.BlockHash != nil:
+		header, err := backend.HeaderByHash(ctx, *crit.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errors.New("unknown block")
+		}
+		db := backend.ChainDb()
+		for rawdb.ReadCanonicalHash(db, header.Number.Uint64()) != header.Hash() {
+			logs, err := forkLogs(ctx, backend, header, crit)
+			if err != nil {
+				return nil, err
+			}
+			replay.removed = append(replay.removed, logs...)
+
+			if header, err = backend.HeaderByHash(ctx, header.ParentHash); err != nil {
+				return nil, err
+			}
+			if header == nil {
+				return nil, errors.New("unknown ancestor block")
+			}
+		}
+		replay.begin = header.Number.Uint64() + 1
+
+	case crit.FromBlock != nil && crit.FromBlock.Sign() >= 0:
+		replay.begin = crit.FromBlock.Uint64()
+
+	case crit.FromBlock != nil && (crit.FromBlock.Int64() == rpc.FinalizedBlockNumber.Int64() || crit.FromBlock.Int64() == rpc.SafeBlockNumber.Int64()):
+		header, err := backend.HeaderByNumber(ctx, rpc.BlockNumber(crit.FromBlock.Int64()))
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errors.New("unknown block")
+		}
+		replay.begin = header.Number.Uint64()
+
+	default:
+		return nil, nil
+	}
+	crit.BlockHash = nil
+	crit.FromBlock = new(big.Int).SetUint64(replay.begin)
+	return replay, nil
+}
+
+// forkLogs returns the logs of a non-canonical block matching the criteria,
+// marked as removed.
+func forkLogs(ctx context.Context, backend Backend, header *types.Header, crit *FilterCriteria) ([]*types.Log, error) {
+	logsList, err := backend.GetLogs(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	var unfiltered []*types.Log
+	for _, logs := range logsList {
+		for _, log := range logs {
+			removed := *log
+			removed.Removed = true
+			unfiltered = append(unfiltered, &removed)
+		}
+	}
+	return filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics), nil
+}
+
+// setEnd sets the last block to replay, rejecting ranges exceeding the limit.
+func (r *logReplay) setEnd(end uint64) error {
+	r.end = end
+	if r.begin <= r.end && r.end-r.begin >= maxReplayBlocks {
+		return errReplayRange
+	}
+	return nil
+}
+
+// run retrieves the logs of the replayed blocks in pages, sending them to the
+// given channel. It is closed when all logs are replayed, or on failure after
+// setting the error of the replay.
+func (r *logReplay) run(backend Backend, crit FilterCriteria, pages chan<- []*types.Log, quit <-chan struct{}) {
+	defer close(pages)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var cursor *LogCursor
+	for r.begin <= r.end {
+		filter := NewRangeFilter(backend, int64(r.begin), int64(r.end), crit.Addresses, crit.Topics)
+		logs, next, err := filter.LogsPage(ctx, replayPageSize, cursor)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if len(logs) > 0 {
+			select {
+			case pages <- logs:
+			case <-quit:
+				return
+			}
+		}
+		if next == nil {
+			return
+		}
+		cursor = next
+	}
+}
+
+// record tracks the blocks of replayed logs near the head.
+func (r *logReplay) record(logs []*types.Log) {
+	for _, log := range logs {
+		if log.BlockNumber+replayReorgDepth > r.end {
+			r.replayed[log.BlockHash] = struct{}{}
+		}
+	}
+}
+
+// filter drops the live logs already sent by the replay. New logs are dropped if
+// their block was replayed, removed logs are dropped unless it was.
+func (r *logReplay) filter(logs []*types.Log) []*types.Log {
+	var ret []*types.Log
+	for _, log := range logs {
+		if log.BlockNumber <= r.end {
+			if _, replayed := r.replayed[log.BlockHash]; replayed != log.Removed {
+				continue
+			}
+		}
+		ret = append(ret, log)
+	}
+	return ret
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/fetcher"
@@ -61,6 +62,10 @@ type txPool interface {
 	// tx hash.
 	Get(hash common.Hash) *types.Transaction
 
+	// IsPrivate returns whether the transaction with the given hash is
+	// private and must never be propagated to the network.
+	IsPrivate(hash common.Hash) bool
+
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
@@ -107,6 +112,7 @@ type handler struct {
 	stateBloom   *trie.SyncBloom
 	blockFetcher *fetcher.BlockFetcher
 	txFetcher    *fetcher.TxFetcher
+	repairer     *ancientRepairer
 	peers        *peerSet
 
 	eventMux      *event.TypeMux
@@ -229,6 +235,11 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		return p.RequestTxs(hashes)
 	}
 	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx)
+
+	// If a freezer verification found corrupted chain data, heal it from the network
+	if corrupt := rawdb.ReadCorruptAncients(config.Database); corrupt != nil {
+		h.repairer = newAncientRepairer(config.Database, corrupt, h.peers.peerWithHighestTD)
+	}
 	h.chainSync = newChainSyncer(h)
 	return h, nil
 }
@@ -411,6 +422,15 @@ func (h *handler) Start(maxPeers int) {
 	h.wg.Add(2)
 	go h.chainSync.loop()
 	go h.txsyncLoop64() // TODO(karalabe): Legacy initial tx echange, drop with eth/64.
+
+	// repair corrupted ancient chain data
+	if h.repairer != nil {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.repairer.loop(h.quitSync)
+		}()
+	}
 }
 
 func (h *handler) Stop() {
@@ -482,6 +502,9 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
+		if h.txpool.IsPrivate(tx.Hash()) {
+			continue // Private transactions are only included by the local miner
+		}
 		peers := h.peers.peersWithoutTransaction(tx.Hash())
 		// Send the tx unconditionally to a subset of our peers
 		numDirect := int(math.Sqrt(float64(len(peers))))
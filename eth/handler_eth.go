@@ -38,7 +38,21 @@ type ethHandler handler
 
 func (h *ethHandler) Chain() *core.BlockChain     { return h.chain }
 func (h *ethHandler) StateBloom() *trie.SyncBloom { return h.stateBloom }
-func (h *ethHandler) TxPool() eth.TxPool          { return h.txpool }
+func (h *ethHandler) TxPool() eth.TxPool          { return &publicTxPool{h.txpool} }
+
+// publicTxPool is the view of the transaction pool exposed to the remote peers,
+// hiding all private transactions.
+type publicTxPool struct {
+	txpool txPool
+}
+
+// Get retrieves a transaction from the pool, unless it's a private one.
+func (p *publicTxPool) Get(hash common.Hash) *types.Transaction {
+	if p.txpool.IsPrivate(hash) {
+		return nil
+	}
+	return p.txpool.Get(hash)
+}
 
 // RunPeer is invoked when a peer joins on the `eth` protocol.
 func (h *ethHandler) RunPeer(peer *eth.Peer, hand eth.Handler) error {
@@ -148,6 +162,12 @@ func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) erro
 			}
 			peer.Log().Debug("Whitelist block verified", "number", headers[0].Number.Uint64(), "hash", want)
 		}
+		// If it's a refetched corrupted ancient header, hand it to the repairer
+		if h.repairer != nil {
+			if headers = h.repairer.filterHeaders(headers); len(headers) == 0 {
+				return nil
+			}
+		}
 		// Irrelevant of the fork checks, send the header to the fetcher just in case
 		headers = h.blockFetcher.FilterHeaders(peer.ID(), headers, time.Now())
 	}
@@ -165,6 +185,11 @@ func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) erro
 func (h *ethHandler) handleBodies(peer *eth.Peer, txs [][]*types.Transaction, uncles [][]*types.Header) error {
 	// Filter out any explicitly requested bodies, deliver the rest to the downloader
 	filter := len(txs) > 0 || len(uncles) > 0
+	if filter && h.repairer != nil {
+		if txs, uncles = h.repairer.filterBodies(txs, uncles); len(txs) == 0 && len(uncles) == 0 {
+			return nil
+		}
+	}
 	if filter {
 		txs, uncles = h.blockFetcher.FilterBodies(peer.ID(), txs, uncles, time.Now())
 	}
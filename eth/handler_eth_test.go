@@ -450,6 +450,95 @@ func testTransactionPropagation(t *testing.T, protocol uint) {
 	}
 }
 
+// Tests that private transactions are neither broadcast nor announced to any of
+// the attached peers, nor retrievable by them.
+func TestPrivateTxPropagation65(t *testing.T) { testPrivateTxPropagation(t, eth.ETH65) }
+func TestPrivateTxPropagation66(t *testing.T) { testPrivateTxPropagation(t, eth.ETH66) }
+
+func testPrivateTxPropagation(t *testing.T, protocol uint) {
+	t.Parallel()
+
+	// Create a source handler to send transactions from and a number of sinks
+	// to receive them, with both direct broadcasts and announcements in play.
+	source := newTestHandler()
+	defer source.close()
+
+	sinks := make([]*testHandler, 10)
+	for i := 0; i < len(sinks); i++ {
+		sinks[i] = newTestHandler()
+		defer sinks[i].close()
+
+		sinks[i].handler.acceptTxs = 1 // mark synced to accept transactions
+	}
+	// Fill the source pool with private transactions before the peers connect,
+	// to ensure they are not part of the initial transaction sync
+	privates := make([]*types.Transaction, 16)
+	for nonce := range privates {
+		tx := types.NewTransaction(uint64(nonce), common.Address{}, big.NewInt(0), 100000, big.NewInt(0), nil)
+		tx, _ = types.SignTx(tx, types.HomesteadSigner{}, testKey)
+
+		privates[nonce] = tx
+	}
+	source.txpool.AddPrivates(privates[:len(privates)/2])
+
+	for i, sink := range sinks {
+		sink := sink // Closure for gorotuine below
+
+		sourcePipe, sinkPipe := p2p.MsgPipe()
+		defer sourcePipe.Close()
+		defer sinkPipe.Close()
+
+		sourcePeer := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{byte(i)}, "", nil, sourcePipe), sourcePipe, (*ethHandler)(source.handler).TxPool())
+		sinkPeer := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{0}, "", nil, sinkPipe), sinkPipe, (*ethHandler)(sink.handler).TxPool())
+		defer sourcePeer.Close()
+		defer sinkPeer.Close()
+
+		go source.handler.runEthPeer(sourcePeer, func(peer *eth.Peer) error {
+			return eth.Handle((*ethHandler)(source.handler), peer)
+		})
+		go sink.handler.runEthPeer(sinkPeer, func(peer *eth.Peer) error {
+			return eth.Handle((*ethHandler)(sink.handler), peer)
+		})
+	}
+	time.Sleep(250 * time.Millisecond) // Wait until the initial transaction sync is done
+
+	// Subscribe to all the transaction pools
+	txChs := make([]chan core.NewTxsEvent, len(sinks))
+	for i := 0; i < len(sinks); i++ {
+		txChs[i] = make(chan core.NewTxsEvent, 1024)
+
+		sub := sinks[i].txpool.SubscribeNewTxsEvent(txChs[i])
+		defer sub.Unsubscribe()
+	}
+	// Add the rest of the private transactions along with some public ones, and
+	// wait for the public ones to arrive at the sinks
+	publics := make([]*types.Transaction, 16)
+	for i := range publics {
+		tx := types.NewTransaction(uint64(len(privates)+i), common.Address{}, big.NewInt(0), 100000, big.NewInt(0), nil)
+		tx, _ = types.SignTx(tx, types.HomesteadSigner{}, testKey)
+
+		publics[i] = tx
+	}
+	source.txpool.AddPrivates(privates[len(privates)/2:])
+	source.txpool.AddRemotes(publics)
+
+	for i := range sinks {
+		for arrived := 0; arrived < len(publics); {
+			select {
+			case event := <-txChs[i]:
+				arrived += len(event.Txs)
+			case <-time.NewTimer(time.Second).C:
+				t.Fatalf("sink %d: transaction propagation timed out: have %d, want %d", i, arrived, len(publics))
+			}
+		}
+		for _, tx := range privates {
+			if sinks[i].txpool.Has(tx.Hash()) {
+				t.Errorf("sink %d: private transaction %x propagated", i, tx.Hash())
+			}
+		}
+	}
+}
+
 // Tests that post eth protocol handshake, clients perform a mutual checkpoint
 // challenge to validate each other's chains. Hash mismatches, or missing ones
 // during a fast sync should lead to the peer getting dropped.
@@ -0,0 +1,243 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	repairCycle   = 3 * time.Second  // Interval between two rounds of repair requests
+	repairTimeout = 10 * time.Second // Time after which an unanswered request is retried
+	repairBatch   = 16               // Maximum number of items requested per round
+)
+
+// ancientRepairer heals the headers and bodies in the ancient store which were
+// flagged as corrupt by a freezer verification, by refetching them from the
+// network. Refetched items are only accepted if they are byte-for-byte equal to
+// the originally frozen data, which the freezer verifies against its checksums.
+type ancientRepairer struct {
+	db   ethdb.Database   // Database with the ancient store to heal
+	peer func() *eth.Peer // Retrieves a peer to request data from
+
+	corrupt *rawdb.CorruptAncients // Items still pending repair
+	headers map[uint64]time.Time   // In-flight header requests by block number
+	bodies  map[uint64]*bodyRepair // In-flight body requests by block number
+	lock    sync.Mutex
+}
+
+// bodyRepair is an in-flight request for a corrupted block body.
+type bodyRepair struct {
+	header *types.Header // Header to validate the refetched body against
+	time   time.Time     // Timestamp when the request was sent
+}
+
+// newAncientRepairer creates a repairer for the given set of corrupted items.
+func newAncientRepairer(db ethdb.Database, corrupt *rawdb.CorruptAncients, peer func() *eth.Peer) *ancientRepairer {
+	return &ancientRepairer{
+		db:      db,
+		peer:    peer,
+		corrupt: corrupt,
+		headers: make(map[uint64]time.Time),
+		bodies:  make(map[uint64]*bodyRepair),
+	}
+}
+
+// loop periodically requests the pending items from the network until all of
+// them are repaired or the handler is stopped.
+func (r *ancientRepairer) loop(quit chan struct{}) {
+	log.Warn("Repairing corrupted ancient chain data", "headers", len(r.corrupt.Headers), "bodies", len(r.corrupt.Bodies))
+
+	ticker := time.NewTicker(repairCycle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if r.done() {
+				log.Info("Repaired all corrupted ancient chain data")
+				return
+			}
+			if peer := r.peer(); peer != nil {
+				r.request(peer)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// done returns whether all corrupted items have been repaired.
+func (r *ancientRepairer) done() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.corrupt.Headers) == 0 && len(r.corrupt.Bodies) == 0
+}
+
+// request sends a round of repair requests to the given peer.
+func (r *ancientRepairer) request(peer *eth.Peer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	for _, number := range pendingItems(r.corrupt.Headers, repairBatch, func(number uint64) bool {
+		return now.Sub(r.headers[number]) < repairTimeout
+	}) {
+		r.headers[number] = now
+		if err := peer.RequestHeadersByNumber(number, 1, 0, false); err != nil {
+			peer.Log().Debug("Failed to request corrupted header", "number", number, "err", err)
+			return
+		}
+	}
+	var hashes []common.Hash
+	for _, number := range pendingItems(r.corrupt.Bodies, repairBatch, func(number uint64) bool {
+		req := r.bodies[number]
+		return req != nil && now.Sub(req.time) < repairTimeout
+	}) {
+		// The body can only be validated if its header is intact
+		header := rawdb.ReadHeader(r.db, rawdb.ReadCanonicalHash(r.db, number), number)
+		if header == nil {
+			continue
+		}
+		// Empty bodies don't need to be fetched, they can be recreated locally
+		if header.TxHash == types.EmptyRootHash && header.UncleHash == types.EmptyUncleHash {
+			r.repairBody(number, new(types.Body))
+			continue
+		}
+		r.bodies[number] = &bodyRepair{header: header, time: now}
+		hashes = append(hashes, header.Hash())
+	}
+	if len(hashes) > 0 {
+		if err := peer.RequestBodies(hashes); err != nil {
+			peer.Log().Debug("Failed to request corrupted bodies", "count", len(hashes), "err", err)
+		}
+	}
+}
+
+// filterHeaders consumes a single-header delivery if it is the answer to a
+// repair request, returning any headers that were not consumed.
+func (r *ancientRepairer) filterHeaders(headers []*types.Header) []*types.Header {
+	if len(headers) != 1 {
+		return headers
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	number := headers[0].Number.Uint64()
+	if _, ok := r.headers[number]; !ok {
+		return headers
+	}
+	if headers[0].Hash() != rawdb.ReadCanonicalHash(r.db, number) {
+		return headers
+	}
+	delete(r.headers, number)
+	if err := rawdb.RepairAncientHeader(r.db, headers[0]); err != nil {
+		log.Error("Failed to repair ancient header", "number", number, "err", err)
+		return nil
+	}
+	r.corrupt.Headers = removeItem(r.corrupt.Headers, number)
+	rawdb.WriteCorruptAncients(r.db, r.corrupt)
+	return nil
+}
+
+// filterBodies consumes a body delivery if all of its bodies answer repair
+// requests, returning the bodies untouched otherwise, so that responses meant
+// for the downloader or fetcher are never split apart.
+func (r *ancientRepairer) filterBodies(txs [][]*types.Transaction, uncles [][]*types.Header) ([][]*types.Transaction, [][]*types.Header) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.bodies) == 0 || len(txs) == 0 {
+		return txs, uncles
+	}
+	matches := make([]uint64, len(txs))
+	for i := range txs {
+		var (
+			txHash    = types.DeriveSha(types.Transactions(txs[i]), trie.NewStackTrie(nil))
+			uncleHash = types.CalcUncleHash(uncles[i])
+			found     bool
+		)
+		for number, req := range r.bodies {
+			if req.header.TxHash == txHash && req.header.UncleHash == uncleHash {
+				matches[i], found = number, true
+				break
+			}
+		}
+		if !found {
+			return txs, uncles
+		}
+	}
+	for i, number := range matches {
+		delete(r.bodies, number)
+		r.repairBody(number, &types.Body{Transactions: txs[i], Uncles: uncles[i]})
+	}
+	return nil, nil
+}
+
+// repairBody overwrites a corrupted ancient body and updates the set of pending
+// items. The caller must hold the lock.
+func (r *ancientRepairer) repairBody(number uint64, body *types.Body) {
+	if err := rawdb.RepairAncientBody(r.db, number, body); err != nil {
+		log.Error("Failed to repair ancient body", "number", number, "err", err)
+		return
+	}
+	r.corrupt.Bodies = removeItem(r.corrupt.Bodies, number)
+	rawdb.WriteCorruptAncients(r.db, r.corrupt)
+}
+
+// pendingItems returns up to limit item numbers from the given ranges, skipping
+// the ones the busy callback reports as already being requested.
+func pendingItems(ranges []rawdb.AncientRange, limit int, busy func(uint64) bool) []uint64 {
+	var items []uint64
+	for _, r := range ranges {
+		for number := r.From; number <= r.To && len(items) < limit; number++ {
+			if !busy(number) {
+				items = append(items, number)
+			}
+		}
+	}
+	return items
+}
+
+// removeItem removes a single item number from the given ranges, splitting up
+// the range containing it if needed.
+func removeItem(ranges []rawdb.AncientRange, number uint64) []rawdb.AncientRange {
+	for i, r := range ranges {
+		if number < r.From || number > r.To {
+			continue
+		}
+		var split []rawdb.AncientRange
+		if number > r.From {
+			split = append(split, rawdb.AncientRange{From: r.From, To: number - 1})
+		}
+		if number < r.To {
+			split = append(split, rawdb.AncientRange{From: number + 1, To: r.To})
+		}
+		return append(ranges[:i], append(split, ranges[i+1:]...)...)
+	}
+	return ranges
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+// Tests that the pending repair ranges are correctly iterated and shrunk.
+func TestRepairRanges(t *testing.T) {
+	ranges := []rawdb.AncientRange{{From: 1, To: 3}, {From: 10, To: 10}, {From: 20, To: 25}}
+
+	busy := func(n uint64) bool { return n == 2 || n == 21 }
+	if have, want := pendingItems(ranges, 4, busy), []uint64{1, 3, 10, 20}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("pending items mismatch: have %v, want %v", have, want)
+	}
+	for _, tt := range []struct {
+		remove uint64
+		want   []rawdb.AncientRange
+	}{
+		{5, []rawdb.AncientRange{{From: 1, To: 3}, {From: 10, To: 10}, {From: 20, To: 25}}},
+		{2, []rawdb.AncientRange{{From: 1, To: 1}, {From: 3, To: 3}, {From: 10, To: 10}, {From: 20, To: 25}}},
+		{10, []rawdb.AncientRange{{From: 1, To: 1}, {From: 3, To: 3}, {From: 20, To: 25}}},
+		{20, []rawdb.AncientRange{{From: 1, To: 1}, {From: 3, To: 3}, {From: 21, To: 25}}},
+		{25, []rawdb.AncientRange{{From: 1, To: 1}, {From: 3, To: 3}, {From: 21, To: 24}}},
+	} {
+		ranges = removeItem(ranges, tt.remove)
+		if !reflect.DeepEqual(ranges, tt.want) {
+			t.Fatalf("ranges mismatch after removing %d: have %v, want %v", tt.remove, ranges, tt.want)
+		}
+	}
+}
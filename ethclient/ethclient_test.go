@@ -188,6 +188,12 @@ var (
 )
 
 func newTestBackend(t *testing.T) (*node.Node, []*types.Block) {
+	return newTestBackendWithConfig(t, func(*ethconfig.Config) {})
+}
+
+// newTestBackendWithConfig creates a test node, letting the caller adjust the
+// configuration of its Ethereum service.
+func newTestBackendWithConfig(t *testing.T, configure func(*ethconfig.Config)) (*node.Node, []*types.Block) {
 	// Generate test chain.
 	genesis, blocks := generateTestChain()
 	// Create node
@@ -198,6 +204,7 @@ func newTestBackend(t *testing.T) (*node.Node, []*types.Block) {
 	// Create Ethereum Service
 	config := &ethconfig.Config{Genesis: genesis}
 	config.Ethash.PowMode = ethash.ModeFake
+	configure(config)
 	ethservice, err := eth.New(n, config)
 	if err != nil {
 		t.Fatalf("can't create new ethereum service: %v", err)
@@ -266,6 +273,9 @@ func TestEthClient(t *testing.T) {
 		"TestAtFunctions": {
 			func(t *testing.T) { testAtFunctions(t, client) },
 		},
+		"TestBlockReceipts": {
+			func(t *testing.T) { testBlockReceipts(t, chain, client) },
+		},
 	}
 
 	t.Parallel()
@@ -561,6 +571,77 @@ func testAtFunctions(t *testing.T, client *rpc.Client) {
 	}
 }
 
+func testBlockReceipts(t *testing.T, chain []*types.Block, client *rpc.Client) {
+	ec := NewClient(client)
+
+	tests := map[string]struct {
+		block   rpc.BlockNumberOrHash
+		want    int
+		wantErr error
+	}{
+		"genesis": {
+			block: rpc.BlockNumberOrHashWithNumber(0),
+		},
+		"first_block_hash": {
+			block: rpc.BlockNumberOrHashWithHash(chain[1].Hash(), true),
+		},
+		"latest": {
+			block: rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber),
+		},
+		"future_block": {
+			block:   rpc.BlockNumberOrHashWithNumber(1000000),
+			wantErr: ethereum.NotFound,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			receipts, err := ec.BlockReceipts(context.Background(), tt.block)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BlockReceipts(%v) error = %q, want %q", tt.block, err, tt.wantErr)
+			}
+			if err == nil && len(receipts) != tt.want {
+				t.Fatalf("BlockReceipts(%v) = %d receipts, want %d", tt.block, len(receipts), tt.want)
+			}
+		})
+	}
+}
+
+// Tests that transactions submitted over RPC are subject to the sender rate limit
+// of the transaction pool, unless their sender is a configured local account.
+func TestSendTransactionRateLimit(t *testing.T) {
+	for _, exempt := range []bool{false, true} {
+		backend, _ := newTestBackendWithConfig(t, func(config *ethconfig.Config) {
+			config.TxPool = core.DefaultTxPoolConfig
+			config.TxPool.SenderRate = 0.001
+			config.TxPool.SenderBurst = 1
+			if exempt {
+				config.TxPool.Locals = []common.Address{testAddr}
+			}
+		})
+		client, _ := backend.Attach()
+		ec := NewClient(client)
+
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx := types.NewTransaction(nonce, common.Address{1}, big.NewInt(1), 22000, big.NewInt(params.InitialBaseFee), nil)
+			signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID), testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ec.SendTransaction(context.Background(), signedTx)
+			switch {
+			case nonce == 0 || exempt:
+				if err != nil {
+					t.Errorf("exempt %v, transaction %d: failed to send: %v", exempt, nonce, err)
+				}
+			case err == nil || err.Error() != core.ErrSenderRateLimit.Error():
+				t.Errorf("exempt %v, transaction %d: error mismatch: have %v, want %v", exempt, nonce, err, core.ErrSenderRateLimit)
+			}
+		}
+		client.Close()
+		backend.Close()
+	}
+}
+
 func sendTransaction(ec *Client) error {
 	// Retrieve chainID
 	chainID, err := ec.ChainID(context.Background())
@@ -99,6 +99,11 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// RepairAncient overwrites a single corrupted ancient item in place. The blob
+	// must be identical to the data originally appended, as verified against the
+	// checksum recorded by the ancient store.
+	RepairAncient(kind string, number uint64, blob []byte) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
@@ -19,6 +19,7 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -32,14 +33,27 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 var (
 	errBlockInvariant = errors.New("block objects must be instantiated with at least one of num or hash")
+	errNoTracing      = errors.New("transaction tracing not supported by the backend")
+	errForbidden      = errors.New("GraphQL requires access to the eth namespace")
+	errTracingHidden  = errors.New("transaction tracing requires access to debug_traceTransaction over HTTP")
 )
 
+// tracingKey is the context key reporting whether transaction traces may be
+// served, that is whether the debug namespace is exposed over HTTP.
+type tracingKey struct{}
+
+// maxStorageRange is the maximum number of entries in a storage range.
+const maxStorageRange = 1024
+
 type Long int64
 
 // ImplementsGraphQLType returns true if Long implements the provided GraphQL type.
@@ -124,6 +138,80 @@ func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash })
 	return state.GetState(a.address, args.Slot), nil
 }
 
+func (a *Account) StorageRange(ctx context.Context, args struct {
+	Start *common.Hash
+	Limit int32
+}) (*StorageRange, error) {
+	if args.Limit < 0 || args.Limit > maxStorageRange {
+		return nil, fmt.Errorf("storage range limit must be between 0 and %d", maxStorageRange)
+	}
+	state, err := a.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := &StorageRange{entries: []*StorageEntry{}}
+	st := state.StorageTrie(a.address)
+	if st == nil {
+		return ret, nil
+	}
+	var start []byte
+	if args.Start != nil {
+		start = args.Start.Bytes()
+	}
+	it := trie.NewIterator(st.NodeIterator(start))
+	for i := int32(0); i < args.Limit && it.Next(); i++ {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, err
+		}
+		entry := &StorageEntry{hash: common.BytesToHash(it.Key), value: common.BytesToHash(content)}
+		if preimage := st.GetKey(it.Key); preimage != nil {
+			slot := common.BytesToHash(preimage)
+			entry.slot = &slot
+		}
+		ret.entries = append(ret.entries, entry)
+	}
+	// Add the next hash so clients can continue iterating
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		ret.next = &next
+	}
+	return ret, it.Err
+}
+
+// StorageRange represents a range of the storage of an account.
+type StorageRange struct {
+	entries []*StorageEntry
+	next    *common.Hash
+}
+
+func (r *StorageRange) Entries(ctx context.Context) []*StorageEntry {
+	return r.entries
+}
+
+func (r *StorageRange) NextHash(ctx context.Context) *common.Hash {
+	return r.next
+}
+
+// StorageEntry represents a storage slot of an account.
+type StorageEntry struct {
+	hash  common.Hash
+	slot  *common.Hash // Preimage of the hash, nil if unknown
+	value common.Hash
+}
+
+func (e *StorageEntry) Hash(ctx context.Context) common.Hash {
+	return e.hash
+}
+
+func (e *StorageEntry) Slot(ctx context.Context) *common.Hash {
+	return e.slot
+}
+
+func (e *StorageEntry) Value(ctx context.Context) common.Hash {
+	return e.value
+}
+
 // Log represents an individual log message. All arguments are mandatory.
 type Log struct {
 	backend     ethapi.Backend
@@ -155,6 +243,10 @@ func (l *Log) Data(ctx context.Context) hexutil.Bytes {
 	return l.log.Data
 }
 
+func (l *Log) Removed(ctx context.Context) bool {
+	return l.log.Removed
+}
+
 // AccessTuple represents EIP-2930
 type AccessTuple struct {
 	address     common.Address
@@ -423,6 +515,105 @@ func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
 	return &ret, nil
 }
 
+func (t *Transaction) Traces(ctx context.Context) (*[]*CallFrame, error) {
+	if enabled, _ := ctx.Value(tracingKey{}).(bool); !enabled {
+		return nil, errTracingHidden
+	}
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	backend, ok := t.backend.(tracers.Backend)
+	if !ok {
+		return nil, errNoTracing
+	}
+	tracer := "callTracer"
+	res, err := tracers.NewAPI(backend).TraceTransaction(ctx, t.hash, &tracers.TraceConfig{Tracer: &tracer})
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := res.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected trace result %T", res)
+	}
+	var root callFrame
+	if err := json.Unmarshal(blob, &root); err != nil {
+		return nil, err
+	}
+	ret := []*CallFrame{}
+	var flatten func(frame *callFrame, depth int32)
+	flatten = func(frame *callFrame, depth int32) {
+		ret = append(ret, &CallFrame{depth: depth, frame: frame})
+		for i := range frame.Calls {
+			flatten(&frame.Calls[i], depth+1)
+		}
+	}
+	flatten(&root, 0)
+	return &ret, nil
+}
+
+// callFrame is a frame of the call tree reported by the callTracer.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to"`
+	Value   *hexutil.Big    `json:"value"`
+	Gas     hexutil.Uint64  `json:"gas"`
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Input   hexutil.Bytes   `json:"input"`
+	Output  hexutil.Bytes   `json:"output"`
+	Error   *string         `json:"error"`
+	Calls   []callFrame     `json:"calls"`
+}
+
+// CallFrame represents a call or contract creation executed by a transaction.
+type CallFrame struct {
+	depth int32
+	frame *callFrame
+}
+
+func (f *CallFrame) Depth(ctx context.Context) int32 {
+	return f.depth
+}
+
+func (f *CallFrame) Type(ctx context.Context) string {
+	return f.frame.Type
+}
+
+func (f *CallFrame) From(ctx context.Context) common.Address {
+	return f.frame.From
+}
+
+func (f *CallFrame) To(ctx context.Context) *common.Address {
+	return f.frame.To
+}
+
+func (f *CallFrame) Value(ctx context.Context) *hexutil.Big {
+	return f.frame.Value
+}
+
+func (f *CallFrame) Gas(ctx context.Context) Long {
+	return Long(f.frame.Gas)
+}
+
+func (f *CallFrame) GasUsed(ctx context.Context) Long {
+	return Long(f.frame.GasUsed)
+}
+
+func (f *CallFrame) Input(ctx context.Context) hexutil.Bytes {
+	return f.frame.Input
+}
+
+func (f *CallFrame) Output(ctx context.Context) hexutil.Bytes {
+	return f.frame.Output
+}
+
+func (f *CallFrame) Error(ctx context.Context) *string {
+	return f.frame.Error
+}
+
 func (t *Transaction) Type(ctx context.Context) (*int32, error) {
 	tx, err := t.resolve(ctx)
 	if err != nil {
@@ -475,6 +666,59 @@ func (t *Transaction) V(ctx context.Context) (hexutil.Big, error) {
 	return hexutil.Big(*v), nil
 }
 
+// Receipt represents the receipt of a transaction included in a block.
+type Receipt struct {
+	transaction *Transaction
+	receipt     *types.Receipt
+}
+
+func (r *Receipt) Transaction(ctx context.Context) *Transaction {
+	return r.transaction
+}
+
+func (r *Receipt) Status(ctx context.Context) Long {
+	return Long(r.receipt.Status)
+}
+
+func (r *Receipt) GasUsed(ctx context.Context) Long {
+	return Long(r.receipt.GasUsed)
+}
+
+func (r *Receipt) CumulativeGasUsed(ctx context.Context) Long {
+	return Long(r.receipt.CumulativeGasUsed)
+}
+
+func (r *Receipt) EffectiveGasPrice(ctx context.Context) (*hexutil.Big, error) {
+	return r.transaction.EffectiveGasPrice(ctx)
+}
+
+func (r *Receipt) CreatedContract(ctx context.Context, args BlockNumberArgs) *Account {
+	if r.receipt.ContractAddress == (common.Address{}) {
+		return nil
+	}
+	return &Account{
+		backend:       r.transaction.backend,
+		address:       r.receipt.ContractAddress,
+		blockNrOrHash: args.NumberOrLatest(),
+	}
+}
+
+func (r *Receipt) LogsBloom(ctx context.Context) hexutil.Bytes {
+	return r.receipt.Bloom.Bytes()
+}
+
+func (r *Receipt) Logs(ctx context.Context) []*Log {
+	ret := make([]*Log, 0, len(r.receipt.Logs))
+	for _, log := range r.receipt.Logs {
+		ret = append(ret, &Log{
+			backend:     r.transaction.backend,
+			transaction: r.transaction,
+			log:         log,
+		})
+	}
+	return ret
+}
+
 type BlockType int
 
 // Block represents an Ethereum block.
@@ -799,6 +1043,37 @@ func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
 	return &ret, nil
 }
 
+// Receipts returns the receipts of all transactions in the block, retrieving
+// them from the backend in a single lookup.
+func (b *Block) Receipts(ctx context.Context) (*[]*Receipt, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	receipts, err := b.resolveReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	ret := make([]*Receipt, 0, len(receipts))
+	for i, receipt := range receipts {
+		ret = append(ret, &Receipt{
+			transaction: &Transaction{
+				backend: b.backend,
+				hash:    txs[i].Hash(),
+				tx:      txs[i],
+				block:   b,
+				index:   uint64(i),
+			},
+			receipt: receipt,
+		})
+	}
+	return &ret, nil
+}
+
 func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
 	block, err := b.resolve(ctx)
 	if err != nil || block == nil {
@@ -946,7 +1221,8 @@ func (c *CallResult) Status() Long {
 }
 
 func (b *Block) Call(ctx context.Context, args struct {
-	Data ethapi.TransactionArgs
+	Data      ethapi.TransactionArgs
+	Overrides *[]StateOverride
 }) (*CallResult, error) {
 	if b.numberOrHash == nil {
 		_, err := b.resolve(ctx)
@@ -954,7 +1230,11 @@ func (b *Block) Call(ctx context.Context, args struct {
 			return nil, err
 		}
 	}
-	result, err := ethapi.DoCall(ctx, b.backend, args.Data, *b.numberOrHash, nil, 5*time.Second, b.backend.RPCGasCap())
+	overrides, err := stateOverrides(args.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ethapi.DoCall(ctx, b.backend, args.Data, *b.numberOrHash, overrides, 5*time.Second, b.backend.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -983,6 +1263,113 @@ func (b *Block) EstimateGas(ctx context.Context, args struct {
 	return Long(gas), err
 }
 
+func (b *Block) CreateAccessList(ctx context.Context, args struct {
+	Data ethapi.TransactionArgs
+}) (*AccessListResult, error) {
+	if b.numberOrHash == nil {
+		_, err := b.resolveHeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return createAccessList(ctx, b.backend, *b.numberOrHash, args.Data)
+}
+
+// StateOverride encapsulates the overrides of an account for a call.
+type StateOverride struct {
+	Address   common.Address
+	Nonce     *Long
+	Code      *hexutil.Bytes
+	Balance   *hexutil.Big
+	State     *[]StorageSlot
+	StateDiff *[]StorageSlot
+}
+
+// StorageSlot encapsulates the value of a storage slot.
+type StorageSlot struct {
+	Slot  common.Hash
+	Value common.Hash
+}
+
+// stateOverrides converts the account overrides of a call into the overrides
+// applied to the state.
+func stateOverrides(overrides *[]StateOverride) (*ethapi.StateOverride, error) {
+	if overrides == nil {
+		return nil, nil
+	}
+	slots := func(slots *[]StorageSlot) *map[common.Hash]common.Hash {
+		if slots == nil {
+			return nil
+		}
+		ret := make(map[common.Hash]common.Hash, len(*slots))
+		for _, slot := range *slots {
+			ret[slot.Slot] = slot.Value
+		}
+		return &ret
+	}
+	ret := make(ethapi.StateOverride, len(*overrides))
+	for _, override := range *overrides {
+		if _, ok := ret[override.Address]; ok {
+			return nil, fmt.Errorf("account %s overridden twice", override.Address.Hex())
+		}
+		account := ethapi.OverrideAccount{
+			Code:      override.Code,
+			State:     slots(override.State),
+			StateDiff: slots(override.StateDiff),
+		}
+		if override.Nonce != nil {
+			nonce := hexutil.Uint64(*override.Nonce)
+			account.Nonce = &nonce
+		}
+		if override.Balance != nil {
+			balance := override.Balance
+			account.Balance = &balance
+		}
+		ret[override.Address] = account
+	}
+	return &ret, nil
+}
+
+// AccessListResult encapsulates the result of the `createAccessList` accessor.
+type AccessListResult struct {
+	accessList types.AccessList
+	gasUsed    Long
+	err        *string // The reason the call failed, nil if it succeeded
+}
+
+func (r *AccessListResult) AccessList() []*AccessTuple {
+	ret := make([]*AccessTuple, 0, len(r.accessList))
+	for i := range r.accessList {
+		ret = append(ret, &AccessTuple{
+			address:     r.accessList[i].Address,
+			storageKeys: &r.accessList[i].StorageKeys,
+		})
+	}
+	return ret
+}
+
+func (r *AccessListResult) GasUsed() Long {
+	return r.gasUsed
+}
+
+func (r *AccessListResult) Error() *string {
+	return r.err
+}
+
+// createAccessList creates the access list of a call at the given block.
+func createAccessList(ctx context.Context, backend ethapi.Backend, blockNrOrHash rpc.BlockNumberOrHash, args ethapi.TransactionArgs) (*AccessListResult, error) {
+	acl, gasUsed, vmerr, err := ethapi.AccessList(ctx, backend, blockNrOrHash, args)
+	if err != nil {
+		return nil, err
+	}
+	ret := &AccessListResult{accessList: acl, gasUsed: Long(gasUsed)}
+	if vmerr != nil {
+		reason := vmerr.Error()
+		ret.err = &reason
+	}
+	return ret, nil
+}
+
 type Pending struct {
 	backend ethapi.Backend
 }
@@ -1021,10 +1408,15 @@ func (p *Pending) Account(ctx context.Context, args struct {
 }
 
 func (p *Pending) Call(ctx context.Context, args struct {
-	Data ethapi.TransactionArgs
+	Data      ethapi.TransactionArgs
+	Overrides *[]StateOverride
 }) (*CallResult, error) {
+	overrides, err := stateOverrides(args.Overrides)
+	if err != nil {
+		return nil, err
+	}
 	pendingBlockNr := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
-	result, err := ethapi.DoCall(ctx, p.backend, args.Data, pendingBlockNr, nil, 5*time.Second, p.backend.RPCGasCap())
+	result, err := ethapi.DoCall(ctx, p.backend, args.Data, pendingBlockNr, overrides, 5*time.Second, p.backend.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -1048,17 +1440,35 @@ func (p *Pending) EstimateGas(ctx context.Context, args struct {
 	return Long(gas), err
 }
 
+func (p *Pending) CreateAccessList(ctx context.Context, args struct {
+	Data ethapi.TransactionArgs
+}) (*AccessListResult, error) {
+	pendingBlockNr := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+	return createAccessList(ctx, p.backend, pendingBlockNr, args.Data)
+}
+
 // Resolver is the top-level object in the GraphQL hierarchy.
 type Resolver struct {
-	backend ethapi.Backend
+	backend      ethapi.Backend
+	filterSystem *filters.EventSystem
 }
 
 func (r *Resolver) Block(ctx context.Context, args struct {
 	Number *Long
 	Hash   *common.Hash
+	Tag    *string
 }) (*Block, error) {
 	var block *Block
-	if args.Number != nil {
+	if args.Tag != nil {
+		if args.Number != nil || args.Hash != nil {
+			return nil, errors.New("block tag can't be combined with number or hash")
+		}
+		numberOrHash := rpc.BlockNumberOrHashWithNumber(tagBlockNumber(*args.Tag))
+		block = &Block{
+			backend:      r.backend,
+			numberOrHash: &numberOrHash,
+		}
+	} else if args.Number != nil {
 		if *args.Number < 0 {
 			return nil, nil
 		}
@@ -1151,6 +1561,8 @@ func (r *Resolver) SendRawTransaction(ctx context.Context, args struct{ Data hex
 type FilterCriteria struct {
 	FromBlock *hexutil.Uint64   // beginning of the queried range, nil means genesis block
 	ToBlock   *hexutil.Uint64   // end of the range, nil means latest block
+	FromTag   *string           // tagged beginning of the range, exclusive with FromBlock
+	ToTag     *string           // tagged end of the range, exclusive with ToBlock
 	Addresses *[]common.Address // restricts matches to events created by specific contracts
 
 	// The Topic list restricts matches to particular event topics. Each event has a list
@@ -1177,6 +1589,18 @@ func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria
 	if args.Filter.ToBlock != nil {
 		end = int64(*args.Filter.ToBlock)
 	}
+	if args.Filter.FromTag != nil {
+		if args.Filter.FromBlock != nil {
+			return nil, errors.New("fromTag can't be combined with fromBlock")
+		}
+		begin = tagBlockNumber(*args.Filter.FromTag).Int64()
+	}
+	if args.Filter.ToTag != nil {
+		if args.Filter.ToBlock != nil {
+			return nil, errors.New("toTag can't be combined with toBlock")
+		}
+		end = tagBlockNumber(*args.Filter.ToTag).Int64()
+	}
 	var addresses []common.Address
 	if args.Filter.Addresses != nil {
 		addresses = *args.Filter.Addresses
@@ -1190,6 +1614,18 @@ func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria
 	return runFilter(ctx, r.backend, filter)
 }
 
+// tagBlockNumber converts a BlockTag into the block number it stands for.
+func tagBlockNumber(tag string) rpc.BlockNumber {
+	switch tag {
+	case "SAFE":
+		return rpc.SafeBlockNumber
+	case "FINALIZED":
+		return rpc.FinalizedBlockNumber
+	default:
+		return rpc.LatestBlockNumber
+	}
+}
+
 func (r *Resolver) GasPrice(ctx context.Context) (hexutil.Big, error) {
 	tipcap, err := r.backend.SuggestGasTipCap(ctx)
 	if err != nil {
@@ -1257,3 +1693,105 @@ func (r *Resolver) Syncing() (*SyncState, error) {
 	// Otherwise gather the block sync stats
 	return &SyncState{progress}, nil
 }
+
+// NewBlocks streams the blocks added to the canonical chain until the
+// subscription ends.
+func (r *Resolver) NewBlocks(ctx context.Context) <-chan *Block {
+	var (
+		headers = make(chan *types.Header)
+		sub     = r.filterSystem.SubscribeNewHeads(headers)
+		blocks  = make(chan *Block)
+	)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				numberOrHash := rpc.BlockNumberOrHashWithHash(header.Hash(), false)
+				block := &Block{
+					backend:      r.backend,
+					numberOrHash: &numberOrHash,
+					hash:         header.Hash(),
+					header:       header,
+				}
+				select {
+				case blocks <- block:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return blocks
+}
+
+// NewLogs streams the logs of new canonical blocks matching the filter until the
+// subscription ends.
+func (r *Resolver) NewLogs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) (<-chan *Log, error) {
+	var crit ethereum.FilterQuery
+	if args.Filter.Addresses != nil {
+		crit.Addresses = *args.Filter.Addresses
+	}
+	if args.Filter.Topics != nil {
+		crit.Topics = *args.Filter.Topics
+	}
+	matches := make(chan []*types.Log)
+	sub, err := r.filterSystem.SubscribeLogs(crit, matches)
+	if err != nil {
+		return nil, err
+	}
+	logs := make(chan *Log)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case matched := <-matches:
+				for _, log := range matched {
+					l := &Log{
+						backend:     r.backend,
+						transaction: &Transaction{backend: r.backend, hash: log.TxHash},
+						log:         log,
+					}
+					select {
+					case logs <- l:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return logs, nil
+}
+
+// NewPendingTransactions streams the transactions entering the pending state
+// until the subscription ends.
+func (r *Resolver) NewPendingTransactions(ctx context.Context) <-chan *Transaction {
+	var (
+		hashes = make(chan []common.Hash)
+		sub    = r.filterSystem.SubscribePendingTxs(hashes)
+		txs    = make(chan *Transaction)
+	)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case pending := <-hashes:
+				for _, hash := range pending {
+					select {
+					case txs <- &Transaction{backend: r.backend, hash: hash}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return txs
+}
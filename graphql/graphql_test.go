@@ -35,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/gorilla/websocket"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -52,7 +53,7 @@ func TestBuildSchema(t *testing.T) {
 		t.Fatalf("could not create new node: %v", err)
 	}
 	// Make sure the schema can be parsed and matched up to the object model.
-	if err := newHandler(stack, nil, []string{}, []string{}); err != nil {
+	if err := newHandler(stack, nil, nil, []string{}, []string{}); err != nil {
 		t.Errorf("Could not construct GraphQL handler: %v", err)
 	}
 }
@@ -126,6 +127,21 @@ func TestGraphQLBlockSerialization(t *testing.T) {
 			want: `{"errors":[{"message":"strconv.ParseInt: parsing \"a\": invalid syntax"}],"data":{}}`,
 			code: 400,
 		},
+		{
+			body: `{"query": "{block(tag:FINALIZED){number}}","variables": null}`,
+			want: `{"data":{"block":{"number":6}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{block(tag:SAFE){number}}","variables": null}`,
+			want: `{"data":{"block":{"number":8}}}`,
+			code: 200,
+		},
+		{
+			body: `{"query": "{logs(filter:{fromTag:SAFE}){index}}","variables": null}`,
+			want: `{"data":{"logs":[]}}`,
+			code: 200,
+		},
 		{
 			body: `{"query": "{bleh{number}}","variables": null}"`,
 			want: `{"errors":[{"message":"Cannot query field \"bleh\" on type \"Query\".","locations":[{"line":1,"column":2}]}]}`,
@@ -179,6 +195,11 @@ func TestGraphQLBlockSerializationEIP2718(t *testing.T) {
 			want: `{"data":{"block":{"number":1,"transactions":[{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x64","hash":"0xd864c9d7d37fade6b70164740540c06dd58bb9c3f6b46101908d6339db6a6a7b","type":0,"accessList":[],"index":0},{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x32","hash":"0x19b35f8187b4e15fb59a9af469dca5dfa3cd363c11d372058c12f6482477b474","type":1,"accessList":[{"address":"0x0000000000000000000000000000000000000dad","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000000"]}],"index":1}]}}}`,
 			code: 200,
 		},
+		{
+			body: `{"query": "{block {receipts { transaction { hash } status gasUsed cumulativeGasUsed createdContract { address } logs { index }}}}"}`,
+			want: `{"data":{"block":{"receipts":[{"transaction":{"hash":"0xd864c9d7d37fade6b70164740540c06dd58bb9c3f6b46101908d6339db6a6a7b"},"status":1,"gasUsed":25204,"cumulativeGasUsed":25204,"createdContract":null,"logs":[]},{"transaction":{"hash":"0x19b35f8187b4e15fb59a9af469dca5dfa3cd363c11d372058c12f6482477b474"},"status":1,"gasUsed":27504,"cumulativeGasUsed":52708,"createdContract":null,"logs":[]}]}}}`,
+			code: 200,
+		},
 	} {
 		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
 		if err != nil {
@@ -197,6 +218,116 @@ func TestGraphQLBlockSerializationEIP2718(t *testing.T) {
 	}
 }
 
+// Tests traces, call overrides, storage ranges and access lists against the
+// state of the test chain.
+func TestGraphQLStateQueries(t *testing.T) {
+	stack, err := node.New(&node.Config{
+		HTTPHost:    "127.0.0.1",
+		HTTPPort:    0,
+		HTTPModules: []string{"debug"},
+	})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	createGQLServiceWithTransactions(t, stack)
+	defer stack.Close()
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	for i, tt := range []struct {
+		body string
+		want string
+	}{
+		{
+			body: `{"query": "{block {transactions { traces { depth type to gas gasUsed input output error }}}}"}`,
+			want: `{"data":{"block":{"transactions":[{"traces":[{"depth":0,"type":"CALL","to":"0x0000000000000000000000000000000000000dad","gas":29000,"gasUsed":4204,"input":"0x","output":"0x","error":null}]},{"traces":[{"depth":0,"type":"CALL","to":"0x0000000000000000000000000000000000000dad","gas":4700,"gasUsed":2204,"input":"0x","output":"0x","error":null}]}]}}}`,
+		},
+		{
+			body: `{"query": "{block {account(address: \"0x0000000000000000000000000000000000000dad\") { storageRange(limit: 1) { entries { hash slot value } nextHash }}}}"}`,
+			want: `{"data":{"block":{"account":{"storageRange":{"entries":[{"hash":"0x290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563","slot":null,"value":"0x000000000000000000000000000000000000000000000000000000000000002a"}],"nextHash":null}}}}}`,
+		},
+		{
+			body: `{"query": "{block {call(data: {to: \"0x0000000000000000000000000000000000000dad\"}, overrides: [{address: \"0x0000000000000000000000000000000000000dad\", code: \"0x60016000526001601ff3\"}]) { data status }}}"}`,
+			want: `{"data":{"block":{"call":{"data":"0x01","status":1}}}}`,
+		},
+		{
+			// The first account's balance must not be clobbered by the second's
+			body: `{"query": "{block {call(data: {to: \"0x0000000000000000000000000000000000000dad\"}, overrides: [{address: \"0x00000000000000000000000000000000000000aa\", balance: \"0x1\"}, {address: \"0x0000000000000000000000000000000000000dad\", code: \"0x7300000000000000000000000000000000000000aa3160005260206000f3\", balance: \"0x2\"}]) { data status }}}"}`,
+			want: `{"data":{"block":{"call":{"data":"0x0000000000000000000000000000000000000000000000000000000000000001","status":1}}}}`,
+		},
+		{
+			body: `{"query": "{block {createAccessList(data: {from: \"0x71562b71999873db5b286df957af199ec94617f7\", gas: 50000, to: \"0x0000000000000000000000000000000000000dad\"}) { accessList { address storageKeys } gasUsed error }}}"}`,
+			want: `{"data":{"block":{"createAccessList":{"accessList":[{"address":"0x0000000000000000000000000000000000000dad","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000001","0x0000000000000000000000000000000000000000000000000000000000000000"]}],"gasUsed":27404,"error":null}}}}`,
+		},
+	} {
+		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("could not post: %v", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read from response body: %v", err)
+		}
+		if have := string(bodyBytes); have != tt.want {
+			t.Errorf("testcase %d %s,\nhave:\n%v\nwant:\n%v", i, tt.body, have, tt.want)
+		}
+	}
+}
+
+// Tests that GraphQL requests are subject to the access control of the HTTP
+// endpoint, serving traces only to clients allowed to call the debug API.
+func TestGraphQLAccessControl(t *testing.T) {
+	stack, err := node.New(&node.Config{
+		HTTPHost:    "127.0.0.1",
+		HTTPPort:    0,
+		HTTPModules: []string{"eth", "debug"},
+		RPCAccess: &node.RPCAccessConfig{
+			Public: []string{"eth_*"},
+			Credentials: []node.RPCCredential{
+				{Name: "ops", Methods: []string{"eth_*", "debug_*"}, APIKey: "ops-key"},
+				{Name: "net", Methods: []string{"net_*"}, APIKey: "net-key"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	createGQLServiceWithTransactions(t, stack)
+	defer stack.Close()
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	query := `{"query": "{block(number: 1) {transactions { traces { depth }}}}"}`
+	for i, tt := range []struct {
+		key  string
+		code int
+		want string
+	}{
+		{"", 400, errTracingHidden.Error()},
+		{"ops-key", 200, `{"data":{"block":{"transactions":[{"traces":[{"depth":0}]},{"traces":[{"depth":0}]}]}}}`},
+		{"net-key", 403, errForbidden.Error()},
+		{"bad-key", 401, "invalid API key"},
+	} {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), strings.NewReader(query))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not post: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("testcase %d: status code mismatch: have %d, want %d", i, resp.StatusCode, tt.code)
+		}
+		if !strings.Contains(string(body), tt.want) {
+			t.Errorf("testcase %d: response mismatch: have %s, want %s", i, body, tt.want)
+		}
+	}
+}
+
 // Tests that a graphQL request is not handled successfully when graphql is not enabled on the specified endpoint
 func TestGraphQLHTTPOnSamePort_GQLRequest_Unsuccessful(t *testing.T) {
 	stack := createNode(t, false, false)
@@ -213,6 +344,107 @@ func TestGraphQLHTTPOnSamePort_GQLRequest_Unsuccessful(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
 
+// Tests that queries and subscriptions are served over WebSocket connections.
+func TestGraphQLWebSocketSubscription(t *testing.T) {
+	stack := createNode(t, false, false)
+	defer stack.Close()
+
+	ethBackend, err := eth.New(stack, &ethconfig.Config{
+		Genesis: &core.Genesis{
+			Config:     params.AllEthashProtocolChanges,
+			GasLimit:   11500000,
+			Difficulty: big.NewInt(1048576),
+		},
+		Ethash:         ethash.Config{PowMode: ethash.ModeFake},
+		NetworkId:      1337,
+		TrieCleanCache: 5,
+		TrieDirtyCache: 5,
+		TrieTimeout:    60 * time.Minute,
+		SnapshotCache:  5,
+	})
+	if err != nil {
+		t.Fatalf("could not create eth backend: %v", err)
+	}
+	if err := New(stack, ethBackend.APIBackend, false, []string{}, []string{}); err != nil {
+		t.Fatalf("could not create graphql service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial(strings.Replace(stack.HTTPEndpoint(), "http", "ws", 1)+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	send := func(msg string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		for {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("could not read %s: %v", want, err)
+			}
+			have := strings.TrimSpace(string(msg))
+			if have == `{"type":"ka"}` {
+				continue
+			}
+			if have != want {
+				t.Fatalf("message mismatch:\nhave: %s\nwant: %s", have, want)
+			}
+			return
+		}
+	}
+	send(`{"type":"connection_init"}`)
+	expect(`{"type":"connection_ack"}`)
+
+	// Queries are answered once, once answered the subscription is installed too
+	send(`{"id":"1","type":"start","payload":{"query":"subscription { newBlocks { number } }"}}`)
+	send(`{"id":"2","type":"start","payload":{"query":"{ block { number } }"}}`)
+	expect(`{"id":"2","type":"data","payload":{"data":{"block":{"number":0}}}}`)
+	expect(`{"id":"2","type":"complete"}`)
+
+	chain, _ := core.GenerateChain(params.AllEthashProtocolChanges, ethBackend.BlockChain().Genesis(),
+		ethash.NewFaker(), ethBackend.ChainDb(), 2, func(i int, gen *core.BlockGen) {})
+	if _, err := ethBackend.BlockChain().InsertChain(chain); err != nil {
+		t.Fatalf("could not import blocks: %v", err)
+	}
+	expect(`{"id":"1","type":"data","payload":{"data":{"newBlocks":{"number":1}}}}`)
+	expect(`{"id":"1","type":"data","payload":{"data":{"newBlocks":{"number":2}}}}`)
+
+	send(`{"id":"1","type":"stop"}`)
+	expect(`{"id":"1","type":"complete"}`)
+}
+
+// Tests that transaction traces are refused unless the debug namespace is
+// exposed over HTTP.
+func TestGraphQLTracesHidden(t *testing.T) {
+	stack := createNode(t, true, true)
+	defer stack.Close()
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	body := `{"query": "{block {transactions { traces { depth }}}}"}`
+	resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not post: %v", err)
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read from response body: %v", err)
+	}
+	if !strings.Contains(string(bodyBytes), errTracingHidden.Error()) {
+		t.Errorf("traces served without the debug API: %s", bodyBytes)
+	}
+}
+
 func createNode(t *testing.T, gqlEnabled bool, txEnabled bool) *node.Node {
 	stack, err := node.New(&node.Config{
 		HTTPHost: "127.0.0.1",
@@ -252,6 +484,8 @@ func createGQLService(t *testing.T, stack *node.Node) {
 		TrieDirtyCache:          5,
 		TrieTimeout:             60 * time.Minute,
 		SnapshotCache:           5,
+		RPCFinalizedDepth:       4,
+		RPCSafeDepth:            2,
 	}
 	ethBackend, err := eth.New(stack, ethConf)
 	if err != nil {
@@ -265,7 +499,7 @@ func createGQLService(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, false, []string{}, []string{})
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
@@ -293,6 +527,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 						byte(vm.SLOAD),
 						byte(vm.SLOAD),
 					},
+					Storage: map[common.Hash]common.Hash{{}: common.HexToHash("0x2a")},
 					Nonce:   0,
 					Balance: big.NewInt(0),
 				},
@@ -350,7 +585,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, false, []string{}, []string{})
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
@@ -31,9 +31,20 @@ const schema string = `
     # Long is a 64 bit unsigned integer.
     scalar Long
 
+    # BlockTag identifies a block relative to the head of the chain.
+    enum BlockTag {
+        # Latest is the most recent known block.
+        LATEST
+        # Safe is the most recent block unlikely to be reorganised.
+        SAFE
+        # Finalized is the most recent block that can't be reverted.
+        FINALIZED
+    }
+
     schema {
         query: Query
         mutation: Mutation
+        subscription: Subscription
     }
 
     # Account is an Ethereum account at a particular block.
@@ -52,6 +63,28 @@ const schema string = `
         # Storage provides access to the storage of a contract account, indexed
         # by its 32 byte slot identifier.
         storage(slot: Bytes32!): Bytes32!
+        # StorageRange returns up to limit storage entries of a contract account,
+        # ordered by the hash of their slot and starting at the given hash.
+        storageRange(start: Bytes32, limit: Int!): StorageRange!
+    }
+
+    # StorageRange is a range of storage entries of a contract account.
+    type StorageRange {
+        # Entries are the storage entries in the range.
+        entries: [StorageEntry!]!
+        # NextHash is the slot hash of the entry following the range, or null if
+        # the range extends to the end of the storage.
+        nextHash: Bytes32
+    }
+
+    # StorageEntry is a storage slot of a contract account.
+    type StorageEntry {
+        # Hash is the hash of the slot, the key of the entry in the storage trie.
+        hash: Bytes32!
+        # Slot is the slot of the entry, or null if its preimage is unknown.
+        slot: Bytes32
+        # Value is the value stored in the slot.
+        value: Bytes32!
     }
 
     # Log is an Ethereum event log.
@@ -67,6 +100,8 @@ const schema string = `
         data: Bytes!
         # Transaction is the transaction that generated this log entry.
         transaction: Transaction!
+        # Removed is true if this log was reverted due to a chain reorganisation.
+        removed: Boolean!
     }
 
     #EIP-2718 
@@ -138,6 +173,60 @@ const schema string = `
         #Envelope transaction support
         type: Int
         accessList: [AccessTuple!]
+        # Traces are the calls and contract creations executed by the transaction,
+        # the transaction itself first, in the order they were made. If the
+        # transaction has not yet been mined, this field will be null. Traces are
+        # only available if the node exposes the debug API over HTTP.
+        traces: [CallFrame!]
+    }
+
+    # CallFrame is a call or contract creation executed by a transaction.
+    type CallFrame {
+        # Depth is the call depth of the frame, 0 for the transaction itself.
+        depth: Int!
+        # Type is the type of the frame: CALL, STATICCALL, DELEGATECALL,
+        # CALLCODE, CREATE, CREATE2 or SELFDESTRUCT.
+        type: String!
+        # From is the address of the caller.
+        from: Address!
+        # To is the address of the callee, or the created contract.
+        to: Address
+        # Value is the value transferred, in wei.
+        value: BigInt
+        # Gas is the amount of gas available to the frame.
+        gas: Long!
+        # GasUsed is the amount of gas used by the frame.
+        gasUsed: Long!
+        # Input is the call data, or the init code of a contract creation.
+        input: Bytes!
+        # Output is the return data of the frame.
+        output: Bytes!
+        # Error is the reason the frame failed, or null if it succeeded.
+        error: String
+    }
+
+    # Receipt is the receipt of a transaction included in a block.
+    type Receipt {
+        # Transaction is the transaction this receipt was generated for.
+        transaction: Transaction!
+        # Status is the return status of the transaction. This will be 1 if the
+        # transaction succeeded, or 0 if it failed.
+        status: Long!
+        # GasUsed is the amount of gas that was used processing the transaction.
+        gasUsed: Long!
+        # CumulativeGasUsed is the total gas used in the block up to and including
+        # the transaction.
+        cumulativeGasUsed: Long!
+        # EffectiveGasPrice is actual value per gas deducted from the sender's
+        # account.
+        effectiveGasPrice: BigInt
+        # CreatedContract is the account that was created by a contract creation
+        # transaction, or null for other transactions.
+        createdContract(block: Long): Account
+        # LogsBloom is a bloom filter of the logs emitted by the transaction.
+        logsBloom: Bytes!
+        # Logs is a list of log entries emitted by the transaction.
+        logs: [Log!]!
     }
 
     # BlockFilterCriteria encapsulates log filter criteria for a filter applied
@@ -222,15 +311,56 @@ const schema string = `
         # transactions are unavailable for this block, or if the index is out of
         # bounds, this field will be null.
         transactionAt(index: Int!): Transaction
+        # Receipts is a list of the receipts of all transactions in this block,
+        # retrieved at once. If transactions are unavailable for this block, this
+        # field will be null.
+        receipts: [Receipt!]
         # Logs returns a filtered set of logs from this block.
         logs(filter: BlockFilterCriteria!): [Log!]!
         # Account fetches an Ethereum account at the current block's state.
         account(address: Address!): Account!
-        # Call executes a local call operation at the current block's state.
-        call(data: CallData!): CallResult
+        # Call executes a local call operation at the current block's state,
+        # with the given accounts overridden.
+        call(data: CallData!, overrides: [StateOverride!]): CallResult
         # EstimateGas estimates the amount of gas that will be required for
         # successful execution of a transaction at the current block's state.
         estimateGas(data: CallData!): Long!
+        # CreateAccessList creates the access list of a local call operation at
+        # the current block's state.
+        createAccessList(data: CallData!): AccessListResult!
+    }
+
+    # StateOverride overrides an account for the duration of a local call.
+    # Fields left out keep the state of the account.
+    input StateOverride {
+        # Address is the address of the overridden account.
+        address: Address!
+        # Nonce is the nonce of the account.
+        nonce: Long
+        # Code is the code of the account.
+        code: Bytes
+        # Balance is the balance of the account, in wei.
+        balance: BigInt
+        # State replaces the whole storage of the account.
+        state: [StorageSlot!]
+        # StateDiff overrides individual slots of the storage of the account.
+        stateDiff: [StorageSlot!]
+    }
+
+    # StorageSlot is the value of a storage slot.
+    input StorageSlot {
+        slot: Bytes32!
+        value: Bytes32!
+    }
+
+    # AccessListResult is the access list of a local call operation.
+    type AccessListResult {
+        # AccessList is the list of accounts and storage slots accessed.
+        accessList: [AccessTuple!]!
+        # GasUsed is the amount of gas used by the call with the access list.
+        gasUsed: Long!
+        # Error is the reason the call failed, or null if it succeeded.
+        error: String
     }
 
     # CallData represents the data associated with a local contract call.
@@ -272,6 +402,12 @@ const schema string = `
         # ToBlock is the block at which to stop searching, inclusive. Defaults
         # to the latest block if not supplied.
         toBlock: Long
+        # FromTag is the tagged block at which to start searching, inclusive.
+        # It can't be combined with fromBlock.
+        fromTag: BlockTag
+        # ToTag is the tagged block at which to stop searching, inclusive. It
+        # can't be combined with toBlock.
+        toTag: BlockTag
         # Addresses is a list of addresses that are of interest. If this list is
         # empty, results will not be filtered by address.
         addresses: [Address!]
@@ -313,17 +449,21 @@ const schema string = `
       transactions: [Transaction!]
       # Account fetches an Ethereum account for the pending state.
       account(address: Address!): Account!
-      # Call executes a local call operation for the pending state.
-      call(data: CallData!): CallResult
+      # Call executes a local call operation for the pending state, with the
+      # given accounts overridden.
+      call(data: CallData!, overrides: [StateOverride!]): CallResult
       # EstimateGas estimates the amount of gas that will be required for
       # successful execution of a transaction for the pending state.
       estimateGas(data: CallData!): Long!
+      # CreateAccessList creates the access list of a local call operation for
+      # the pending state.
+      createAccessList(data: CallData!): AccessListResult!
     }
 
     type Query {
-        # Block fetches an Ethereum block by number or by hash. If neither is
-        # supplied, the most recent known block is returned.
-        block(number: Long, hash: Bytes32): Block
+        # Block fetches an Ethereum block by number, by hash or by tag. If none
+        # is supplied, the most recent known block is returned.
+        block(number: Long, hash: Bytes32, tag: BlockTag): Block
         # Blocks returns all the blocks between two numbers, inclusive. If
         # to is not supplied, it defaults to the most recent known block.
         blocks(from: Long, to: Long): [Block!]!
@@ -349,4 +489,16 @@ const schema string = `
         # SendRawTransaction sends an RLP-encoded transaction to the network.
         sendRawTransaction(data: Bytes!): Bytes32!
     }
+
+    type Subscription {
+        # NewBlocks fires for every block added to the canonical chain, including
+        # the blocks of a chain reorganisation.
+        newBlocks: Block!
+        # NewLogs fires for every log matching the filter in new canonical blocks.
+        # Logs of blocks reverted by a chain reorganisation fire again, removed.
+        newLogs(filter: BlockFilterCriteria!): Log!
+        # NewPendingTransactions fires for every transaction entering the pending
+        # state.
+        newPendingTransactions: Transaction!
+    }
 `
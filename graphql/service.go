@@ -17,19 +17,42 @@
 package graphql
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
 	"github.com/graph-gophers/graphql-go"
 )
 
 type handler struct {
-	Schema *graphql.Schema
+	Schema   *graphql.Schema
+	upgrader *websocket.Upgrader
+	tracing  bool // Whether the debug API is exposed over HTTP, for transaction traces
+}
+
+// context returns the context to execute the operations of a request in, based
+// on the given one. Transaction traces are served if the client may call the
+// equivalent RPC method.
+func (h handler) context(ctx context.Context, r *http.Request) context.Context {
+	tracing := h.tracing && rpc.MethodAllowed(r.Context(), "debug_traceTransaction")
+	return context.WithValue(ctx, tracingKey{}, tracing)
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// GraphQL serves the data and operations of the eth namespace
+	if !rpc.MethodAllowed(r.Context(), "eth_*") {
+		http.Error(w, errForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
 	var params struct {
 		Query         string                 `json:"query"`
 		OperationName string                 `json:"operationName"`
@@ -40,7 +63,7 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := h.Schema.Exec(r.Context(), params.Query, params.OperationName, params.Variables)
+	response := h.Schema.Exec(h.context(r.Context(), r), params.Query, params.OperationName, params.Variables)
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -55,26 +78,35 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// New constructs a new GraphQL service instance.
-func New(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
+// New constructs a new GraphQL service instance. Subscriptions are served over
+// WebSocket connections to the same endpoint, lightMode must be set for light
+// client backends.
+func New(stack *node.Node, backend ethapi.Backend, lightMode bool, cors, vhosts []string) error {
 	if backend == nil {
 		panic("missing backend")
 	}
 	// check if http server with given endpoint exists and enable graphQL on it
-	return newHandler(stack, backend, cors, vhosts)
+	return newHandler(stack, backend, filters.NewEventSystem(backend, lightMode), cors, vhosts)
 }
 
 // newHandler returns a new `http.Handler` that will answer GraphQL queries.
 // It additionally exports an interactive query browser on the / endpoint.
-func newHandler(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
-	q := Resolver{backend}
+// GraphQL shares the HTTP endpoint and its access control, so transaction traces
+// are only served to clients allowed to call debug_traceTransaction over HTTP.
+func newHandler(stack *node.Node, backend ethapi.Backend, filterSystem *filters.EventSystem, cors, vhosts []string) error {
+	q := Resolver{backend, filterSystem}
 
 	s, err := graphql.ParseSchema(schema, &q)
 	if err != nil {
 		return err
 	}
-	h := handler{Schema: s}
-	handler := node.NewHTTPHandlerStack(h, cors, vhosts)
+	h := handler{Schema: s, upgrader: newUpgrader(cors)}
+	for _, module := range stack.Config().HTTPModules {
+		if module == "debug" {
+			h.tracing = true
+		}
+	}
+	handler := node.NewHTTPHandlerStack(h, cors, vhosts, stack.RPCAccessControl())
 
 	stack.RegisterHandler("GraphQL UI", "/graphql/ui", GraphiQL{})
 	stack.RegisterHandler("GraphQL", "/graphql", handler)
@@ -0,0 +1,247 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// The WebSocket transport implements the graphql-ws protocol of the Apollo
+// subscriptions-transport-ws library, supported by most GraphQL clients.
+const (
+	wsProtocol = "graphql-ws"
+
+	wsConnectionInit      = "connection_init"      // Client requests a connection
+	wsConnectionAck       = "connection_ack"       // Server accepts the connection
+	wsConnectionError     = "connection_error"     // Server rejects a message outside an operation
+	wsConnectionTerminate = "connection_terminate" // Client closes the connection
+	wsKeepAlive           = "ka"                   // Server keeps the connection alive
+	wsStart               = "start"                // Client starts an operation
+	wsStop                = "stop"                 // Client stops an operation
+	wsData                = "data"                 // Server sends a result of an operation
+	wsError               = "error"                // Server fails to start an operation
+	wsComplete            = "complete"             // Server ends an operation
+
+	wsKeepAliveInterval = 30 * time.Second
+	wsWriteTimeout      = 10 * time.Second
+	wsReadLimit         = 1024 * 1024
+	wsMaxOperations     = 100 // Maximum number of running operations per connection
+)
+
+// wsMessage is a message of the graphql-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsRequest is the payload of a start message.
+type wsRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// wsConn serves the GraphQL operations of a WebSocket connection. Queries and
+// mutations are answered once, subscriptions stream their results until stopped.
+type wsConn struct {
+	conn   *websocket.Conn
+	schema *graphql.Schema
+
+	writeMu sync.Mutex // Serializes the writes of the operations
+
+	opsMu sync.Mutex
+	ops   map[string]context.CancelFunc // Running operations by id
+	wg    sync.WaitGroup
+}
+
+// newUpgrader creates the WebSocket upgrader of the GraphQL endpoint. Browsers
+// are accepted from the CORS origins, or from the origin of the endpoint itself.
+func newUpgrader(cors []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{wsProtocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, allowed := range cors {
+				if allowed == "*" || strings.EqualFold(allowed, origin) {
+					return true
+				}
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+}
+
+// serveWebSocket upgrades the request to a WebSocket connection and serves the
+// operations sent over it until it is closed.
+func (h handler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("GraphQL WebSocket upgrade failed", "err", err)
+		return
+	}
+	conn.SetReadLimit(wsReadLimit)
+
+	c := &wsConn{
+		conn:   conn,
+		schema: h.Schema,
+		ops:    make(map[string]context.CancelFunc),
+	}
+	ctx, cancel := context.WithCancel(h.context(context.Background(), r))
+	c.serve(ctx)
+	cancel()
+
+	c.wg.Wait()
+	conn.Close()
+}
+
+// serve reads the messages of the client until the connection is closed or
+// terminated.
+func (c *wsConn) serve(ctx context.Context) {
+	keepalive := time.NewTicker(wsKeepAliveInterval)
+	defer keepalive.Stop()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case <-keepalive.C:
+				if err := c.write(&wsMessage{Type: wsKeepAlive}); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case wsConnectionInit:
+			c.write(&wsMessage{Type: wsConnectionAck})
+			c.write(&wsMessage{Type: wsKeepAlive})
+
+		case wsConnectionTerminate:
+			return
+
+		case wsStart:
+			var req wsRequest
+			if err := json.Unmarshal(msg.Payload, &req); err != nil {
+				c.writeError(msg.ID, wsError, "invalid request payload")
+				continue
+			}
+			c.start(ctx, msg.ID, &req)
+
+		case wsStop:
+			c.opsMu.Lock()
+			if cancel, ok := c.ops[msg.ID]; ok {
+				cancel()
+			}
+			c.opsMu.Unlock()
+
+		default:
+			c.writeError(msg.ID, wsConnectionError, "unknown message type "+msg.Type)
+		}
+	}
+}
+
+// start runs an operation, sending its results to the client until it ends or
+// is stopped.
+func (c *wsConn) start(ctx context.Context, id string, req *wsRequest) {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+
+	if id == "" {
+		c.writeError(id, wsError, "missing operation id")
+		return
+	}
+	if _, ok := c.ops[id]; ok {
+		c.writeError(id, wsError, "duplicate operation id")
+		return
+	}
+	if len(c.ops) >= wsMaxOperations {
+		c.writeError(id, wsError, "too many operations")
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	results, err := c.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		cancel()
+		c.writeError(id, wsError, err.Error())
+		return
+	}
+	c.ops[id] = cancel
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		// Results must be drained until closed, even if the client is gone
+		for result := range results {
+			if ctx.Err() != nil {
+				continue
+			}
+			payload, err := json.Marshal(result)
+			if err != nil {
+				log.Warn("Failed to encode GraphQL result", "err", err)
+				continue
+			}
+			c.write(&wsMessage{ID: id, Type: wsData, Payload: payload})
+		}
+		c.opsMu.Lock()
+		delete(c.ops, id)
+		c.opsMu.Unlock()
+		cancel()
+
+		c.write(&wsMessage{ID: id, Type: wsComplete})
+	}()
+}
+
+// write sends a message to the client.
+func (c *wsConn) write(msg *wsMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+// writeError sends an error message to the client.
+func (c *wsConn) writeError(id, typ, message string) {
+	payload, _ := json.Marshal(map[string]string{"message": message})
+	c.write(&wsMessage{ID: id, Type: typ, Payload: payload})
+}
@@ -149,30 +149,49 @@ func NewPublicTxPoolAPI(b Backend) *PublicTxPoolAPI {
 	return &PublicTxPoolAPI{b}
 }
 
-// Content returns the transactions contained within the transaction pool.
-func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransaction {
-	content := map[string]map[string]map[string]*RPCTransaction{
-		"pending": make(map[string]map[string]*RPCTransaction),
-		"queued":  make(map[string]map[string]*RPCTransaction),
+// RPCPrivateTransaction represents a private transaction in the pool, along with
+// its status and the block number at which it expires.
+type RPCPrivateTransaction struct {
+	*RPCTransaction
+	Status string         `json:"status"`
+	Expiry hexutil.Uint64 `json:"expiryBlock"`
+}
+
+// Content returns the transactions contained within the transaction pool. The
+// private transactions are additionally listed with their status and expiry.
+func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]interface{} {
+	content := map[string]map[string]map[string]interface{}{
+		"pending": make(map[string]map[string]interface{}),
+		"queued":  make(map[string]map[string]interface{}),
+		"private": make(map[string]map[string]interface{}),
 	}
 	pending, queue := s.b.TxPoolContent()
+	private := s.b.TxPoolPrivate()
 	curHeader := s.b.CurrentHeader()
-	// Flatten the pending transactions
-	for account, txs := range pending {
-		dump := make(map[string]*RPCTransaction)
-		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
-		}
-		content["pending"][account.Hex()] = dump
-	}
-	// Flatten the queued transactions
-	for account, txs := range queue {
-		dump := make(map[string]*RPCTransaction)
-		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+
+	flatten := func(status string, set map[common.Address]types.Transactions) {
+		for account, txs := range set {
+			dump := make(map[string]interface{})
+			for _, tx := range txs {
+				rpcTx := newRPCPendingTransaction(tx, curHeader, s.b.ChainConfig())
+				dump[fmt.Sprintf("%d", tx.Nonce())] = rpcTx
+
+				if expiry, ok := private[tx.Hash()]; ok {
+					if content["private"][account.Hex()] == nil {
+						content["private"][account.Hex()] = make(map[string]interface{})
+					}
+					content["private"][account.Hex()][fmt.Sprintf("%d", tx.Nonce())] = &RPCPrivateTransaction{
+						RPCTransaction: rpcTx,
+						Status:         status,
+						Expiry:         hexutil.Uint64(expiry),
+					}
+				}
+			}
+			content[status][account.Hex()] = dump
 		}
-		content["queued"][account.Hex()] = dump
 	}
+	flatten("pending", pending)
+	flatten("queued", queue)
 	return content
 }
 
@@ -208,6 +227,76 @@ func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	}
 }
 
+// TxStatus returns the status (unknown/pending/queued) of a transaction in the
+// pool, along with the latest change it underwent, which is also available for
+// a while after the transaction was dropped.
+func (s *PublicTxPoolAPI) TxStatus(hash common.Hash) map[string]interface{} {
+	status, ev := s.b.TxPoolTxStatus(hash)
+
+	fields := map[string]interface{}{
+		"hash":      hash,
+		"status":    "unknown",
+		"lastEvent": nil,
+	}
+	switch status {
+	case core.TxStatusPending:
+		fields["status"] = "pending"
+	case core.TxStatusQueued:
+		fields["status"] = "queued"
+	}
+	if ev != nil {
+		fields["lastEvent"] = s.marshalEvent(*ev)
+	}
+	return fields
+}
+
+// Events creates a subscription that is triggered each time a transaction is
+// added to, promoted, demoted, replaced or dropped within the transaction pool.
+func (s *PublicTxPoolAPI) Events(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.TxPoolEvent, 128)
+		eventSub := s.b.SubscribeTxPoolEvent(events)
+		defer eventSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, s.marshalEvent(ev))
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// marshalEvent converts a transaction pool event into its RPC representation.
+func (s *PublicTxPoolAPI) marshalEvent(ev core.TxPoolEvent) map[string]interface{} {
+	from, _ := types.Sender(types.LatestSigner(s.b.ChainConfig()), ev.Tx)
+	fields := map[string]interface{}{
+		"hash":  ev.Tx.Hash(),
+		"from":  from,
+		"nonce": hexutil.Uint64(ev.Tx.Nonce()),
+		"type":  ev.Type.String(),
+		"time":  hexutil.Uint64(ev.Time.Unix()),
+	}
+	if ev.Reason != nil {
+		fields["reason"] = ev.Reason.Error()
+	}
+	if ev.Type == core.TxEventReplaced {
+		fields["replacedBy"] = ev.ReplacedBy
+	}
+	return fields
+}
+
 // Inspect retrieves the content of the transaction pool and flattens it into an
 // easily inspectable list.
 func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
@@ -757,6 +846,32 @@ func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Ha
 	return nil, err
 }
 
+// GetBlockReceipts returns the receipts of all transactions in the requested
+// block, retrieved at once.
+func (s *PublicBlockChainAPI) GetBlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	receipts, err := s.b.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	var (
+		header = block.Header()
+		signer = types.MakeSigner(s.b.ChainConfig(), block.Number())
+		result = make([]map[string]interface{}, len(receipts))
+	)
+	for i, receipt := range receipts {
+		result[i] = marshalReceipt(s.b.ChainConfig(), header, signer, txs[i], uint64(i), receipt)
+	}
+	return result, nil
+}
+
 // GetUncleByBlockNumberAndIndex returns the uncle block for the given block hash and index. When fullTx is true
 // all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error) {
@@ -1618,15 +1733,24 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	}
 	receipt := receipts[index]
 
+	header, err := s.b.HeaderByHash(ctx, blockHash)
+	if err != nil || header == nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(s.b.ChainConfig(), new(big.Int).SetUint64(blockNumber))
+	return marshalReceipt(s.b.ChainConfig(), header, signer, tx, index, receipt), nil
+}
+
+// marshalReceipt converts the receipt of the transaction at the given index of
+// the block into the RPC representation.
+func marshalReceipt(config *params.ChainConfig, header *types.Header, signer types.Signer, tx *types.Transaction, index uint64, receipt *types.Receipt) map[string]interface{} {
 	// Derive the sender.
-	bigblock := new(big.Int).SetUint64(blockNumber)
-	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
-		"blockHash":         blockHash,
-		"blockNumber":       hexutil.Uint64(blockNumber),
-		"transactionHash":   hash,
+		"blockHash":         header.Hash(),
+		"blockNumber":       hexutil.Uint64(header.Number.Uint64()),
+		"transactionHash":   tx.Hash(),
 		"transactionIndex":  hexutil.Uint64(index),
 		"from":              from,
 		"to":                tx.To(),
@@ -1638,13 +1762,9 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	if !s.b.ChainConfig().IsLondon(bigblock) {
+	if !config.IsLondon(header.Number) {
 		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
 	} else {
-		header, err := s.b.HeaderByHash(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
 		gasPrice := new(big.Int).Add(header.BaseFee, tx.EffectiveGasTipValue(header.BaseFee))
 		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 	}
@@ -1661,7 +1781,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	return fields
 }
 
 // sign is a helper function that signs a transaction with the private key of the given address.
@@ -1679,6 +1799,28 @@ func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transacti
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
 func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, b.SendTx)
+}
+
+// SubmitPrivateTransaction is a helper function that submits tx to txPool as a
+// private transaction, which is never propagated to the network and is dropped
+// after the given number of blocks, and logs a message.
+func SubmitPrivateTransaction(ctx context.Context, b Backend, tx *types.Transaction, lifetime uint64) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, func(ctx context.Context, tx *types.Transaction) error {
+		return b.SendPrivateTx(ctx, tx, lifetime)
+	})
+}
+
+// SubmitConditionalTransaction is a helper function that submits tx to txPool as
+// a private transaction, only to be included while its preconditions hold, and
+// logs a message.
+func SubmitConditionalTransaction(ctx context.Context, b Backend, tx *types.Transaction, cond *core.TxConditions) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, func(ctx context.Context, tx *types.Transaction) error {
+		return b.SendConditionalTx(ctx, tx, cond)
+	})
+}
+
+func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction, send func(context.Context, *types.Transaction) error) (common.Hash, error) {
 	// If the transaction fee cap is already specified, ensure the
 	// fee of the given transaction is _reasonable_.
 	if err := checkTxFee(tx.GasPrice(), tx.Gas(), b.RPCTxFeeCap()); err != nil {
@@ -1688,7 +1830,7 @@ func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 		// Ensure only eip155 signed transactions are submitted if EIP155Required is set.
 		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
 	}
-	if err := b.SendTx(ctx, tx); err != nil {
+	if err := send(ctx, tx); err != nil {
 		return common.Hash{}, err
 	}
 	// Print a log with full tx details for manual investigations and interventions
@@ -1766,6 +1908,33 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// SendPrivateRawTransaction will add the signed transaction to the transaction
+// pool as a private transaction. It is never propagated to the network, only
+// included by the local miner, and dropped if not included within the given
+// number of blocks. If no lifetime is given, the pool's default is used.
+func (s *PublicTransactionPoolAPI) SendPrivateRawTransaction(ctx context.Context, input hexutil.Bytes, lifetime *hexutil.Uint64) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	var blocks uint64
+	if lifetime != nil {
+		blocks = uint64(*lifetime)
+	}
+	return SubmitPrivateTransaction(ctx, s.b, tx, blocks)
+}
+
+// SendRawTransactionConditional will add the signed transaction to the transaction
+// pool, only to be included by the local miner in a block satisfying the given
+// preconditions. The transaction is dropped as soon as they can no longer hold.
+func (s *PublicTransactionPoolAPI) SendRawTransactionConditional(ctx context.Context, input hexutil.Bytes, conditions TransactionConditions) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	return SubmitConditionalTransaction(ctx, s.b, tx, conditions.toConditions())
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
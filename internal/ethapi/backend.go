@@ -71,6 +71,8 @@ type Backend interface {
 
 	// Transaction pool API
 	SendTx(ctx context.Context, signedTx *types.Transaction) error
+	SendPrivateTx(ctx context.Context, signedTx *types.Transaction, lifetime uint64) error
+	SendConditionalTx(ctx context.Context, signedTx *types.Transaction, cond *core.TxConditions) error
 	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
 	GetPoolTransactions() (types.Transactions, error)
 	GetPoolTransaction(txHash common.Hash) *types.Transaction
@@ -78,7 +80,10 @@ type Backend interface {
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
 	TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions)
+	TxPoolPrivate() map[common.Hash]uint64
+	TxPoolTxStatus(hash common.Hash) (core.TxStatus, *core.TxPoolEvent)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+	SubscribeTxPoolEvent(chan<- core.TxPoolEvent) event.Subscription
 
 	// Filter API
 	BloomStatus() (uint64, uint64)
@@ -0,0 +1,75 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// KnownAccountArgs is the expected storage of an account, given either as the
+// root hash of its storage trie, or as an object of storage slot values.
+type KnownAccountArgs struct {
+	StorageRoot  *common.Hash
+	StorageSlots map[common.Hash]common.Hash
+}
+
+// UnmarshalJSON parses either a storage root or an object of storage slots.
+func (args *KnownAccountArgs) UnmarshalJSON(input []byte) error {
+	var root common.Hash
+	if err := json.Unmarshal(input, &root); err == nil {
+		args.StorageRoot = &root
+		return nil
+	}
+	return json.Unmarshal(input, &args.StorageSlots)
+}
+
+// TransactionConditions represents the preconditions of a conditional transaction.
+type TransactionConditions struct {
+	BlockNumberMin *hexutil.Big                         `json:"blockNumberMin"`
+	BlockNumberMax *hexutil.Big                         `json:"blockNumberMax"`
+	TimestampMin   *hexutil.Uint64                      `json:"timestampMin"`
+	TimestampMax   *hexutil.Uint64                      `json:"timestampMax"`
+	KnownAccounts  map[common.Address]*KnownAccountArgs `json:"knownAccounts"`
+}
+
+// toConditions converts the arguments to the preconditions checked by the pool.
+func (args *TransactionConditions) toConditions() *core.TxConditions {
+	cond := &core.TxConditions{
+		BlockNumberMin: (*big.Int)(args.BlockNumberMin),
+		BlockNumberMax: (*big.Int)(args.BlockNumberMax),
+		TimestampMin:   (*uint64)(args.TimestampMin),
+		TimestampMax:   (*uint64)(args.TimestampMax),
+	}
+	if len(args.KnownAccounts) > 0 {
+		cond.KnownAccounts = make(map[common.Address]core.KnownAccount, len(args.KnownAccounts))
+		for addr, account := range args.KnownAccounts {
+			if account == nil {
+				continue
+			}
+			cond.KnownAccounts[addr] = core.KnownAccount{
+				StorageRoot:  account.StorageRoot,
+				StorageSlots: account.StorageSlots,
+			}
+		}
+	}
+	return cond
+}
@@ -69,9 +69,40 @@ func (b *LesApiBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentHeader(), nil
 	}
+	if number == rpc.FinalizedBlockNumber {
+		return b.finalizedHeader(ctx)
+	}
+	if number == rpc.SafeBlockNumber {
+		if _, ok := b.eth.engine.(consensus.FinalityEngine); !ok && b.eth.config.RPCSafeDepth > 0 {
+			return b.confirmedHeader(ctx, b.eth.config.RPCSafeDepth)
+		}
+		return b.finalizedHeader(ctx)
+	}
 	return b.eth.blockchain.GetHeaderByNumberOdr(ctx, uint64(number))
 }
 
+// finalizedHeader returns the latest finalized block, as determined by the
+// consensus engine or at the configured confirmation depth.
+func (b *LesApiBackend) finalizedHeader(ctx context.Context) (*types.Header, error) {
+	if engine, ok := b.eth.engine.(consensus.FinalityEngine); ok {
+		return engine.FinalizedHeader(b.eth.blockchain), nil
+	}
+	if depth := b.eth.config.RPCFinalizedDepth; depth > 0 {
+		return b.confirmedHeader(ctx, depth)
+	}
+	return nil, errors.New("finalized block not available")
+}
+
+// confirmedHeader returns the canonical block the given number of blocks below
+// the head, or the genesis block if the chain is shorter.
+func (b *LesApiBackend) confirmedHeader(ctx context.Context, depth uint64) (*types.Header, error) {
+	head := b.eth.blockchain.CurrentHeader().Number.Uint64()
+	if head < depth {
+		return b.eth.blockchain.GetHeaderByNumberOdr(ctx, 0)
+	}
+	return b.eth.blockchain.GetHeaderByNumberOdr(ctx, head-depth)
+}
+
 func (b *LesApiBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.HeaderByNumber(ctx, blockNr)
@@ -194,6 +225,14 @@ func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.Add(ctx, signedTx)
 }
 
+func (b *LesApiBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, lifetime uint64) error {
+	return errors.New("private transactions are not supported by light clients")
+}
+
+func (b *LesApiBackend) SendConditionalTx(ctx context.Context, signedTx *types.Transaction, cond *core.TxConditions) error {
+	return errors.New("conditional transactions are not supported by light clients")
+}
+
 func (b *LesApiBackend) RemoveTx(txHash common.Hash) {
 	b.eth.txPool.RemoveTx(txHash)
 }
@@ -226,6 +265,24 @@ func (b *LesApiBackend) TxPoolContentFrom(addr common.Address) (types.Transactio
 	return b.eth.txPool.ContentFrom(addr)
 }
 
+func (b *LesApiBackend) TxPoolPrivate() map[common.Hash]uint64 {
+	return nil
+}
+
+func (b *LesApiBackend) TxPoolTxStatus(hash common.Hash) (core.TxStatus, *core.TxPoolEvent) {
+	if b.eth.txPool.GetTransaction(hash) != nil {
+		return core.TxStatusPending, nil
+	}
+	return core.TxStatusUnknown, nil
+}
+
+func (b *LesApiBackend) SubscribeTxPoolEvent(ch chan<- core.TxPoolEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.eth.txPool.SubscribeNewTxsEvent(ch)
 }
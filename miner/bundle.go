@@ -0,0 +1,456 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxBundles is the maximum number of bundles waiting for inclusion.
+	maxBundles = 1024
+
+	// maxBundlesPerSender is the maximum number of bundles waiting for inclusion
+	// submitted by the same sender, the sender of their first transaction.
+	maxBundlesPerSender = 16
+
+	// maxBundleBlocksAhead is the maximum number of blocks a bundle may target
+	// ahead of the current head.
+	maxBundleBlocksAhead = 25
+)
+
+var (
+	// errBundleEmpty is returned if a bundle without transactions is submitted.
+	errBundleEmpty = errors.New("empty bundle")
+
+	// errBundleStale is returned if a bundle targets an already mined block.
+	errBundleStale = errors.New("bundle targets past block")
+
+	// errBundleFuture is returned if a bundle targets a block too far ahead.
+	errBundleFuture = fmt.Errorf("bundle targets block more than %d blocks ahead", maxBundleBlocksAhead)
+
+	// errBundleSenderQuota is returned if the sender of a bundle has too many
+	// bundles waiting for inclusion.
+	errBundleSenderQuota = errors.New("too many bundles of sender")
+
+	// errBundleTimestamps is returned if the timestamp range of a bundle is empty.
+	errBundleTimestamps = errors.New("bundle min timestamp above max timestamp")
+
+	// errBundlePoolFull is returned if no more bundles can be accepted.
+	errBundlePoolFull = errors.New("bundle pool is full")
+)
+
+// Bundle is an ordered list of transactions which is included in the target block
+// atomically: either all transactions are included contiguously and in order, or
+// none of them are.
+type Bundle struct {
+	Txs          types.Transactions // Transactions to include, in order
+	BlockNumber  uint64             // Number of the block to include the bundle in
+	MinTimestamp uint64             // Minimum block timestamp to include the bundle at (0 = no limit)
+	MaxTimestamp uint64             // Maximum block timestamp to include the bundle at (0 = no limit)
+
+	// RevertingTxHashes are the transactions allowed to revert without the
+	// whole bundle being dropped.
+	RevertingTxHashes []common.Hash
+
+	sender common.Address // Sender of the first transaction, set on validation
+}
+
+// validate checks the consistency of the bundle against the current head number.
+func (b *Bundle) validate(head uint64) error {
+	if len(b.Txs) == 0 {
+		return errBundleEmpty
+	}
+	if b.BlockNumber <= head {
+		return errBundleStale
+	}
+	if b.BlockNumber > head+maxBundleBlocksAhead {
+		return errBundleFuture
+	}
+	if b.MaxTimestamp != 0 && b.MinTimestamp > b.MaxTimestamp {
+		return errBundleTimestamps
+	}
+	return nil
+}
+
+// includable returns whether the bundle may be included in the given block.
+func (b *Bundle) includable(header *types.Header) bool {
+	if b.BlockNumber != header.Number.Uint64() {
+		return false
+	}
+	if b.MinTimestamp != 0 && header.Time < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && header.Time > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
+
+// mayRevert returns whether the given transaction is allowed to revert.
+func (b *Bundle) mayRevert(hash common.Hash) bool {
+	for _, allowed := range b.RevertingTxHashes {
+		if allowed == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// BundleTxResult is the outcome of a single transaction of a simulated bundle.
+type BundleTxResult struct {
+	Hash     common.Hash
+	GasUsed  uint64
+	Reverted bool     // Whether the transaction reverted
+	Profit   *big.Int // Coinbase balance increase caused by the transaction
+}
+
+// BundleResult is the outcome of a simulated bundle.
+type BundleResult struct {
+	BlockNumber uint64
+	Timestamp   uint64
+	Coinbase    common.Address
+	GasUsed     uint64
+	Profit      *big.Int // Coinbase balance increase caused by the bundle
+	GasPrice    *big.Int // Effective gas price paid to the coinbase (profit per gas)
+	Txs         []*BundleTxResult
+
+	// Err is the reason the bundle would be dropped, or nil if it would be
+	// included.
+	Err error
+}
+
+// bundlePool is the set of bundles waiting for inclusion, in arrival order.
+type bundlePool struct {
+	bundles []*Bundle
+	lock    sync.Mutex
+}
+
+// add inserts a new bundle into the pool, after validating it against the current
+// head number.
+func (p *bundlePool) add(bundle *Bundle, head uint64) error {
+	if err := bundle.validate(head); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.bundles) >= maxBundles {
+		return errBundlePoolFull
+	}
+	var queued int
+	for _, b := range p.bundles {
+		if b.sender == bundle.sender {
+			queued++
+		}
+	}
+	if queued >= maxBundlesPerSender {
+		return errBundleSenderQuota
+	}
+	p.bundles = append(p.bundles, bundle)
+	return nil
+}
+
+// includable drops all bundles targeting blocks before the given one, and
+// returns the ones which may be included in it.
+func (p *bundlePool) includable(header *types.Header) []*Bundle {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		number  = header.Number.Uint64()
+		retain  = p.bundles[:0]
+		bundles []*Bundle
+	)
+	for _, bundle := range p.bundles {
+		if bundle.BlockNumber < number {
+			continue
+		}
+		retain = append(retain, bundle)
+		if bundle.includable(header) {
+			bundles = append(bundles, bundle)
+		}
+	}
+	for i := len(retain); i < len(p.bundles); i++ {
+		p.bundles[i] = nil
+	}
+	p.bundles = retain
+	return bundles
+}
+
+// addBundle validates the transactions of a bundle against the current head
+// state and queues it up for inclusion.
+func (w *worker) addBundle(bundle *Bundle) error {
+	head := w.chain.CurrentBlock()
+	if err := bundle.validate(head.NumberU64()); err != nil {
+		return err
+	}
+	statedb, err := w.chain.StateAt(head.Root())
+	if err != nil {
+		return err
+	}
+	if err := w.validateBundleTxs(bundle, head, statedb); err != nil {
+		return err
+	}
+	return w.bundles.add(bundle, head.NumberU64())
+}
+
+// validateBundleTxs checks the transactions of a bundle the way the transaction
+// pool checks the transactions it accepts: their signatures, nonces, gas and
+// fees must be valid in the block following the given head, and their senders
+// must afford them. The sender of the bundle is set along the way.
+func (w *worker) validateBundleTxs(bundle *Bundle, head *types.Block, statedb *state.StateDB) error {
+	var (
+		number  = new(big.Int).Add(head.Number(), common.Big1)
+		signer  = types.MakeSigner(w.chainConfig, number)
+		london  = w.chainConfig.IsLondon(number)
+		gasCap  = core.CalcGasLimit(head.GasLimit(), w.config.GasCeil)
+		baseFee *big.Int
+		nonces  = make(map[common.Address]uint64)
+		costs   = make(map[common.Address]*big.Int)
+		gas     uint64
+	)
+	if london {
+		baseFee = misc.CalcBaseFee(w.chainConfig, head.Header())
+	}
+	for i, tx := range bundle.Txs {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
+		}
+		if i == 0 {
+			bundle.sender = from
+		}
+		if !london && tx.Type() == types.DynamicFeeTxType {
+			return fmt.Errorf("tx %d: %w", i, core.ErrTxTypeNotSupported)
+		}
+		if tx.GasTipCapIntCmp(tx.GasFeeCap()) > 0 {
+			return fmt.Errorf("tx %d: %w", i, core.ErrTipAboveFeeCap)
+		}
+		if baseFee != nil && tx.GasFeeCapIntCmp(baseFee) < 0 {
+			return fmt.Errorf("tx %d: %w", i, core.ErrFeeCapTooLow)
+		}
+		intrGas, err := core.IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, true, w.chainConfig.IsIstanbul(number))
+		if err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
+		}
+		if tx.Gas() < intrGas {
+			return fmt.Errorf("tx %d: %w", i, core.ErrIntrinsicGas)
+		}
+		if gas += tx.Gas(); gas > gasCap {
+			return fmt.Errorf("tx %d: %w", i, core.ErrGasLimitReached)
+		}
+		// Transactions of a sender must follow its account nonce and each other
+		next, ok := nonces[from]
+		if !ok {
+			next = statedb.GetNonce(from)
+		}
+		if tx.Nonce() < next {
+			return fmt.Errorf("tx %d: %w", i, core.ErrNonceTooLow)
+		}
+		nonces[from] = tx.Nonce() + 1
+
+		cost, ok := costs[from]
+		if !ok {
+			cost = new(big.Int)
+			costs[from] = cost
+		}
+		if cost.Add(cost, tx.Cost()).Cmp(statedb.GetBalance(from)) > 0 {
+			return fmt.Errorf("tx %d: %w", i, core.ErrInsufficientFunds)
+		}
+	}
+	return nil
+}
+
+// commitBundles includes all bundles eligible for the current block ahead of
+// any other transaction, returning whether any of them was included.
+func (w *worker) commitBundles(coinbase common.Address) bool {
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	bundles := w.bundles.includable(w.current.header)
+	if strategy, ok := w.ordering.(BundleOrderingStrategy); ok && len(bundles) > 0 {
+		results := make([]*BundleResult, len(bundles))
+		for i, bundle := range bundles {
+			results[i] = w.simulateCurrentBundle(bundle, coinbase)
+		}
+		bundles = strategy.OrderBundles(bundles, results)
+	}
+	var included bool
+	for _, bundle := range bundles {
+		if err := w.commitBundle(bundle, coinbase); err != nil {
+			log.Debug("Bundle dropped", "number", bundle.BlockNumber, "txs", len(bundle.Txs), "err", err)
+			continue
+		}
+		included = true
+	}
+	return included
+}
+
+// commitBundle applies all transactions of a bundle on top of the current state.
+// If any of them fails, or reverts without being allowed to, all changes done by
+// the bundle are rolled back. As the state journal is flushed after every single
+// transaction, the rollback is done to a copy of the state taken in advance.
+func (w *worker) commitBundle(bundle *Bundle, coinbase common.Address) error {
+	var (
+		state    = w.current.state.Copy()
+		gas      = w.current.gasPool.Gas()
+		gasUsed  = w.current.header.GasUsed
+		tcount   = w.current.tcount
+		txs      = len(w.current.txs)
+		receipts = len(w.current.receipts)
+	)
+	var err error
+	for _, tx := range bundle.Txs {
+		w.current.state.Prepare(tx.Hash(), w.current.tcount)
+		if _, err = w.commitTransaction(tx, coinbase); err != nil {
+			err = fmt.Errorf("tx %x: %w", tx.Hash(), err)
+			break
+		}
+		w.current.tcount++
+
+		if receipt := w.current.receipts[len(w.current.receipts)-1]; receipt.Status == types.ReceiptStatusFailed && !bundle.mayRevert(tx.Hash()) {
+			err = fmt.Errorf("tx %x: reverted", tx.Hash())
+			break
+		}
+	}
+	if err != nil {
+		w.current.state.StopPrefetcher()
+		w.current.state = state
+		*w.current.gasPool = core.GasPool(gas)
+		w.current.header.GasUsed = gasUsed
+		w.current.tcount = tcount
+		w.current.txs = w.current.txs[:txs]
+		w.current.receipts = w.current.receipts[:receipts]
+		return err
+	}
+	return nil
+}
+
+// simulateBundle executes a bundle on top of the current chain head, as if it
+// was included at the start of the next block, and reports its profitability.
+func (w *worker) simulateBundle(bundle *Bundle) (*BundleResult, error) {
+	if len(bundle.Txs) == 0 {
+		return nil, errBundleEmpty
+	}
+	w.mu.RLock()
+	coinbase := w.coinbase
+	w.mu.RUnlock()
+
+	parent := w.chain.CurrentBlock()
+	statedb, err := w.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	timestamp := uint64(time.Now().Unix())
+	if timestamp <= parent.Time() {
+		timestamp = parent.Time() + 1
+	}
+	if bundle.MinTimestamp > timestamp {
+		timestamp = bundle.MinTimestamp
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
+		Time:       timestamp,
+		Coinbase:   coinbase,
+		Difficulty: parent.Difficulty(),
+	}
+	if w.chainConfig.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
+	}
+	result := &BundleResult{
+		BlockNumber: header.Number.Uint64(),
+		Timestamp:   header.Time,
+		Coinbase:    coinbase,
+		Profit:      new(big.Int),
+		GasPrice:    new(big.Int),
+	}
+	if bundle.BlockNumber != 0 && !bundle.includable(header) {
+		result.Err = fmt.Errorf("bundle not includable in block %d at %d", header.Number, header.Time)
+	}
+	if err := w.executeBundle(bundle, statedb, header, new(core.GasPool).AddGas(header.GasLimit), 0, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// simulateCurrentBundle executes a bundle on top of the block being built, on a
+// copy of its state, and reports its profitability. Bundles which can't be
+// executed are reported with the failure as their error.
+func (w *worker) simulateCurrentBundle(bundle *Bundle, coinbase common.Address) *BundleResult {
+	result := &BundleResult{
+		BlockNumber: w.current.header.Number.Uint64(),
+		Timestamp:   w.current.header.Time,
+		Coinbase:    coinbase,
+		Profit:      new(big.Int),
+		GasPrice:    new(big.Int),
+	}
+	gasPool := new(core.GasPool).AddGas(w.current.gasPool.Gas())
+	if err := w.executeBundle(bundle, w.current.state.Copy(), w.current.header, gasPool, w.current.tcount, result); err != nil {
+		result.Err = err
+	}
+	return result
+}
+
+// executeBundle applies the transactions of a bundle to the given state, filling
+// the result with their outcome. The first transaction gets the given index in
+// the block. An error is returned if a transaction can't be executed.
+func (w *worker) executeBundle(bundle *Bundle, statedb *state.StateDB, header *types.Header, gasPool *core.GasPool, index int, result *BundleResult) error {
+	var (
+		vmCfg   = *w.chain.GetVMConfig()
+		start   = statedb.GetBalance(result.Coinbase)
+		gasUsed uint64
+	)
+	for i, tx := range bundle.Txs {
+		before := statedb.GetBalance(result.Coinbase)
+
+		statedb.Prepare(tx.Hash(), index+i)
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &result.Coinbase, gasPool, statedb, header, tx, &gasUsed, vmCfg)
+		if err != nil {
+			return fmt.Errorf("tx %x: %w", tx.Hash(), err)
+		}
+		txResult := &BundleTxResult{
+			Hash:     tx.Hash(),
+			GasUsed:  receipt.GasUsed,
+			Reverted: receipt.Status == types.ReceiptStatusFailed,
+			Profit:   new(big.Int).Sub(statedb.GetBalance(result.Coinbase), before),
+		}
+		if txResult.Reverted && !bundle.mayRevert(tx.Hash()) && result.Err == nil {
+			result.Err = fmt.Errorf("tx %x: reverted", tx.Hash())
+		}
+		result.Txs = append(result.Txs, txResult)
+	}
+	result.GasUsed = gasUsed
+	result.Profit.Sub(statedb.GetBalance(result.Coinbase), start)
+	if result.GasUsed > 0 {
+		result.GasPrice.Div(result.Profit, new(big.Int).SetUint64(result.GasUsed))
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// bundleTransfer creates a value transfer from the test bank for a bundle.
+func bundleTransfer(nonce uint64) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(10*params.InitialBaseFee), nil), types.HomesteadSigner{}, testBankKey)
+	return tx
+}
+
+// bundleRevert creates a contract creation from the test bank which reverts.
+func bundleRevert(nonce uint64) *types.Transaction {
+	// PUSH1 0; PUSH1 0; REVERT
+	tx, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(0), 100000, big.NewInt(10*params.InitialBaseFee), common.FromHex("0x60006000fd")), types.HomesteadSigner{}, testBankKey)
+	return tx
+}
+
+func TestBundleValidation(t *testing.T) {
+	tests := []struct {
+		bundle *Bundle
+		err    error
+	}{
+		{&Bundle{BlockNumber: 2}, errBundleEmpty},
+		{&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 1}, errBundleStale},
+		{&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 2, MinTimestamp: 2, MaxTimestamp: 1}, errBundleTimestamps},
+		{&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 2, MinTimestamp: 2}, nil},
+		{&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 1 + maxBundleBlocksAhead}, nil},
+		{&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 2 + maxBundleBlocksAhead}, errBundleFuture},
+	}
+	for i, tt := range tests {
+		if err := new(bundlePool).add(tt.bundle, 1); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Ensure bundles are dropped once their block passed
+	pool := new(bundlePool)
+	for number := uint64(1); number <= 3; number++ {
+		if err := pool.add(&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: number}, 0); err != nil {
+			t.Fatalf("failed to add bundle for block %d: %v", number, err)
+		}
+	}
+	if bundles := pool.includable(&types.Header{Number: big.NewInt(2)}); len(bundles) != 1 || bundles[0].BlockNumber != 2 {
+		t.Fatalf("includable bundles mismatch: have %v", bundles)
+	}
+	if len(pool.bundles) != 2 {
+		t.Fatalf("retained bundles mismatch: have %d, want 2", len(pool.bundles))
+	}
+}
+
+// Tests that the number of bundles waiting for inclusion is capped per sender.
+func TestBundleSenderQuota(t *testing.T) {
+	pool := new(bundlePool)
+	for i := 0; i < maxBundlesPerSender; i++ {
+		if err := pool.add(&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 1, sender: testBankAddress}, 0); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	if err := pool.add(&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 1, sender: testBankAddress}, 0); err != errBundleSenderQuota {
+		t.Fatalf("error mismatch: have %v, want %v", err, errBundleSenderQuota)
+	}
+	if err := pool.add(&Bundle{Txs: types.Transactions{bundleTransfer(0)}, BlockNumber: 1, sender: testUserAddress}, 0); err != nil {
+		t.Fatalf("failed to add bundle of other sender: %v", err)
+	}
+}
+
+// Tests that the transactions of bundles are validated against the head state
+// before the bundles are accepted.
+func TestBundleAdmission(t *testing.T) {
+	w, _ := newTestWorker(t, ethashChainConfig, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	sign := func(tx *types.Transaction, signer types.Signer) *types.Transaction {
+		signed, _ := types.SignTx(tx, signer, testBankKey)
+		return signed
+	}
+	otherChain := types.NewEIP155Signer(big.NewInt(1337))
+	tests := []struct {
+		txs types.Transactions
+		err error
+	}{
+		{types.Transactions{bundleTransfer(0), bundleTransfer(1)}, nil},
+		{types.Transactions{bundleTransfer(0), bundleTransfer(0)}, core.ErrNonceTooLow},
+		{types.Transactions{sign(types.NewTransaction(0, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), otherChain)}, types.ErrInvalidChainId},
+		{types.Transactions{sign(types.NewTransaction(0, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{})}, core.ErrFeeCapTooLow},
+		{types.Transactions{sign(types.NewTransaction(0, testUserAddress, big.NewInt(1000), params.TxGas-1, big.NewInt(params.InitialBaseFee), nil), types.HomesteadSigner{})}, core.ErrIntrinsicGas},
+		{types.Transactions{sign(types.NewTransaction(0, testUserAddress, testBankFunds, params.TxGas, big.NewInt(params.InitialBaseFee), nil), types.HomesteadSigner{})}, core.ErrInsufficientFunds},
+	}
+	for i, tt := range tests {
+		err := w.addBundle(&Bundle{Txs: tt.txs, BlockNumber: 1})
+		if (tt.err == nil && err != nil) || !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if len(w.bundles.bundles) != 1 || w.bundles.bundles[0].sender != testBankAddress {
+		t.Fatalf("accepted bundles mismatch: have %d", len(w.bundles.bundles))
+	}
+}
+
+func TestBundleInclusion(t *testing.T) {
+	tests := []struct {
+		bundle *Bundle
+		txs    []*types.Transaction // Expected transactions of the block
+	}{
+		// Bundle included ahead of the pool transactions
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleTransfer(1)}, BlockNumber: 1},
+			txs:    []*types.Transaction{bundleTransfer(0), bundleTransfer(1)},
+		},
+		// Bundle targeting another block
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleTransfer(1)}, BlockNumber: 2},
+			txs:    pendingTxs,
+		},
+		// Bundle outside of its timestamp range
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleTransfer(1)}, BlockNumber: 1, MaxTimestamp: 1},
+			txs:    pendingTxs,
+		},
+		// Bundle with a reverting transaction
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleRevert(1)}, BlockNumber: 1},
+			txs:    pendingTxs,
+		},
+		// Bundle with an allowed reverting transaction
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleRevert(1)}, BlockNumber: 1, RevertingTxHashes: []common.Hash{bundleRevert(1).Hash()}},
+			txs:    []*types.Transaction{bundleTransfer(0), bundleRevert(1)},
+		},
+		// Bundle with an invalid transaction
+		{
+			bundle: &Bundle{Txs: types.Transactions{bundleTransfer(0), bundleTransfer(2)}, BlockNumber: 1},
+			txs:    pendingTxs,
+		},
+	}
+	for i, tt := range tests {
+		w, _ := newTestWorker(t, ethashChainConfig, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 0)
+
+		if err := w.bundles.add(tt.bundle, 0); err != nil {
+			t.Fatalf("test %d: failed to add bundle: %v", i, err)
+		}
+		w.commitNewWork(nil, true, time.Now().Unix())
+
+		block := w.pendingBlock()
+		if len(block.Transactions()) != len(tt.txs) {
+			t.Errorf("test %d: transaction count mismatch: have %d, want %d", i, len(block.Transactions()), len(tt.txs))
+		} else {
+			for j, tx := range block.Transactions() {
+				if tx.Hash() != tt.txs[j].Hash() {
+					t.Errorf("test %d: tx %d mismatch: have %x, want %x", i, j, tx.Hash(), tt.txs[j].Hash())
+				}
+			}
+		}
+		w.close()
+	}
+}
+
+func TestBundleSimulation(t *testing.T) {
+	w, _ := newTestWorker(t, ethashChainConfig, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	coinbase := common.Address{0xc0}
+	w.setEtherbase(coinbase)
+
+	// Simulate a profitable bundle and check the reported profits
+	result, err := w.simulateBundle(&Bundle{Txs: types.Transactions{bundleTransfer(0), bundleTransfer(1)}, BlockNumber: 1})
+	if err != nil {
+		t.Fatalf("failed to simulate bundle: %v", err)
+	}
+	if result.Err != nil {
+		t.Errorf("bundle not includable: %v", result.Err)
+	}
+	if result.Coinbase != coinbase || result.BlockNumber != 1 {
+		t.Errorf("simulation context mismatch: have coinbase %x number %d", result.Coinbase, result.BlockNumber)
+	}
+	if result.GasUsed != 2*params.TxGas {
+		t.Errorf("gas used mismatch: have %d, want %d", result.GasUsed, 2*params.TxGas)
+	}
+	total := new(big.Int)
+	for i, tx := range result.Txs {
+		if tx.Profit.Sign() <= 0 {
+			t.Errorf("tx %d: no profit", i)
+		}
+		total.Add(total, tx.Profit)
+	}
+	if total.Cmp(result.Profit) != 0 {
+		t.Errorf("profit mismatch: have %v, want %v", result.Profit, total)
+	}
+	if want := new(big.Int).Div(result.Profit, big.NewInt(int64(result.GasUsed))); result.GasPrice.Cmp(want) != 0 {
+		t.Errorf("effective gas price mismatch: have %v, want %v", result.GasPrice, want)
+	}
+	// Simulate a reverting bundle, which is reported as not includable
+	result, err = w.simulateBundle(&Bundle{Txs: types.Transactions{bundleTransfer(0), bundleRevert(1)}})
+	if err != nil {
+		t.Fatalf("failed to simulate bundle: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("reverting bundle reported includable")
+	}
+	if len(result.Txs) != 2 || !result.Txs[1].Reverted {
+		t.Errorf("reverting transaction not reported")
+	}
+	// Simulate an invalid bundle
+	if _, err := w.simulateBundle(&Bundle{Txs: types.Transactions{bundleTransfer(1)}}); err == nil {
+		t.Errorf("invalid bundle simulated")
+	}
+}
+
+// Tests that the bundle ordering includes the most profitable of competing
+// bundles, while the default ordering includes the first arriving one.
+func TestBundleOrdering(t *testing.T) {
+	transfer := func(price int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(price*params.InitialBaseFee), nil), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	cheap, dear := transfer(2), transfer(10)
+
+	for _, tt := range []struct {
+		ordering string
+		want     *types.Transaction
+	}{
+		{OrderingPrice, cheap},
+		{OrderingBundle, dear},
+	} {
+		config := *testConfig
+		config.Ordering = tt.ordering
+		w, _ := newTestWorkerWithConfig(t, &config, ethashChainConfig, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 0)
+		w.setEtherbase(common.Address{0xc0})
+
+		for _, tx := range []*types.Transaction{cheap, dear} {
+			if err := w.bundles.add(&Bundle{Txs: types.Transactions{tx}, BlockNumber: 1}, 0); err != nil {
+				t.Fatalf("%s: failed to add bundle: %v", tt.ordering, err)
+			}
+		}
+		w.commitNewWork(nil, true, time.Now().Unix())
+
+		if txs := w.pendingBlock().Transactions(); len(txs) == 0 || txs[0].Hash() != tt.want.Hash() {
+			t.Errorf("%s: wrong bundle included first", tt.ordering)
+		}
+		w.close()
+	}
+}
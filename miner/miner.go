@@ -51,6 +51,7 @@ type Config struct {
 	GasPrice   *big.Int       // Minimum gas price for mining a transaction
 	Recommit   time.Duration  // The time interval for miner to re-create mining work.
 	Noverify   bool           // Disable remote mining solution verification(only useful in ethash).
+	Ordering   string         // Block building strategy ordering the transactions (default = price)
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -227,6 +228,18 @@ func (miner *Miner) DisablePreseal() {
 	miner.worker.disablePreseal()
 }
 
+// AddBundle queues up an atomic transaction bundle for inclusion in the block it
+// targets, after validating its transactions against the current head.
+func (miner *Miner) AddBundle(bundle *Bundle) error {
+	return miner.worker.addBundle(bundle)
+}
+
+// SimulateBundle executes a bundle on top of the current chain head and reports
+// whether it would be included, along with its profitability.
+func (miner *Miner) SimulateBundle(bundle *Bundle) (*BundleResult, error) {
+	return miner.worker.simulateBundle(bundle)
+}
+
 // SubscribePendingLogs starts delivering logs from pending transactions
 // to the given channel.
 func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscription {
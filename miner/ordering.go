@@ -0,0 +1,284 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Names of the built-in block building strategies.
+const (
+	OrderingPrice      = "price"      // Greedy ordering by effective miner tip
+	OrderingFIFO       = "fifo"       // First-come-first-served ordering by arrival time
+	OrderingRoundRobin = "roundrobin" // Fair ordering, one transaction per sender and round
+	OrderingBundle     = "bundle"     // Bundles by profitability, then transactions by effective miner tip
+)
+
+// TransactionOrder yields the pending transactions considered for inclusion in
+// a block one by one, in the order preferred by a block building strategy. The
+// transactions of a single sender are always yielded in nonce order.
+type TransactionOrder interface {
+	// Peek returns the next transaction to include, or nil if none is left.
+	Peek() *types.Transaction
+
+	// Shift replaces the current transaction with the next one of its sender.
+	Shift()
+
+	// Pop removes the current transaction along with all subsequent ones of its
+	// sender. It's used when a transaction can't be executed.
+	Pop()
+}
+
+// OrderingStrategy is a block building strategy, deciding in which order the
+// pending transactions are considered for inclusion into a block.
+//
+// Bundles are committed by the worker ahead of the ordered transactions, in
+// arrival order unless the strategy is a BundleOrderingStrategy too.
+type OrderingStrategy interface {
+	// Order creates the transaction order for a block from the executable pending
+	// transactions, grouped by sender and sorted by nonce. The map is reowned by
+	// the strategy.
+	Order(signer types.Signer, txs map[common.Address]types.Transactions, baseFee *big.Int) TransactionOrder
+}
+
+// BundleOrderingStrategy is a block building strategy which also decides in
+// which order the bundles targeting a block are considered for inclusion. The
+// transactions of a bundle are always included atomically and in their order.
+type BundleOrderingStrategy interface {
+	OrderingStrategy
+
+	// OrderBundles sorts the bundles which may be included in a block, given the
+	// outcome of each one simulated on top of the block built so far. Bundles
+	// left out of the returned list are not included.
+	OrderBundles(bundles []*Bundle, results []*BundleResult) []*Bundle
+}
+
+var (
+	orderingsLock sync.RWMutex
+	orderings     = map[string]OrderingStrategy{
+		OrderingPrice:      priceOrdering{},
+		OrderingFIFO:       fifoOrdering{},
+		OrderingRoundRobin: roundRobinOrdering{},
+		OrderingBundle:     bundleOrdering{},
+	}
+)
+
+// RegisterOrdering makes a block building strategy selectable by name via the
+// Ordering field of the miner config. Registering an existing name replaces the
+// previous strategy.
+func RegisterOrdering(name string, strategy OrderingStrategy) {
+	orderingsLock.Lock()
+	defer orderingsLock.Unlock()
+
+	orderings[name] = strategy
+}
+
+// Orderings returns the names of all selectable block building strategies.
+func Orderings() []string {
+	orderingsLock.RLock()
+	defer orderingsLock.RUnlock()
+
+	names := make([]string, 0, len(orderings))
+	for name := range orderings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsOrdering returns whether a block building strategy with the given name is
+// registered.
+func IsOrdering(name string) bool {
+	_, err := lookupOrdering(name)
+	return err == nil
+}
+
+// lookupOrdering retrieves the block building strategy with the given name. An
+// empty name selects the default price ordering.
+func lookupOrdering(name string) (OrderingStrategy, error) {
+	if name == "" {
+		name = OrderingPrice
+	}
+	orderingsLock.RLock()
+	defer orderingsLock.RUnlock()
+
+	strategy, ok := orderings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction ordering %q", name)
+	}
+	return strategy, nil
+}
+
+// priceOrdering orders the transactions greedily by their effective miner tip.
+type priceOrdering struct{}
+
+// Order implements OrderingStrategy.
+func (priceOrdering) Order(signer types.Signer, txs map[common.Address]types.Transactions, baseFee *big.Int) TransactionOrder {
+	return types.NewTransactionsByPriceAndNonce(signer, txs, baseFee)
+}
+
+// fifoOrdering orders the transactions by the time they were first seen, so the
+// earliest arriving executable transaction is always included first.
+type fifoOrdering struct{}
+
+// Order implements OrderingStrategy.
+func (fifoOrdering) Order(signer types.Signer, txs map[common.Address]types.Transactions, baseFee *big.Int) TransactionOrder {
+	order := newSenderOrder(signer, txs, baseFee)
+	order.rotate = false
+	return order
+}
+
+// roundRobinOrdering orders the transactions fairly across senders, including
+// one transaction of every sender per round. The senders take their turns in the
+// arrival order of their first transaction.
+type roundRobinOrdering struct{}
+
+// Order implements OrderingStrategy.
+func (roundRobinOrdering) Order(signer types.Signer, txs map[common.Address]types.Transactions, baseFee *big.Int) TransactionOrder {
+	order := newSenderOrder(signer, txs, baseFee)
+	order.rotate = true
+	return order
+}
+
+// bundleOrdering orders the bundles by their profitability for the miner, that
+// is the effective gas price they pay to the coinbase, and the transactions of
+// the pool greedily by their effective miner tip.
+type bundleOrdering struct {
+	priceOrdering
+}
+
+// OrderBundles implements BundleOrderingStrategy. Bundles which would be dropped
+// are left out, the others are sorted by effective gas price, then by total
+// profit, keeping the arrival order of equally profitable ones.
+func (bundleOrdering) OrderBundles(bundles []*Bundle, results []*BundleResult) []*Bundle {
+	type ranked struct {
+		bundle *Bundle
+		result *BundleResult
+	}
+	var ranking []ranked
+	for i, bundle := range bundles {
+		if results[i] != nil && results[i].Err == nil {
+			ranking = append(ranking, ranked{bundle, results[i]})
+		}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if cmp := ranking[i].result.GasPrice.Cmp(ranking[j].result.GasPrice); cmp != 0 {
+			return cmp > 0
+		}
+		return ranking[i].result.Profit.Cmp(ranking[j].result.Profit) > 0
+	})
+	ordered := make([]*Bundle, len(ranking))
+	for i, r := range ranking {
+		ordered[i] = r.bundle
+	}
+	return ordered
+}
+
+// senderHead is the next transaction of a sender.
+type senderHead struct {
+	from common.Address
+	tx   *types.Transaction
+}
+
+// senderOrder is a transaction order based on the arrival time of transactions.
+// Without rotation, the sender heads are kept sorted by arrival time. With it,
+// a sender is moved to the back of the queue after each of its transactions.
+type senderOrder struct {
+	txs     map[common.Address]types.Transactions
+	heads   []*senderHead
+	baseFee *big.Int
+	rotate  bool
+}
+
+// newSenderOrder creates a sender based order, with the senders queued up in the
+// arrival order of their first transaction.
+func newSenderOrder(signer types.Signer, txs map[common.Address]types.Transactions, baseFee *big.Int) *senderOrder {
+	order := &senderOrder{
+		txs:     txs,
+		heads:   make([]*senderHead, 0, len(txs)),
+		baseFee: baseFee,
+	}
+	for from, accTxs := range txs {
+		// Remove the sender if it doesn't match, or if its head is not payable
+		if acc, _ := types.Sender(signer, accTxs[0]); acc != from || !order.payable(accTxs[0]) {
+			delete(txs, from)
+			continue
+		}
+		order.heads = append(order.heads, &senderHead{from: from, tx: accTxs[0]})
+		txs[from] = accTxs[1:]
+	}
+	sort.Slice(order.heads, func(i, j int) bool {
+		return order.earlier(order.heads[i], order.heads[j])
+	})
+	return order
+}
+
+// payable returns whether the transaction pays at least the base fee.
+func (o *senderOrder) payable(tx *types.Transaction) bool {
+	_, err := tx.EffectiveGasTip(o.baseFee)
+	return err == nil
+}
+
+// earlier returns whether head a arrived before head b, using the senders as a
+// tie breaker for a deterministic order.
+func (o *senderOrder) earlier(a, b *senderHead) bool {
+	if ta, tb := a.tx.Time(), b.tx.Time(); !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return bytes.Compare(a.from[:], b.from[:]) < 0
+}
+
+// Peek implements TransactionOrder.
+func (o *senderOrder) Peek() *types.Transaction {
+	if len(o.heads) == 0 {
+		return nil
+	}
+	return o.heads[0].tx
+}
+
+// Shift implements TransactionOrder.
+func (o *senderOrder) Shift() {
+	head := o.heads[0]
+	if txs := o.txs[head.from]; len(txs) > 0 && o.payable(txs[0]) {
+		head.tx, o.txs[head.from] = txs[0], txs[1:]
+
+		if o.rotate {
+			o.heads = append(o.heads[1:], head)
+			return
+		}
+		// Sift the new head down to its place in the arrival order
+		i := sort.Search(len(o.heads)-1, func(i int) bool {
+			return o.earlier(head, o.heads[i+1])
+		})
+		copy(o.heads, o.heads[1:i+1])
+		o.heads[i] = head
+		return
+	}
+	o.Pop()
+}
+
+// Pop implements TransactionOrder.
+func (o *senderOrder) Pop() {
+	o.heads = o.heads[1:]
+}
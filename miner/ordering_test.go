@@ -0,0 +1,148 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// orderingTestSet creates three senders with three transactions each, where the
+// transactions of sender i arrive at round*3+i and sender i pays a tip of 3-i.
+func orderingTestSet(t *testing.T) (types.Signer, map[common.Address]types.Transactions, []common.Address) {
+	signer := types.HomesteadSigner{}
+	keys := make([]*ecdsa.PrivateKey, 3)
+	addrs := make([]common.Address, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	txs := make(map[common.Address]types.Transactions)
+	for round := 0; round < 3; round++ {
+		for i, key := range keys {
+			tx, err := types.SignTx(types.NewTransaction(uint64(round), common.Address{}, nil, 21000, big.NewInt(int64(3-i)), nil), signer, key)
+			if err != nil {
+				t.Fatalf("failed to sign tx: %v", err)
+			}
+			txs[addrs[i]] = append(txs[addrs[i]], tx)
+			time.Sleep(time.Millisecond) // Give every transaction a distinct arrival time
+		}
+	}
+	return signer, txs, addrs
+}
+
+// drainOrder retrieves all transactions from an order, returning their senders
+// and verifying that every sender's nonces are in order.
+func drainOrder(t *testing.T, signer types.Signer, order TransactionOrder) []common.Address {
+	var (
+		senders []common.Address
+		nonces  = make(map[common.Address]uint64)
+	)
+	for tx := order.Peek(); tx != nil; tx = order.Peek() {
+		from, _ := types.Sender(signer, tx)
+		if tx.Nonce() != nonces[from] {
+			t.Fatalf("nonce gap for %x: have %d, want %d", from, tx.Nonce(), nonces[from])
+		}
+		nonces[from]++
+		senders = append(senders, from)
+		order.Shift()
+	}
+	return senders
+}
+
+func TestOrderings(t *testing.T) {
+	tests := []struct {
+		ordering string
+		senders  []int
+	}{
+		{OrderingPrice, []int{0, 0, 0, 1, 1, 1, 2, 2, 2}},
+		{OrderingFIFO, []int{0, 1, 2, 0, 1, 2, 0, 1, 2}},
+		{OrderingRoundRobin, []int{0, 1, 2, 0, 1, 2, 0, 1, 2}},
+	}
+	for _, tt := range tests {
+		strategy, err := lookupOrdering(tt.ordering)
+		if err != nil {
+			t.Fatalf("%s: failed to look up ordering: %v", tt.ordering, err)
+		}
+		signer, txs, addrs := orderingTestSet(t)
+		senders := drainOrder(t, signer, strategy.Order(signer, txs, nil))
+		if len(senders) != len(tt.senders) {
+			t.Fatalf("%s: transaction count mismatch: have %d, want %d", tt.ordering, len(senders), len(tt.senders))
+		}
+		for i, idx := range tt.senders {
+			if senders[i] != addrs[idx] {
+				t.Errorf("%s: tx %d: sender mismatch: have %x, want %x", tt.ordering, i, senders[i], addrs[idx])
+			}
+		}
+	}
+}
+
+// Tests that the round-robin ordering rotates the senders even if one of them
+// has many more transactions, while the fifo ordering drains the earliest first.
+func TestOrderingFairness(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	spammer, _ := crypto.GenerateKey()
+	user, _ := crypto.GenerateKey()
+
+	txs := make(map[common.Address]types.Transactions)
+	for i := 0; i < 5; i++ {
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), common.Address{}, nil, 21000, big.NewInt(1), nil), signer, spammer)
+		txs[crypto.PubkeyToAddress(spammer.PublicKey)] = append(txs[crypto.PubkeyToAddress(spammer.PublicKey)], tx)
+	}
+	time.Sleep(time.Millisecond)
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{}, nil, 21000, big.NewInt(1), nil), signer, user)
+	txs[crypto.PubkeyToAddress(user.PublicKey)] = types.Transactions{tx}
+
+	copied := make(map[common.Address]types.Transactions)
+	for addr, list := range txs {
+		copied[addr] = list
+	}
+	if senders := drainOrder(t, signer, roundRobinOrdering{}.Order(signer, txs, nil)); senders[1] != crypto.PubkeyToAddress(user.PublicKey) {
+		t.Errorf("round-robin: user not included second")
+	}
+	if senders := drainOrder(t, signer, fifoOrdering{}.Order(signer, copied, nil)); senders[5] != crypto.PubkeyToAddress(user.PublicKey) {
+		t.Errorf("fifo: user not included last")
+	}
+}
+
+func TestOrderBundles(t *testing.T) {
+	bundles := []*Bundle{{BlockNumber: 0}, {BlockNumber: 1}, {BlockNumber: 2}, {BlockNumber: 3}}
+	results := []*BundleResult{
+		{GasPrice: big.NewInt(1), Profit: big.NewInt(10)},
+		{GasPrice: big.NewInt(2), Profit: big.NewInt(5)},
+		{GasPrice: big.NewInt(1), Profit: big.NewInt(20)},
+		{GasPrice: big.NewInt(3), Profit: big.NewInt(30), Err: errors.New("reverted")},
+	}
+	ordered := bundleOrdering{}.OrderBundles(bundles, results)
+
+	want := []uint64{1, 2, 0}
+	if len(ordered) != len(want) {
+		t.Fatalf("bundle count mismatch: have %d, want %d", len(ordered), len(want))
+	}
+	for i, number := range want {
+		if ordered[i].BlockNumber != number {
+			t.Errorf("bundle %d mismatch: have %d, want %d", i, ordered[i].BlockNumber, number)
+		}
+	}
+}
@@ -193,22 +193,34 @@ func (b *testWorkerBackend) newRandomTx(creation bool) *types.Transaction {
 }
 
 func newTestWorker(t *testing.T, chainConfig *params.ChainConfig, engine consensus.Engine, db ethdb.Database, blocks int) (*worker, *testWorkerBackend) {
+	return newTestWorkerWithConfig(t, testConfig, chainConfig, engine, db, blocks)
+}
+
+func newTestWorkerWithConfig(t *testing.T, config *Config, chainConfig *params.ChainConfig, engine consensus.Engine, db ethdb.Database, blocks int) (*worker, *testWorkerBackend) {
 	backend := newTestWorkerBackend(t, chainConfig, engine, db, blocks)
 	backend.txPool.AddLocals(pendingTxs)
-	w := newWorker(testConfig, chainConfig, engine, backend, new(event.TypeMux), nil, false)
+	w := newWorker(config, chainConfig, engine, backend, new(event.TypeMux), nil, false)
 	w.setEtherbase(testBankAddress)
 	return w, backend
 }
 
 func TestGenerateBlockAndImportEthash(t *testing.T) {
-	testGenerateBlockAndImport(t, false)
+	testGenerateBlockAndImport(t, false, "")
 }
 
 func TestGenerateBlockAndImportClique(t *testing.T) {
-	testGenerateBlockAndImport(t, true)
+	testGenerateBlockAndImport(t, true, "")
 }
 
-func testGenerateBlockAndImport(t *testing.T, isClique bool) {
+func TestGenerateBlockAndImportOrderings(t *testing.T) {
+	for _, ordering := range Orderings() {
+		t.Run(ordering, func(t *testing.T) {
+			testGenerateBlockAndImport(t, false, ordering)
+		})
+	}
+}
+
+func testGenerateBlockAndImport(t *testing.T, isClique bool, ordering string) {
 	var (
 		engine      consensus.Engine
 		chainConfig *params.ChainConfig
@@ -224,7 +236,10 @@ func testGenerateBlockAndImport(t *testing.T, isClique bool) {
 	}
 
 	chainConfig.LondonBlock = big.NewInt(0)
-	w, b := newTestWorker(t, chainConfig, engine, db, 0)
+
+	config := *testConfig
+	config.Ordering = ordering
+	w, b := newTestWorkerWithConfig(t, &config, chainConfig, engine, db, 0)
 	defer w.close()
 
 	// This test chain imports the mined blocks.
@@ -185,6 +185,8 @@ func (api *privateAdminAPI) StartHTTP(host *string, port *int, cors *string, api
 		CorsAllowedOrigins: api.node.config.HTTPCors,
 		Vhosts:             api.node.config.HTTPVirtualHosts,
 		Modules:            api.node.config.HTTPModules,
+		access:             api.node.rpcAccess,
+		limiter:            api.node.rpcLimiter,
 	}
 	if cors != nil {
 		config.CorsAllowedOrigins = nil
@@ -208,7 +210,8 @@ func (api *privateAdminAPI) StartHTTP(host *string, port *int, cors *string, api
 	if err := api.node.http.setListenAddr(*host, *port); err != nil {
 		return false, err
 	}
-	if err := api.node.http.enableRPC(api.node.rpcAPIs, config); err != nil {
+	open, _ := api.node.getAPIs()
+	if err := api.node.http.enableRPC(open, config); err != nil {
 		return false, err
 	}
 	if err := api.node.http.start(); err != nil {
@@ -258,6 +261,8 @@ func (api *privateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 	config := wsConfig{
 		Modules: api.node.config.WSModules,
 		Origins: api.node.config.WSOrigins,
+		access:  api.node.rpcAccess,
+		limiter: api.node.rpcLimiter,
 		// ExposeAll: api.node.config.WSExposeAll,
 	}
 	if apis != nil {
@@ -278,7 +283,8 @@ func (api *privateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 	if err := server.setListenAddr(*host, *port); err != nil {
 		return false, err
 	}
-	if err := server.enableWS(api.node.rpcAPIs, config); err != nil {
+	open, _ := api.node.getAPIs()
+	if err := server.enableWS(open, config); err != nil {
 		return false, err
 	}
 	if err := server.start(); err != nil {
@@ -45,6 +45,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the authenticated RPC secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -142,6 +143,50 @@ type Config struct {
 	// HTTPPathPrefix specifies a path prefix on which http-rpc is to be served.
 	HTTPPathPrefix string `toml:",omitempty"`
 
+	// HTTPGRPC serves the HTTP-RPC APIs over gRPC as well, on the same port, with
+	// typed messages for the methods whose types allow it and JSON tunnelled in
+	// the messages of the others. The server accepts HTTP/2 requests for it, with
+	// or without TLS.
+	HTTPGRPC bool `toml:",omitempty"`
+
+	// RPCAccess restricts the methods callable over the HTTP and WebSocket RPC
+	// interfaces by the credentials presented by clients. If nil, the exposed
+	// modules are callable by anyone.
+	RPCAccess *RPCAccessConfig `toml:",omitempty"`
+
+	// RPCRateLimits limits the calls served over the HTTP and WebSocket RPC
+	// interfaces, per client and per method. The limits are shared by the
+	// interfaces, including gRPC. If nil, calls are unlimited.
+	RPCRateLimits *rpc.RateLimitConfig `toml:",omitempty"`
+
+	// RPCAuditLog is the path of the file recording the calls served over the HTTP
+	// and WebSocket RPC interfaces, with their parameters, results and clients, as
+	// JSON lines. Relative paths are resolved in the instance directory. Calls are
+	// not recorded if empty.
+	RPCAuditLog string `toml:",omitempty"`
+
+	// RPCAuditLogMaxSize is the size in megabytes at which the audit log is rotated.
+	// It defaults to 100 megabytes if zero.
+	RPCAuditLogMaxSize int `toml:",omitempty"`
+
+	// RPCAuditLogMaxFiles is the number of rotated audit log files kept. It defaults
+	// to 10 files if zero.
+	RPCAuditLogMaxFiles int `toml:",omitempty"`
+
+	// AuthAddr is the listening address on which to start the authenticated RPC
+	// server, serving the APIs restricted to authenticated clients (and the eth
+	// namespace) over HTTP and websocket. The server is only started if any such
+	// API is registered.
+	AuthAddr string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC server.
+	AuthPort int `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded secret used to authenticate clients
+	// of the authenticated RPC server. If empty, a new secret is generated in the
+	// data directory.
+	JWTSecret string `toml:",omitempty"`
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string
@@ -0,0 +1,131 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwtExpiryTimeout is the maximum allowed difference between the issuance time
+// of a token and the local time.
+const jwtExpiryTimeout = 5 * time.Second
+
+var (
+	errJWTMissing   = errors.New("missing token")
+	errJWTMalformed = errors.New("malformed token")
+	errJWTAlgorithm = errors.New("unsupported signing algorithm")
+	errJWTSignature = errors.New("invalid token signature")
+	errJWTStale     = errors.New("stale token")
+)
+
+// jwtHandler is an http.Handler which only lets requests through which carry a
+// HS256 signed JSON web token, issued recently with the shared secret.
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+}
+
+// newJWTHandler wraps the given handler with JWT authentication.
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{secret: secret, next: next}
+}
+
+// ServeHTTP implements http.Handler.
+func (handler *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		httpError(w, r, errJWTMissing.Error(), http.StatusForbidden)
+		return
+	}
+	if err := verifyJWT(handler.secret, strings.TrimPrefix(auth, "Bearer "), time.Now()); err != nil {
+		httpError(w, r, err.Error(), http.StatusForbidden)
+		return
+	}
+	handler.next.ServeHTTP(w, r)
+}
+
+// verifyJWT checks that the token is signed with the secret using HS256, and that
+// its issuance time is close enough to the given one.
+func verifyJWT(secret []byte, token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return err
+	}
+	if header.Alg != "HS256" {
+		return errJWTAlgorithm
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errJWTMalformed
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errJWTSignature
+	}
+	var claims struct {
+		IssuedAt *int64 `json:"iat"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return err
+	}
+	if claims.IssuedAt == nil {
+		return errJWTMalformed
+	}
+	if diff := now.Sub(time.Unix(*claims.IssuedAt, 0)); diff > jwtExpiryTimeout || diff < -jwtExpiryTimeout {
+		return errJWTStale
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64 encoded JSON part of a token.
+func decodeJWTPart(part string, v interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if err := json.NewDecoder(bytes.NewReader(blob)).Decode(v); err != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+// NewJWTToken creates a HS256 signed JSON web token issued at the given time,
+// as expected by the authenticated RPC endpoint.
+func NewJWTToken(secret []byte, issued time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]int64{"iat": issued.Unix()})
+	token := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return token + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	var (
+		secret = []byte("0123456789abcdef0123456789abcdef")
+		now    = time.Unix(1600000000, 0)
+	)
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{NewJWTToken(secret, now), nil},
+		{NewJWTToken(secret, now.Add(-4*time.Second)), nil},
+		{NewJWTToken(secret, now.Add(4*time.Second)), nil},
+		{NewJWTToken(secret, now.Add(-6*time.Second)), errJWTStale},
+		{NewJWTToken(secret, now.Add(6*time.Second)), errJWTStale},
+		{NewJWTToken([]byte("other secret"), now), errJWTSignature},
+		{"eyJhbGciOiJub25lIn0.eyJpYXQiOjE2MDAwMDAwMDB9.", errJWTAlgorithm},
+		{"not a token", errJWTMalformed},
+		{"a.b.c", errJWTMalformed},
+	}
+	for i, test := range tests {
+		if err := verifyJWT(secret, test.token, now); err != test.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestJWTHandler(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	handler := newJWTHandler(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusForbidden},
+		{"Basic Zm9vOmJhcg==", http.StatusForbidden},
+		{"Bearer " + NewJWTToken([]byte("other secret"), time.Now()), http.StatusForbidden},
+		{"Bearer " + NewJWTToken(secret, time.Now()), http.StatusOK},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("test %d: status code mismatch: have %d, want %d", i, rec.Code, test.code)
+		}
+	}
+}
@@ -17,8 +17,10 @@
 package node
 
 import (
+	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -27,6 +29,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -43,6 +46,7 @@ type Node struct {
 	accman        *accounts.Manager
 	log           log.Logger
 	ephemKeystore string            // if non-empty, the key directory that will be removed by Stop
+	ephemJWT      string            // if non-empty, the JWT secret file that will be removed by Stop
 	dirLock       fileutil.Releaser // prevents concurrent use of instance directory
 	stop          chan struct{}     // Channel to wait for termination notifications
 	server        *p2p.Server       // Currently running P2P networking layer
@@ -50,12 +54,16 @@ type Node struct {
 	state         int               // Tracks state of node lifecycle
 
 	lock          sync.Mutex
-	lifecycles    []Lifecycle // All registered backends, services, and auxiliary services that have a lifecycle
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	http          *httpServer //
-	ws            *httpServer //
-	ipc           *ipcServer  // Stores information about the ipc http server
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	lifecycles    []Lifecycle       // All registered backends, services, and auxiliary services that have a lifecycle
+	rpcAPIs       []rpc.API         // List of APIs currently provided by the node
+	http          *httpServer       //
+	ws            *httpServer       //
+	httpAuth      *httpServer       // Stores information about the authenticated http and ws server
+	rpcAccess     *RPCAccessControl // Access control of the http and ws servers, if configured
+	rpcAudit      *rpc.AuditFile    // Records the calls of the http and ws servers, if configured
+	rpcLimiter    *rpc.RateLimiter  // Rate limits shared by the http and ws servers, if configured
+	ipc           *ipcServer        // Stores information about the ipc http server
+	inprocHandler *rpc.Server       // In-process RPC request handler to process the API requests
 
 	databases map[*closeTrackingDB]struct{} // All open databases
 }
@@ -94,6 +102,11 @@ func New(conf *Config) (*Node, error) {
 	if strings.HasSuffix(conf.Name, ".ipc") {
 		return nil, errors.New(`Config.Name cannot end in ".ipc"`)
 	}
+	if conf.RPCRateLimits != nil {
+		if err := conf.RPCRateLimits.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RPC rate limits: %v", err)
+		}
+	}
 
 	node := &Node{
 		config:        conf,
@@ -146,11 +159,48 @@ func New(conf *Config) (*Node, error) {
 	// Configure RPC servers.
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
+	node.httpAuth = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
 
+	if conf.RPCAccess != nil {
+		if node.rpcAccess, err = NewRPCAccessControl(conf.RPCAccess); err != nil {
+			return nil, err
+		}
+		node.http.tls, node.ws.tls = node.rpcAccess.tls, node.rpcAccess.tls
+	}
+	if conf.RPCAuditLog != "" {
+		if node.rpcAudit, err = node.openAuditLog(); err != nil {
+			return nil, err
+		}
+	}
+	if conf.RPCRateLimits != nil {
+		node.rpcLimiter = rpc.NewRateLimiter(*conf.RPCRateLimits)
+	}
+
 	return node, nil
 }
 
+// openAuditLog opens the audit log of the RPC calls.
+func (n *Node) openAuditLog() (*rpc.AuditFile, error) {
+	path := n.config.ResolvePath(n.config.RPCAuditLog)
+	if path == "" {
+		path = n.config.RPCAuditLog
+	}
+	maxSize, maxFiles := n.config.RPCAuditLogMaxSize, n.config.RPCAuditLogMaxFiles
+	if maxSize == 0 {
+		maxSize = 100
+	}
+	if maxFiles == 0 {
+		maxFiles = 10
+	}
+	audit, err := rpc.OpenAuditFile(path, int64(maxSize)*1024*1024, maxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RPC audit log: %v", err)
+	}
+	n.log.Info("Recording RPC calls", "path", path)
+	return audit, nil
+}
+
 // Start starts all registered lifecycles, RPC services and p2p networking.
 // Node can only be started once.
 func (n *Node) Start() error {
@@ -233,11 +283,21 @@ func (n *Node) doClose(errs []error) error {
 	if err := n.accman.Close(); err != nil {
 		errs = append(errs, err)
 	}
+	if n.rpcAudit != nil {
+		if err := n.rpcAudit.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if n.ephemKeystore != "" {
 		if err := os.RemoveAll(n.ephemKeystore); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	if n.ephemJWT != "" {
+		if err := os.Remove(n.ephemJWT); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	// Release instance directory lock.
 	n.closeDataDir()
@@ -341,9 +401,11 @@ func (n *Node) startRPC() error {
 		return err
 	}
 
+	open, auth := n.getAPIs()
+
 	// Configure IPC.
 	if n.ipc.endpoint != "" {
-		if err := n.ipc.start(n.rpcAPIs); err != nil {
+		if err := n.ipc.start(open); err != nil {
 			return err
 		}
 	}
@@ -355,11 +417,15 @@ func (n *Node) startRPC() error {
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
 			prefix:             n.config.HTTPPathPrefix,
+			access:             n.rpcAccess,
+			limiter:            n.rpcLimiter,
+			audit:              n.auditLog(),
+			grpc:               n.config.HTTPGRPC,
 		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
 			return err
 		}
-		if err := n.http.enableRPC(n.rpcAPIs, config); err != nil {
+		if err := n.http.enableRPC(open, config); err != nil {
 			return err
 		}
 	}
@@ -371,21 +437,118 @@ func (n *Node) startRPC() error {
 			Modules: n.config.WSModules,
 			Origins: n.config.WSOrigins,
 			prefix:  n.config.WSPathPrefix,
+			access:  n.rpcAccess,
+			limiter: n.rpcLimiter,
+			audit:   n.auditLog(),
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
 		}
-		if err := server.enableWS(n.rpcAPIs, config); err != nil {
+		if err := server.enableWS(open, config); err != nil {
 			return err
 		}
 	}
 
+	// Configure the authenticated endpoint, if any API is restricted to it.
+	if n.config.AuthAddr != "" && len(auth) > 0 {
+		if err := n.startAuth(auth); err != nil {
+			return err
+		}
+	}
 	if err := n.http.start(); err != nil {
 		return err
 	}
 	return n.ws.start()
 }
 
+// startAuth configures the JSON-RPC over HTTP and WebSocket endpoint serving the
+// given APIs to clients authenticated with the JWT secret.
+func (n *Node) startAuth(apis []rpc.API) error {
+	secret, err := n.obtainJWTSecret()
+	if err != nil {
+		return err
+	}
+	var modules []string
+	for _, api := range apis {
+		modules = append(modules, api.Namespace)
+	}
+	if err := n.httpAuth.setListenAddr(n.config.AuthAddr, n.config.AuthPort); err != nil {
+		return err
+	}
+	// Access is guarded by the secret, so don't restrict hosts and origins
+	if err := n.httpAuth.enableRPC(apis, httpConfig{Modules: modules, Vhosts: []string{"*"}, jwtSecret: secret}); err != nil {
+		return err
+	}
+	if err := n.httpAuth.enableWS(apis, wsConfig{Modules: modules, Origins: []string{"*"}, jwtSecret: secret}); err != nil {
+		return err
+	}
+	return n.httpAuth.start()
+}
+
+// obtainJWTSecret loads the hex encoded JWT secret from the configured file. If
+// none is configured, the secret is loaded from the data directory, or generated
+// if not yet existing. Nodes without a data directory generate a new secret on
+// every start, written to a temporary file for the clients to pick it up.
+func (n *Node) obtainJWTSecret() ([]byte, error) {
+	path := n.config.JWTSecret
+	if path == "" {
+		path = n.config.ResolvePath(datadirJWTSecret)
+	}
+	if path != "" {
+		if blob, err := ioutil.ReadFile(path); err == nil {
+			secret, err := hexutil.Decode("0x" + strings.TrimPrefix(strings.TrimSpace(string(blob)), "0x"))
+			if err != nil || len(secret) != 32 {
+				return nil, fmt.Errorf("invalid JWT secret in %s", path)
+			}
+			return secret, nil
+		} else if n.config.JWTSecret != "" {
+			return nil, err
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := crand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate JWT secret: %v", err)
+	}
+	if path == "" {
+		file, err := ioutil.TempFile("", datadirJWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		path = file.Name()
+		file.Close()
+		n.ephemJWT = path
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	n.log.Info("Generated JWT secret", "path", path)
+	return secret, nil
+}
+
+// getAPIs returns the APIs which may be served to any client, and the ones to be
+// served on the authenticated endpoint. The latter is empty unless any API is
+// restricted to authenticated clients, in which case the eth namespace is served
+// there too.
+func (n *Node) getAPIs() (open, auth []rpc.API) {
+	var authenticated bool
+	for _, api := range n.rpcAPIs {
+		if api.Authenticated {
+			authenticated = true
+		} else {
+			open = append(open, api)
+		}
+	}
+	if !authenticated {
+		return open, nil
+	}
+	for _, api := range n.rpcAPIs {
+		if api.Authenticated || api.Namespace == "eth" {
+			auth = append(auth, api)
+		}
+	}
+	return open, auth
+}
+
 func (n *Node) wsServerForPort(port int) *httpServer {
 	if n.config.HTTPHost == "" || n.http.port == port {
 		return n.http
@@ -396,6 +559,7 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
+	n.httpAuth.stop()
 	n.ipc.stop()
 	n.stopInProc()
 }
@@ -527,15 +691,35 @@ func (n *Node) IPCEndpoint() string {
 // HTTPEndpoint returns the URL of the HTTP server. Note that this URL does not
 // contain the JSON-RPC path prefix set by HTTPPathPrefix.
 func (n *Node) HTTPEndpoint() string {
-	return "http://" + n.http.listenAddr()
+	return n.http.scheme("http") + "://" + n.http.listenAddr()
+}
+
+// HTTPAuthEndpoint returns the URL of the authenticated HTTP server.
+func (n *Node) HTTPAuthEndpoint() string {
+	return "http://" + n.httpAuth.listenAddr()
 }
 
 // WSEndpoint returns the current JSON-RPC over WebSocket endpoint.
 func (n *Node) WSEndpoint() string {
 	if n.http.wsAllowed() {
-		return "ws://" + n.http.listenAddr() + n.http.wsConfig.prefix
+		return n.http.scheme("ws") + "://" + n.http.listenAddr() + n.http.wsConfig.prefix
+	}
+	return n.ws.scheme("ws") + "://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
+}
+
+// auditLog returns the audit log of the RPC calls, or nil if not configured.
+func (n *Node) auditLog() rpc.AuditLog {
+	if n.rpcAudit == nil {
+		return nil // avoid a non-nil interface holding a nil pointer
 	}
-	return "ws://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
+	return n.rpcAudit
+}
+
+// RPCAccessControl retrieves the access control of the HTTP and WebSocket RPC
+// endpoints, or nil if not configured. Custom authenticators may be added to it
+// before the node is started.
+func (n *Node) RPCAccessControl() *RPCAccessControl {
+	return n.rpcAccess
 }
 
 // EventMux retrieves the event multiplexer used by all the network services in
@@ -17,6 +17,8 @@
 package node
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -591,6 +593,72 @@ func (test rpcPrefixTest) check(t *testing.T, node *Node) {
 	}
 }
 
+// Tests that the calls served over HTTP are recorded in the audit log.
+func TestRPCAuditLog(t *testing.T) {
+	conf := &Config{
+		DataDir:     t.TempDir(),
+		HTTPHost:    "127.0.0.1",
+		RPCAuditLog: "rpcaudit.log",
+	}
+	node, err := New(conf)
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	if err := node.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	resp := rpcRequest(t, node.HTTPEndpoint())
+	resp.Body.Close()
+	node.Close()
+
+	data, err := ioutil.ReadFile(conf.ResolvePath("rpcaudit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec rpc.AuditRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("invalid audit log %q: %v", data, err)
+	}
+	assert.Equal(t, "rpc_modules", rec.Method)
+	assert.Equal(t, "127.0.0.1", rec.Client)
+	assert.Contains(t, string(rec.Result), `"rpc":"1.0"`)
+}
+
+// Tests that generated JWT secrets are stored privately, in the data directory or
+// a temporary file removed once the node is closed.
+func TestJWTSecretGeneration(t *testing.T) {
+	for _, datadir := range []string{t.TempDir(), ""} {
+		node, err := New(&Config{DataDir: datadir})
+		if err != nil {
+			t.Fatalf("could not create a new node: %v", err)
+		}
+		secret, err := node.obtainJWTSecret()
+		if err != nil {
+			t.Fatalf("could not obtain JWT secret: %v", err)
+		}
+		path := node.config.ResolvePath(datadirJWTSecret)
+		if datadir == "" {
+			path = node.ephemJWT
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("JWT secret not stored: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("JWT secret file mode mismatch: have %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+		if datadir != "" {
+			if again, err := node.obtainJWTSecret(); err != nil || !bytes.Equal(again, secret) {
+				t.Errorf("stored JWT secret not reused: %x, %v", again, err)
+			}
+		}
+		node.Close()
+		if _, err := os.Stat(path); datadir == "" && !os.IsNotExist(err) {
+			t.Errorf("temporary JWT secret not removed: %v", err)
+		}
+	}
+}
+
 func createNode(t *testing.T, httpPort, wsPort int) *Node {
 	conf := &Config{
 		HTTPHost: "127.0.0.1",
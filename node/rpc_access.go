@@ -0,0 +1,320 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// apiKeyHeader is the HTTP header carrying API keys.
+const apiKeyHeader = "X-API-Key"
+
+var (
+	errInvalidAPIKey     = errors.New("invalid API key")
+	errUnknownClientCert = errors.New("unknown client certificate")
+)
+
+// RPCAccessConfig configures the authentication of HTTP and WebSocket RPC clients.
+type RPCAccessConfig struct {
+	// Public is the list of methods callable without credentials. Unauthenticated
+	// clients can't call any method if empty.
+	Public []string `toml:",omitempty"`
+
+	// Credentials are the credentials accepted from clients.
+	Credentials []RPCCredential `toml:",omitempty"`
+
+	// TLSCert and TLSKey are the paths of the PEM encoded certificate and key to
+	// serve the HTTP and WebSocket endpoints over TLS with. TLS is required to
+	// authenticate clients by their certificates.
+	TLSCert string `toml:",omitempty"`
+	TLSKey  string `toml:",omitempty"`
+
+	// ClientCA is the path of the PEM encoded certificates of the authorities
+	// issuing client certificates.
+	ClientCA string `toml:",omitempty"`
+}
+
+// RPCCredential is a credential accepted from RPC clients, allowing them to call
+// the listed methods. Methods are given as namespace_method, namespace_* matches
+// all methods of a namespace and * matches all methods.
+//
+// A credential is presented either as an API key, as a bearer token signed with
+// a JWT secret, or as a client certificate. Credentials with none of these set
+// can only be presented to authenticators added by AddAuthenticator.
+type RPCCredential struct {
+	Name    string   // Name identifying the credential
+	Methods []string // Methods callable with the credential
+
+	APIKey     string `toml:",omitempty"` // Key sent in the X-API-Key header
+	JWTSecret  string `toml:",omitempty"` // Hex encoded secret signing HS256 bearer tokens
+	ClientName string `toml:",omitempty"` // Subject common name of the client certificate
+}
+
+// RPCAuthenticator identifies the credential presented with an RPC request.
+type RPCAuthenticator interface {
+	// Authenticate returns the name of the credential presented with the request,
+	// or an empty name if the request carries no credential handled by the
+	// authenticator. Invalid credentials are reported as an error.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// RPCAccessControl authenticates HTTP and WebSocket RPC clients, restricting them
+// to the methods allowed for their credentials.
+type RPCAccessControl struct {
+	auths   []RPCAuthenticator
+	methods map[string]methodSet // Allowed methods by credential name
+	public  methodSet            // Methods allowed without credentials
+	tls     *tls.Config          // TLS configuration of the endpoints, if any
+}
+
+// NewRPCAccessControl creates the access control for the given configuration.
+func NewRPCAccessControl(config *RPCAccessConfig) (*RPCAccessControl, error) {
+	ac := &RPCAccessControl{
+		methods: make(map[string]methodSet),
+		public:  newMethodSet(config.Public),
+	}
+	var (
+		keys    = new(apiKeyAuthenticator)
+		tokens  = new(jwtAuthenticator)
+		clients = &certAuthenticator{names: make(map[string]string)}
+	)
+	for _, cred := range config.Credentials {
+		if cred.Name == "" {
+			return nil, errors.New("RPC credential without name")
+		}
+		if _, ok := ac.methods[cred.Name]; ok {
+			return nil, fmt.Errorf("duplicate RPC credential %q", cred.Name)
+		}
+		ac.methods[cred.Name] = newMethodSet(cred.Methods)
+
+		if cred.APIKey != "" {
+			keys.keys = append(keys.keys, namedSecret{[]byte(cred.APIKey), cred.Name})
+		}
+		if cred.JWTSecret != "" {
+			secret, err := hexutil.Decode("0x" + strings.TrimPrefix(cred.JWTSecret, "0x"))
+			if err != nil || len(secret) != 32 {
+				return nil, fmt.Errorf("invalid JWT secret of RPC credential %q", cred.Name)
+			}
+			tokens.secrets = append(tokens.secrets, namedSecret{secret, cred.Name})
+		}
+		if cred.ClientName != "" {
+			clients.names[cred.ClientName] = cred.Name
+		}
+	}
+	if config.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("can't load RPC TLS certificate: %v", err)
+		}
+		ac.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if config.ClientCA != "" {
+		if ac.tls == nil {
+			return nil, errors.New("RPC client certificates require a TLS certificate")
+		}
+		blob, err := ioutil.ReadFile(config.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(blob) {
+			return nil, fmt.Errorf("no certificates in %s", config.ClientCA)
+		}
+		ac.tls.ClientCAs = pool
+		ac.tls.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if len(clients.names) > 0 && (ac.tls == nil || ac.tls.ClientCAs == nil) {
+		return nil, errors.New("RPC client certificates require a client CA")
+	}
+	if len(keys.keys) > 0 {
+		ac.auths = append(ac.auths, keys)
+	}
+	if len(tokens.secrets) > 0 {
+		ac.auths = append(ac.auths, tokens)
+	}
+	if len(clients.names) > 0 {
+		ac.auths = append(ac.auths, clients)
+	}
+	return ac, nil
+}
+
+// AddAuthenticator adds a custom authenticator, consulted after the built-in ones.
+// The credentials it returns must be configured by name. It must be called before
+// the RPC endpoints are started.
+func (ac *RPCAccessControl) AddAuthenticator(auth RPCAuthenticator) {
+	ac.auths = append(ac.auths, auth)
+}
+
+// authenticate returns the name of the credential presented with the request,
+// and the methods its client may call.
+func (ac *RPCAccessControl) authenticate(r *http.Request) (string, methodSet, error) {
+	for _, auth := range ac.auths {
+		name, err := auth.Authenticate(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if name == "" {
+			continue
+		}
+		methods, ok := ac.methods[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown credential %q", name)
+		}
+		return name, methods, nil
+	}
+	return "", ac.public, nil
+}
+
+// handler wraps the given RPC handler, restricting the calls of each client to
+// the methods allowed for its credential. Authenticated clients are identified
+// by the name of their credential, e.g. for rate limiting. Requests with invalid
+// credentials are rejected with a JSON-RPC error, or the UNAUTHENTICATED status
+// for gRPC calls.
+func (ac *RPCAccessControl) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, methods, err := ac.authenticate(r)
+		if err != nil && isGRPC(r) {
+			rpc.GRPCError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   map[string]interface{}{"code": -32000, "message": err.Error()},
+			})
+			return
+		}
+		ctx := rpc.WithMethodFilter(r.Context(), methods.contains)
+		if name != "" {
+			ctx = rpc.WithClientName(ctx, name)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// methodSet is a set of method names and namespace wildcards.
+type methodSet map[string]struct{}
+
+func newMethodSet(methods []string) methodSet {
+	set := make(methodSet, len(methods))
+	for _, method := range methods {
+		set[strings.TrimSpace(method)] = struct{}{}
+	}
+	return set
+}
+
+// contains reports whether the method is in the set.
+func (set methodSet) contains(method string) bool {
+	if _, ok := set["*"]; ok {
+		return true
+	}
+	if _, ok := set[method]; ok {
+		return true
+	}
+	if i := strings.IndexByte(method, '_'); i >= 0 {
+		_, ok := set[method[:i]+"_*"]
+		return ok
+	}
+	return false
+}
+
+// namedSecret is a secret identifying a credential.
+type namedSecret struct {
+	secret []byte
+	name   string
+}
+
+// apiKeyAuthenticator authenticates requests by the API key in their headers.
+type apiKeyAuthenticator struct {
+	keys []namedSecret
+}
+
+// Authenticate implements RPCAuthenticator.
+func (auth *apiKeyAuthenticator) Authenticate(r *http.Request) (string, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return "", nil
+	}
+	for _, k := range auth.keys {
+		if subtle.ConstantTimeCompare(k.secret, []byte(key)) == 1 {
+			return k.name, nil
+		}
+	}
+	return "", errInvalidAPIKey
+}
+
+// jwtAuthenticator authenticates requests by the bearer token in their headers,
+// identifying the credential by the secret the token is signed with.
+type jwtAuthenticator struct {
+	secrets []namedSecret
+}
+
+// Authenticate implements RPCAuthenticator.
+func (auth *jwtAuthenticator) Authenticate(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", nil
+	}
+	var (
+		token = strings.TrimPrefix(header, "Bearer ")
+		now   = time.Now()
+	)
+	for _, s := range auth.secrets {
+		switch err := verifyJWT(s.secret, token, now); err {
+		case nil:
+			return s.name, nil
+		case errJWTSignature:
+			continue
+		default:
+			return "", err
+		}
+	}
+	return "", errJWTSignature
+}
+
+// certAuthenticator authenticates requests by the common name of the verified
+// client certificate of the connection.
+type certAuthenticator struct {
+	names map[string]string // Credential names by certificate common name
+}
+
+// Authenticate implements RPCAuthenticator.
+func (auth *certAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", nil
+	}
+	name, ok := auth.names[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	if !ok {
+		return "", errUnknownClientCert
+	}
+	return name, nil
+}
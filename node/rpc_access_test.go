@@ -0,0 +1,219 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/http2"
+)
+
+type accessTestService struct{}
+
+func (accessTestService) Ping() string { return "pong" }
+
+func TestMethodSet(t *testing.T) {
+	set := newMethodSet([]string{"eth_blockNumber", "debug_*"})
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"eth_blockNumber", true},
+		{"eth_call", false},
+		{"debug_traceTransaction", true},
+		{"debugx_trace", false},
+		{"admin_peers", false},
+	}
+	for _, test := range tests {
+		if have := set.contains(test.method); have != test.want {
+			t.Errorf("%s: have %v, want %v", test.method, have, test.want)
+		}
+	}
+	if !newMethodSet([]string{"*"}).contains("admin_peers") {
+		t.Error("wildcard doesn't match all methods")
+	}
+}
+
+// Tests that HTTP clients can only call the methods allowed for their credentials.
+func TestRPCAccessControl(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	access, err := NewRPCAccessControl(&RPCAccessConfig{
+		Public: []string{"eth_ping"},
+		Credentials: []RPCCredential{
+			{Name: "internal", APIKey: "internal-key", Methods: []string{"*"}},
+			{Name: "tracer", JWTSecret: hexutil.Encode(secret), Methods: []string{"debug_*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create access control: %v", err)
+	}
+	apis := []rpc.API{
+		{Namespace: "eth", Service: accessTestService{}},
+		{Namespace: "debug", Service: accessTestService{}},
+	}
+	srv := newHTTPServer(testlog.Logger(t, log.LvlDebug), rpc.DefaultHTTPTimeouts)
+	if err := srv.enableRPC(apis, httpConfig{Modules: []string{"eth", "debug"}, access: access}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.setListenAddr("localhost", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.stop()
+
+	tests := []struct {
+		header, value string
+		allowed       map[string]bool
+		status        int
+	}{
+		{"", "", map[string]bool{"eth_ping": true, "debug_ping": false}, 0},
+		{apiKeyHeader, "internal-key", map[string]bool{"eth_ping": true, "debug_ping": true}, 0},
+		{apiKeyHeader, "wrong-key", nil, http.StatusUnauthorized},
+		{"Authorization", "Bearer " + NewJWTToken(secret, time.Now()), map[string]bool{"eth_ping": false, "debug_ping": true}, 0},
+		{"Authorization", "Bearer " + NewJWTToken([]byte("another secret"), time.Now()), nil, http.StatusUnauthorized},
+	}
+	for i, test := range tests {
+		client, err := rpc.DialHTTP("http://" + srv.listenAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.header != "" {
+			client.SetHeader(test.header, test.value)
+		}
+		if test.status != 0 {
+			err := client.Call(nil, "eth_ping")
+			if httpErr, ok := err.(rpc.HTTPError); !ok || httpErr.StatusCode != test.status {
+				t.Errorf("test %d: error mismatch: have %v, want status %d", i, err, test.status)
+			}
+		}
+		for method, allowed := range test.allowed {
+			var result string
+			err := client.Call(&result, method)
+			if allowed && err != nil {
+				t.Errorf("test %d: %s failed: %v", i, method, err)
+			}
+			if !allowed {
+				if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != -32004 {
+					t.Errorf("test %d: %s not denied: %v", i, method, err)
+				}
+			}
+		}
+		client.Close()
+	}
+}
+
+// Tests that gRPC calls are subject to the access control, and that rejected
+// calls are answered with a gRPC status.
+func TestRPCAccessControlGRPC(t *testing.T) {
+	access, err := NewRPCAccessControl(&RPCAccessConfig{
+		Public:      []string{"eth_ping"},
+		Credentials: []RPCCredential{{Name: "internal", APIKey: "internal-key", Methods: []string{"*"}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create access control: %v", err)
+	}
+	apis := []rpc.API{
+		{Namespace: "eth", Service: accessTestService{}},
+		{Namespace: "debug", Service: accessTestService{}},
+	}
+	srv := newHTTPServer(testlog.Logger(t, log.LvlDebug), rpc.DefaultHTTPTimeouts)
+	if err := srv.enableRPC(apis, httpConfig{Modules: []string{"eth", "debug"}, access: access, grpc: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.setListenAddr("localhost", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.stop()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	tests := []struct {
+		path, key string
+		status    string
+		body      string
+	}{
+		{"/geth.Eth/Ping", "", "0", "pong"},
+		{"/geth.Debug/Ping", "", "0", "method debug_ping is not allowed"},
+		{"/geth.Debug/Ping", "internal-key", "0", "pong"},
+		{"/geth.Eth/Ping", "wrong-key", "16", ""},
+	}
+	for i, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+srv.listenAddr()+test.path, bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("content-type", "application/grpc")
+		if test.key != "" {
+			req.Header.Set(apiKeyHeader, test.key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("test %d: request failed: %v", i, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		status := resp.Trailer.Get("grpc-status")
+		if status == "" {
+			status = resp.Header.Get("grpc-status")
+		}
+		if resp.StatusCode != http.StatusOK || status != test.status {
+			t.Errorf("test %d: have HTTP status %d, gRPC status %q, want gRPC status %s", i, resp.StatusCode, status, test.status)
+		}
+		if !strings.Contains(string(body), test.body) {
+			t.Errorf("test %d: response %q misses %q", i, body, test.body)
+		}
+	}
+}
+
+// Tests that clients are identified by the common name of their certificates.
+func TestCertAuthenticator(t *testing.T) {
+	auth := &certAuthenticator{names: map[string]string{"ops.internal": "ops"}}
+
+	request := func(name string) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		return &http.Request{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	}
+	if name, err := auth.Authenticate(request("ops.internal")); name != "ops" || err != nil {
+		t.Errorf("known certificate: have %q, %v", name, err)
+	}
+	if _, err := auth.Authenticate(request("unknown")); err != errUnknownClientCert {
+		t.Errorf("unknown certificate: have %v, want %v", err, errUnknownClientCert)
+	}
+	if name, err := auth.Authenticate(&http.Request{}); name != "" || err != nil {
+		t.Errorf("plain connection: have %q, %v", name, err)
+	}
+}
@@ -19,6 +19,7 @@ package node
 import (
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -32,6 +33,8 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/rs/cors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // httpConfig is the JSON-RPC/HTTP configuration.
@@ -39,19 +42,29 @@ type httpConfig struct {
 	Modules            []string
 	CorsAllowedOrigins []string
 	Vhosts             []string
-	prefix             string // path prefix on which to mount http handler
+	prefix             string            // path prefix on which to mount http handler
+	jwtSecret          []byte            // optional JWT secret to authenticate requests with
+	access             *RPCAccessControl // optional per-client access control
+	limiter            *rpc.RateLimiter  // optional rate limits of the calls
+	audit              rpc.AuditLog      // optional log recording the calls
+	grpc               bool              // serve the APIs over gRPC as well
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
 type wsConfig struct {
-	Origins []string
-	Modules []string
-	prefix  string // path prefix on which to mount ws handler
+	Origins   []string
+	Modules   []string
+	prefix    string            // path prefix on which to mount ws handler
+	jwtSecret []byte            // optional JWT secret to authenticate requests with
+	access    *RPCAccessControl // optional per-client access control
+	limiter   *rpc.RateLimiter  // optional rate limits of the calls
+	audit     rpc.AuditLog      // optional log recording the calls
 }
 
 type rpcHandler struct {
 	http.Handler
 	server *rpc.Server
+	grpc   http.Handler // non-nil when gRPC is enabled
 }
 
 type httpServer struct {
@@ -62,6 +75,7 @@ type httpServer struct {
 	mu       sync.Mutex
 	server   *http.Server
 	listener net.Listener // non-nil when server is running
+	tls      *tls.Config  // serves over TLS if non-nil
 
 	// HTTP RPC handler things.
 
@@ -131,6 +145,18 @@ func (h *httpServer) start() error {
 		h.server.WriteTimeout = h.timeouts.WriteTimeout
 		h.server.IdleTimeout = h.timeouts.IdleTimeout
 	}
+	// gRPC requires HTTP/2, which is served without TLS as well.
+	tlsConfig := h.tls
+	if h.grpcAllowed() {
+		if err := http2.ConfigureServer(h.server, nil); err != nil {
+			return err
+		}
+		h.server.Handler = h2c.NewHandler(h, &http2.Server{IdleTimeout: h.timeouts.IdleTimeout})
+		if tlsConfig != nil {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.NextProtos = append([]string{"h2"}, tlsConfig.NextProtos...)
+		}
+	}
 
 	// Start the server.
 	listener, err := net.Listen("tcp", h.endpoint)
@@ -141,11 +167,14 @@ func (h *httpServer) start() error {
 		h.disableWS()
 		return err
 	}
+	if h.tls != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 	h.listener = listener
 	go h.server.Serve(listener)
 
 	if h.wsAllowed() {
-		url := fmt.Sprintf("ws://%v", listener.Addr())
+		url := fmt.Sprintf("%s://%v", h.scheme("ws"), listener.Addr())
 		if h.wsConfig.prefix != "" {
 			url += h.wsConfig.prefix
 		}
@@ -162,6 +191,9 @@ func (h *httpServer) start() error {
 		"cors", strings.Join(h.httpConfig.CorsAllowedOrigins, ","),
 		"vhosts", strings.Join(h.httpConfig.Vhosts, ","),
 	)
+	if h.grpcAllowed() {
+		h.log.Info("gRPC enabled", "url", h.scheme("http")+"://"+listener.Addr().String(), "definition", h.grpcDefinitionPath())
+	}
 
 	// Log all handlers mounted on server.
 	var paths []string
@@ -173,7 +205,7 @@ func (h *httpServer) start() error {
 	for _, path := range paths {
 		name := h.handlerNames[path]
 		if !logged[name] {
-			log.Info(name+" enabled", "url", "http://"+listener.Addr().String()+path)
+			log.Info(name+" enabled", "url", h.scheme("http")+"://"+listener.Addr().String()+path)
 			logged[name] = true
 		}
 	}
@@ -181,17 +213,21 @@ func (h *httpServer) start() error {
 }
 
 func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// check if ws request and serve if ws enabled
+	// check if ws request and serve if ws enabled. Requests to other paths may
+	// be served by the handlers in the mux, e.g. GraphQL subscriptions.
 	ws := h.wsHandler.Load().(*rpcHandler)
-	if ws != nil && isWebsocket(r) {
-		if checkPath(r, h.wsConfig.prefix) {
-			ws.ServeHTTP(w, r)
-		}
+	if ws != nil && isWebsocket(r) && checkPath(r, h.wsConfig.prefix) {
+		ws.ServeHTTP(w, r)
 		return
 	}
 	// if http-rpc is enabled, try to serve request
 	rpc := h.httpHandler.Load().(*rpcHandler)
 	if rpc != nil {
+		// gRPC calls are routed by their method path, not by the prefix.
+		if rpc.grpc != nil && (isGRPC(r) || r.Method == http.MethodGet && r.URL.Path == h.grpcDefinitionPath()) {
+			rpc.grpc.ServeHTTP(w, r)
+			return
+		}
 		// First try to route in the mux.
 		// Requests to a path below root are handled by the mux,
 		// which has all the handlers registered via Node.RegisterHandler.
@@ -210,6 +246,14 @@ func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
+// scheme returns the URL scheme of the server for the given base protocol.
+func (h *httpServer) scheme(base string) string {
+	if h.tls != nil {
+		return base + "s"
+	}
+	return base
+}
+
 // checkPath checks whether a given request URL matches a given path prefix.
 func checkPath(r *http.Request, path string) bool {
 	// if no prefix has been specified, request URL must be on root
@@ -283,10 +327,28 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	if config.limiter != nil {
+		srv.SetRateLimiter(config.limiter)
+	}
+	if config.audit != nil {
+		srv.SetAuditLog(config.audit)
+	}
+	handler := NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts, config.access)
+	if config.jwtSecret != nil {
+		handler = newJWTHandler(config.jwtSecret, handler)
+	}
+	var grpc http.Handler
+	if config.grpc {
+		grpc = newGRPCHandlerStack(srv, config.Vhosts, config.access)
+		if config.jwtSecret != nil {
+			grpc = newJWTHandler(config.jwtSecret, grpc)
+		}
+	}
 	h.httpConfig = config
 	h.httpHandler.Store(&rpcHandler{
-		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
+		Handler: handler,
 		server:  srv,
+		grpc:    grpc,
 	})
 	return nil
 }
@@ -315,9 +377,22 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	if config.limiter != nil {
+		srv.SetRateLimiter(config.limiter)
+	}
+	if config.audit != nil {
+		srv.SetAuditLog(config.audit)
+	}
+	handler := srv.WebsocketHandler(config.Origins)
+	if config.access != nil {
+		handler = config.access.handler(handler)
+	}
+	if config.jwtSecret != nil {
+		handler = newJWTHandler(config.jwtSecret, handler)
+	}
 	h.wsConfig = config
 	h.wsHandler.Store(&rpcHandler{
-		Handler: srv.WebsocketHandler(config.Origins),
+		Handler: handler,
 		server:  srv,
 	})
 	return nil
@@ -350,6 +425,17 @@ func (h *httpServer) rpcAllowed() bool {
 	return h.httpHandler.Load().(*rpcHandler) != nil
 }
 
+// grpcAllowed returns true when gRPC is enabled.
+func (h *httpServer) grpcAllowed() bool {
+	handler := h.httpHandler.Load().(*rpcHandler)
+	return handler != nil && handler.grpc != nil
+}
+
+// grpcDefinitionPath returns the path on which the gRPC service definition is served.
+func (h *httpServer) grpcDefinitionPath() string {
+	return strings.TrimSuffix(h.httpConfig.prefix, "/") + grpcDefinitionPath
+}
+
 // wsAllowed returns true when JSON-RPC over WebSocket is enabled.
 func (h *httpServer) wsAllowed() bool {
 	return h.wsHandler.Load().(*rpcHandler) != nil
@@ -361,14 +447,56 @@ func isWebsocket(r *http.Request) bool {
 		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
 }
 
-// NewHTTPHandlerStack returns wrapped http-related handlers
-func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string) http.Handler {
+// NewHTTPHandlerStack returns wrapped http-related handlers. If access is non-nil,
+// clients are restricted to the methods allowed for their credentials.
+func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, access *RPCAccessControl) http.Handler {
+	if access != nil {
+		srv = access.handler(srv)
+	}
 	// Wrap the CORS-handler within a host-handler
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
 	return newGzipHandler(handler)
 }
 
+// grpcDefinitionPath is the path below the HTTP-RPC prefix on which the gRPC
+// service definition is served.
+const grpcDefinitionPath = "/grpc.proto"
+
+// newGRPCHandlerStack returns the handler serving the APIs of the server over
+// gRPC, along with their service definition. Requests are checked against the
+// virtual hosts and the access control, CORS and compression do not apply.
+func newGRPCHandlerStack(srv *rpc.Server, vhosts []string, access *RPCAccessControl) http.Handler {
+	grpc := srv.GRPCHandler()
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			grpc.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		io.WriteString(w, srv.GRPCServiceDefinition())
+	})
+	if access != nil {
+		handler = access.handler(handler)
+	}
+	return newVHostHandler(vhosts, handler)
+}
+
+// isGRPC checks whether an http request is a gRPC call.
+func isGRPC(r *http.Request) bool {
+	return rpc.IsGRPCRequest(r)
+}
+
+// httpError rejects a request with the given HTTP error, answering gRPC calls
+// with the matching gRPC status instead.
+func httpError(w http.ResponseWriter, r *http.Request, error string, code int) {
+	if isGRPC(r) {
+		rpc.GRPCError(w, error, code)
+		return
+	}
+	http.Error(w, error, code)
+}
+
 func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	// disable CORS support if user has not specified a custom CORS configuration
 	if len(allowedOrigins) == 0 {
@@ -427,7 +555,7 @@ func (h *virtualHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.next.ServeHTTP(w, r)
 		return
 	}
-	http.Error(w, "invalid host specified", http.StatusForbidden)
+	httpError(w, r, "invalid host specified", http.StatusForbidden)
 }
 
 var gzPool = sync.Pool{
@@ -453,7 +581,7 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 
 func newGzipHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || isWebsocket(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
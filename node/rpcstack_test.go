@@ -18,7 +18,10 @@ package node
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -30,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 )
 
 // TestCorsHandler makes sure CORS are properly handled on the http server.
@@ -229,6 +233,45 @@ func Test_checkPath(t *testing.T) {
 	}
 }
 
+// TestGRPC makes sure gRPC calls and JSON-RPC requests are served on the same port.
+func TestGRPC(t *testing.T) {
+	srv := createAndStartServer(t, &httpConfig{grpc: true}, false, &wsConfig{})
+	defer srv.stop()
+	url := "http://" + srv.listenAddr()
+
+	// JSON-RPC over HTTP/1.1 still works.
+	resp := rpcRequest(t, url)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Call rpc_modules over gRPC, without TLS.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	msg := []byte{0, 0, 0, 0, 4, 0x0a, 2, '[', ']'} // Request{params: "[]"}
+	req, _ := http.NewRequest(http.MethodPost, url+"/geth.Rpc/Modules", bytes.NewReader(msg))
+	req.Header.Set("content-type", "application/grpc")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("gRPC request failed:", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "0", resp.Trailer.Get("grpc-status"))
+	assert.Contains(t, string(body), `"rpc":"1.0"`)
+
+	// The service definition is served as well.
+	resp, err = http.Get(url + grpcDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "rpc Modules(JSONRequest) returns (JSONResponse);")
+}
+
 func createAndStartServer(t *testing.T, conf *httpConfig, ws bool, wsConf *wsConfig) *httpServer {
 	t.Helper()
 
@@ -0,0 +1,80 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"net/http"
+)
+
+// MethodFilter reports whether a method may be called.
+type MethodFilter func(method string) bool
+
+type (
+	methodFilterKey struct{}
+	clientNameKey   struct{}
+)
+
+// WithMethodFilter returns a copy of the context restricting the calls served
+// under it to the methods accepted by the filter. HTTP middleware uses it to
+// apply per-client access control to the requests it passes to the server, as
+// the request context is used for HTTP requests and WebSocket connections.
+//
+// Calls of any other method are answered with an error.
+func WithMethodFilter(ctx context.Context, filter MethodFilter) context.Context {
+	return context.WithValue(ctx, methodFilterKey{}, filter)
+}
+
+// methodFilterFromContext retrieves the method filter of the context, if any.
+func methodFilterFromContext(ctx context.Context) MethodFilter {
+	filter, _ := ctx.Value(methodFilterKey{}).(MethodFilter)
+	return filter
+}
+
+// MethodAllowed reports whether the method filter of the context, if any, allows
+// calling the method. Handlers served next to the RPC server, like GraphQL, use
+// it to apply the same access control to what they serve.
+func MethodAllowed(ctx context.Context, method string) bool {
+	filter := methodFilterFromContext(ctx)
+	return filter == nil || filter(method)
+}
+
+// WithClientName returns a copy of the context identifying the client of the
+// calls served under it, e.g. by the name of the credential it authenticated
+// with. Per-client rate limits are keyed by the name instead of the IP address.
+func WithClientName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, clientNameKey{}, name)
+}
+
+// clientNameFromContext retrieves the client name of the context, if any.
+func clientNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(clientNameKey{}).(string)
+	return name
+}
+
+// connContext derives the context of a long-lived connection from the request
+// establishing it, keeping the remote address and the values set by middleware.
+func connContext(r *http.Request) context.Context {
+	ctx := context.WithValue(context.Background(), "remote", r.RemoteAddr)
+	if filter := methodFilterFromContext(r.Context()); filter != nil {
+		ctx = WithMethodFilter(ctx, filter)
+	}
+	if name := clientNameFromContext(r.Context()); name != "" {
+		ctx = WithClientName(ctx, name)
+	}
+	return ctx
+}
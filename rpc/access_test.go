@@ -0,0 +1,98 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// filterHandler restricts the requests passed to the server to the test_echo method.
+func filterHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := func(method string) bool { return method == "test_echo" }
+		next.ServeHTTP(w, r.WithContext(WithMethodFilter(r.Context(), filter)))
+	})
+}
+
+// Tests that calls of filtered methods are denied over HTTP, also within batches.
+func TestHTTPMethodFilter(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	httpsrv := httptest.NewServer(filterHandler(srv))
+	defer httpsrv.Close()
+
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testMethodFilter(t, client)
+}
+
+// Tests that calls of filtered methods are denied over WebSocket connections.
+func TestWebsocketMethodFilter(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Stop()
+	httpsrv := httptest.NewServer(filterHandler(srv.WebsocketHandler([]string{"*"})))
+	defer httpsrv.Close()
+
+	client, err := DialWebsocket(context.Background(), "ws:"+strings.TrimPrefix(httpsrv.URL, "http:"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testMethodFilter(t, client)
+
+	// Subscriptions are calls of the subscribe method
+	if _, err := client.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 1, 1); !isMethodDenied(err) {
+		t.Fatalf("wrong error for denied subscription: %v", err)
+	}
+}
+
+func testMethodFilter(t *testing.T, client *Client) {
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatalf("allowed call failed: %v", err)
+	}
+	if err := client.Call(nil, "test_noArgsRets"); !isMethodDenied(err) {
+		t.Fatalf("wrong error for denied call: %v", err)
+	}
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 10, &echoArgs{"world"}}, Result: new(echoResult)},
+		{Method: "test_noArgsRets", Result: new(interface{})},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch call failed: %v", err)
+	}
+	if batch[0].Error != nil {
+		t.Errorf("allowed batch element failed: %v", batch[0].Error)
+	}
+	if !isMethodDenied(batch[1].Error) {
+		t.Errorf("wrong error for denied batch element: %v", batch[1].Error)
+	}
+}
+
+func isMethodDenied(err error) bool {
+	rpcErr, ok := err.(Error)
+	return ok && rpcErr.ErrorCode() == new(methodDeniedError).ErrorCode()
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// AuditRecord is the record of a method call served by a server.
+type AuditRecord struct {
+	Time     time.Time       `json:"time"`             // Time the call was received
+	Client   string          `json:"client,omitempty"` // Name set with WithClientName, or IP address
+	Remote   string          `json:"remote,omitempty"` // Remote address of the connection
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"` // Parameters, with secrets redacted
+	Result   json.RawMessage `json:"result,omitempty"` // Result, with secrets redacted
+	Error    *AuditError     `json:"error,omitempty"`
+	Duration time.Duration   `json:"duration"` // Time taken to serve the call, in nanoseconds
+}
+
+// AuditError is the error returned by a recorded call.
+type AuditError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// AuditLog records the method calls served by a server. Record is called once
+// the response of a call has been created, concurrently for concurrent calls.
+type AuditLog interface {
+	Record(*AuditRecord)
+}
+
+// SetAuditLog configures the log recording the calls served. It must be called
+// before serving any requests.
+func (s *Server) SetAuditLog(audit AuditLog) {
+	s.audit = audit
+}
+
+// auditRedacted replaces the secrets in audit records.
+var auditRedacted = json.RawMessage(`"[redacted]"`)
+
+// auditSecretParams lists the positions of the parameters carrying secrets, like
+// passwords, keys and PINs, which are redacted from audit records. All parameters
+// of other personal methods are redacted, as they may carry secrets too.
+var auditSecretParams = map[string][]int{
+	"personal_listAccounts":           nil,
+	"personal_listWallets":            nil,
+	"personal_lockAccount":            nil,
+	"personal_ecRecover":              nil,
+	"personal_deriveAccount":          nil,
+	"personal_initializeWallet":       nil,
+	"personal_openWallet":             {1},
+	"personal_newAccount":             {0},
+	"personal_importRawKey":           {0, 1},
+	"personal_unlockAccount":          {1},
+	"personal_sendTransaction":        {1},
+	"personal_signTransaction":        {1},
+	"personal_signAndSendTransaction": {1},
+	"personal_sign":                   {2},
+	"personal_unpair":                 {1},
+}
+
+// auditSecretResults lists the methods whose results are secrets.
+var auditSecretResults = map[string]bool{
+	"personal_initializeWallet": true, // Seed phrase of the new wallet
+}
+
+// newAuditRecord creates the record of a call and its response, redacting the
+// secrets they carry.
+func newAuditRecord(start time.Time, client, remote string, msg, resp *jsonrpcMessage) *AuditRecord {
+	rec := &AuditRecord{
+		Time:     start,
+		Client:   client,
+		Remote:   remote,
+		Method:   msg.Method,
+		Params:   redactParams(msg.Method, msg.Params),
+		Result:   resp.Result,
+		Duration: time.Since(start),
+	}
+	if auditSecretResults[msg.Method] && resp.Result != nil {
+		rec.Result = auditRedacted
+	}
+	if resp.Error != nil {
+		rec.Error = &AuditError{Code: resp.Error.Code, Message: resp.Error.Message}
+		if resp.Error.Data != nil {
+			rec.Error.Data, _ = json.Marshal(resp.Error.Data)
+		}
+	}
+	return rec
+}
+
+// redactParams returns the parameters of a call with the secrets they carry
+// replaced, or all of them if they can't be told apart.
+func redactParams(method string, params json.RawMessage) json.RawMessage {
+	secrets, known := auditSecretParams[method]
+	if !known && !strings.HasPrefix(method, "personal"+serviceMethodSeparator) {
+		return params
+	}
+	if len(params) == 0 || (known && len(secrets) == 0) {
+		return params
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal(params, &args); err != nil {
+		return auditRedacted
+	}
+	if !known {
+		for i := range args {
+			args[i] = auditRedacted
+		}
+	}
+	for _, i := range secrets {
+		if i < len(args) {
+			args[i] = auditRedacted
+		}
+	}
+	var redacted bytes.Buffer
+	redacted.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			redacted.WriteByte(',')
+		}
+		redacted.Write(arg)
+	}
+	redacted.WriteByte(']')
+	return redacted.Bytes()
+}
+
+type auditLogKey struct{}
+
+// withAuditLog returns a copy of the context carrying the audit log of the
+// connections served under it.
+func withAuditLog(ctx context.Context, audit AuditLog) context.Context {
+	if audit == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, auditLogKey{}, audit)
+}
+
+// auditLogFromContext retrieves the audit log of the context, if any.
+func auditLogFromContext(ctx context.Context) AuditLog {
+	audit, _ := ctx.Value(auditLogKey{}).(AuditLog)
+	return audit
+}
+
+// AuditFile is an AuditLog writing the records as JSON lines to a file. The file
+// is rotated when it exceeds its maximum size, keeping a limited number of the
+// previous files, named after the file with the suffixes .1 (most recent), .2
+// and so on.
+type AuditFile struct {
+	path     string
+	maxSize  int64 // Size of the file triggering a rotation, never rotated if zero
+	maxFiles int   // Number of previous files kept
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenAuditFile opens the audit log at the given path, appending to the file if
+// it exists.
+func OpenAuditFile(path string, maxSize int64, maxFiles int) (*AuditFile, error) {
+	a := &AuditFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// open opens the current file of the log.
+func (a *AuditFile) open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// Record implements AuditLog, appending the record to the file.
+func (a *AuditFile) Record(rec *AuditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Warn("Failed to encode RPC audit record", "method", rec.Method, "err", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return // closed
+	}
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			log.Warn("Failed to rotate RPC audit log", "path", a.path, "err", err)
+			if a.file == nil {
+				return
+			}
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Warn("Failed to write RPC audit record", "path", a.path, "err", err)
+	}
+}
+
+// rotate moves the current file to the previous files, starting a new one. If
+// the file can't be moved, writing continues to it.
+func (a *AuditFile) rotate() error {
+	err := a.file.Close()
+	if err == nil {
+		if a.maxFiles > 0 {
+			for i := a.maxFiles - 1; i > 0; i-- {
+				os.Rename(a.previous(i), a.previous(i+1))
+			}
+			err = os.Rename(a.path, a.previous(1))
+		} else {
+			err = os.Remove(a.path)
+		}
+	}
+	a.file = nil
+	if openErr := a.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// previous returns the path of the n-th previous file.
+func (a *AuditFile) previous(n int) string {
+	return fmt.Sprintf("%s.%d", a.path, n)
+}
+
+// Close closes the file. Records of calls served afterwards are dropped.
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
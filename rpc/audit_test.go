@@ -0,0 +1,157 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAuditLog keeps the records in memory.
+type testAuditLog struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+func (l *testAuditLog) Record(rec *AuditRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, rec)
+}
+
+// Tests that calls are recorded along with their results or errors.
+func TestAuditLog(t *testing.T) {
+	audit := new(testAuditLog)
+	server := newTestServer()
+	server.SetAuditLog(audit)
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(nil, "test_returnError"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if len(audit.records) != 2 {
+		t.Fatalf("wrong number of records: %d", len(audit.records))
+	}
+	echo, failed := audit.records[0], audit.records[1]
+	if echo.Method != "test_echo" || string(echo.Params) != `["hello",10,{"S":"world"}]` {
+		t.Errorf("wrong call recorded: %s %s", echo.Method, echo.Params)
+	}
+	if string(echo.Result) != `{"String":"hello","Int":10,"Args":{"S":"world"}}` || echo.Error != nil {
+		t.Errorf("wrong result recorded: %s, error %v", echo.Result, echo.Error)
+	}
+	if echo.Time.IsZero() || echo.Duration < 0 {
+		t.Errorf("wrong timing recorded: %v %v", echo.Time, echo.Duration)
+	}
+	want := AuditError{Code: 444, Message: "testError", Data: json.RawMessage(`"testError data"`)}
+	if failed.Error == nil || failed.Error.Code != want.Code || failed.Error.Message != want.Message || string(failed.Error.Data) != string(want.Data) {
+		t.Errorf("wrong error recorded: %+v", failed.Error)
+	}
+}
+
+// Tests that the secrets carried by calls are redacted from their records.
+func TestAuditRedaction(t *testing.T) {
+	tests := []struct {
+		method, params, result string
+		wantParams, wantResult string
+	}{
+		{"test_echo", `["hello",10]`, `"hello"`, `["hello",10]`, `"hello"`},
+		{"personal_listAccounts", `[]`, `[]`, `[]`, `[]`},
+		{"personal_unlockAccount", `["0x01","secret",300]`, `true`, `["0x01","[redacted]",300]`, `true`},
+		{"personal_unlockAccount", `["0x01"]`, ``, `["0x01"]`, ``},
+		{"personal_sendTransaction", `[{"from":"0x01"},"secret"]`, `"0x02"`, `[{"from":"0x01"},"[redacted]"]`, `"0x02"`},
+		{"personal_sign", `["0x1234","0x01","secret"]`, `"0x03"`, `["0x1234","0x01","[redacted]"]`, `"0x03"`},
+		{"personal_importRawKey", `["key","secret"]`, `"0x01"`, `["[redacted]","[redacted]"]`, `"0x01"`},
+		{"personal_initializeWallet", `["url"]`, `"seed phrase"`, `["url"]`, `"[redacted]"`},
+		{"personal_futureMethod", `["a","b"]`, `true`, `["[redacted]","[redacted]"]`, `true`},
+		{"personal_newAccount", `{"password":"secret"}`, `"0x01"`, `"[redacted]"`, `"0x01"`},
+	}
+	for i, tt := range tests {
+		msg := &jsonrpcMessage{Method: tt.method, Params: json.RawMessage(tt.params)}
+		resp := &jsonrpcMessage{}
+		if tt.result != "" {
+			resp.Result = json.RawMessage(tt.result)
+		}
+		rec := newAuditRecord(time.Now(), "", "", msg, resp)
+		if string(rec.Params) != tt.wantParams {
+			t.Errorf("test %d: params mismatch: have %s, want %s", i, rec.Params, tt.wantParams)
+		}
+		if string(rec.Result) != tt.wantResult {
+			t.Errorf("test %d: result mismatch: have %s, want %s", i, rec.Result, tt.wantResult)
+		}
+	}
+}
+
+// Tests that the audit file is rotated when exceeding its size.
+func TestAuditFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditFile(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &AuditRecord{Time: time.Unix(0, 0).UTC(), Method: "test_echo", Params: json.RawMessage(`["hello"]`)}
+	line, _ := json.Marshal(rec)
+	perFile := 300 / (len(line) + 1)
+
+	// Write enough records for four files, only three of which are kept
+	for i := 0; i < 3*perFile+1; i++ {
+		audit.Record(rec)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]int{path: 1, path + ".1": perFile, path + ".2": perFile} {
+		if n := countLines(t, file); n != want {
+			t.Errorf("wrong number of records in %s: %d, want %d", file, n, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("too many files kept: %v", err)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var n int
+	for scanner := bufio.NewScanner(file); scanner.Scan(); n++ {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record in %s: %v", path, err)
+		}
+	}
+	return n
+}
@@ -311,6 +311,38 @@ func TestClientSubscribe(t *testing.T) {
 	}
 }
 
+// This checks that a subscription failed by the server delivers its notifications
+// and then ends with the error sent by the server.
+func TestClientSubscribeFail(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	nc := make(chan int)
+	count := 10
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "failSubscription", count, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		if val := <-nc; val != i {
+			t.Fatalf("value mismatch: got %d, want %d", val, i)
+		}
+	}
+	select {
+	case v := <-nc:
+		t.Fatal("received value after failure:", v)
+	case err := <-sub.Err():
+		if err == nil || err.Error() != "subscription failed" {
+			t.Fatalf("wrong error: got %v, want %q", err, "subscription failed")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("subscription not failed within 1s")
+	}
+	sub.Unsubscribe()
+}
+
 // In this test, the connection drops while Subscribe is waiting for a response.
 func TestClientSubscribeClose(t *testing.T) {
 	server := newTestServer()
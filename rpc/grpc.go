@@ -0,0 +1,747 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The gRPC transport serves every method of the server as a method of a gRPC
+// service named after its namespace, e.g. eth_getBalance is served as
+// /geth.Eth/GetBalance. Subscriptions are served as server streaming methods,
+// e.g. eth_subscribe("newHeads") as /geth.Eth/SubscribeNewHeads.
+//
+// Methods whose argument and result types have a protocol buffers encoding, see
+// grpc_types.go, take and return typed messages derived from these types, which
+// are decoded into and encoded from the Go values of the call directly. The
+// other methods and the subscriptions tunnel JSON-RPC: their messages carry the
+// JSON-RPC parameters and results as opaque JSON bytes, which clients encode and
+// decode as they would over HTTP. See GRPCServiceDefinition.
+const (
+	grpcPackage     = "geth"
+	grpcContentType = "application/grpc"
+)
+
+// gRPC status codes, see https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	grpcOK                = 0
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcDefinitionHeader is the beginning of the protocol buffers definition of
+// the gRPC services, declaring the JSON carrying messages shared by all methods.
+const grpcDefinitionHeader = `syntax = "proto3";
+
+// The geth services serve the JSON-RPC methods over gRPC. The JSON-RPC signature
+// of each method is given in the comment above it. Methods with typed messages
+// take a request with a field per argument, in order, and return a response
+// with the result in its first field. Addresses, hashes and byte strings are
+// bytes, big integers are bytes holding their big-endian magnitude, and block
+// numbers are int64 with the negative values of the block tags: -1 for latest,
+// -2 for pending, -3 for finalized and -4 for safe.
+//
+// The other methods tunnel JSON-RPC, their messages carrying JSON encoded bytes
+// that are not described by this definition. The JSON encoding of their types
+// is the one used by the JSON-RPC APIs over HTTP.
+package geth;
+
+// JSONRequest carries the parameters of a method, as a JSON array.
+message JSONRequest {
+  bytes params_json = 1;
+}
+
+// JSONResponse carries the JSON encoded result of a method, or its error.
+message JSONResponse {
+  bytes result_json = 1;
+  JSONError error = 2;
+}
+
+// JSONError is a JSON-RPC error, with its JSON encoded data. It is the error of
+// the typed responses as well.
+message JSONError {
+  int64 code = 1;
+  string message = 2;
+  bytes data_json = 3;
+}
+
+// JSONNotification carries the JSON encoded result of a subscription notification.
+message JSONNotification {
+  bytes result_json = 1;
+}
+`
+
+// GRPCHandler returns a handler serving the methods of the server over gRPC. The
+// handler must be served over HTTP/2, for example via
+// golang.org/x/net/http2/h2c.
+func (s *Server) GRPCHandler() http.Handler {
+	return &grpcHandler{s}
+}
+
+// GRPCServiceDefinition returns the protocol buffers definition of the gRPC
+// services of the server, for generating clients. Methods with typed messages
+// come with the declarations of their messages, the parameters and results of
+// the others remain JSON, whose Go types are documented along with each method.
+func (s *Server) GRPCServiceDefinition() string {
+	s.services.mu.Lock()
+	defer s.services.mu.Unlock()
+
+	namespaces := make([]string, 0, len(s.services.services))
+	for namespace := range s.services.services {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	// The messages of the methods are named first, so that the messages of the
+	// structs don't take their names.
+	schema := newProtoSchema("JSONRequest", "JSONResponse", "JSONError", "JSONNotification")
+	for _, namespace := range namespaces {
+		for name := range s.services.services[namespace].callbacks {
+			schema.taken[grpcName(namespace)+grpcName(name)+"Request"] = true
+			schema.taken[grpcName(namespace)+grpcName(name)+"Response"] = true
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(grpcDefinitionHeader)
+	for _, namespace := range namespaces {
+		svc := s.services.services[namespace]
+		fmt.Fprintf(&b, "\nservice %s {\n", grpcName(namespace))
+		for _, name := range sortedCallbacks(svc.callbacks) {
+			cb := svc.callbacks[name]
+			fmt.Fprintf(&b, "  // %s_%s(%s)%s\n", namespace, name, cb.argsString(), cb.resultString())
+			if m := grpcMessagesOf(cb); m != nil {
+				request := grpcName(namespace) + grpcName(name) + "Request"
+				response := grpcName(namespace) + grpcName(name) + "Response"
+				schema.writeMethod(namespace+serviceMethodSeparator+name, request, response, m)
+				fmt.Fprintf(&b, "  rpc %s(%s) returns (%s);\n", grpcName(name), request, response)
+			} else {
+				fmt.Fprintf(&b, "  rpc %s(JSONRequest) returns (JSONResponse);\n", grpcName(name))
+			}
+		}
+		for _, name := range sortedCallbacks(svc.subscriptions) {
+			cb := svc.subscriptions[name]
+			args := strconv.Quote(name)
+			if len(cb.argTypes) > 0 {
+				args += ", " + cb.argsString()
+			}
+			fmt.Fprintf(&b, "  // %s_subscribe(%s)\n", namespace, args)
+			fmt.Fprintf(&b, "  rpc Subscribe%s(JSONRequest) returns (stream JSONNotification);\n", grpcName(name))
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString(schema.String())
+	return b.String()
+}
+
+// sortedCallbacks returns the names of the callbacks in alphabetical order.
+func sortedCallbacks(callbacks map[string]*callback) []string {
+	names := make([]string, 0, len(callbacks))
+	for name := range callbacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// argsString returns the Go types of the arguments of the callback.
+func (c *callback) argsString() string {
+	args := make([]string, 0, len(c.argTypes))
+	for _, typ := range c.argTypes {
+		args = append(args, typ.String())
+	}
+	return strings.Join(args, ", ")
+}
+
+// resultString returns the Go type of the result of the callback, if any.
+func (c *callback) resultString() string {
+	typ := c.fn.Type()
+	if typ.NumOut() == 0 || c.errPos == 0 {
+		return ""
+	}
+	return " " + typ.Out(0).String()
+}
+
+// grpcName converts a namespace or method name into a gRPC service or method
+// name, capitalizing its first letter.
+func grpcName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[n:]
+}
+
+// grpcMethod resolves the method called by a gRPC path. For subscriptions, the
+// name of the subscription is returned along with the subscribe method.
+func (s *Server) grpcMethod(path string) (method string, subscription string, ok bool) {
+	elems := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(elems) != 2 || !strings.HasPrefix(elems[0], grpcPackage+".") {
+		return "", "", false
+	}
+	service, name := strings.TrimPrefix(elems[0], grpcPackage+"."), elems[1]
+
+	s.services.mu.Lock()
+	defer s.services.mu.Unlock()
+
+	for namespace, svc := range s.services.services {
+		if grpcName(namespace) != service {
+			continue
+		}
+		if cb := formatName(name); svc.callbacks[cb] != nil {
+			return namespace + serviceMethodSeparator + cb, "", true
+		}
+		if strings.HasPrefix(name, "Subscribe") {
+			if sub := formatName(strings.TrimPrefix(name, "Subscribe")); svc.subscriptions[sub] != nil {
+				return namespace + subscribeMethodSuffix, sub, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// grpcHandler serves the methods of a server over gRPC.
+type grpcHandler struct {
+	s *Server
+}
+
+func (h *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2 POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	if !IsGRPCRequest(r) {
+		http.Error(w, "invalid content type, only "+grpcContentType+" is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("content-type", grpcContentType)
+	resp := &grpcResponse{w: w}
+
+	method, subscription, ok := h.s.grpcMethod(r.URL.Path)
+	if !ok {
+		resp.writeStatus(grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		code := grpcInvalidArgument
+		if err == errGRPCMessageTooLarge {
+			code = grpcResourceExhausted
+		}
+		resp.writeStatus(code, err.Error())
+		return
+	}
+	ctx := httpRequestContext(r)
+	if timeout, ok := parseGRPCTimeout(r.Header.Get("grpc-timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if subscription == "" {
+		if cb := h.s.services.callback(method); cb != nil {
+			if m := grpcMessagesOf(cb); m != nil {
+				h.serveTypedCall(ctx, resp, r, method, cb, m, req)
+				return
+			}
+		}
+	}
+	fields, err := parseProtoFields(req)
+	if err != nil {
+		resp.writeStatus(grpcInvalidArgument, err.Error())
+		return
+	}
+	params := json.RawMessage(fields[1])
+	if subscription != "" {
+		if params, err = prependParam(subscription, params); err != nil {
+			resp.writeStatus(grpcInvalidArgument, err.Error())
+			return
+		}
+	}
+	msg := &jsonrpcMessage{Version: vsn, ID: json.RawMessage("1"), Method: method, Params: params}
+	if subscription != "" {
+		h.serveSubscription(ctx, resp, r, msg)
+	} else {
+		h.serveCall(ctx, resp, r, msg)
+	}
+}
+
+// serveTypedCall serves a unary call of a method with typed messages, decoding
+// its arguments from the request and encoding its result into the response
+// without going through JSON.
+func (h *grpcHandler) serveTypedCall(ctx context.Context, resp *grpcResponse, r *http.Request, method string, cb *callback, m *grpcMessages, req []byte) {
+	if atomic.LoadInt32(&h.s.run) == 0 {
+		resp.writeStatus(grpcUnavailable, "server stopped")
+		return
+	}
+	args, err := m.decodeRequest(req)
+	if err != nil {
+		resp.writeStatus(grpcInvalidArgument, err.Error())
+		return
+	}
+	// The handler applies the method filter, rate limits and audit log of the
+	// server, it never writes to the codec.
+	handler := newHandler(h.s.connContext(ctx), newGRPCCodec(nil, r.RemoteAddr, nil), h.s.idgen, &h.s.services)
+	handler.allowSubscribe = false
+	defer handler.close(io.EOF, nil)
+
+	var answer []byte
+	result, err := handler.handleTypedCall(method, cb, args)
+	if err == nil {
+		if answer, err = m.encodeResult(result); err != nil {
+			resp.writeStatus(grpcInternal, "invalid result: "+err.Error())
+			return
+		}
+	} else {
+		answer = appendProtoBytes(nil, 2, encodeGRPCError(errorMessage(err).Error))
+	}
+	if err := resp.writeMessage(answer); err != nil {
+		return
+	}
+	resp.writeStatus(grpcOK, "")
+}
+
+// serveCall serves a unary method call.
+func (h *grpcHandler) serveCall(ctx context.Context, resp *grpcResponse, r *http.Request, msg *jsonrpcMessage) {
+	var answer *jsonrpcMessage
+	codec := newGRPCCodec(msg, r.RemoteAddr, func(msg *jsonrpcMessage) error {
+		answer = msg
+		return nil
+	})
+	h.s.serveSingleRequest(ctx, codec)
+	codec.close()
+
+	if answer == nil {
+		resp.writeStatus(grpcUnavailable, "server stopped")
+		return
+	}
+	if err := resp.writeMessage(encodeGRPCResponse(answer)); err != nil {
+		return
+	}
+	resp.writeStatus(grpcOK, "")
+}
+
+// serveSubscription serves a subscription, streaming its notifications until
+// the call is cancelled or the subscription fails.
+func (h *grpcHandler) serveSubscription(ctx context.Context, resp *grpcResponse, r *http.Request, msg *jsonrpcMessage) {
+	var (
+		subscribed bool
+		subErr     *jsonError
+		failed     = make(chan struct{})
+	)
+	// The callback runs under the lock of the codec, the state it sets is read
+	// once the codec is closed.
+	codec := newGRPCCodec(msg, r.RemoteAddr, func(msg *jsonrpcMessage) error {
+		// The first message is the response to the subscribe call
+		if !subscribed {
+			subscribed = true
+			if msg.Error != nil {
+				subErr = msg.Error
+				close(failed)
+			}
+			return nil
+		}
+		var result subscriptionResult
+		if err := json.Unmarshal(msg.Params, &result); err != nil {
+			return err
+		}
+		if result.Error != nil {
+			subErr = result.Error
+			close(failed)
+			return nil
+		}
+		return resp.writeMessage(appendProtoBytes(nil, 1, result.Result))
+	})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-failed:
+		}
+		codec.close()
+	}()
+	h.s.serveCodec(ctx, codec)
+	codec.close()
+
+	switch {
+	case !subscribed:
+		resp.writeStatus(grpcUnavailable, "server stopped")
+	case subErr != nil:
+		resp.writeStatus(grpcCode(subErr.Code), subErr.Message)
+	default:
+		resp.writeStatus(grpcOK, "")
+	}
+}
+
+// IsGRPCRequest reports whether the request is a gRPC call.
+func IsGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("content-type"), grpcContentType)
+}
+
+// GRPCError answers a gRPC call with the status matching an HTTP error code, for
+// handlers rejecting calls before they reach the gRPC handler. gRPC clients read
+// the status of a call from a successful HTTP response.
+func GRPCError(w http.ResponseWriter, error string, code int) {
+	status := grpcUnknown
+	switch code {
+	case http.StatusBadRequest:
+		status = grpcInvalidArgument
+	case http.StatusUnauthorized:
+		status = grpcUnauthenticated
+	case http.StatusForbidden:
+		status = grpcPermissionDenied
+	case http.StatusNotFound:
+		status = grpcUnimplemented
+	case http.StatusTooManyRequests:
+		status = grpcResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		status = grpcUnavailable
+	}
+	w.Header().Set("content-type", grpcContentType)
+	resp := &grpcResponse{w: w}
+	resp.writeStatus(status, error)
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcCode converts a JSON-RPC error code into a gRPC status code.
+func grpcCode(code int) int {
+	switch code {
+	case -32601:
+		return grpcUnimplemented
+	case -32602:
+		return grpcInvalidArgument
+	default:
+		return grpcUnknown
+	}
+}
+
+// parseGRPCTimeout parses the timeout of a gRPC call, e.g. 100m for 100ms.
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// prependParam inserts a parameter before the JSON array of parameters.
+func prependParam(param interface{}, params json.RawMessage) (json.RawMessage, error) {
+	var args []json.RawMessage
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, errors.New("non-array parameters")
+		}
+	}
+	first, err := json.Marshal(param)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(append([]json.RawMessage{first}, args...))
+}
+
+// grpcCodec is the ServerCodec of a single gRPC call. It feeds the request of
+// the call to the server, passing the messages written back to a callback.
+type grpcCodec struct {
+	req    *jsonrpcMessage
+	remote string
+
+	mu        sync.Mutex // Guards the callback against use after close
+	write     func(*jsonrpcMessage) error
+	closeCh   chan interface{}
+	closeOnce sync.Once
+}
+
+func newGRPCCodec(req *jsonrpcMessage, remote string, write func(*jsonrpcMessage) error) *grpcCodec {
+	return &grpcCodec{
+		req:     req,
+		remote:  remote,
+		write:   write,
+		closeCh: make(chan interface{}),
+	}
+}
+
+func (c *grpcCodec) readBatch() ([]*jsonrpcMessage, bool, error) {
+	if req := c.req; req != nil {
+		c.req = nil
+		return []*jsonrpcMessage{req}, false, nil
+	}
+	<-c.closeCh
+	return nil, false, io.EOF
+}
+
+func (c *grpcCodec) writeJSON(ctx context.Context, v interface{}) error {
+	msg, ok := v.(*jsonrpcMessage)
+	if !ok {
+		return fmt.Errorf("unexpected gRPC response %T", v)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closeCh:
+		return ErrClientQuit
+	default:
+		return c.write(msg)
+	}
+}
+
+func (c *grpcCodec) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeOnce.Do(func() { close(c.closeCh) })
+}
+
+func (c *grpcCodec) closed() <-chan interface{} {
+	return c.closeCh
+}
+
+func (c *grpcCodec) remoteAddr() string {
+	return c.remote
+}
+
+var errGRPCMessageTooLarge = fmt.Errorf("message too large (>%d)", maxRequestContentLength)
+
+// readGRPCMessage reads the request message of a gRPC call.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, errors.New("missing request message")
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestContentLength {
+		return nil, errGRPCMessageTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.New("truncated request message")
+	}
+	return msg, nil
+}
+
+// grpcResponse writes the response of a gRPC call.
+type grpcResponse struct {
+	w       http.ResponseWriter
+	started bool // Whether the headers were sent along with a message
+}
+
+// writeMessage writes a length-prefixed message of the response.
+func (r *grpcResponse) writeMessage(msg []byte) error {
+	r.started = true
+
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := r.w.Write(append(prefix[:], msg...)); err != nil {
+		return err
+	}
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writeStatus sets the status of the response. It is sent in the trailers, or
+// in the headers if the response has no messages.
+func (r *grpcResponse) writeStatus(code int, message string) {
+	var prefix string
+	if r.started {
+		prefix = http.TrailerPrefix
+	}
+	r.w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		r.w.Header().Set(prefix+"Grpc-Message", url.PathEscape(message))
+	}
+}
+
+// encodeGRPCResponse encodes a JSON-RPC response into a JSONResponse message.
+func encodeGRPCResponse(resp *jsonrpcMessage) []byte {
+	var msg []byte
+	if len(resp.Result) > 0 {
+		msg = appendProtoBytes(msg, 1, resp.Result)
+	}
+	if resp.Error != nil {
+		msg = appendProtoBytes(msg, 2, encodeGRPCError(resp.Error))
+	}
+	return msg
+}
+
+// encodeGRPCError encodes a JSON-RPC error into a JSONError message.
+func encodeGRPCError(err *jsonError) []byte {
+	var msg []byte
+	msg = appendProtoVarint(msg, 1, uint64(int64(err.Code)))
+	msg = appendProtoBytes(msg, 2, []byte(err.Message))
+	if err.Data != nil {
+		if data, err := json.Marshal(err.Data); err == nil {
+			msg = appendProtoBytes(msg, 3, data)
+		}
+	}
+	return msg
+}
+
+// appendProtoVarint appends a varint field of a protocol buffers message.
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3)
+	return appendUvarint(buf, v)
+}
+
+// appendProtoBytes appends a length-delimited field of a protocol buffers message.
+func appendProtoBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|2)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// appendProtoFixed64 appends a fixed64 field of a protocol buffers message.
+func appendProtoFixed64(buf []byte, field int, v uint64) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|protoWireFixed64)
+	var enc [8]byte
+	binary.LittleEndian.PutUint64(enc[:], v)
+	return append(buf, enc[:]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var enc [binary.MaxVarintLen64]byte
+	return append(buf, enc[:binary.PutUvarint(enc[:], v)]...)
+}
+
+// parseProtoFields returns the length-delimited fields of a protocol buffers
+// message by field number, skipping fields of other wire types.
+func parseProtoFields(msg []byte) (map[int][]byte, error) {
+	fields := make(map[int][]byte)
+	err := readProtoFields(msg, func(num, wire int, x uint64, data []byte) error {
+		if wire == protoWireBytes {
+			fields[num] = data
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// readProtoFields calls fn with the number, wire type and value of each field of
+// a protocol buffers message. The value of length-delimited fields is passed in
+// data, the value of the others in x.
+func readProtoFields(msg []byte, fn func(num, wire int, x uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return errors.New("invalid message field")
+		}
+		msg = msg[n:]
+
+		var (
+			x    uint64
+			data []byte
+		)
+		switch wire := int(key & 7); wire {
+		case protoWireVarint:
+			if x, n = binary.Uvarint(msg); n <= 0 {
+				return errors.New("invalid varint field")
+			}
+		case protoWireFixed64:
+			n = 8
+			if n <= len(msg) {
+				x = binary.LittleEndian.Uint64(msg)
+			}
+		case protoWireBytes:
+			size, m := binary.Uvarint(msg)
+			if m <= 0 || size > uint64(len(msg)-m) {
+				return errors.New("invalid length-delimited field")
+			}
+			data = msg[m : m+int(size)]
+			n = m + int(size)
+		case protoWireFixed32:
+			n = 4
+			if n <= len(msg) {
+				x = uint64(binary.LittleEndian.Uint32(msg))
+			}
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if n > len(msg) {
+			return errors.New("truncated message field")
+		}
+		if err := fn(int(key>>3), int(key&7), x, data); err != nil {
+			return err
+		}
+		msg = msg[n:]
+	}
+	return nil
+}
+
+// readPackedProtoField calls fn with each value of a packed repeated field of
+// scalars encoded with the given wire type.
+func readPackedProtoField(data []byte, wire int, fn func(x uint64) error) error {
+	for len(data) > 0 {
+		var x uint64
+		switch wire {
+		case protoWireVarint:
+			var n int
+			if x, n = binary.Uvarint(data); n <= 0 {
+				return errors.New("invalid packed varint")
+			}
+			data = data[n:]
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return errors.New("truncated packed field")
+			}
+			x, data = binary.LittleEndian.Uint64(data), data[8:]
+		default:
+			return fmt.Errorf("unsupported packed wire type %d", wire)
+		}
+		if err := fn(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// grpcTestClient calls the gRPC methods of an HTTP/2 server without TLS.
+type grpcTestClient struct {
+	t      *testing.T
+	url    string
+	client *http.Client
+}
+
+func newGRPCTestClient(t *testing.T, url string) *grpcTestClient {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	return &grpcTestClient{t, url, &http.Client{Transport: transport}}
+}
+
+// send sends a request with the given message.
+func (c *grpcTestClient) send(ctx context.Context, path string, msg []byte) *http.Response {
+	c.t.Helper()
+
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(append(prefix[:], msg...)))
+	req.Header.Set("content-type", grpcContentType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal("request failed:", err)
+	}
+	return resp
+}
+
+// call sends a request with the given message, returning the response and the
+// messages read from its body.
+func (c *grpcTestClient) call(ctx context.Context, path string, msg []byte) (*http.Response, [][]byte) {
+	c.t.Helper()
+
+	resp := c.send(ctx, path, msg)
+	defer resp.Body.Close()
+
+	var (
+		prefix [5]byte
+		msgs   [][]byte
+	)
+	for {
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+			break
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(resp.Body, msg); err != nil {
+			c.t.Fatal("truncated response message:", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	// Trailers are only available once the body was consumed
+	ioutil.ReadAll(resp.Body)
+	return resp, msgs
+}
+
+// jsonRequest returns a JSONRequest message carrying the given parameters.
+func jsonRequest(params string) []byte {
+	return appendProtoBytes(nil, 1, []byte(params))
+}
+
+// grpcStatus returns the status of a gRPC response, sent in its trailers or in
+// its headers if it has no messages.
+func grpcStatus(resp *http.Response) string {
+	if status := resp.Trailer.Get("grpc-status"); status != "" {
+		return status
+	}
+	return resp.Header.Get("grpc-status")
+}
+
+func TestGRPCCall(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(h2c.NewHandler(server.GRPCHandler(), &http2.Server{}))
+	defer ts.Close()
+	client := newGRPCTestClient(t, ts.URL)
+
+	// Successful typed call: test_echo("x", -3, &echoArgs{"foo"})
+	req := appendProtoBytes(nil, 1, []byte("x"))
+	req = appendProtoVarint(req, 2, uint64(-3&(1<<64-1)))
+	req = appendProtoBytes(req, 3, appendProtoBytes(nil, 1, []byte("foo")))
+	resp, msgs := client.call(context.Background(), "/geth.Test/Echo", req)
+	if status := grpcStatus(resp); status != "0" {
+		t.Fatalf("wrong status %q, message %q", status, resp.Trailer.Get("grpc-message"))
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("wrong number of messages: %d", len(msgs))
+	}
+	fields, err := parseProtoFields(msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := appendProtoBytes(nil, 1, []byte("x"))
+	want = appendProtoVarint(want, 2, uint64(-3&(1<<64-1)))
+	want = appendProtoBytes(want, 3, appendProtoBytes(nil, 1, []byte("foo")))
+	if !bytes.Equal(fields[1], want) {
+		t.Fatalf("wrong result %x, want %x", fields[1], want)
+	}
+
+	// Failing typed call
+	resp, msgs = client.call(context.Background(), "/geth.Test/ReturnError", nil)
+	if status := grpcStatus(resp); status != "0" {
+		t.Fatalf("wrong status %q", status)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("wrong number of messages: %d", len(msgs))
+	}
+	fields, _ = parseProtoFields(msgs[0])
+	errFields, err := parseProtoFields(fields[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(errFields[2]) != "testError" || string(errFields[3]) != `"testError data"` {
+		t.Fatalf("wrong error %q, data %q", errFields[2], errFields[3])
+	}
+
+	// Invalid typed request: the argument of the wrong wire type
+	resp, _ = client.call(context.Background(), "/geth.Test/Echo", appendProtoVarint(nil, 1, 1))
+	if status := grpcStatus(resp); status != "3" {
+		t.Fatalf("wrong status %q for invalid request", status)
+	}
+
+	// Methods with untyped arguments tunnel JSON
+	resp, msgs = client.call(context.Background(), "/geth.Test/CallMeBack", jsonRequest(`["test_echo", []]`))
+	if status := grpcStatus(resp); status != "0" {
+		t.Fatalf("wrong status %q", status)
+	}
+	fields, _ = parseProtoFields(msgs[0])
+	errFields, _ = parseProtoFields(fields[2])
+	if string(errFields[2]) != "no client" {
+		t.Fatalf("wrong error %q", errFields[2])
+	}
+
+	// Unknown method
+	resp, msgs = client.call(context.Background(), "/geth.Test/Missing", nil)
+	if status := grpcStatus(resp); status != "12" {
+		t.Fatalf("wrong status %q for unknown method", status)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("unexpected messages for unknown method: %d", len(msgs))
+	}
+}
+
+// TestGRPCTypedCallFilter checks that typed calls are subject to the method
+// filter of the request.
+func TestGRPCTypedCallFilter(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	handler := server.GRPCHandler()
+	ts := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow := func(method string) bool { return method != "test_echo" }
+		handler.ServeHTTP(w, r.WithContext(WithMethodFilter(r.Context(), allow)))
+	}), &http2.Server{}))
+	defer ts.Close()
+	client := newGRPCTestClient(t, ts.URL)
+
+	resp, msgs := client.call(context.Background(), "/geth.Test/Echo", nil)
+	if status := grpcStatus(resp); status != "0" || len(msgs) != 1 {
+		t.Fatalf("wrong status %q, %d messages", status, len(msgs))
+	}
+	fields, _ := parseProtoFields(msgs[0])
+	if fields[1] != nil {
+		t.Fatalf("denied call returned a result: %x", fields[1])
+	}
+	errFields, _ := parseProtoFields(fields[2])
+	if want := (&methodDeniedError{method: "test_echo"}).Error(); string(errFields[2]) != want {
+		t.Fatalf("wrong error %q, want %q", errFields[2], want)
+	}
+}
+
+func TestGRPCSubscription(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(h2c.NewHandler(server.GRPCHandler(), &http2.Server{}))
+	defer ts.Close()
+	client := newGRPCTestClient(t, ts.URL)
+
+	// The subscription streams until cancelled, so read the notifications as
+	// they arrive.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp := client.send(ctx, "/geth.Nftest/SubscribeSomeSubscription", jsonRequest(`[3, 10]`))
+	defer resp.Body.Close()
+
+	var prefix [5]byte
+	for i := 0; i < 3; i++ {
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+			t.Fatalf("missing notification %d: %v", i, err)
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(resp.Body, msg); err != nil {
+			t.Fatal(err)
+		}
+		fields, err := parseProtoFields(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.Itoa(10 + i); string(fields[1]) != want {
+			t.Fatalf("wrong notification %d: %s, want %s", i, fields[1], want)
+		}
+	}
+
+	// Subscriptions failing to start end the stream with an error status
+	resp2, msgs := client.call(context.Background(), "/geth.Nftest/SubscribeSomeSubscription", jsonRequest(`["invalid"]`))
+	if status := grpcStatus(resp2); status != "3" {
+		t.Fatalf("wrong status %q for invalid subscription", status)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("unexpected messages for invalid subscription: %d", len(msgs))
+	}
+}
+
+func TestGRPCServiceDefinition(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	def := server.GRPCServiceDefinition()
+	for _, want := range []string{
+		"service Test {",
+		"  // test_echo(string, int, *rpc.echoArgs) rpc.echoResult\n  rpc Echo(TestEchoRequest) returns (TestEchoResponse);",
+		"message TestEchoRequest {\n  string arg1 = 1;\n  int64 arg2 = 2;\n  optional EchoArgs arg3 = 3;\n}",
+		"message TestEchoResponse {\n  EchoResult result = 1;\n  JSONError error = 2;\n}",
+		"message EchoResult {\n  string string = 1;\n  int64 int = 2;\n  optional EchoArgs args = 3;\n}",
+		"message EchoArgs {\n  string s = 1;\n}",
+		"  rpc CallMeBack(JSONRequest) returns (JSONResponse);",
+		"service Nftest {",
+		"  // nftest_subscribe(\"someSubscription\", int, int)\n  rpc SubscribeSomeSubscription(JSONRequest) returns (stream JSONNotification);",
+	} {
+		if !strings.Contains(def, want) {
+			t.Errorf("service definition misses %q:\n%s", want, def)
+		}
+	}
+	if strings.Count(def, "message EchoArgs {") != 1 {
+		t.Errorf("service definition declares EchoArgs more than once:\n%s", def)
+	}
+}
+
+// grpcTypesTest covers the encodings of the Ethereum types.
+type grpcTypesTest struct {
+	Address common.Address    `json:"address"`
+	Balance *hexutil.Big      `json:"balance"`
+	Nonce   hexutil.Uint64    `json:"nonce"`
+	Block   BlockNumberOrHash `json:"block"`
+	Topics  []common.Hash     `json:"topics"`
+	Data    hexutil.Bytes     `json:"data"`
+	Ratio   float64           `json:"ratio"`
+	Ignored chan int          `json:"-"`
+}
+
+func TestGRPCTypedMessages(t *testing.T) {
+	pt := protoTypeOf(reflect.TypeOf(grpcTypesTest{}))
+	if pt == nil {
+		t.Fatal("no encoding")
+	}
+	block := LatestBlockNumber
+	in := grpcTypesTest{
+		Address: common.HexToAddress("0x01"),
+		Balance: (*hexutil.Big)(big.NewInt(1000)),
+		Nonce:   7,
+		Block:   BlockNumberOrHash{BlockNumber: &block},
+		Topics:  []common.Hash{{1}, {}},
+		Data:    hexutil.Bytes{0xff},
+		Ratio:   0.5,
+	}
+	msg, err := pt.encodeMessage(reflect.ValueOf(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out grpcTypesTest
+	if err := pt.decodeMessage(reflect.ValueOf(&out).Elem(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("wrong decoded value %+v, want %+v", out, in)
+	}
+	// Addresses are their bytes, big integers their big-endian magnitude, and
+	// block numbers the values of the tags.
+	fields, _ := parseProtoFields(msg)
+	if !bytes.Equal(fields[1], in.Address[:]) || !bytes.Equal(fields[2], []byte{0x03, 0xe8}) {
+		t.Fatalf("wrong encoding of address %x or balance %x", fields[1], fields[2])
+	}
+	if want := appendProtoVarint(nil, 1, uint64(1<<64-1)); !bytes.Equal(fields[4], want) {
+		t.Fatalf("wrong encoding of block %x, want %x", fields[4], want)
+	}
+
+	// Packed repeated scalars are accepted as well.
+	packed := appendProtoBytes(nil, 1, []byte{1, 2, 3})
+	var nums struct{ N []uint16 }
+	if err := protoTypeOf(reflect.TypeOf(nums)).decodeMessage(reflect.ValueOf(&nums).Elem(), packed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nums.N, []uint16{1, 2, 3}) {
+		t.Fatalf("wrong packed values %v", nums.N)
+	}
+
+	// Types without encoding make the method fall back to JSON.
+	for _, v := range []interface{}{map[string]int{}, []interface{}{}, struct{ t time.Time }{}, [][]int{}} {
+		if protoTypeOf(reflect.TypeOf(v)) != nil {
+			t.Errorf("unexpected encoding for %T", v)
+		}
+	}
+}
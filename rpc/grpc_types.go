@@ -0,0 +1,559 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The typed messages of the gRPC methods are derived from the Go types of the
+// arguments and results of their callbacks:
+//
+//   - bool, signed and unsigned integers, floats and strings map to bool, int64,
+//     uint64, double and string. Block numbers are int64, with the negative
+//     values of the block tags, e.g. -1 for latest.
+//   - Byte slices and arrays, e.g. common.Address and common.Hash, map to bytes.
+//   - big.Int and hexutil.Big map to bytes, holding the big-endian magnitude of
+//     non-negative integers.
+//   - Structs map to messages with a field per exported field, in the order of
+//     declaration.
+//   - Pointers map to optional fields, slices to repeated fields.
+//
+// Methods using other types, e.g. interfaces or maps, are served with the JSON
+// messages instead.
+
+// protoKind is the kind of the protocol buffers encoding of a Go type.
+type protoKind int
+
+const (
+	protoBool protoKind = iota
+	protoInt
+	protoUint
+	protoDouble
+	protoString
+	protoBytes
+	protoBigInt
+	protoMessage
+	protoOptional // pointers, encoded if non-nil
+	protoRepeated // slices other than bytes
+)
+
+// Wire types of protocol buffers fields.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// protoType is the protocol buffers encoding of a Go type.
+type protoType struct {
+	kind   protoKind
+	typ    reflect.Type
+	elem   *protoType          // element of optional and repeated types
+	fields []protoMessageField // fields of messages, numbered from 1
+}
+
+// protoMessageField is a field of a message, mapping an exported struct field.
+type protoMessageField struct {
+	name  string
+	index int // index of the struct field
+	typ   *protoType
+}
+
+var (
+	bigIntType = reflect.TypeOf(big.Int{})
+	byteType   = reflect.TypeOf(byte(0))
+
+	protoTypes sync.Map // reflect.Type -> *protoType, nil if the type has no encoding
+)
+
+// protoTypeOf returns the protocol buffers encoding of a Go type, or nil if the
+// type has none.
+func protoTypeOf(typ reflect.Type) *protoType {
+	if pt, ok := protoTypes.Load(typ); ok {
+		return pt.(*protoType)
+	}
+	pt := newProtoType(typ, make(map[reflect.Type]bool))
+	protoTypes.Store(typ, pt)
+	return pt
+}
+
+// newProtoType derives the encoding of a Go type. Types whose encoding depends
+// on themselves are not supported, the structs being derived are tracked in the
+// given set.
+func newProtoType(typ reflect.Type, deriving map[reflect.Type]bool) *protoType {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &protoType{kind: protoBool, typ: typ}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &protoType{kind: protoInt, typ: typ}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &protoType{kind: protoUint, typ: typ}
+	case reflect.Float32, reflect.Float64:
+		return &protoType{kind: protoDouble, typ: typ}
+	case reflect.String:
+		return &protoType{kind: protoString, typ: typ}
+
+	case reflect.Array:
+		if typ.Elem() != byteType {
+			return nil
+		}
+		return &protoType{kind: protoBytes, typ: typ}
+
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &protoType{kind: protoBytes, typ: typ}
+		}
+		elem := newProtoType(typ.Elem(), deriving)
+		if elem == nil || elem.repeated() {
+			return nil
+		}
+		return &protoType{kind: protoRepeated, typ: typ, elem: elem}
+
+	case reflect.Ptr:
+		elem := newProtoType(typ.Elem(), deriving)
+		if elem == nil || elem.kind == protoOptional {
+			return nil
+		}
+		return &protoType{kind: protoOptional, typ: typ, elem: elem}
+
+	case reflect.Struct:
+		if typ.ConvertibleTo(bigIntType) {
+			return &protoType{kind: protoBigInt, typ: typ}
+		}
+		if deriving[typ] {
+			return nil
+		}
+		deriving[typ] = true
+		defer delete(deriving, typ)
+
+		pt := &protoType{kind: protoMessage, typ: typ}
+		names := make(map[string]bool)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				return nil // unexported state, e.g. time.Time
+			}
+			name := protoFieldName(field)
+			if name == "" {
+				continue
+			}
+			ft := newProtoType(field.Type, deriving)
+			if ft == nil || names[name] {
+				return nil
+			}
+			names[name] = true
+			pt.fields = append(pt.fields, protoMessageField{name: name, index: i, typ: ft})
+		}
+		return pt
+	}
+	return nil
+}
+
+// repeated reports whether the type is encoded as a repeated field.
+func (pt *protoType) repeated() bool {
+	return pt.kind == protoRepeated || pt.kind == protoOptional && pt.elem.kind == protoRepeated
+}
+
+// wireType returns the wire type of the fields holding values of the type.
+func (pt *protoType) wireType() int {
+	switch pt.kind {
+	case protoBool, protoInt, protoUint:
+		return protoWireVarint
+	case protoDouble:
+		return protoWireFixed64
+	case protoOptional, protoRepeated:
+		return pt.elem.wireType()
+	default:
+		return protoWireBytes
+	}
+}
+
+// protoFieldName returns the name of the message field mapping a struct field,
+// the snake case of its JSON name. Fields omitted from JSON are skipped.
+func protoFieldName(field reflect.StructField) string {
+	name := field.Name
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+		return ""
+	} else if isProtoIdent(tag) {
+		name = tag
+	}
+	var b strings.Builder
+	prev := '_'
+	for _, r := range name {
+		if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// isProtoIdent reports whether the name is a valid protocol buffers identifier.
+func isProtoIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// encode appends the field holding the value to a message. Zero values of
+// singular fields are omitted, unless forced for optional and repeated ones.
+func (pt *protoType) encode(buf []byte, num int, v reflect.Value, force bool) ([]byte, error) {
+	switch pt.kind {
+	case protoOptional:
+		if v.IsNil() {
+			return buf, nil
+		}
+		return pt.elem.encode(buf, num, v.Elem(), true)
+
+	case protoRepeated:
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if buf, err = pt.elem.encode(buf, num, v.Index(i), true); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case protoBool:
+		if v.Bool() {
+			return appendProtoVarint(buf, num, 1), nil
+		} else if force {
+			return appendProtoVarint(buf, num, 0), nil
+		}
+	case protoInt:
+		if n := v.Int(); n != 0 || force {
+			return appendProtoVarint(buf, num, uint64(n)), nil
+		}
+	case protoUint:
+		if n := v.Uint(); n != 0 || force {
+			return appendProtoVarint(buf, num, n), nil
+		}
+	case protoDouble:
+		if f := v.Float(); f != 0 || force {
+			return appendProtoFixed64(buf, num, math.Float64bits(f)), nil
+		}
+	case protoString:
+		if s := v.String(); s != "" || force {
+			return appendProtoBytes(buf, num, []byte(s)), nil
+		}
+	case protoBytes:
+		var data []byte
+		if v.Kind() == reflect.Array {
+			data = make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+		} else {
+			data = v.Bytes()
+		}
+		if len(data) > 0 || force {
+			return appendProtoBytes(buf, num, data), nil
+		}
+	case protoBigInt:
+		n := v.Convert(bigIntType).Interface().(big.Int)
+		if n.Sign() < 0 {
+			return nil, errors.New("negative integers are not supported")
+		}
+		if data := n.Bytes(); len(data) > 0 || force {
+			return appendProtoBytes(buf, num, data), nil
+		}
+	case protoMessage:
+		msg, err := pt.encodeMessage(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoBytes(buf, num, msg), nil
+	}
+	return buf, nil
+}
+
+// encodeMessage encodes a struct into a message.
+func (pt *protoType) encodeMessage(v reflect.Value) ([]byte, error) {
+	var (
+		msg []byte
+		err error
+	)
+	for i, field := range pt.fields {
+		if msg, err = field.typ.encode(msg, i+1, v.Field(field.index), false); err != nil {
+			return nil, fmt.Errorf("%s: %v", field.name, err)
+		}
+	}
+	return msg, nil
+}
+
+// decode decodes a field into the value, which must be settable. Fields of
+// repeated types are appended to the value, packed ones included.
+func (pt *protoType) decode(v reflect.Value, wire int, x uint64, data []byte) error {
+	switch pt.kind {
+	case protoOptional:
+		if v.IsNil() {
+			v.Set(reflect.New(pt.typ.Elem()))
+		}
+		return pt.elem.decode(v.Elem(), wire, x, data)
+
+	case protoRepeated:
+		if wire == protoWireBytes && pt.elem.wireType() != protoWireBytes {
+			return readPackedProtoField(data, pt.elem.wireType(), func(x uint64) error {
+				return pt.decode(v, pt.elem.wireType(), x, nil)
+			})
+		}
+		elem := reflect.New(pt.typ.Elem()).Elem()
+		if err := pt.elem.decode(elem, wire, x, data); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	}
+	if want := pt.wireType(); wire != want {
+		return fmt.Errorf("wire type %d, want %d", wire, want)
+	}
+	switch pt.kind {
+	case protoBool:
+		v.SetBool(x != 0)
+	case protoInt:
+		if v.OverflowInt(int64(x)) {
+			return fmt.Errorf("%d overflows %v", int64(x), v.Type())
+		}
+		v.SetInt(int64(x))
+	case protoUint:
+		if v.OverflowUint(x) {
+			return fmt.Errorf("%d overflows %v", x, v.Type())
+		}
+		v.SetUint(x)
+	case protoDouble:
+		v.SetFloat(math.Float64frombits(x))
+	case protoString:
+		if !utf8.Valid(data) {
+			return errors.New("invalid UTF-8 string")
+		}
+		v.SetString(string(data))
+	case protoBytes:
+		if v.Kind() == reflect.Array {
+			if len(data) != v.Len() {
+				return fmt.Errorf("%d bytes, want %d", len(data), v.Len())
+			}
+			reflect.Copy(v, reflect.ValueOf(data))
+		} else {
+			v.SetBytes(append([]byte{}, data...))
+		}
+	case protoBigInt:
+		v.Set(reflect.ValueOf(new(big.Int).SetBytes(data)).Elem().Convert(v.Type()))
+	case protoMessage:
+		return pt.decodeMessage(v, data)
+	}
+	return nil
+}
+
+// decodeMessage decodes a message into a struct, skipping unknown fields.
+func (pt *protoType) decodeMessage(v reflect.Value, msg []byte) error {
+	return readProtoFields(msg, func(num, wire int, x uint64, data []byte) error {
+		if num < 1 || num > len(pt.fields) {
+			return nil
+		}
+		field := pt.fields[num-1]
+		if err := field.typ.decode(v.Field(field.index), wire, x, data); err != nil {
+			return fmt.Errorf("%s: %v", field.name, err)
+		}
+		return nil
+	})
+}
+
+// grpcMessages are the typed messages of a gRPC method. The request message has
+// a field per argument of the callback, the response message has the result in
+// its first field and the error in its second.
+type grpcMessages struct {
+	args   []*protoType
+	result *protoType // nil if the callback has no result
+}
+
+// grpcMessagesOf returns the typed messages of a callback, or nil if any of its
+// argument and result types has no encoding.
+func grpcMessagesOf(cb *callback) *grpcMessages {
+	m := &grpcMessages{args: make([]*protoType, len(cb.argTypes))}
+	for i, typ := range cb.argTypes {
+		if m.args[i] = protoTypeOf(typ); m.args[i] == nil {
+			return nil
+		}
+	}
+	if typ := cb.fn.Type(); typ.NumOut() > 0 && cb.errPos != 0 {
+		if m.result = protoTypeOf(typ.Out(0)); m.result == nil {
+			return nil
+		}
+	}
+	return m
+}
+
+// decodeRequest decodes the arguments of a call from its request message.
+// Missing arguments are zero, or nil for optional ones.
+func (m *grpcMessages) decodeRequest(msg []byte) ([]reflect.Value, error) {
+	args := make([]reflect.Value, len(m.args))
+	for i, pt := range m.args {
+		args[i] = reflect.New(pt.typ).Elem()
+	}
+	err := readProtoFields(msg, func(num, wire int, x uint64, data []byte) error {
+		if num < 1 || num > len(args) {
+			return nil
+		}
+		if err := m.args[num-1].decode(args[num-1], wire, x, data); err != nil {
+			return fmt.Errorf("arg%d: %v", num, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// encodeResult encodes the result of a call into its response message.
+func (m *grpcMessages) encodeResult(result interface{}) ([]byte, error) {
+	if m.result == nil || result == nil {
+		return nil, nil
+	}
+	return m.result.encode(nil, 1, reflect.ValueOf(result), false)
+}
+
+// protoSchema collects the typed messages of a service definition, naming the
+// messages of the Go structs after their types.
+type protoSchema struct {
+	names   map[reflect.Type]string
+	taken   map[string]bool
+	pending []*protoType // messages named but not yet declared
+	b       strings.Builder
+}
+
+func newProtoSchema(reserved ...string) *protoSchema {
+	s := &protoSchema{names: make(map[reflect.Type]string), taken: make(map[string]bool)}
+	for _, name := range reserved {
+		s.taken[name] = true
+	}
+	return s
+}
+
+// writeMethod declares the request and response messages of a method.
+func (s *protoSchema) writeMethod(method, request, response string, m *grpcMessages) {
+	fmt.Fprintf(&s.b, "\n// %s carries the arguments of %s.\nmessage %s {\n", request, method, request)
+	for i, pt := range m.args {
+		fmt.Fprintf(&s.b, "  %s arg%d = %d;\n", s.fieldType(pt, fmt.Sprintf("%sArg%d", request, i+1)), i+1, i+1)
+	}
+	fmt.Fprintf(&s.b, "}\n\n// %s carries the result of %s, or its error.\nmessage %s {\n", response, method, response)
+	if m.result != nil {
+		fmt.Fprintf(&s.b, "  %s result = 1;\n", s.fieldType(m.result, response+"Result"))
+	}
+	s.b.WriteString("  JSONError error = 2;\n}\n")
+}
+
+// String declares the messages of the structs used by the methods, and returns
+// the declarations of all messages.
+func (s *protoSchema) String() string {
+	for len(s.pending) > 0 {
+		pt := s.pending[0]
+		s.pending = s.pending[1:]
+
+		name := s.names[pt.typ]
+		fmt.Fprintf(&s.b, "\n// %s is %v.\nmessage %s {\n", name, pt.typ, name)
+		for i, field := range pt.fields {
+			hint := name + grpcName(pt.typ.Field(field.index).Name)
+			fmt.Fprintf(&s.b, "  %s %s = %d;\n", s.fieldType(field.typ, hint), field.name, i+1)
+		}
+		s.b.WriteString("}\n")
+	}
+	return s.b.String()
+}
+
+// fieldType returns the type of a field holding values of the given type, with
+// its label. Messages of unnamed structs are named after the given hint.
+func (s *protoSchema) fieldType(pt *protoType, hint string) string {
+	switch {
+	case pt.repeated():
+		if pt.kind == protoOptional {
+			pt = pt.elem
+		}
+		return "repeated " + s.typeName(pt.elem, hint)
+	case pt.kind == protoOptional:
+		return "optional " + s.typeName(pt.elem, hint)
+	default:
+		return s.typeName(pt, hint)
+	}
+}
+
+// typeName returns the name of the type of a field holding values of the given
+// type, dropping the labels of optional types.
+func (s *protoSchema) typeName(pt *protoType, hint string) string {
+	switch pt.kind {
+	case protoBool:
+		return "bool"
+	case protoInt:
+		return "int64"
+	case protoUint:
+		return "uint64"
+	case protoDouble:
+		return "double"
+	case protoString:
+		return "string"
+	case protoBytes, protoBigInt:
+		return "bytes"
+	case protoOptional:
+		return s.typeName(pt.elem, hint)
+	}
+	return s.messageName(pt, hint)
+}
+
+// messageName returns the name of the message of a struct, naming it after its
+// type and scheduling its declaration if it wasn't already.
+func (s *protoSchema) messageName(pt *protoType, hint string) string {
+	if name, ok := s.names[pt.typ]; ok {
+		return name
+	}
+	name := pt.typ.Name()
+	if !isProtoIdent(name) {
+		name = hint
+	}
+	name = grpcName(name)
+	if s.taken[name] {
+		if pkg := path.Base(pt.typ.PkgPath()); isProtoIdent(pkg) {
+			name = grpcName(pkg) + name
+		}
+	}
+	for base, i := name, 2; s.taken[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	s.taken[name] = true
+	s.names[pt.typ] = name
+	s.pending = append(s.pending, pt)
+	return name
+}
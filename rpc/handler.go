@@ -61,6 +61,10 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	allowMethod    MethodFilter // restricts the callable methods if non-nil
+	limiter        *RateLimiter // rate limits of the calls if non-nil
+	client         string       // identity of the client for rate limiting
+	audit          AuditLog     // records the calls served if non-nil
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -84,6 +88,10 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		allowMethod:    methodFilterFromContext(connCtx),
+		limiter:        rateLimiterFromContext(connCtx),
+		client:         clientKey(connCtx),
+		audit:          auditLogFromContext(connCtx),
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -216,6 +224,17 @@ func (h *handler) cancelServerSubscriptions(err error) {
 	}
 }
 
+// removeSubscription removes a failed subscription and closes its error channel.
+func (h *handler) removeSubscription(id ID) {
+	h.subLock.Lock()
+	defer h.subLock.Unlock()
+
+	if s := h.serverSubs[id]; s != nil {
+		close(s.err)
+		delete(h.serverSubs, id)
+	}
+}
+
 // startCallProc runs fn in a new goroutine and starts tracking it in the h.calls wait group.
 func (h *handler) startCallProc(fn func(*callProc)) {
 	h.callWG.Add(1)
@@ -254,9 +273,16 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	sub := h.clientSubs[result.ID]
+	if sub == nil {
+		return
+	}
+	if result.Error != nil {
+		delete(h.clientSubs, result.ID)
+		sub.close(result.Error)
+		return
 	}
+	sub.deliver(result.Result)
 }
 
 // handleResponse processes method call responses.
@@ -296,6 +322,9 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 		return nil
 	case msg.isCall():
 		resp := h.handleCall(ctx, msg)
+		if h.audit != nil {
+			h.audit.Record(newAuditRecord(start, h.client, h.conn.remoteAddr(), msg, resp))
+		}
 		var ctx []interface{}
 		ctx = append(ctx, "reqid", idForLog{msg.ID}, "t", time.Since(start))
 		if resp.Error != nil {
@@ -317,6 +346,14 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	// Unsubscribing is always allowed, it only affects the caller's own subscriptions.
+	if !msg.isUnsubscribe() {
+		release, err := h.admit(cp.ctx, msg.Method)
+		if err != nil {
+			return msg.errorResponse(err)
+		}
+		defer release()
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -339,18 +376,78 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
 	if callb != h.unsubscribeCb {
-		rpcRequestGauge.Inc(1)
-		if answer.Error != nil {
-			failedReqeustGauge.Inc(1)
-		} else {
-			successfulRequestGauge.Inc(1)
-		}
-		rpcServingTimer.UpdateSince(start)
-		newRPCServingTimer(msg.Method, answer.Error == nil).UpdateSince(start)
+		updateCallMetrics(msg.Method, start, answer.Error == nil)
 	}
 	return answer
 }
 
+// handleTypedCall serves a call whose arguments were decoded by the transport,
+// e.g. from the protocol buffers of a gRPC call, returning the result of the
+// method for the transport to encode. The call is admitted, measured and audited
+// like the calls of handleCall.
+func (h *handler) handleTypedCall(method string, callb *callback, args []reflect.Value) (interface{}, error) {
+	start := time.Now()
+	result, err := h.runTypedCall(method, callb, args)
+
+	if h.audit != nil {
+		// The audit log records JSON, encoded only when it is enabled.
+		msg := &jsonrpcMessage{Version: vsn, ID: json.RawMessage("1"), Method: method}
+		params := make([]interface{}, len(args))
+		for i, arg := range args {
+			params[i] = arg.Interface()
+		}
+		msg.Params, _ = json.Marshal(params)
+		resp := msg.response(result)
+		if err != nil {
+			resp = msg.errorResponse(err)
+		}
+		h.audit.Record(newAuditRecord(start, h.client, h.conn.remoteAddr(), msg, resp))
+	}
+	if err != nil {
+		h.log.Warn("Served "+method, "t", time.Since(start), "err", err)
+	} else {
+		h.log.Debug("Served "+method, "t", time.Since(start))
+	}
+	return result, err
+}
+
+func (h *handler) runTypedCall(method string, callb *callback, args []reflect.Value) (interface{}, error) {
+	release, err := h.admit(h.rootCtx, method)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	result, err := callb.call(h.rootCtx, method, args)
+	updateCallMetrics(method, start, err == nil)
+	return result, err
+}
+
+// admit checks that the client may call the method, waiting for its rate limits.
+// The returned function releases the limits once the call is done.
+func (h *handler) admit(ctx context.Context, method string) (func(), error) {
+	if h.allowMethod != nil && !h.allowMethod(method) {
+		return nil, &methodDeniedError{method: method}
+	}
+	if h.limiter != nil {
+		return h.limiter.acquire(ctx, h.client, method, h.reg)
+	}
+	return func() {}, nil
+}
+
+// updateCallMetrics collects the statistics of a method call if metrics are enabled.
+func updateCallMetrics(method string, start time.Time, success bool) {
+	rpcRequestGauge.Inc(1)
+	if success {
+		successfulRequestGauge.Inc(1)
+	} else {
+		failedReqeustGauge.Inc(1)
+	}
+	rpcServingTimer.UpdateSince(start)
+	newRPCServingTimer(method, success).UpdateSince(start)
+}
+
 // handleSubscribe processes *_subscribe method calls.
 func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	if !h.allowSubscribe {
@@ -239,6 +239,16 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// All checks passed, create a codec that reads directly from the request body
 	// until EOF, writes the response to w, and orders the server to process a
 	// single request.
+	ctx := httpRequestContext(r)
+	w.Header().Set("content-type", contentType)
+	codec := newHTTPServerConn(r, w)
+	defer codec.close()
+	s.serveSingleRequest(ctx, codec)
+}
+
+// httpRequestContext returns the context of the calls of an HTTP request,
+// carrying the details of the client.
+func httpRequestContext(r *http.Request) context.Context {
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, "remote", r.RemoteAddr)
 	ctx = context.WithValue(ctx, "scheme", r.Proto)
@@ -249,11 +259,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if origin := r.Header.Get("Origin"); origin != "" {
 		ctx = context.WithValue(ctx, "Origin", origin)
 	}
-
-	w.Header().Set("content-type", contentType)
-	codec := newHTTPServerConn(r, w)
-	defer codec.close()
-	s.serveSingleRequest(ctx, codec)
+	return ctx
 }
 
 // validateRequest returns a non-zero response code and error message if the
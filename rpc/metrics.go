@@ -27,6 +27,10 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+
+	rateLimitWaitTimer        = metrics.NewRegisteredTimer("rpc/limits/wait", nil)
+	rateLimitRejectMeter      = metrics.NewRegisteredMeter("rpc/limits/rejected/all", nil)
+	rateLimitRejectOtherMeter = metrics.NewRegisteredMeter("rpc/limits/rejected/other", nil) // Methods neither configured nor served
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -37,3 +41,7 @@ func newRPCServingTimer(method string, valid bool) metrics.Timer {
 	m := fmt.Sprintf("rpc/duration/%s/%s", method, flag)
 	return metrics.GetOrRegisterTimer(m, nil)
 }
+
+func newRateLimitRejectMeter(method string) metrics.Meter {
+	return metrics.GetOrRegisterMeter(fmt.Sprintf("rpc/limits/rejected/%s", method), nil)
+}
@@ -0,0 +1,360 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxLimitedClients is the number of clients whose limits are tracked. The least
+// recently active idle clients are forgotten, getting fresh limits when returning.
+const maxLimitedClients = 4096
+
+// RateLimit limits the calls of a client or of a method.
+type RateLimit struct {
+	Rate          float64 // Cost units granted per second, unlimited if zero
+	Burst         int     // Maximum cost units available at once
+	MaxConcurrent int     // Maximum number of calls executing at once, unlimited if zero
+}
+
+// RateLimitConfig configures the rate limits of a server. Every call is charged
+// the cost of its method against the limit of the calling client and the limit
+// of the method itself. Clients are identified by the name set with
+// WithClientName, or by their IP address.
+//
+// Calls exceeding a limit wait for at most QueueTimeout. If the limit can't be
+// met in time, or too many calls are waiting already, the call fails with a
+// "limit exceeded" error.
+type RateLimitConfig struct {
+	Client  RateLimit            // Limit of each client
+	Clients map[string]RateLimit // Limits of specific clients, overriding Client
+	Methods map[string]RateLimit // Limits of methods, shared by all clients
+	Costs   map[string]int       // Cost of methods, one unless specified
+
+	MaxQueued    int           // Maximum number of calls waiting for a limit
+	QueueTimeout time.Duration // Maximum time a call waits for a limit
+}
+
+// Validate checks that the limits can be met by calls. It reports limits which
+// would reject every call, such as a rate without burst.
+func (c *RateLimitConfig) Validate() error {
+	if err := c.Client.validate(); err != nil {
+		return fmt.Errorf("client limit: %v", err)
+	}
+	for client, limit := range c.Clients {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("limit of client %q: %v", client, err)
+		}
+	}
+	for method, limit := range c.Methods {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("limit of method %q: %v", method, err)
+		}
+	}
+	for method, cost := range c.Costs {
+		if cost < 0 {
+			return fmt.Errorf("cost of method %q: negative cost %d", method, cost)
+		}
+	}
+	if c.MaxQueued < 0 || c.QueueTimeout < 0 {
+		return errors.New("negative call queue limits")
+	}
+	return nil
+}
+
+// validate checks that the limit can be met by calls.
+func (l RateLimit) validate() error {
+	switch {
+	case l.Rate < 0:
+		return fmt.Errorf("negative rate %v", l.Rate)
+	case l.Rate > 0 && l.Burst <= 0:
+		return fmt.Errorf("rate %v without burst", l.Rate)
+	case l.MaxConcurrent < 0:
+		return fmt.Errorf("negative concurrency %d", l.MaxConcurrent)
+	}
+	return nil
+}
+
+// limiter enforces a single rate limit.
+type limiter struct {
+	bucket *rate.Limiter    // Token bucket of the cost units, nil if unlimited
+	slots  chan struct{}    // Semaphore of the executing calls, nil if unlimited
+	queued int32            // Number of calls waiting for the limit
+	config *RateLimitConfig // Configuration of the call queueing
+}
+
+func newLimiter(limit RateLimit, config *RateLimitConfig) *limiter {
+	l := &limiter{config: config}
+	if limit.Rate > 0 {
+		l.bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+	}
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire admits a call of the given cost, waiting until the given deadline if
+// the limit is exhausted. The returned function must be called when the call is
+// done.
+func (l *limiter) acquire(ctx context.Context, cost int, deadline time.Time) (func(), error) {
+	now := time.Now()
+
+	var res *rate.Reservation
+	if l.bucket != nil {
+		if res = l.bucket.ReserveN(now, cost); !res.OK() {
+			return nil, &limitExceededError{fmt.Sprintf("call cost %d exceeds the limit", cost)}
+		}
+	}
+	// Admit the call right away if the limit isn't exhausted
+	if res == nil || res.DelayFrom(now) == 0 {
+		if l.slots == nil {
+			return func() {}, nil
+		}
+		select {
+		case l.slots <- struct{}{}:
+			return l.release, nil
+		default:
+		}
+	}
+	// Queue the call, unless the queue is full or the wait would be too long
+	if atomic.AddInt32(&l.queued, 1) > int32(l.config.MaxQueued) || (res != nil && now.Add(res.DelayFrom(now)).After(deadline)) {
+		atomic.AddInt32(&l.queued, -1)
+		if res != nil {
+			res.CancelAt(now)
+		}
+		return nil, &limitExceededError{"rate limit exceeded"}
+	}
+	defer atomic.AddInt32(&l.queued, -1)
+
+	if res != nil {
+		if delay := res.DelayFrom(now); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				res.Cancel()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-timeout.C:
+		return nil, &limitExceededError{"concurrent request limit exceeded"}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release frees the slot of an executing call.
+func (l *limiter) release() {
+	<-l.slots
+}
+
+// RateLimiter enforces rate limits on the calls of one or more servers. Servers
+// sharing a limiter share the limits of each client and method, such as those of
+// the transports of a node.
+type RateLimiter struct {
+	config  RateLimitConfig
+	methods map[string]*limiter // Limiters of the limited methods
+
+	mu      sync.Mutex
+	clients map[string]*list.Element // Limiters of the tracked clients
+	recent  *list.List               // Tracked clients, most recently active first
+}
+
+// clientLimiter is the limiter of a tracked client.
+type clientLimiter struct {
+	*limiter
+	key  string
+	refs int       // Number of calls admitted or waiting
+	last time.Time // Time the last call was done
+}
+
+// idle reports whether the client can be forgotten without losing any of its
+// limits: it has no calls executing or waiting, and its bucket is full again.
+func (cl *clientLimiter) idle(now time.Time) bool {
+	if cl.refs > 0 {
+		return false
+	}
+	if b := cl.bucket; b != nil {
+		refill := time.Duration(float64(b.Burst()) / float64(b.Limit()) * float64(time.Second))
+		return now.Sub(cl.last) >= refill
+	}
+	return true
+}
+
+// NewRateLimiter creates a limiter enforcing the given limits, which must have
+// been validated.
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{
+		config:  config,
+		methods: make(map[string]*limiter),
+		clients: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+	for method, limit := range config.Methods {
+		rl.methods[method] = newLimiter(limit, &rl.config)
+	}
+	return rl
+}
+
+// acquire admits a call of the method by the client, waiting for the limits if
+// needed. The returned function must be called when the call is done. Methods
+// served by reg are metered separately when rejected.
+func (rl *RateLimiter) acquire(ctx context.Context, client string, method string, reg *serviceRegistry) (func(), error) {
+	var (
+		start    = time.Now()
+		deadline = start.Add(rl.config.QueueTimeout)
+		cost     = 1
+	)
+	if c, ok := rl.config.Costs[method]; ok {
+		cost = c
+	}
+	cl := rl.client(client)
+	releaseClient, err := cl.acquire(ctx, cost, deadline)
+	if err != nil {
+		rl.done(cl)
+		rl.reject(method, reg)
+		return nil, err
+	}
+	release := func() {
+		releaseClient()
+		rl.done(cl)
+	}
+	if l := rl.methods[method]; l != nil {
+		releaseMethod, err := l.acquire(ctx, cost, deadline)
+		if err != nil {
+			release()
+			rl.reject(method, reg)
+			return nil, err
+		}
+		releaseCall := release
+		release = func() {
+			releaseMethod()
+			releaseCall()
+		}
+	}
+	rateLimitWaitTimer.UpdateSince(start)
+	return release, nil
+}
+
+// client retrieves the limiter of the client, creating it if not yet tracked,
+// and holds it until done is called. If too many clients are tracked, the least
+// recently active idle one is forgotten. Clients which aren't idle are never
+// forgotten, so the limit of tracked clients is exceeded if all of them are busy.
+func (rl *RateLimiter) client(client string) *clientLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if el, ok := rl.clients[client]; ok {
+		rl.recent.MoveToFront(el)
+		cl := el.Value.(*clientLimiter)
+		cl.refs++
+		return cl
+	}
+	if len(rl.clients) >= maxLimitedClients {
+		now := time.Now()
+		for el := rl.recent.Back(); el != nil; el = el.Prev() {
+			if cl := el.Value.(*clientLimiter); cl.idle(now) {
+				rl.recent.Remove(el)
+				delete(rl.clients, cl.key)
+				break
+			}
+		}
+	}
+	limit, ok := rl.config.Clients[client]
+	if !ok {
+		limit = rl.config.Client
+	}
+	cl := &clientLimiter{limiter: newLimiter(limit, &rl.config), key: client, refs: 1}
+	rl.clients[client] = rl.recent.PushFront(cl)
+	return cl
+}
+
+// done releases the hold on a client limiter taken by client.
+func (rl *RateLimiter) done(cl *clientLimiter) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cl.refs--
+	cl.last = time.Now()
+}
+
+// reject records a call rejected by the limits. Rejections are metered per method
+// for the configured and served methods only, as the method names are chosen by
+// the callers.
+func (rl *RateLimiter) reject(method string, reg *serviceRegistry) {
+	rateLimitRejectMeter.Mark(1)
+
+	_, limited := rl.config.Methods[method]
+	_, costed := rl.config.Costs[method]
+	if limited || costed || (reg != nil && reg.callback(method) != nil) {
+		newRateLimitRejectMeter(method).Mark(1)
+	} else {
+		rateLimitRejectOtherMeter.Mark(1)
+	}
+}
+
+type rateLimiterKey struct{}
+
+// withRateLimiter returns a copy of the context carrying the rate limiter of the
+// connections served under it.
+func withRateLimiter(ctx context.Context, rl *RateLimiter) context.Context {
+	if rl == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rateLimiterKey{}, rl)
+}
+
+// rateLimiterFromContext retrieves the rate limiter of the context, if any.
+func rateLimiterFromContext(ctx context.Context) *RateLimiter {
+	rl, _ := ctx.Value(rateLimiterKey{}).(*RateLimiter)
+	return rl
+}
+
+// clientKey identifies the client of a connection for rate limiting, by its name
+// if set, or by its IP address.
+func clientKey(ctx context.Context) string {
+	if name := clientNameFromContext(ctx); name != "" {
+		return name
+	}
+	remote, _ := ctx.Value("remote").(string)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
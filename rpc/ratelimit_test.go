@@ -0,0 +1,198 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+func isLimitExceeded(err error) bool {
+	rpcErr, ok := err.(Error)
+	return ok && rpcErr.ErrorCode() == new(limitExceededError).ErrorCode()
+}
+
+// Tests that calls are charged the cost of their method.
+func TestRateLimitCosts(t *testing.T) {
+	server := newTestServer()
+	server.SetRateLimits(RateLimitConfig{
+		Client: RateLimit{Rate: 0.1, Burst: 3},
+		Costs:  map[string]int{"test_echo": 2},
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatalf("first call failed: %v", err)
+	}
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); !isLimitExceeded(err) {
+		t.Fatalf("wrong error for call exceeding the budget: %v", err)
+	}
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("cheap call failed: %v", err)
+	}
+	// Unsubscribing is never limited
+	if err := client.Call(nil, "nftest_unsubscribe", "0x1"); isLimitExceeded(err) {
+		t.Fatalf("unsubscribe limited: %v", err)
+	}
+}
+
+// Tests that calls exceeding the concurrency limit are queued, and rejected if
+// the queue is full.
+func TestRateLimitConcurrency(t *testing.T) {
+	server := newTestServer()
+	server.SetRateLimits(RateLimitConfig{
+		Methods:      map[string]RateLimit{"test_sleep": {MaxConcurrent: 1}},
+		MaxQueued:    1,
+		QueueTimeout: time.Second,
+	})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errc <- client.Call(nil, "test_sleep", 200*time.Millisecond) }()
+		time.Sleep(50 * time.Millisecond)
+	}
+	// The first call is executing and the second one is queued
+	if err := client.Call(nil, "test_sleep", 0); !isLimitExceeded(err) {
+		t.Fatalf("wrong error for call exceeding the queue: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+	}
+	// Calls of other methods aren't affected
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.CallContext(ctx, nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("unlimited call failed: %v", err)
+	}
+}
+
+// Tests that clients are identified by their name, or by their IP address.
+func TestRateLimitClientKey(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "remote", "10.0.0.1:30303")
+	if key := clientKey(ctx); key != "10.0.0.1" {
+		t.Errorf("key mismatch: have %q, want %q", key, "10.0.0.1")
+	}
+	if key := clientKey(WithClientName(ctx, "internal")); key != "internal" {
+		t.Errorf("key mismatch: have %q, want %q", key, "internal")
+	}
+}
+
+// Tests that servers sharing a limiter share the limits of their clients.
+func TestRateLimitShared(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{Client: RateLimit{Rate: 0.1, Burst: 1}})
+
+	var clients []*Client
+	for i := 0; i < 2; i++ {
+		server := newTestServer()
+		server.SetRateLimiter(limiter)
+		defer server.Stop()
+		client := DialInProc(server)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+	if err := clients[0].Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("first call failed: %v", err)
+	}
+	if err := clients[1].Call(nil, "test_noArgsRets"); !isLimitExceeded(err) {
+		t.Fatalf("call on other server not limited: %v", err)
+	}
+}
+
+// Tests that only idle clients are forgotten when too many are tracked.
+func TestRateLimitEviction(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{Client: RateLimit{MaxConcurrent: 1}})
+
+	busy := limiter.client("busy")
+	release, err := busy.acquire(context.Background(), 1, time.Now())
+	if err != nil {
+		t.Fatalf("failed to acquire slot: %v", err)
+	}
+	for i := 0; i < 2*maxLimitedClients; i++ {
+		limiter.done(limiter.client(fmt.Sprintf("client-%d", i)))
+	}
+	if len(limiter.clients) != maxLimitedClients {
+		t.Errorf("tracked clients mismatch: have %d, want %d", len(limiter.clients), maxLimitedClients)
+	}
+	if el, ok := limiter.clients["busy"]; !ok || el.Value.(*clientLimiter) != busy {
+		t.Fatalf("busy client forgotten")
+	}
+	release()
+	limiter.done(busy)
+
+	// Clients whose bucket is still refilling must be kept too
+	limiter = NewRateLimiter(RateLimitConfig{Client: RateLimit{Rate: 1, Burst: 1}})
+	limiter.done(limiter.client("drained"))
+	for i := 0; i < maxLimitedClients; i++ {
+		limiter.done(limiter.client(fmt.Sprintf("client-%d", i)))
+	}
+	if _, ok := limiter.clients["drained"]; !ok {
+		t.Fatalf("refilling client forgotten")
+	}
+}
+
+// Tests that rejections are only metered per method for served methods.
+func TestRateLimitRejectMeters(t *testing.T) {
+	server := newTestServer()
+	server.SetRateLimits(RateLimitConfig{Client: RateLimit{Rate: 0.1, Burst: 1}})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	for _, method := range []string{"test_noArgsRets", "test_noArgsRets", "test_missing"} {
+		client.Call(nil, method)
+	}
+	if metrics.DefaultRegistry.Get("rpc/limits/rejected/test_noArgsRets") == nil {
+		t.Errorf("rejections of served method not metered")
+	}
+	if metrics.DefaultRegistry.Get("rpc/limits/rejected/test_missing") != nil {
+		t.Errorf("rejections of unknown method metered separately")
+	}
+}
+
+// Tests that limits rejecting every call are reported.
+func TestRateLimitValidate(t *testing.T) {
+	tests := []struct {
+		config RateLimitConfig
+		valid  bool
+	}{
+		{RateLimitConfig{}, true},
+		{RateLimitConfig{Client: RateLimit{Rate: 10, Burst: 10, MaxConcurrent: 2}}, true},
+		{RateLimitConfig{Client: RateLimit{Rate: 10}}, false},
+		{RateLimitConfig{Client: RateLimit{Rate: -1}}, false},
+		{RateLimitConfig{Clients: map[string]RateLimit{"internal": {Rate: 1}}}, false},
+		{RateLimitConfig{Methods: map[string]RateLimit{"eth_call": {MaxConcurrent: -1}}}, false},
+		{RateLimitConfig{Costs: map[string]int{"eth_call": -1}}, false},
+		{RateLimitConfig{QueueTimeout: -time.Second}, false},
+	}
+	for i, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("test %d: validation mismatch: have %v, want valid %v", i, err, tt.valid)
+		}
+	}
+}
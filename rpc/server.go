@@ -46,6 +46,8 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set
+	limiter  *RateLimiter
+	audit    AuditLog
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -66,12 +68,36 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetRateLimits configures the rate limits of the calls served. It must be called
+// before serving any requests.
+func (s *Server) SetRateLimits(config RateLimitConfig) {
+	s.SetRateLimiter(NewRateLimiter(config))
+}
+
+// SetRateLimiter configures the limiter of the calls served, which may be shared
+// with other servers. It must be called before serving any requests.
+func (s *Server) SetRateLimiter(limiter *RateLimiter) {
+	s.limiter = limiter
+}
+
+// connContext returns the context of the connections served, carrying the rate
+// limiter and audit log of the server.
+func (s *Server) connContext(ctx context.Context) context.Context {
+	return withAuditLog(withRateLimiter(ctx, s.limiter), s.audit)
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
 //
 // Note that codec options are no longer supported.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
+	s.serveCodec(context.Background(), codec)
+}
+
+// serveCodec serves the codec like ServeCodec, running the handlers of the
+// connection under the given context.
+func (s *Server) serveCodec(ctx context.Context, codec ServerCodec) {
 	defer codec.close()
 
 	// Don't serve if server is stopped.
@@ -83,7 +109,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(s.connContext(ctx), codec, s.idgen, &s.services)
 	<-codec.closed()
 	c.Close()
 }
@@ -97,7 +123,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 		return
 	}
 
-	h := newHandler(ctx, codec, s.idgen, &s.services)
+	h := newHandler(s.connContext(ctx), codec, s.idgen, &s.services)
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
@@ -97,6 +97,7 @@ type Notifier struct {
 	mu           sync.Mutex
 	sub          *Subscription
 	buffer       []json.RawMessage
+	failure      *jsonError
 	callReturned bool
 	activated    bool
 }
@@ -134,6 +135,9 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	} else if n.sub.ID != id {
 		panic("Notify with wrong ID")
 	}
+	if n.failure != nil {
+		return nil
+	}
 	if n.activated {
 		return n.send(n.sub, enc)
 	}
@@ -141,6 +145,27 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	return nil
 }
 
+// Fail sends the given error to the client and ends the subscription. No more
+// notifications are sent after it, and the subscription's error channel is closed.
+func (n *Notifier) Fail(id ID, err error) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.sub == nil {
+		panic("can't Fail before subscription is created")
+	} else if n.sub.ID != id {
+		panic("Fail with wrong ID")
+	}
+	if n.failure != nil {
+		return nil
+	}
+	n.failure = errorMessage(err).Error
+	if n.activated {
+		return n.sendFailure()
+	}
+	return nil
+}
+
 // Closed returns a channel that is closed when the RPC connection is closed.
 // Deprecated: use subscription error channel
 func (n *Notifier) Closed() <-chan interface{} {
@@ -169,11 +194,26 @@ func (n *Notifier) activate() error {
 		}
 	}
 	n.activated = true
+	if n.failure != nil {
+		return n.sendFailure()
+	}
 	return nil
 }
 
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
-	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
+	return n.write(&subscriptionResult{ID: string(sub.ID), Result: data})
+}
+
+// sendFailure delivers the error ending the subscription to the client and
+// removes the subscription from the connection.
+func (n *Notifier) sendFailure() error {
+	err := n.write(&subscriptionResult{ID: string(n.sub.ID), Error: n.failure})
+	n.h.removeSubscription(n.sub.ID)
+	return err
+}
+
+func (n *Notifier) write(result *subscriptionResult) error {
+	params, _ := json.Marshal(result)
 	ctx := context.Background()
 	return n.h.conn.writeJSON(ctx, &jsonrpcMessage{
 		Version: vsn,
@@ -344,6 +384,10 @@ func (sub *ClientSubscription) forward() (unsubscribeServer bool, err error) {
 				// Exiting because Unsubscribe was called, unsubscribe on server.
 				return true, nil
 			}
+			if _, failed := err.(*jsonError); failed {
+				// The server failed the subscription, deliver the queued values first.
+				return false, sub.flush(buffer, err)
+			}
 			return false, err
 
 		case 1: // <-sub.in
@@ -363,6 +407,23 @@ func (sub *ClientSubscription) forward() (unsubscribeServer bool, err error) {
 	}
 }
 
+// flush sends the queued values on the subscription channel, returning the given
+// error once done, or nil if Unsubscribe is called meanwhile.
+func (sub *ClientSubscription) flush(buffer *list.List, err error) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
+		{Dir: reflect.SelectSend, Chan: sub.channel},
+	}
+	for buffer.Len() > 0 {
+		cases[1].Send = reflect.ValueOf(buffer.Front().Value)
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			return nil
+		}
+		buffer.Remove(buffer.Front())
+	}
+	return err
+}
+
 func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, error) {
 	val := reflect.New(sub.etype)
 	err := json.Unmarshal(result, val.Interface())
@@ -47,6 +47,8 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		14: {`someString`, true, BlockNumber(0)},
 		15: {`""`, true, BlockNumber(0)},
 		16: {``, true, BlockNumber(0)},
+		17: {`"finalized"`, false, FinalizedBlockNumber},
+		18: {`"safe"`, false, SafeBlockNumber},
 	}
 
 	for i, test := range tests {
@@ -122,3 +124,31 @@ func TestBlockNumberOrHash_UnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockNumberOrHash_JSONRoundtrip(t *testing.T) {
+	tests := []BlockNumberOrHash{
+		BlockNumberOrHashWithNumber(0x1234),
+		BlockNumberOrHashWithNumber(LatestBlockNumber),
+		BlockNumberOrHashWithNumber(PendingBlockNumber),
+		BlockNumberOrHashWithNumber(FinalizedBlockNumber),
+		BlockNumberOrHashWithNumber(SafeBlockNumber),
+		BlockNumberOrHashWithHash(common.HexToHash("0x1234"), true),
+	}
+	for i, test := range tests {
+		blob, err := json.Marshal(test)
+		if err != nil {
+			t.Fatalf("test %d: marshal failed: %v", i, err)
+		}
+		var bnh BlockNumberOrHash
+		if err := json.Unmarshal(blob, &bnh); err != nil {
+			t.Fatalf("test %d: unmarshal of %s failed: %v", i, blob, err)
+		}
+		hash, _ := bnh.Hash()
+		wantHash, _ := test.Hash()
+		num, _ := bnh.Number()
+		wantNum, _ := test.Number()
+		if hash != wantHash || num != wantNum || bnh.RequireCanonical != test.RequireCanonical {
+			t.Errorf("test %d: roundtrip mismatch: have %v, want %v", i, bnh, test)
+		}
+	}
+}